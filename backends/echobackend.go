@@ -62,3 +62,10 @@ func (be *echoBackend) Handle(connection net.Conn) {
 		be.connectionsMutex.Unlock()
 	})
 }
+
+// HandlePacket handles given datagram connection by writing every datagram read from it back to the
+// connection itself.
+// HandlePacket takes ownership of given connection.
+func (be *echoBackend) HandlePacket(connection net.Conn) {
+	be.Handle(connection)
+}
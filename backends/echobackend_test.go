@@ -257,3 +257,30 @@ func TestEchoBackend_Handle_ConcurrentConnections(t *testing.T) {
 		t.Errorf("after cleanup, active connections = %d, want 0", backend.activeConnections.Len())
 	}
 }
+
+func TestEchoBackend_HandlePacket_EchoesData(t *testing.T) {
+	backend := newEchoBackend(config.EchoBackendConfig{
+		Name: "test-echo",
+	})
+
+	backendConn, testConn := net.Pipe()
+	defer backendConn.Close()
+	defer testConn.Close()
+
+	backend.HandlePacket(backendConn)
+
+	testData := []byte("hello datagram")
+	go func() {
+		testConn.Write(testData)
+	}()
+
+	readBuffer := make([]byte, len(testData))
+	n, err := io.ReadFull(testConn, readBuffer)
+	if err != nil {
+		t.Fatalf("failed to read echoed data: %v", err)
+	}
+
+	if string(readBuffer[:n]) != string(testData) {
+		t.Errorf("echoed data = %q, want %q", string(readBuffer[:n]), string(testData))
+	}
+}
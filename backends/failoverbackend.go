@@ -0,0 +1,347 @@
+package backends
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const defaultFailbackDelay = 30 * time.Second
+
+// failbackMode defines when a failoverBackend goes back to members that failed.
+type failbackMode int
+
+const (
+	// failbackDelayed skips members that failed for the failback delay, and tries them again afterwards.
+	failbackDelayed failbackMode = iota
+	// failbackImmediate tries all members in order for every connection, so connections go back to the primary
+	// as soon as it works again.
+	failbackImmediate
+	// failbackNever sticks to the member that worked last, and only moves on once it fails.
+	failbackNever
+)
+
+// parseFailbackMode parses given failback mode, which is "delayed", "immediate" or "never". An empty mode
+// defaults to "delayed".
+func parseFailbackMode(mode string) (failbackMode, error) {
+	switch mode {
+	case "", "delayed":
+		return failbackDelayed, nil
+	case "immediate":
+		return failbackImmediate, nil
+	case "never":
+		return failbackNever, nil
+	default:
+		return failbackDelayed, fmt.Errorf("unknown failback mode '%s'", mode)
+	}
+}
+
+// healthReporter is implemented by backends that check the health of their targets.
+type healthReporter interface {
+	isHealthy() bool
+}
+
+// failoverMember is a member of a failoverBackend. Members configured by address are backed by a
+// tcpForwarderBackend owned by the failoverBackend, while members referring to named backends share them.
+type failoverMember struct {
+	label     string
+	backend   Backend
+	owned     bool
+	downUntil time.Time
+}
+
+// isHealthy reports whether the health check of the member found its targets healthy. Members without health
+// check are always healthy.
+func (m *failoverMember) isHealthy() bool {
+	reporter, ok := m.backend.(healthReporter)
+
+	return !ok || reporter.isHealthy()
+}
+
+// isDown reports whether the member is down at given time, because it failed within the failback delay, or its
+// health check found its targets down.
+func (m *failoverMember) isDown(now time.Time) bool {
+	return !m.isHealthy() || now.Before(m.downUntil)
+}
+
+type failoverBackend struct {
+	name          string
+	members       []*failoverMember
+	failback      failbackMode
+	failbackDelay time.Duration
+	activeMember  int
+	membersMutex  sync.Mutex
+	now           func() time.Time
+}
+
+// newFailoverBackend creates a new instance of failoverBackend, preparing it with all necessary dependencies.
+// Members refer either to a target address or to a backend of given backendList. The failback delay defaults
+// to 30 seconds if not set.
+func newFailoverBackend(conf config.FailoverBackendConfig, backendList *BackendList) (*failoverBackend, error) {
+	failback, err := parseFailbackMode(conf.Failback)
+	if err != nil {
+		return nil, err
+	}
+
+	failbackDelay := conf.FailbackDelay
+	if failbackDelay <= 0 {
+		failbackDelay = defaultFailbackDelay
+	}
+
+	if len(conf.Members) == 0 {
+		return nil, errors.New("no members configured")
+	}
+
+	members := make([]*failoverMember, 0, len(conf.Members))
+
+	for _, memberConf := range conf.Members {
+		member, memberErr := newFailoverMember(conf, memberConf, backendList)
+		if memberErr != nil {
+			return nil, memberErr
+		}
+
+		members = append(members, member)
+	}
+
+	return &failoverBackend{
+		name:          conf.Name,
+		members:       members,
+		failback:      failback,
+		failbackDelay: failbackDelay,
+		activeMember:  0,
+		membersMutex:  sync.Mutex{},
+		now:           time.Now,
+	}, nil
+}
+
+// newFailoverMember creates the member of given config for the failoverBackend of given config.
+func newFailoverMember(
+	conf config.FailoverBackendConfig,
+	memberConf config.FailoverMemberConfig,
+	backendList *BackendList,
+) (*failoverMember, error) {
+	switch {
+	case memberConf.TargetAddr != "" && memberConf.Backend != "":
+		return nil, fmt.Errorf("member '%s' has both a targetAddr and a backend", memberConf.TargetAddr)
+	case memberConf.TargetAddr != "":
+		// The forwarder is named after both, so its logs, like the ones of health checks, tell the members apart
+		forwarder, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+			Name:                    conf.Name + "/" + memberConf.TargetAddr,
+			TargetAddr:              memberConf.TargetAddr,
+			HealthCheck:             conf.HealthCheck,
+			SendProxyProtocolConfig: config.SendProxyProtocolConfig{},
+			SocketOptionsConfig:     conf.SocketOptionsConfig,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &failoverMember{label: memberConf.TargetAddr, backend: forwarder, owned: true, downUntil: time.Time{}}, nil
+	case memberConf.Backend != "":
+		backend, ok := backendList.get(memberConf.Backend)
+		if !ok {
+			return nil, fmt.Errorf("member backend '%s' does not exist", memberConf.Backend)
+		}
+
+		return &failoverMember{label: memberConf.Backend, backend: backend, owned: false, downUntil: time.Time{}}, nil
+	default:
+		return nil, errors.New("member without targetAddr or backend")
+	}
+}
+
+// GetName returns the name of the current failoverBackend instance.
+func (be *failoverBackend) GetName() string {
+	return be.name
+}
+
+// Close closes all active connections of the members configured by address. Members referring to named backends
+// get closed by the BackendList.
+func (be *failoverBackend) Close() error {
+	var errs []error
+
+	for _, member := range be.members {
+		if member.owned {
+			errs = append(errs, member.backend.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// startHealthChecks starts the health checks of all members, including members referring to named backends, as
+// they get routed to through the failoverBackend.
+func (be *failoverBackend) startHealthChecks() {
+	for _, member := range be.members {
+		if checker, ok := member.backend.(healthChecker); ok {
+			checker.startHealthChecks()
+		}
+	}
+}
+
+// Handle hands given connection to the members in order, until one of them connects to its target. If none does,
+// the connection gets closed.
+// Handle takes ownership of given connection.
+func (be *failoverBackend) Handle(connection net.Conn) {
+	be.handle(connection, false)
+}
+
+// HandlePacket handles given datagram connection like Handle does, skipping members that can't forward datagrams.
+// HandlePacket takes ownership of given connection.
+func (be *failoverBackend) HandlePacket(connection net.Conn) {
+	be.handle(connection, true)
+}
+
+// handle hands given connection to the members in the order given by the failback mode, until one of them
+// connects to its target. Members report failing to connect with a dial failure, which marks them as down, and
+// makes handle move on to the next member. If all members fail, the dial failure gets reported for the
+// connection, and it gets closed.
+func (be *failoverBackend) handle(connection net.Conn, packet bool) {
+	for _, index := range be.memberOrder() {
+		member := be.members[index]
+
+		attempt := &failoverConn{Conn: connection, failed: atomic.Bool{}}
+
+		if packet {
+			packetBackend, ok := member.backend.(PacketBackend)
+			if !ok {
+				continue
+			}
+
+			packetBackend.HandlePacket(attempt)
+		} else {
+			member.backend.Handle(attempt)
+		}
+
+		if !attempt.failed.Load() {
+			be.markUp(index)
+			return
+		}
+
+		be.markDown(index)
+
+		slog.Info(
+			"failover member could not connect, trying next member",
+			slog.String("name", be.name),
+			slog.String("member", member.label),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+		)
+	}
+
+	slog.Info("backend could not connect to any member", slog.String("name", be.name))
+
+	helper.ReportDialFailure(connection)
+
+	if err := connection.Close(); err != nil {
+		slog.Warn("could not properly close incoming connection after all members failed", slog.Any("error", err))
+	}
+}
+
+// memberOrder returns the indexes of the members in the order they should be tried for the next connection.
+func (be *failoverBackend) memberOrder() []int {
+	be.membersMutex.Lock()
+	defer be.membersMutex.Unlock()
+
+	order := make([]int, 0, len(be.members))
+
+	switch be.failback {
+	case failbackImmediate:
+		for i := range be.members {
+			order = append(order, i)
+		}
+	case failbackDelayed:
+		// Members that are down still get tried last, as trying them beats giving up
+		now := be.now()
+		var down []int
+
+		for i, member := range be.members {
+			if member.isDown(now) {
+				down = append(down, i)
+			} else {
+				order = append(order, i)
+			}
+		}
+
+		order = append(order, down...)
+	case failbackNever:
+		for i := range be.members {
+			order = append(order, (be.activeMember+i)%len(be.members))
+		}
+	}
+
+	return be.healthyFirst(order)
+}
+
+// healthyFirst moves the members whose health check found their targets down to the end of given order, as they
+// only fail after the dial timed out. Members that are down still get tried, as trying them beats giving up.
+func (be *failoverBackend) healthyFirst(order []int) []int {
+	healthy := make([]int, 0, len(order))
+	var down []int
+
+	for _, index := range order {
+		if be.members[index].isHealthy() {
+			healthy = append(healthy, index)
+		} else {
+			down = append(down, index)
+		}
+	}
+
+	return append(healthy, down...)
+}
+
+// markUp notes that the member with given index connected successfully.
+func (be *failoverBackend) markUp(index int) {
+	be.membersMutex.Lock()
+	defer be.membersMutex.Unlock()
+
+	if be.members[index].downUntil.IsZero() && be.activeMember == index {
+		return
+	}
+
+	be.members[index].downUntil = time.Time{}
+	be.activeMember = index
+
+	slog.Info("failover backend uses member", slog.String("name", be.name), slog.String("member", be.members[index].label))
+}
+
+// markDown marks the member with given index as down for the failback delay.
+func (be *failoverBackend) markDown(index int) {
+	be.membersMutex.Lock()
+	defer be.membersMutex.Unlock()
+
+	be.members[index].downUntil = be.now().Add(be.failbackDelay)
+}
+
+// failoverConn is a connection handed to a member of a failoverBackend. It catches the dial failure reported
+// by the member, and the close following it, so the connection can be handed to the next member instead.
+type failoverConn struct {
+	net.Conn
+
+	failed atomic.Bool
+}
+
+// ReportDialFailure notes that the member couldn't connect to its target.
+func (c *failoverConn) ReportDialFailure() {
+	c.failed.Store(true)
+}
+
+// Close closes the underlying connection, unless the member failed to connect, in which case the connection
+// is kept open for the next member.
+func (c *failoverConn) Close() error {
+	if c.failed.Load() {
+		return nil
+	}
+
+	return c.Conn.Close()
+}
+
+// NetConn returns the underlying connection.
+func (c *failoverConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,360 @@
+package backends
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+// testFailover is a failoverBackend with mocked members, that fail while their entry in failing is set.
+type testFailover struct {
+	backend *failoverBackend
+	failing []bool
+	now     time.Time
+}
+
+// newTestFailover creates a testFailover with given failback mode and number of members, and a failback delay
+// of a minute.
+func newTestFailover(t *testing.T, failback string, memberCount int) *testFailover {
+	t.Helper()
+
+	names := make([]string, memberCount)
+	conf := config.BackendConfigs{Echo: make([]config.EchoBackendConfig, memberCount)}
+	members := make([]config.FailoverMemberConfig, memberCount)
+
+	for i := range memberCount {
+		names[i] = string(rune('a' + i))
+		conf.Echo[i] = config.EchoBackendConfig{Name: names[i]}
+		members[i] = config.FailoverMemberConfig{Backend: names[i]}
+	}
+
+	backendList, err := NewBackendList(conf)
+	if err != nil {
+		t.Fatalf("NewBackendList() failed: %v", err)
+	}
+
+	backend, err := newFailoverBackend(config.FailoverBackendConfig{
+		Name:          "test-failover",
+		Members:       members,
+		Failback:      failback,
+		FailbackDelay: time.Minute,
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newFailoverBackend() failed: %v", err)
+	}
+
+	tf := &testFailover{backend: backend, failing: make([]bool, memberCount), now: time.Unix(1000, 0)}
+	backend.now = func() time.Time { return tf.now }
+
+	for i, member := range backend.members {
+		member.backend = &mockBackend{
+			name: names[i],
+			mockHandle: func(connection net.Conn) {
+				if tf.failing[i] {
+					helper.ReportDialFailure(connection)
+				} else {
+					connection.Write([]byte(names[i]))
+				}
+
+				connection.Close()
+			},
+		}
+	}
+
+	return tf
+}
+
+// handle hands a new connection to the failoverBackend, and returns the name of the member that took it, or
+// an empty string if none did.
+func (tf *testFailover) handle(t *testing.T) string {
+	t.Helper()
+
+	incomingConn, testConn := net.Pipe()
+	defer testConn.Close()
+
+	go tf.backend.Handle(incomingConn)
+
+	answer, err := io.ReadAll(testConn)
+	if err != nil {
+		t.Fatalf("could not read answer: %v", err)
+	}
+
+	return string(answer)
+}
+
+func TestParseFailbackMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    failbackMode
+		wantErr bool
+	}{
+		{mode: "", want: failbackDelayed},
+		{mode: "delayed", want: failbackDelayed},
+		{mode: "immediate", want: failbackImmediate},
+		{mode: "never", want: failbackNever},
+		{mode: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := parseFailbackMode(tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFailbackMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseFailbackMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailoverBackend_GetName(t *testing.T) {
+	tf := newTestFailover(t, "", 1)
+
+	if got := tf.backend.GetName(); got != "test-failover" {
+		t.Errorf("GetName() = %q, want %q", got, "test-failover")
+	}
+
+	if tf.backend.failback != failbackDelayed {
+		t.Errorf("failback = %v, want %v", tf.backend.failback, failbackDelayed)
+	}
+}
+
+func TestFailoverBackend_NewFailoverBackend_InvalidConfig(t *testing.T) {
+	backendList, err := NewBackendList(config.BackendConfigs{Echo: []config.EchoBackendConfig{{Name: "echo"}}})
+	if err != nil {
+		t.Fatalf("NewBackendList() failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		conf config.FailoverBackendConfig
+	}{
+		{
+			name: "unknown failback mode",
+			conf: config.FailoverBackendConfig{Failback: "sometimes", Members: []config.FailoverMemberConfig{{Backend: "echo"}}},
+		},
+		{
+			name: "no members",
+			conf: config.FailoverBackendConfig{},
+		},
+		{
+			name: "member with targetAddr and backend",
+			conf: config.FailoverBackendConfig{Members: []config.FailoverMemberConfig{{TargetAddr: "127.0.0.1:22", Backend: "echo"}}},
+		},
+		{
+			name: "empty member",
+			conf: config.FailoverBackendConfig{Members: []config.FailoverMemberConfig{{}}},
+		},
+		{
+			name: "unknown member backend",
+			conf: config.FailoverBackendConfig{Members: []config.FailoverMemberConfig{{Backend: "missing"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Name = "test-failover"
+
+			if _, err := newFailoverBackend(tt.conf, backendList); err == nil {
+				t.Error("expected newFailoverBackend() to fail")
+			}
+		})
+	}
+}
+
+func TestFailoverBackend_Handle_TriesMembersInOrder(t *testing.T) {
+	tf := newTestFailover(t, "immediate", 3)
+
+	if got := tf.handle(t); got != "a" {
+		t.Errorf("connection handled by %q, want %q", got, "a")
+	}
+
+	tf.failing[0] = true
+	if got := tf.handle(t); got != "b" {
+		t.Errorf("connection handled by %q, want %q", got, "b")
+	}
+
+	tf.failing[1] = true
+	if got := tf.handle(t); got != "c" {
+		t.Errorf("connection handled by %q, want %q", got, "c")
+	}
+
+	// Immediate failback goes back to the primary right away
+	tf.failing[0] = false
+	if got := tf.handle(t); got != "a" {
+		t.Errorf("connection handled by %q, want %q", got, "a")
+	}
+}
+
+func TestFailoverBackend_Handle_DelayedFailback(t *testing.T) {
+	tf := newTestFailover(t, "delayed", 2)
+
+	tf.failing[0] = true
+	if got := tf.handle(t); got != "b" {
+		t.Errorf("connection handled by %q, want %q", got, "b")
+	}
+
+	// The primary is down for the failback delay, even though it would work again
+	tf.failing[0] = false
+	tf.now = tf.now.Add(30 * time.Second)
+	if got := tf.handle(t); got != "b" {
+		t.Errorf("connection handled by %q during failback delay, want %q", got, "b")
+	}
+
+	// Down members still get tried if all others fail
+	tf.failing[1] = true
+	if got := tf.handle(t); got != "a" {
+		t.Errorf("connection handled by %q with secondary failing, want %q", got, "a")
+	}
+
+	tf.failing[1] = false
+	tf.failing[0] = true
+	tf.handle(t)
+
+	tf.failing[0] = false
+	tf.now = tf.now.Add(time.Minute)
+	if got := tf.handle(t); got != "a" {
+		t.Errorf("connection handled by %q after failback delay, want %q", got, "a")
+	}
+}
+
+func TestFailoverBackend_Handle_NeverFailback(t *testing.T) {
+	tf := newTestFailover(t, "never", 3)
+
+	tf.failing[0] = true
+	if got := tf.handle(t); got != "b" {
+		t.Errorf("connection handled by %q, want %q", got, "b")
+	}
+
+	// The secondary is used until it fails, then the next members are tried, wrapping around
+	tf.failing[0] = false
+	tf.now = tf.now.Add(time.Hour)
+	if got := tf.handle(t); got != "b" {
+		t.Errorf("connection handled by %q, want %q", got, "b")
+	}
+
+	tf.failing[1] = true
+	tf.failing[2] = true
+	if got := tf.handle(t); got != "a" {
+		t.Errorf("connection handled by %q, want %q", got, "a")
+	}
+}
+
+func TestFailoverBackend_Handle_AllMembersFail(t *testing.T) {
+	tf := newTestFailover(t, "", 2)
+	tf.failing[0] = true
+	tf.failing[1] = true
+
+	incomingConn, testConn := net.Pipe()
+	defer testConn.Close()
+
+	reportingConn := &dialFailureConn{Conn: incomingConn}
+	go tf.backend.Handle(reportingConn)
+
+	if _, err := testConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF after all members failed, got: %v", err)
+	}
+
+	if reportingConn.reportedDialFailures != 1 {
+		t.Errorf("reported %d dial failures, want 1", reportingConn.reportedDialFailures)
+	}
+}
+
+func TestFailoverBackend_Handle_TargetAddrMember(t *testing.T) {
+	backendList, err := NewBackendList(config.BackendConfigs{Echo: []config.EchoBackendConfig{{Name: "maintenance"}}})
+	if err != nil {
+		t.Fatalf("NewBackendList() failed: %v", err)
+	}
+
+	backend, err := newFailoverBackend(config.FailoverBackendConfig{
+		Name:    "test-failover",
+		Members: []config.FailoverMemberConfig{{TargetAddr: "192.168.0.2:22"}, {Backend: "maintenance"}},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newFailoverBackend() failed: %v", err)
+	}
+	defer backend.Close()
+
+	forwarder, ok := backend.members[0].backend.(*tcpForwarderBackend)
+	if !ok {
+		t.Fatalf("member of targetAddr is %T, want *tcpForwarderBackend", backend.members[0].backend)
+	}
+
+	// Members configured by address have to be told apart in logs
+	if got := forwarder.GetName(); got != "test-failover/192.168.0.2:22" {
+		t.Errorf("GetName() of member = %q, want %q", got, "test-failover/192.168.0.2:22")
+	}
+
+	forwarder.dialer = &mockDialer{
+		mockDialTimeout: func(_, address string, _ time.Duration) (net.Conn, error) {
+			if address != "192.168.0.2:22" {
+				t.Errorf("dialed %q, want %q", address, "192.168.0.2:22")
+			}
+
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	incomingConn, testConn := net.Pipe()
+	defer testConn.Close()
+
+	backend.Handle(incomingConn)
+
+	// The echo backend took over the connection after the forwarder failed
+	go testConn.Write([]byte("ping"))
+
+	answer := make([]byte, 4)
+	if _, err = io.ReadFull(testConn, answer); err != nil || string(answer) != "ping" {
+		t.Errorf("got answer %q, %v, want %q", answer, err, "ping")
+	}
+}
+
+func TestFailoverBackend_HandlePacket_SkipsMembersWithoutPackets(t *testing.T) {
+	tf := newTestFailover(t, "", 2)
+
+	// Mock backends can't forward datagrams, so only the packet capable echo backend is left
+	tf.backend.members[1].backend = newEchoBackend(config.EchoBackendConfig{Name: "b"})
+	defer tf.backend.members[1].backend.Close()
+
+	incomingConn, testConn := net.Pipe()
+	defer testConn.Close()
+
+	tf.backend.HandlePacket(incomingConn)
+
+	go testConn.Write([]byte("ping"))
+
+	answer := make([]byte, 4)
+	if _, err := io.ReadFull(testConn, answer); err != nil || string(answer) != "ping" {
+		t.Errorf("got answer %q, %v, want %q", answer, err, "ping")
+	}
+}
+
+func TestFailoverBackend_Handle_TriesMembersDownLast(t *testing.T) {
+	for _, failback := range []string{"immediate", "delayed", "never"} {
+		t.Run(failback, func(t *testing.T) {
+			tf := newTestFailover(t, failback, 2)
+
+			forwarder, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{Name: "a", TargetAddr: "127.0.0.1:3000"})
+			if err != nil {
+				t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+			}
+
+			forwarder.health = newDownTargetHealth()
+			defer forwarder.Close()
+
+			tf.backend.members[0].backend = forwarder
+
+			if got := tf.backend.memberOrder(); fmt.Sprint(got) != "[1 0]" {
+				t.Errorf("memberOrder() = %v, want [1 0]", got)
+			}
+		})
+	}
+}
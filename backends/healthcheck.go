@@ -0,0 +1,355 @@
+package backends
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultHealthCheckRise     = 2
+	defaultHealthCheckFall     = 3
+	healthCheckMaxResponse     = 4096
+)
+
+// healthCheckType defines how a healthCheck checks a target.
+type healthCheckType int
+
+const (
+	// healthCheckTCP checks that the target accepts connections.
+	healthCheckTCP healthCheckType = iota
+	// healthCheckSendExpect sends a configured payload, and checks that the answer contains an expected one.
+	healthCheckSendExpect
+	// healthCheckHTTP sends an HTTP GET request, and checks the status of the response.
+	healthCheckHTTP
+	// healthCheckTLS checks that the target completes a TLS handshake.
+	healthCheckTLS
+)
+
+// parseHealthCheckType parses given health check type, which is "tcp", "sendExpect", "http" or "tls". An empty
+// type defaults to "tcp".
+func parseHealthCheckType(checkType string) (healthCheckType, error) {
+	switch checkType {
+	case "", "tcp":
+		return healthCheckTCP, nil
+	case "sendExpect":
+		return healthCheckSendExpect, nil
+	case "http":
+		return healthCheckHTTP, nil
+	case "tls":
+		return healthCheckTLS, nil
+	default:
+		return healthCheckTCP, fmt.Errorf("unknown health check type '%s'", checkType)
+	}
+}
+
+// healthChecker is implemented by backends that check the health of their targets, or of their members.
+type healthChecker interface {
+	startHealthChecks()
+}
+
+// healthCheck checks whether targets are healthy, as configured by a HealthCheckConfig.
+type healthCheck struct {
+	conf      config.HealthCheckConfig
+	checkType healthCheckType
+	dialer    dialer
+}
+
+// newHealthCheck creates a new healthCheck for given config, connecting to targets with given dialer. If conf
+// is nil, nil is returned, which means targets don't get checked. Interval, timeout, rise and fall default to
+// sane values if not set.
+func newHealthCheck(conf *config.HealthCheckConfig, targetDialer dialer) (*healthCheck, error) {
+	if conf == nil {
+		return nil, nil //nolint:nilnil // no config means no health check
+	}
+
+	checkType, err := parseHealthCheckType(conf.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.Interval < 0 || conf.Timeout < 0 || conf.Jitter < 0 || conf.Rise < 0 || conf.Fall < 0 {
+		return nil, errors.New("health check values must not be negative")
+	}
+
+	checkConf := *conf
+	checkConf.Interval = cmp.Or(checkConf.Interval, defaultHealthCheckInterval)
+	checkConf.Timeout = cmp.Or(checkConf.Timeout, min(defaultHealthCheckTimeout, checkConf.Interval))
+	checkConf.Rise = cmp.Or(checkConf.Rise, defaultHealthCheckRise)
+	checkConf.Fall = cmp.Or(checkConf.Fall, defaultHealthCheckFall)
+	checkConf.HTTPPath = cmp.Or(checkConf.HTTPPath, "/")
+
+	if checkType == healthCheckSendExpect && checkConf.Expect == "" {
+		return nil, errors.New("sendExpect health check without expect")
+	}
+
+	if !strings.HasPrefix(checkConf.HTTPPath, "/") {
+		return nil, fmt.Errorf("httpPath '%s' doesn't start with a slash", checkConf.HTTPPath)
+	}
+
+	if checkConf.HTTPExpectStatus != 0 && http.StatusText(checkConf.HTTPExpectStatus) == "" {
+		return nil, fmt.Errorf("unknown httpExpectStatus %d", checkConf.HTTPExpectStatus)
+	}
+
+	return &healthCheck{conf: checkConf, checkType: checkType, dialer: targetDialer}, nil
+}
+
+// watch returns the targetHealth of the target at given address, which checks it every interval once started. If
+// the healthCheck is nil, nil is returned, which reports the target as healthy.
+func (hc *healthCheck) watch(backendName string, targetAddr string) *targetHealth {
+	if hc == nil {
+		return nil
+	}
+
+	health := &targetHealth{
+		backendName: backendName,
+		targetAddr:  targetAddr,
+		check:       hc,
+		healthy:     atomic.Bool{},
+		passed:      0,
+		failed:      0,
+		startOnce:   sync.Once{},
+		stopOnce:    sync.Once{},
+		stopped:     make(chan struct{}),
+	}
+	// Targets start healthy, so connections aren't rejected until the first checks ran
+	health.healthy.Store(true)
+
+	return health
+}
+
+// nextDelay returns the time until the next check, which is the interval plus a random share of the jitter.
+func (hc *healthCheck) nextDelay() time.Duration {
+	if hc.conf.Jitter == 0 {
+		return hc.conf.Interval
+	}
+
+	return hc.conf.Interval + rand.N(hc.conf.Jitter) //nolint:gosec // jitter doesn't need cryptographic randomness
+}
+
+// run checks the target at given address once, returning why it isn't healthy, or nil if it is.
+func (hc *healthCheck) run(targetAddr string) error {
+	connection, err := hc.dialer.DialTimeout("tcp", targetAddr, hc.conf.Timeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := connection.Close(); closeErr != nil {
+			slog.Debug("could not close health check connection", slog.Any("error", closeErr))
+		}
+	}()
+
+	if err = connection.SetDeadline(time.Now().Add(hc.conf.Timeout)); err != nil {
+		return fmt.Errorf("could not set deadline: %w", err)
+	}
+
+	switch hc.checkType {
+	case healthCheckTCP:
+		return nil
+	case healthCheckSendExpect:
+		return hc.sendExpect(connection)
+	case healthCheckHTTP:
+		return hc.httpGet(connection, targetAddr)
+	case healthCheckTLS:
+		return hc.tlsHandshake(connection, targetAddr)
+	default:
+		return fmt.Errorf("unknown health check type %d", hc.checkType)
+	}
+}
+
+// sendExpect sends the configured payload on given connection, and reads until the answer contains the expected
+// payload. Answers longer than healthCheckMaxResponse without the expected payload fail the check.
+func (hc *healthCheck) sendExpect(connection net.Conn) error {
+	if hc.conf.Send != "" {
+		if _, err := io.WriteString(connection, hc.conf.Send); err != nil {
+			return fmt.Errorf("could not send payload: %w", err)
+		}
+	}
+
+	expect := []byte(hc.conf.Expect)
+	answer := make([]byte, 0, healthCheckMaxResponse)
+
+	for len(answer) < cap(answer) {
+		n, err := connection.Read(answer[len(answer):cap(answer)])
+		answer = answer[:len(answer)+n]
+
+		if bytes.Contains(answer, expect) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("answer didn't contain expected payload: %w", err)
+		}
+	}
+
+	return fmt.Errorf("answer didn't contain expected payload within %d bytes", healthCheckMaxResponse)
+}
+
+// httpGet sends a GET request for the configured path on given connection, and checks the status of the response.
+// Without configured status, every 2xx and 3xx status passes.
+func (hc *healthCheck) httpGet(connection net.Conn, targetAddr string) error {
+	host := cmp.Or(hc.conf.HTTPHost, targetAddr)
+	request := "GET " + hc.conf.HTTPPath + " HTTP/1.1\r\nHost: " + host + "\r\nUser-Agent: pluggo\r\nConnection: close\r\n\r\n"
+
+	if _, err := io.WriteString(connection, request); err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(connection), nil)
+	if err != nil {
+		return fmt.Errorf("could not read response: %w", err)
+	}
+
+	if err = response.Body.Close(); err != nil {
+		slog.Debug("could not close health check response body", slog.Any("error", err))
+	}
+
+	if hc.conf.HTTPExpectStatus != 0 {
+		if response.StatusCode != hc.conf.HTTPExpectStatus {
+			return fmt.Errorf("got status %d, want %d", response.StatusCode, hc.conf.HTTPExpectStatus)
+		}
+
+		return nil
+	}
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("got status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// tlsHandshake completes a TLS handshake on given connection. The server name defaults to the host of given
+// target address.
+func (hc *healthCheck) tlsHandshake(connection net.Conn, targetAddr string) error {
+	serverName := hc.conf.TLSServerName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(targetAddr)
+	}
+
+	tlsConnection := tls.Client(connection, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: hc.conf.TLSSkipVerify, //nolint:gosec // the admin may skip verifying self-signed targets
+		MinVersion:         tls.VersionTLS12,
+	})
+
+	if err := tlsConnection.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake failed: %w", err)
+	}
+
+	return nil
+}
+
+// targetHealth is the health of a single target, updated by periodic checks. A target goes down after fall
+// failed checks in a row, and comes back up after rise passed checks in a row.
+type targetHealth struct {
+	backendName string
+	targetAddr  string
+	check       *healthCheck
+	healthy     atomic.Bool
+	passed      int
+	failed      int
+	startOnce   sync.Once
+	stopOnce    sync.Once
+	stopped     chan struct{}
+}
+
+// isHealthy reports whether the target is healthy. A nil targetHealth is always healthy, as the target
+// doesn't get checked.
+func (th *targetHealth) isHealthy() bool {
+	if th == nil {
+		return true
+	}
+
+	return th.healthy.Load()
+}
+
+// start starts checking the target, unless it already got started. Starting a nil targetHealth does nothing.
+func (th *targetHealth) start() {
+	if th == nil {
+		return
+	}
+
+	th.startOnce.Do(func() {
+		go th.run()
+	})
+}
+
+// stop stops checking the target. Stopping a nil targetHealth does nothing.
+func (th *targetHealth) stop() {
+	if th == nil {
+		return
+	}
+
+	th.stopOnce.Do(func() {
+		close(th.stopped)
+	})
+}
+
+// run checks the target right away and every interval afterwards, until the targetHealth gets stopped.
+func (th *targetHealth) run() {
+	for {
+		th.record(th.check.run(th.targetAddr))
+
+		timer := time.NewTimer(th.check.nextDelay())
+
+		select {
+		case <-th.stopped:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// record updates the health of the target with the result of a check, and logs when the target goes down or up.
+func (th *targetHealth) record(checkErr error) {
+	if checkErr == nil {
+		th.failed = 0
+		th.passed++
+
+		if !th.healthy.Load() && th.passed >= th.check.conf.Rise {
+			th.healthy.Store(true)
+			slog.Info("backend target is up", slog.String("name", th.backendName), slog.String("targetAddr", th.targetAddr))
+		}
+
+		return
+	}
+
+	th.passed = 0
+	th.failed++
+
+	slog.Debug(
+		"backend target failed health check",
+		slog.String("name", th.backendName),
+		slog.String("targetAddr", th.targetAddr),
+		slog.Int("failedChecks", th.failed),
+		slog.Any("error", checkErr),
+	)
+
+	if th.healthy.Load() && th.failed >= th.check.conf.Fall {
+		th.healthy.Store(false)
+		slog.Warn(
+			"backend target is down",
+			slog.String("name", th.backendName),
+			slog.String("targetAddr", th.targetAddr),
+			slog.Any("error", checkErr),
+		)
+	}
+}
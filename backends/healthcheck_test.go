@@ -0,0 +1,341 @@
+package backends
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// newTestHealthCheck creates a healthCheck for given config, using a real dialer.
+func newTestHealthCheck(t *testing.T, conf config.HealthCheckConfig) *healthCheck {
+	t.Helper()
+
+	check, err := newHealthCheck(&conf, defaultDialer{socketOptions: nil})
+	if err != nil {
+		t.Fatalf("newHealthCheck() failed: %v", err)
+	}
+
+	return check
+}
+
+// newDownTargetHealth returns a targetHealth that isn't checked, and reports its target as down.
+func newDownTargetHealth() *targetHealth {
+	return &targetHealth{stopped: make(chan struct{})}
+}
+
+// startTestLineServer starts a tcp server answering every line it receives with given answer, and returns its
+// address.
+func startTestLineServer(t *testing.T, answer string) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			connection, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+
+			go func() {
+				defer connection.Close()
+
+				if _, readErr := bufio.NewReader(connection).ReadString('\n'); readErr == nil {
+					connection.Write([]byte(answer))
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// closedTestAddr returns the address of a port nobody listens on.
+func closedTestAddr(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	addr := listener.Addr().String()
+	listener.Close()
+
+	return addr
+}
+
+func TestParseHealthCheckType(t *testing.T) {
+	tests := []struct {
+		checkType string
+		want      healthCheckType
+		wantErr   bool
+	}{
+		{checkType: "", want: healthCheckTCP},
+		{checkType: "tcp", want: healthCheckTCP},
+		{checkType: "sendExpect", want: healthCheckSendExpect},
+		{checkType: "http", want: healthCheckHTTP},
+		{checkType: "tls", want: healthCheckTLS},
+		{checkType: "icmp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.checkType, func(t *testing.T) {
+			got, err := parseHealthCheckType(tt.checkType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHealthCheckType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseHealthCheckType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHealthCheck_Defaults(t *testing.T) {
+	check, err := newHealthCheck(nil, defaultDialer{socketOptions: nil})
+	if err != nil || check != nil {
+		t.Errorf("newHealthCheck(nil) = %v, %v, want nil, nil", check, err)
+	}
+
+	check = newTestHealthCheck(t, config.HealthCheckConfig{Interval: time.Second})
+
+	if check.conf.Timeout != time.Second {
+		t.Errorf("timeout = %v, want it limited to the interval of %v", check.conf.Timeout, time.Second)
+	}
+
+	if check.conf.Rise != defaultHealthCheckRise || check.conf.Fall != defaultHealthCheckFall {
+		t.Errorf("rise/fall = %d/%d, want %d/%d", check.conf.Rise, check.conf.Fall, defaultHealthCheckRise, defaultHealthCheckFall)
+	}
+
+	if check.conf.HTTPPath != "/" {
+		t.Errorf("httpPath = %q, want %q", check.conf.HTTPPath, "/")
+	}
+}
+
+func TestNewHealthCheck_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.HealthCheckConfig
+	}{
+		{name: "unknown type", conf: config.HealthCheckConfig{Type: "icmp"}},
+		{name: "negative interval", conf: config.HealthCheckConfig{Interval: -time.Second}},
+		{name: "negative fall", conf: config.HealthCheckConfig{Fall: -1}},
+		{name: "sendExpect without expect", conf: config.HealthCheckConfig{Type: "sendExpect", Send: "PING\r\n"}},
+		{name: "relative httpPath", conf: config.HealthCheckConfig{Type: "http", HTTPPath: "health"}},
+		{name: "unknown httpExpectStatus", conf: config.HealthCheckConfig{Type: "http", HTTPExpectStatus: 999}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHealthCheck(&tt.conf, defaultDialer{socketOptions: nil}); err == nil {
+				t.Error("expected newHealthCheck() to fail")
+			}
+		})
+	}
+}
+
+func TestHealthCheck_Run(t *testing.T) {
+	lineServerAddr := startTestLineServer(t, "+PONG\r\n")
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusNoContent)
+		case "/broken":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer httpServer.Close()
+
+	httpAddr := strings.TrimPrefix(httpServer.URL, "http://")
+
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+
+	tlsAddr := strings.TrimPrefix(tlsServer.URL, "https://")
+
+	tests := []struct {
+		name    string
+		conf    config.HealthCheckConfig
+		addr    string
+		wantErr bool
+	}{
+		{name: "tcp", conf: config.HealthCheckConfig{}, addr: lineServerAddr},
+		{name: "tcp closed port", conf: config.HealthCheckConfig{}, addr: closedTestAddr(t), wantErr: true},
+		{
+			name: "sendExpect",
+			conf: config.HealthCheckConfig{Type: "sendExpect", Send: "PING\r\n", Expect: "+PONG"},
+			addr: lineServerAddr,
+		},
+		{
+			name:    "sendExpect wrong answer",
+			conf:    config.HealthCheckConfig{Type: "sendExpect", Send: "PING\r\n", Expect: "-ERR"},
+			addr:    lineServerAddr,
+			wantErr: true,
+		},
+		{
+			name: "http",
+			conf: config.HealthCheckConfig{Type: "http", HTTPPath: "/health"},
+			addr: httpAddr,
+		},
+		{
+			name:    "http bad status",
+			conf:    config.HealthCheckConfig{Type: "http", HTTPPath: "/broken"},
+			addr:    httpAddr,
+			wantErr: true,
+		},
+		{
+			name: "http expected status",
+			conf: config.HealthCheckConfig{Type: "http", HTTPPath: "/missing", HTTPExpectStatus: http.StatusNotFound},
+			addr: httpAddr,
+		},
+		{
+			name:    "http no http server",
+			conf:    config.HealthCheckConfig{Type: "http"},
+			addr:    lineServerAddr,
+			wantErr: true,
+		},
+		{
+			name: "tls",
+			conf: config.HealthCheckConfig{Type: "tls", TLSSkipVerify: true},
+			addr: tlsAddr,
+		},
+		{
+			name:    "tls unknown authority",
+			conf:    config.HealthCheckConfig{Type: "tls"},
+			addr:    tlsAddr,
+			wantErr: true,
+		},
+		{
+			name:    "tls no tls server",
+			conf:    config.HealthCheckConfig{Type: "tls", TLSSkipVerify: true},
+			addr:    httpAddr,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Timeout = time.Second
+			check := newTestHealthCheck(t, tt.conf)
+
+			if err := check.run(tt.addr); (err != nil) != tt.wantErr {
+				t.Errorf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTargetHealth_Record_RiseAndFall(t *testing.T) {
+	health := &targetHealth{
+		backendName: "test-backend",
+		targetAddr:  "127.0.0.1:3000",
+		check:       newTestHealthCheck(t, config.HealthCheckConfig{Rise: 2, Fall: 3}),
+		stopped:     make(chan struct{}),
+	}
+	health.healthy.Store(true)
+
+	checkErr := net.ErrClosed
+
+	steps := []struct {
+		err         error
+		wantHealthy bool
+	}{
+		{err: checkErr, wantHealthy: true},
+		{err: checkErr, wantHealthy: true},
+		{err: nil, wantHealthy: true},
+		{err: checkErr, wantHealthy: true},
+		{err: checkErr, wantHealthy: true},
+		{err: checkErr, wantHealthy: false},
+		{err: nil, wantHealthy: false},
+		{err: checkErr, wantHealthy: false},
+		{err: nil, wantHealthy: false},
+		{err: nil, wantHealthy: true},
+	}
+
+	for i, step := range steps {
+		health.record(step.err)
+
+		if got := health.isHealthy(); got != step.wantHealthy {
+			t.Errorf("step %d: isHealthy() = %v, want %v", i, got, step.wantHealthy)
+		}
+	}
+}
+
+func TestHealthCheck_Watch_MarksTargetDown(t *testing.T) {
+	check := newTestHealthCheck(t, config.HealthCheckConfig{
+		Interval: 5 * time.Millisecond,
+		Jitter:   5 * time.Millisecond,
+		Fall:     2,
+	})
+
+	health := check.watch("test-backend", closedTestAddr(t))
+	defer health.stop()
+
+	health.start()
+	health.start()
+
+	deadline := time.Now().Add(time.Second)
+	for health.isHealthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("target didn't get marked down")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	health.stop()
+	health.stop()
+
+	var unchecked *targetHealth
+	if !unchecked.isHealthy() {
+		t.Error("target without health check isn't healthy")
+	}
+}
+
+func TestBackendList_StartHealthChecks_OnlyRoutedBackends(t *testing.T) {
+	healthCheck := &config.HealthCheckConfig{Interval: 5 * time.Millisecond, Fall: 1}
+	targetAddr := closedTestAddr(t)
+
+	backendList, err := NewBackendList(config.BackendConfigs{
+		TCPForwarder: []config.TCPForwarderBackendConfig{
+			{Name: "routed", TargetAddr: targetAddr, HealthCheck: healthCheck},
+			{Name: "unrouted", TargetAddr: targetAddr, HealthCheck: healthCheck},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewBackendList() failed: %v", err)
+	}
+	defer backendList.CloseAll()
+
+	routed, _ := backendList.Get("routed")
+	backendList.StartHealthChecks()
+
+	deadline := time.Now().Add(time.Second)
+	for routed.(*tcpForwarderBackend).isHealthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("routed target didn't get marked down")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	// The unrouted backend had as much time as the routed one, but never got checked
+	if !backendList.list["unrouted"].(*tcpForwarderBackend).isHealthy() {
+		t.Error("unrouted target got checked")
+	}
+}
@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// FrontendNameProvider is implemented by connections that know the name of the frontend that accepted them.
+type FrontendNameProvider interface {
+	FrontendName() string
+}
+
+// ServerNameProvider is implemented by connections that know the TLS server name the client asked for without
+// terminating TLS, like the connections of frontends routing by SNI.
+type ServerNameProvider interface {
+	ServerName() string
+}
+
+// tlsStateProvider is implemented by TLS connections, like tls.Conn.
+type tlsStateProvider interface {
+	ConnectionState() tls.ConnectionState
+}
+
+// FrontendName returns the name of the frontend that accepted given connection, or an empty string if it's
+// unknown. Wrapping connections get unwrapped until a connection implementing FrontendNameProvider is found.
+func FrontendName(connection net.Conn) string {
+	if provider, ok := FindConn[FrontendNameProvider](connection); ok {
+		return provider.FrontendName()
+	}
+
+	return ""
+}
+
+// ServerName returns the TLS server name the client of given connection asked for, or an empty string if it's
+// unknown. The name is taken from a connection implementing ServerNameProvider, or from the handshake of a TLS
+// connection terminated by the frontend.
+func ServerName(connection net.Conn) string {
+	if provider, ok := FindConn[ServerNameProvider](connection); ok {
+		return provider.ServerName()
+	}
+
+	if provider, ok := FindConn[tlsStateProvider](connection); ok {
+		return provider.ConnectionState().ServerName
+	}
+
+	return ""
+}
+
+// ALPN returns the application protocol negotiated with the client of given connection, or an empty string if
+// there is none. Only TLS connections terminated by the frontend know the negotiated protocol.
+func ALPN(connection net.Conn) string {
+	if provider, ok := FindConn[tlsStateProvider](connection); ok {
+		return provider.ConnectionState().NegotiatedProtocol
+	}
+
+	return ""
+}
@@ -0,0 +1,93 @@
+package helper
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+// mockFrontendNameConn is a net.Conn knowing the name of its frontend.
+type mockFrontendNameConn struct {
+	mockConn
+
+	frontendName string
+}
+
+func (m *mockFrontendNameConn) FrontendName() string {
+	return m.frontendName
+}
+
+// mockServerNameConn is a net.Conn knowing the server name its client asked for.
+type mockServerNameConn struct {
+	mockWrappingConn
+
+	serverName string
+}
+
+func (m *mockServerNameConn) ServerName() string {
+	return m.serverName
+}
+
+// mockTLSConn is a net.Conn with a TLS connection state, like tls.Conn.
+type mockTLSConn struct {
+	mockWrappingConn
+
+	state tls.ConnectionState
+}
+
+func (m *mockTLSConn) ConnectionState() tls.ConnectionState {
+	return m.state
+}
+
+func TestFrontendName(t *testing.T) {
+	if got := FrontendName(&mockWrappingConn{Conn: &mockConn{}}); got != "" {
+		t.Errorf("FrontendName() without provider = %q, want empty", got)
+	}
+
+	connection := &mockWrappingConn{Conn: &mockFrontendNameConn{frontendName: "ssh"}}
+	if got := FrontendName(connection); got != "ssh" {
+		t.Errorf("FrontendName() = %q, want %q", got, "ssh")
+	}
+}
+
+func TestServerNameAndALPN(t *testing.T) {
+	tests := []struct {
+		name           string
+		connection     *mockWrappingConn
+		wantServerName string
+		wantALPN       string
+	}{
+		{
+			name:       "plain connection",
+			connection: &mockWrappingConn{Conn: &mockConn{}},
+		},
+		{
+			name: "tls connection",
+			connection: &mockWrappingConn{Conn: &mockTLSConn{
+				mockWrappingConn: mockWrappingConn{Conn: &mockConn{}},
+				state:            tls.ConnectionState{ServerName: "mail.example.com", NegotiatedProtocol: "imap"},
+			}},
+			wantServerName: "mail.example.com",
+			wantALPN:       "imap",
+		},
+		{
+			name: "sni routed connection",
+			connection: &mockWrappingConn{Conn: &mockServerNameConn{
+				mockWrappingConn: mockWrappingConn{Conn: &mockConn{}},
+				serverName:       "git.example.com",
+			}},
+			wantServerName: "git.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ServerName(tt.connection); got != tt.wantServerName {
+				t.Errorf("ServerName() = %q, want %q", got, tt.wantServerName)
+			}
+
+			if got := ALPN(tt.connection); got != tt.wantALPN {
+				t.Errorf("ALPN() = %q, want %q", got, tt.wantALPN)
+			}
+		})
+	}
+}
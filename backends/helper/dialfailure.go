@@ -0,0 +1,17 @@
+package helper
+
+import "net"
+
+// DialFailureReporter is implemented by connections that want to know when a backend couldn't connect to its
+// target for them, like the connections of frontends banning sources that cause too many dial failures.
+type DialFailureReporter interface {
+	ReportDialFailure()
+}
+
+// ReportDialFailure tells given connection that the backend couldn't connect to its target. Wrapping connections
+// get unwrapped until a connection implementing DialFailureReporter is found. If there is none, nothing happens.
+func ReportDialFailure(connection net.Conn) {
+	if reporter, ok := FindConn[DialFailureReporter](connection); ok {
+		reporter.ReportDialFailure()
+	}
+}
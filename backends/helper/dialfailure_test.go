@@ -0,0 +1,48 @@
+package helper
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+// mockDialFailureConn is a net.Conn counting the reported dial failures.
+type mockDialFailureConn struct {
+	mockConn
+
+	reportCallCount uint
+}
+
+func (m *mockDialFailureConn) ReportDialFailure() {
+	m.reportCallCount++
+}
+
+// mockWrappingConn is a net.Conn wrapping another one.
+type mockWrappingConn struct {
+	net.Conn
+}
+
+func (m *mockWrappingConn) NetConn() net.Conn {
+	return m.Conn
+}
+
+func TestReportDialFailure(t *testing.T) {
+	reporter := &mockDialFailureConn{}
+
+	ReportDialFailure(reporter)
+	if reporter.reportCallCount != 1 {
+		t.Errorf("reportCallCount = %d, want 1", reporter.reportCallCount)
+	}
+
+	ReportDialFailure(tls.Server(&mockWrappingConn{Conn: reporter}, &tls.Config{}))
+	if reporter.reportCallCount != 2 {
+		t.Errorf("reportCallCount = %d, want 2 after reporting through wrapping connections", reporter.reportCallCount)
+	}
+}
+
+func TestReportDialFailure_NoReporter(t *testing.T) {
+	// Must neither panic for connections without reporter, nor for wrappers of nothing
+	ReportDialFailure(&mockConn{})
+	ReportDialFailure(&mockWrappingConn{Conn: nil})
+	ReportDialFailure(nil)
+}
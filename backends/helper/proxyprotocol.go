@@ -0,0 +1,16 @@
+package helper
+
+// The values of PROXY protocol v2 headers shared by the frontends reading and the backends writing them. The
+// version and command share the byte following the signature, with the version in the upper four bits.
+const (
+	ProxyProtocolV2Version      = 0x2
+	ProxyProtocolV2CommandLocal = 0x0
+	ProxyProtocolV2CommandProxy = 0x1
+	ProxyProtocolV2FamilyTCP4   = 0x11
+	ProxyProtocolV2FamilyTCP6   = 0x21
+)
+
+// ProxyProtocolV2Signature returns the signature every PROXY protocol v2 header starts with.
+func ProxyProtocolV2Signature() []byte {
+	return []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+}
@@ -0,0 +1,131 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	// maxDSCP is the highest DSCP value, as DSCP uses the upper 6 bits of the TOS field.
+	maxDSCP = 63
+	// tcpFastOpenQueueLength is the number of pending TCP fast open requests a listener accepts.
+	tcpFastOpenQueueLength = 256
+)
+
+// SocketOptions are the options applied to the TCP sockets of listeners and dialers, on top of the Go defaults.
+// Options set to their zero value keep the default of the operating system.
+type SocketOptions struct {
+	conf        config.SocketOptionsConfig
+	transparent bool
+}
+
+// NewSocketOptions creates new SocketOptions from given config, validating it.
+func NewSocketOptions(conf config.SocketOptionsConfig) (*SocketOptions, error) {
+	if conf.KeepAliveIdle < 0 || conf.KeepAliveInterval < 0 || conf.KeepAliveCount < 0 {
+		return nil, errors.New("keep-alive options must not be negative")
+	}
+
+	if conf.UserTimeout < 0 || conf.DeferAccept < 0 {
+		return nil, errors.New("userTimeout and deferAccept must not be negative")
+	}
+
+	if conf.ReceiveBufferSize < 0 || conf.SendBufferSize < 0 {
+		return nil, errors.New("buffer sizes must not be negative")
+	}
+
+	if conf.DSCP < 0 || conf.DSCP > maxDSCP {
+		return nil, fmt.Errorf("dscp %d is out of range 0-%d", conf.DSCP, maxDSCP)
+	}
+
+	return &SocketOptions{conf: conf, transparent: false}, nil
+}
+
+// EnableTransparent makes listening sockets transparent, so they accept connections to any address that got
+// redirected to them by a TPROXY rule.
+func (so *SocketOptions) EnableTransparent() {
+	so.transparent = true
+}
+
+// ListenConfig returns a net.ListenConfig applying the SocketOptions to listening sockets. Most options get
+// inherited by the accepted connections, except for noDelay, which has to be applied using ApplyToConn.
+// ListenConfig is nil-safe, returning a net.ListenConfig with the Go defaults.
+func (so *SocketOptions) ListenConfig() *net.ListenConfig {
+	if so == nil {
+		return &net.ListenConfig{}
+	}
+
+	return &net.ListenConfig{
+		Control:         so.control(true),
+		KeepAliveConfig: so.keepAliveConfig(),
+	}
+}
+
+// Dialer returns a net.Dialer with given timeout, applying the SocketOptions to dialed sockets. noDelay has to be
+// applied to the dialed connection using ApplyToConn.
+// Dialer is nil-safe, returning a net.Dialer with the Go defaults.
+func (so *SocketOptions) Dialer(timeout time.Duration) *net.Dialer {
+	if so == nil {
+		return &net.Dialer{Timeout: timeout}
+	}
+
+	return &net.Dialer{
+		Timeout:         timeout,
+		Control:         so.control(false),
+		KeepAliveConfig: so.keepAliveConfig(),
+	}
+}
+
+// ApplyToConn applies the options, that can't be set before a connection is established, to given connection.
+// Connections that aren't TCP connections are left alone.
+// ApplyToConn is nil-safe.
+func (so *SocketOptions) ApplyToConn(connection net.Conn) {
+	if so == nil || so.conf.NoDelay == nil {
+		return
+	}
+
+	tcpConnection, ok := connection.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	if err := tcpConnection.SetNoDelay(*so.conf.NoDelay); err != nil {
+		slog.Debug("could not set noDelay on connection", slog.Any("error", err))
+	}
+}
+
+// keepAliveConfig returns the keep-alive config for sockets. Values left at 0 use the Go defaults.
+func (so *SocketOptions) keepAliveConfig() net.KeepAliveConfig {
+	return net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     so.conf.KeepAliveIdle,
+		Interval: so.conf.KeepAliveInterval,
+		Count:    so.conf.KeepAliveCount,
+	}
+}
+
+// control returns the function setting the socket options on a new socket, before it gets bound or connected.
+// Options only making sense for listening sockets are only applied if listening is true.
+func (so *SocketOptions) control(listening bool) func(network, address string, rawConn syscall.RawConn) error {
+	return func(network, address string, rawConn syscall.RawConn) error {
+		var setErr error
+
+		err := rawConn.Control(func(fd uintptr) {
+			setErr = so.setSocketOptions(int(fd), network, listening) //nolint:gosec // file descriptors fit into int
+		})
+		if err != nil {
+			return fmt.Errorf("could not access socket for '%s': %w", address, err)
+		}
+
+		if setErr != nil {
+			return fmt.Errorf("could not set socket options for '%s': %w", address, setErr)
+		}
+
+		return nil
+	}
+}
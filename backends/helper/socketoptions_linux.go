@@ -0,0 +1,91 @@
+//go:build linux
+
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// Socket options missing in the syscall package.
+const (
+	soReusePort        = 0xf
+	tcpUserTimeout     = 0x12
+	tcpFastOpen        = 0x17
+	tcpFastOpenConnect = 0x1e
+	ipv6Transparent    = 0x4b
+)
+
+// setSocketOptions sets all configured options on the socket with given file descriptor. TCP options are only
+// set on TCP sockets, and listener options only on listening sockets.
+func (so *SocketOptions) setSocketOptions(fd int, network string, listening bool) error {
+	isTCP := strings.HasPrefix(network, "tcp")
+	isIPv6 := strings.HasSuffix(network, "6")
+
+	var errs []error
+
+	setInt := func(name string, level, option, value int) {
+		if err := syscall.SetsockoptInt(fd, level, option, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	if so.conf.ReusePort && listening {
+		setInt("reusePort", syscall.SOL_SOCKET, soReusePort, 1)
+	}
+
+	if so.transparent && listening {
+		if isIPv6 {
+			setInt("transparent", syscall.IPPROTO_IPV6, ipv6Transparent, 1)
+		} else {
+			setInt("transparent", syscall.IPPROTO_IP, syscall.IP_TRANSPARENT, 1)
+		}
+	}
+
+	if so.conf.FreeBind {
+		setInt("freeBind", syscall.IPPROTO_IP, syscall.IP_FREEBIND, 1)
+	}
+
+	if so.conf.ReceiveBufferSize > 0 {
+		setInt("receiveBufferSize", syscall.SOL_SOCKET, syscall.SO_RCVBUF, so.conf.ReceiveBufferSize)
+	}
+
+	if so.conf.SendBufferSize > 0 {
+		setInt("sendBufferSize", syscall.SOL_SOCKET, syscall.SO_SNDBUF, so.conf.SendBufferSize)
+	}
+
+	if so.conf.DSCP > 0 {
+		// The DSCP is stored in the upper 6 bits of the TOS field, the lower 2 bits are used by ECN
+		tos := so.conf.DSCP << 2
+
+		if isIPv6 {
+			setInt("dscp", syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+		} else {
+			setInt("dscp", syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+		}
+	}
+
+	if !isTCP {
+		return errors.Join(errs...)
+	}
+
+	if so.conf.UserTimeout > 0 {
+		setInt("userTimeout", syscall.IPPROTO_TCP, tcpUserTimeout, int(so.conf.UserTimeout.Milliseconds()))
+	}
+
+	if so.conf.FastOpen {
+		if listening {
+			setInt("fastOpen", syscall.IPPROTO_TCP, tcpFastOpen, tcpFastOpenQueueLength)
+		} else {
+			setInt("fastOpen", syscall.IPPROTO_TCP, tcpFastOpenConnect, 1)
+		}
+	}
+
+	if so.conf.DeferAccept > 0 && listening {
+		setInt("deferAccept", syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT, int(so.conf.DeferAccept.Seconds()))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,152 @@
+//go:build linux
+
+package helper
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// getTestSocketOption returns the value of given socket option of given connection or listener.
+func getTestSocketOption(t *testing.T, conn syscall.Conn, level, option int) int {
+	t.Helper()
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("could not access socket: %v", err)
+	}
+
+	var value int
+	var getErr error
+
+	err = rawConn.Control(func(fd uintptr) {
+		value, getErr = syscall.GetsockoptInt(int(fd), level, option)
+	})
+	if err != nil || getErr != nil {
+		t.Fatalf("could not get socket option: %v %v", err, getErr)
+	}
+
+	return value
+}
+
+func TestSocketOptions_ListenConfig_SetsOptions(t *testing.T) {
+	socketOptions, err := NewSocketOptions(config.SocketOptionsConfig{
+		ReusePort:   true,
+		FreeBind:    true,
+		UserTimeout: 30 * time.Second,
+		DeferAccept: 5 * time.Second,
+		DSCP:        46,
+	})
+	if err != nil {
+		t.Fatalf("NewSocketOptions() failed: %v", err)
+	}
+
+	listener, err := socketOptions.ListenConfig().Listen(context.Background(), "tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer listener.Close()
+
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		t.Fatalf("listener is %T, want *net.TCPListener", listener)
+	}
+
+	tests := []struct {
+		name   string
+		level  int
+		option int
+		want   int
+	}{
+		{name: "reusePort", level: syscall.SOL_SOCKET, option: soReusePort, want: 1},
+		{name: "freeBind", level: syscall.IPPROTO_IP, option: syscall.IP_FREEBIND, want: 1},
+		{name: "userTimeout", level: syscall.IPPROTO_TCP, option: tcpUserTimeout, want: 30000},
+		{name: "dscp", level: syscall.IPPROTO_IP, option: syscall.IP_TOS, want: 46 << 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getTestSocketOption(t, tcpListener, tt.level, tt.option); got != tt.want {
+				t.Errorf("socket option = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// The kernel rounds deferAccept up to its retransmission timeouts, so only check it got set
+	if got := getTestSocketOption(t, tcpListener, syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT); got == 0 {
+		t.Error("deferAccept didn't get set")
+	}
+}
+
+func TestSocketOptions_Dialer_SkipsListenerOptions(t *testing.T) {
+	socketOptions, err := NewSocketOptions(config.SocketOptionsConfig{ReusePort: true, SendBufferSize: 65536})
+	if err != nil {
+		t.Fatalf("NewSocketOptions() failed: %v", err)
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer listener.Close()
+
+	connection, err := socketOptions.Dialer(time.Second).Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer connection.Close()
+
+	tcpConnection, ok := connection.(*net.TCPConn)
+	if !ok {
+		t.Fatalf("connection is %T, want *net.TCPConn", connection)
+	}
+
+	if got := getTestSocketOption(t, tcpConnection, syscall.SOL_SOCKET, soReusePort); got != 0 {
+		t.Errorf("reusePort = %d on dialed socket, want 0", got)
+	}
+
+	// The kernel doubles the buffer size to account for its bookkeeping overhead
+	if got := getTestSocketOption(t, tcpConnection, syscall.SOL_SOCKET, syscall.SO_SNDBUF); got < 65536 {
+		t.Errorf("sendBufferSize = %d, want at least 65536", got)
+	}
+}
+
+func TestSocketOptions_ApplyToConn_SetsNoDelay(t *testing.T) {
+	noDelay := false
+	socketOptions, err := NewSocketOptions(config.SocketOptionsConfig{NoDelay: &noDelay})
+	if err != nil {
+		t.Fatalf("NewSocketOptions() failed: %v", err)
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer listener.Close()
+
+	connection, err := socketOptions.Dialer(time.Second).Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer connection.Close()
+
+	tcpConnection, ok := connection.(*net.TCPConn)
+	if !ok {
+		t.Fatalf("connection is %T, want *net.TCPConn", connection)
+	}
+
+	if got := getTestSocketOption(t, tcpConnection, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); got != 1 {
+		t.Fatalf("TCP_NODELAY = %d before ApplyToConn(), want Go default 1", got)
+	}
+
+	socketOptions.ApplyToConn(connection)
+
+	if got := getTestSocketOption(t, tcpConnection, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); got != 0 {
+		t.Errorf("TCP_NODELAY = %d after ApplyToConn(), want 0", got)
+	}
+}
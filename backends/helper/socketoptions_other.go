@@ -0,0 +1,16 @@
+//go:build !linux
+
+package helper
+
+import "errors"
+
+// setSocketOptions fails if any option is configured, as setting socket options is only supported on linux.
+func (so *SocketOptions) setSocketOptions(_ int, _ string, _ bool) error {
+	conf := so.conf
+	if so.transparent || conf.ReusePort || conf.FreeBind || conf.FastOpen || conf.UserTimeout > 0 || conf.DeferAccept > 0 ||
+		conf.ReceiveBufferSize > 0 || conf.SendBufferSize > 0 || conf.DSCP > 0 {
+		return errors.New("socket options are only supported on linux")
+	}
+
+	return nil
+}
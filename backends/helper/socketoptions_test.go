@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+func TestNewSocketOptions_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.SocketOptionsConfig
+	}{
+		{name: "negative keepAliveIdle", conf: config.SocketOptionsConfig{KeepAliveIdle: -time.Second}},
+		{name: "negative keepAliveCount", conf: config.SocketOptionsConfig{KeepAliveCount: -1}},
+		{name: "negative userTimeout", conf: config.SocketOptionsConfig{UserTimeout: -time.Second}},
+		{name: "negative receiveBufferSize", conf: config.SocketOptionsConfig{ReceiveBufferSize: -1}},
+		{name: "dscp too high", conf: config.SocketOptionsConfig{DSCP: 64}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSocketOptions(tt.conf); err == nil {
+				t.Error("expected NewSocketOptions() to fail")
+			}
+		})
+	}
+}
+
+func TestSocketOptions_ApplyToConn_IgnoresOtherConnections(_ *testing.T) {
+	noDelay := false
+	socketOptions, _ := NewSocketOptions(config.SocketOptionsConfig{NoDelay: &noDelay})
+
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+	defer serverSide.Close()
+
+	// Neither a connection that isn't a TCP connection nor a nil SocketOptions may cause a panic
+	socketOptions.ApplyToConn(serverSide)
+	(*SocketOptions)(nil).ApplyToConn(serverSide)
+}
+
+func TestSocketOptions_NilSafe(t *testing.T) {
+	var socketOptions *SocketOptions
+
+	if listenConfig := socketOptions.ListenConfig(); listenConfig.Control != nil {
+		t.Error("ListenConfig() of nil SocketOptions has a control function")
+	}
+
+	if dialer := socketOptions.Dialer(time.Second); dialer.Control != nil || dialer.Timeout != time.Second {
+		t.Errorf("Dialer() of nil SocketOptions = %+v, want plain dialer with timeout", dialer)
+	}
+}
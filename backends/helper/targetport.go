@@ -0,0 +1,30 @@
+package helper
+
+import (
+	"net"
+	"strconv"
+)
+
+// TargetPortProvider is implemented by connections that want the backend to connect to a specific port of its
+// target host, like the connections of frontends keeping the destination port of port ranges. A port of 0
+// means the connection has no preference.
+type TargetPortProvider interface {
+	TargetPort() int
+}
+
+// TargetAddr returns the address a backend should connect to for given connection. That's given targetAddr,
+// unless the connection or a connection wrapped by it implements TargetPortProvider, in which case the port of
+// targetAddr gets replaced.
+func TargetAddr(connection net.Conn, targetAddr string) string {
+	provider, ok := FindConn[TargetPortProvider](connection)
+	if !ok || provider.TargetPort() == 0 {
+		return targetAddr
+	}
+
+	host, _, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return targetAddr
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(provider.TargetPort()))
+}
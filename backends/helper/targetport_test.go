@@ -0,0 +1,56 @@
+package helper
+
+import "testing"
+
+// mockTargetPortConn is a net.Conn requesting a specific target port.
+type mockTargetPortConn struct {
+	mockConn
+
+	targetPort int
+}
+
+func (m *mockTargetPortConn) TargetPort() int {
+	return m.targetPort
+}
+
+func TestTargetAddr(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection *mockWrappingConn
+		targetAddr string
+		want       string
+	}{
+		{
+			name:       "without provider",
+			connection: &mockWrappingConn{Conn: &mockConn{}},
+			targetAddr: "192.168.1.10:5000",
+			want:       "192.168.1.10:5000",
+		},
+		{
+			name:       "with provider",
+			connection: &mockWrappingConn{Conn: &mockTargetPortConn{targetPort: 5005}},
+			targetAddr: "192.168.1.10:5000",
+			want:       "192.168.1.10:5005",
+		},
+		{
+			name:       "ipv6 target",
+			connection: &mockWrappingConn{Conn: &mockTargetPortConn{targetPort: 5005}},
+			targetAddr: "[fd00::10]:5000",
+			want:       "[fd00::10]:5005",
+		},
+		{
+			name:       "invalid target",
+			connection: &mockWrappingConn{Conn: &mockTargetPortConn{targetPort: 5005}},
+			targetAddr: "invalid",
+			want:       "invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TargetAddr(tt.connection, tt.targetAddr); got != tt.want {
+				t.Errorf("TargetAddr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
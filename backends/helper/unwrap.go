@@ -0,0 +1,29 @@
+package helper
+
+import "net"
+
+// netConnWrapper is implemented by connections wrapping another connection, like tls.Conn.
+type netConnWrapper interface {
+	NetConn() net.Conn
+}
+
+// FindConn returns the first connection implementing T, starting with given connection and unwrapping
+// wrapping connections until one implements T. The second return value is false if none does.
+func FindConn[T any](connection net.Conn) (T, bool) {
+	for connection != nil {
+		if found, ok := connection.(T); ok {
+			return found, true
+		}
+
+		wrapper, ok := connection.(netConnWrapper)
+		if !ok {
+			break
+		}
+
+		connection = wrapper.NetConn()
+	}
+
+	var zero T
+
+	return zero, false
+}
@@ -3,6 +3,8 @@ package backends
 import (
 	"net"
 	"time"
+
+	"github.com/sateffen/pluggo/backends/helper"
 )
 
 // this file provides interfaces and their default implementations to make the other structs testable.
@@ -11,11 +13,19 @@ type dialer interface {
 	DialTimeout(network, address string, timeout time.Duration) (net.Conn, error)
 }
 
-type defaultDialer struct{}
+type defaultDialer struct {
+	socketOptions *helper.SocketOptions
+}
+
+func (d defaultDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	connection, err := d.socketOptions.Dialer(timeout).Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	d.socketOptions.ApplyToConn(connection)
 
-func (defaultDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
-	d := net.Dialer{Timeout: timeout}
-	return d.Dial(network, address)
+	return connection, nil
 }
 
 type sleeper interface {
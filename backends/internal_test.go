@@ -49,3 +49,23 @@ func (m *mockWoLSender) SendWoLPacket() error {
 	}
 	return nil
 }
+
+// mockBackend implements the Backend interface, handing connections to mockHandle.
+type mockBackend struct {
+	name       string
+	mockHandle func(connection net.Conn)
+}
+
+func (m *mockBackend) GetName() string {
+	return m.name
+}
+
+func (m *mockBackend) Handle(connection net.Conn) {
+	if m.mockHandle != nil {
+		m.mockHandle(connection)
+	}
+}
+
+func (m *mockBackend) Close() error {
+	return nil
+}
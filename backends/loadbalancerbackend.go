@@ -0,0 +1,424 @@
+package backends
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net"
+	"sync"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+// loadBalancerStrategy defines how a loadBalancerBackend picks the target for a connection.
+type loadBalancerStrategy int
+
+const (
+	// loadBalancerRoundRobin picks the targets one after another.
+	loadBalancerRoundRobin loadBalancerStrategy = iota
+	// loadBalancerWeightedRoundRobin picks the targets one after another, each as often as its weight says,
+	// spreading the picks of heavy targets evenly.
+	loadBalancerWeightedRoundRobin
+	// loadBalancerLeastConnections picks the target with the fewest active connections relative to its weight.
+	loadBalancerLeastConnections
+	// loadBalancerRandomTwoChoices picks two random targets, and takes the one with fewer active connections
+	// relative to its weight.
+	loadBalancerRandomTwoChoices
+	// loadBalancerSourceHash picks the target by hashing the source IP, so a client always gets the same target
+	// as long as it is available. Adding or removing targets only moves the clients of affected targets.
+	loadBalancerSourceHash
+)
+
+// parseLoadBalancerStrategy parses given strategy name. An empty name defaults to round-robin.
+func parseLoadBalancerStrategy(strategy string) (loadBalancerStrategy, error) {
+	switch strategy {
+	case "", "roundRobin":
+		return loadBalancerRoundRobin, nil
+	case "weightedRoundRobin":
+		return loadBalancerWeightedRoundRobin, nil
+	case "leastConnections":
+		return loadBalancerLeastConnections, nil
+	case "randomTwoChoices":
+		return loadBalancerRandomTwoChoices, nil
+	case "sourceHash":
+		return loadBalancerSourceHash, nil
+	default:
+		return loadBalancerRoundRobin, fmt.Errorf("unknown strategy '%s'", strategy)
+	}
+}
+
+// loadBalancerTarget is a target of a loadBalancerBackend. Its connections count as active from the moment
+// the target got picked, so dials in progress count against its maxConnections as well.
+type loadBalancerTarget struct {
+	addr              string
+	weight            int
+	maxConnections    int
+	pendingDials      int
+	currentWeight     int
+	activeConnections *list.List
+	health            *targetHealth
+}
+
+// active returns the number of active connections of the target, including dials in progress.
+func (t *loadBalancerTarget) active() int {
+	return t.pendingDials + t.activeConnections.Len()
+}
+
+// available reports whether the target can take another connection.
+func (t *loadBalancerTarget) available() bool {
+	return t.maxConnections == 0 || t.active() < t.maxConnections
+}
+
+// lessLoaded reports whether target t has fewer active connections than given other target, relative to their
+// weights.
+func (t *loadBalancerTarget) lessLoaded(other *loadBalancerTarget) bool {
+	return t.active()*other.weight < other.active()*t.weight
+}
+
+type loadBalancerBackend struct {
+	name             string
+	strategy         loadBalancerStrategy
+	targets          []*loadBalancerTarget
+	nextTarget       int
+	connectionsMutex sync.Mutex
+	dialer           dialer
+	random           func(n int) int
+}
+
+// newLoadBalancerBackend creates a new instance of loadBalancerBackend, preparing it with all necessary
+// dependencies. Weights default to 1, and a maxConnections of 0 means unlimited. If a health check is configured,
+// all targets start getting checked right away.
+func newLoadBalancerBackend(conf config.LoadBalancerBackendConfig) (*loadBalancerBackend, error) {
+	strategy, err := parseLoadBalancerStrategy(conf.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conf.Targets) == 0 {
+		return nil, errors.New("no targets configured")
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options: %w", err)
+	}
+
+	targetDialer := defaultDialer{socketOptions: socketOptions}
+
+	check, err := newHealthCheck(conf.HealthCheck, targetDialer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid health check: %w", err)
+	}
+
+	targets := make([]*loadBalancerTarget, 0, len(conf.Targets))
+
+	for _, targetConf := range conf.Targets {
+		if targetConf.TargetAddr == "" {
+			return nil, errors.New("target without targetAddr")
+		}
+
+		if targetConf.Weight < 0 || targetConf.MaxConnections < 0 {
+			return nil, fmt.Errorf("weight and maxConnections of target '%s' must not be negative", targetConf.TargetAddr)
+		}
+
+		weight := targetConf.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		targets = append(targets, &loadBalancerTarget{
+			addr:              targetConf.TargetAddr,
+			weight:            weight,
+			maxConnections:    targetConf.MaxConnections,
+			pendingDials:      0,
+			currentWeight:     0,
+			activeConnections: list.New(),
+			health:            nil,
+		})
+	}
+
+	// Checks only start once the config is known to be valid, so no checks keep running for discarded targets
+	for _, target := range targets {
+		target.health = check.watch(conf.Name, target.addr)
+	}
+
+	return &loadBalancerBackend{
+		name:             conf.Name,
+		strategy:         strategy,
+		targets:          targets,
+		nextTarget:       0,
+		connectionsMutex: sync.Mutex{},
+		dialer:           targetDialer,
+		random:           rand.IntN, //nolint:gosec // spreading load doesn't need cryptographic randomness
+	}, nil
+}
+
+// GetName returns the name of the current loadBalancerBackend instance.
+func (be *loadBalancerBackend) GetName() string {
+	return be.name
+}
+
+// Close closes all active connections managed by this loadBalancerBackend instance, and stops checking its targets.
+func (be *loadBalancerBackend) Close() error {
+	be.connectionsMutex.Lock()
+	var connections []*helper.PipeHelper
+	for _, target := range be.targets {
+		target.health.stop()
+
+		for e := target.activeConnections.Front(); e != nil; e = e.Next() {
+			if pipeHelper, ok := e.Value.(*helper.PipeHelper); ok {
+				connections = append(connections, pipeHelper)
+			}
+		}
+	}
+	be.connectionsMutex.Unlock()
+
+	for _, conn := range connections {
+		conn.Close()
+	}
+
+	return nil
+}
+
+// Handle handles given connection by picking a target and trying to dial it. If the target is reachable,
+// a pipe will get generated, else the connection gets closed.
+// Handle takes ownership of given connection.
+func (be *loadBalancerBackend) Handle(connection net.Conn) {
+	be.handle(connection, "tcp")
+}
+
+// HandlePacket handles given datagram connection like Handle does, but forwards the datagrams to the picked
+// target via udp.
+// HandlePacket takes ownership of given connection.
+func (be *loadBalancerBackend) HandlePacket(connection net.Conn) {
+	be.handle(connection, "udp")
+}
+
+// handle picks a target for given connection, dials it using given network and pipes given connection to it.
+// If all targets reached their maxConnections, the connection gets closed. If the connection asks for a specific
+// target port, that port is used instead of the configured one.
+func (be *loadBalancerBackend) handle(connection net.Conn, network string) {
+	target, ok := be.pick(connection)
+	if !ok {
+		slog.Info(
+			"backend has no target with free connections",
+			slog.String("name", be.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+		)
+
+		if err := connection.Close(); err != nil {
+			slog.Warn("could not properly close incoming connection without target", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	targetAddr := helper.TargetAddr(connection, target.addr)
+
+	connectionToTarget, err := be.dialer.DialTimeout(network, targetAddr, tcpDialTimeout)
+	if err != nil {
+		be.connectionsMutex.Lock()
+		target.pendingDials--
+		be.connectionsMutex.Unlock()
+
+		slog.Info(
+			"backend could not connect to target",
+			slog.String("targetAddr", targetAddr),
+			slog.String("network", network),
+			slog.String("name", be.name),
+			slog.Any("error", err),
+		)
+
+		helper.ReportDialFailure(connection)
+
+		if err = connection.Close(); err != nil {
+			slog.Warn("could not properly close incoming connection after dialer timeout", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	pipeHelper := helper.NewPipeHelper(connection, connectionToTarget)
+
+	be.connectionsMutex.Lock()
+	target.pendingDials--
+	listElement := target.activeConnections.PushBack(pipeHelper)
+	be.connectionsMutex.Unlock()
+
+	//nolint:gosec // if an error happens here, the matrix is broken
+	pipeHelper.OnClose(func() {
+		be.connectionsMutex.Lock()
+		target.activeConnections.Remove(listElement)
+		be.connectionsMutex.Unlock()
+	})
+}
+
+// startHealthChecks starts checking the targets, if a health check is configured.
+func (be *loadBalancerBackend) startHealthChecks() {
+	for _, target := range be.targets {
+		target.health.start()
+	}
+}
+
+// isHealthy reports whether any target is healthy.
+func (be *loadBalancerBackend) isHealthy() bool {
+	for _, target := range be.targets {
+		if target.health.isHealthy() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pick picks the target for given connection using the configured strategy, skipping targets that reached their
+// maxConnections or are down. If all targets with free connections are down, they get picked anyway, as trying
+// them beats giving up. The picked target counts the connection as pending dial, until the caller either adds
+// the connection or removes the pending dial. The second return value is false if all targets are full.
+func (be *loadBalancerBackend) pick(connection net.Conn) (*loadBalancerTarget, bool) {
+	be.connectionsMutex.Lock()
+	defer be.connectionsMutex.Unlock()
+
+	candidates := make([]*loadBalancerTarget, 0, len(be.targets))
+	var downCandidates []*loadBalancerTarget
+
+	for i := range be.targets {
+		// Rotate the candidates for round-robin, the other strategies don't care about the order
+		target := be.targets[(be.nextTarget+i)%len(be.targets)]
+
+		switch {
+		case !target.available():
+		case target.health.isHealthy():
+			candidates = append(candidates, target)
+		default:
+			downCandidates = append(downCandidates, target)
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = downCandidates
+	}
+
+	if len(candidates) == 0 {
+		return nil, false
+	}
+
+	var picked *loadBalancerTarget
+
+	switch be.strategy {
+	case loadBalancerRoundRobin:
+		picked = candidates[0]
+		be.nextTarget = (be.indexOf(picked) + 1) % len(be.targets)
+	case loadBalancerWeightedRoundRobin:
+		picked = pickWeightedRoundRobin(candidates)
+	case loadBalancerLeastConnections:
+		picked = candidates[0]
+		for _, candidate := range candidates[1:] {
+			if candidate.lessLoaded(picked) {
+				picked = candidate
+			}
+		}
+	case loadBalancerRandomTwoChoices:
+		picked = be.pickRandomTwoChoices(candidates)
+	case loadBalancerSourceHash:
+		picked = pickSourceHash(candidates, sourceHost(connection.RemoteAddr()))
+	}
+
+	picked.pendingDials++
+
+	return picked, true
+}
+
+// indexOf returns the index of given target in the targets of the loadBalancerBackend.
+func (be *loadBalancerBackend) indexOf(target *loadBalancerTarget) int {
+	for i, candidate := range be.targets {
+		if candidate == target {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// pickRandomTwoChoices picks two different random candidates, and returns the one with fewer active connections
+// relative to its weight.
+func (be *loadBalancerBackend) pickRandomTwoChoices(candidates []*loadBalancerTarget) *loadBalancerTarget {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	first := be.random(len(candidates))
+
+	second := be.random(len(candidates) - 1)
+	if second >= first {
+		second++
+	}
+
+	if candidates[second].lessLoaded(candidates[first]) {
+		return candidates[second]
+	}
+
+	return candidates[first]
+}
+
+// pickWeightedRoundRobin picks a candidate using smooth weighted round-robin: every pick raises the current weight
+// of each candidate by its weight, and lowers the current weight of the picked one by the sum of all weights. That
+// way each candidate gets picked as often as its weight says, without picking heavy targets in bursts.
+func pickWeightedRoundRobin(candidates []*loadBalancerTarget) *loadBalancerTarget {
+	var picked *loadBalancerTarget
+
+	totalWeight := 0
+
+	for _, candidate := range candidates {
+		candidate.currentWeight += candidate.weight
+		totalWeight += candidate.weight
+
+		if picked == nil || candidate.currentWeight > picked.currentWeight {
+			picked = candidate
+		}
+	}
+
+	picked.currentWeight -= totalWeight
+
+	return picked
+}
+
+// pickSourceHash picks a candidate for given source using weighted rendezvous hashing: every candidate gets
+// a score based on the hash of the source and its address, and the candidate with the highest score wins. If
+// that candidate isn't available, the source consistently falls back to its second best candidate.
+func pickSourceHash(candidates []*loadBalancerTarget, source string) *loadBalancerTarget {
+	var picked *loadBalancerTarget
+
+	bestScore := math.Inf(-1)
+
+	for _, candidate := range candidates {
+		hash := fnv.New64a()
+		hash.Write([]byte(source + "\x00" + candidate.addr))
+
+		// Map the hash to (0, 1), as only 53 bits fit into the mantissa of a float64
+		position := (float64(hash.Sum64()>>11) + 0.5) / (1 << 53) //nolint:mnd // bits of a float64 mantissa
+
+		score := float64(candidate.weight) / -math.Log(position)
+		if score > bestScore {
+			picked = candidate
+			bestScore = score
+		}
+	}
+
+	return picked
+}
+
+// sourceHost returns the host of given remote address, so all connections of a client share the same source.
+func sourceHost(remoteAddr net.Addr) string {
+	host, _, err := net.SplitHostPort(remoteAddr.String())
+	if err != nil {
+		return remoteAddr.String()
+	}
+
+	return host
+}
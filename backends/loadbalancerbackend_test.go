@@ -0,0 +1,382 @@
+package backends
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// newTestLoadBalancerBackend creates a loadBalancerBackend with given strategy and targets, whose dialer
+// reports every dialed address to the returned channel, and connects to a pipe.
+func newTestLoadBalancerBackend(t *testing.T, strategy string, targets []config.LoadBalancerTargetConfig) (*loadBalancerBackend, chan string) {
+	t.Helper()
+
+	backend, err := newLoadBalancerBackend(config.LoadBalancerBackendConfig{
+		Name:     "test-load-balancer",
+		Strategy: strategy,
+		Targets:  targets,
+	})
+	if err != nil {
+		t.Fatalf("newLoadBalancerBackend() failed: %v", err)
+	}
+
+	dialedAddrs := make(chan string, 100)
+	backend.dialer = &mockDialer{
+		mockDialTimeout: func(_, address string, _ time.Duration) (net.Conn, error) {
+			dialedAddrs <- address
+
+			targetConn, targetTestConn := net.Pipe()
+			t.Cleanup(func() { targetTestConn.Close() })
+
+			return targetConn, nil
+		},
+	}
+
+	t.Cleanup(func() { backend.Close() })
+
+	return backend, dialedAddrs
+}
+
+// handleTestConnections hands given number of connections from given source to given backend, and returns
+// the addresses dialed for them.
+func handleTestConnections(t *testing.T, backend *loadBalancerBackend, dialedAddrs chan string, count int, source string) []string {
+	t.Helper()
+
+	addrs := make([]string, 0, count)
+
+	for range count {
+		incomingConn, testConn := net.Pipe()
+		t.Cleanup(func() { testConn.Close() })
+
+		backend.Handle(&remoteAddrConn{Conn: incomingConn, remoteAddr: &net.TCPAddr{IP: net.ParseIP(source), Port: 40000}})
+		addrs = append(addrs, <-dialedAddrs)
+	}
+
+	return addrs
+}
+
+// remoteAddrConn is a net.Conn with a custom remote address.
+type remoteAddrConn struct {
+	net.Conn
+
+	remoteAddr net.Addr
+}
+
+func (c *remoteAddrConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func TestParseLoadBalancerStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     loadBalancerStrategy
+		wantErr  bool
+	}{
+		{strategy: "", want: loadBalancerRoundRobin},
+		{strategy: "roundRobin", want: loadBalancerRoundRobin},
+		{strategy: "weightedRoundRobin", want: loadBalancerWeightedRoundRobin},
+		{strategy: "leastConnections", want: loadBalancerLeastConnections},
+		{strategy: "randomTwoChoices", want: loadBalancerRandomTwoChoices},
+		{strategy: "sourceHash", want: loadBalancerSourceHash},
+		{strategy: "fastest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			got, err := parseLoadBalancerStrategy(tt.strategy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLoadBalancerStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseLoadBalancerStrategy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBalancerBackend_GetName(t *testing.T) {
+	backend, _ := newTestLoadBalancerBackend(t, "", []config.LoadBalancerTargetConfig{{TargetAddr: "127.0.0.1:3000"}})
+
+	if got := backend.GetName(); got != "test-load-balancer" {
+		t.Errorf("GetName() = %q, want %q", got, "test-load-balancer")
+	}
+}
+
+func TestLoadBalancerBackend_NewLoadBalancerBackend_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.LoadBalancerBackendConfig
+	}{
+		{
+			name: "unknown strategy",
+			conf: config.LoadBalancerBackendConfig{Strategy: "fastest", Targets: []config.LoadBalancerTargetConfig{{TargetAddr: "127.0.0.1:3000"}}},
+		},
+		{
+			name: "no targets",
+			conf: config.LoadBalancerBackendConfig{},
+		},
+		{
+			name: "target without address",
+			conf: config.LoadBalancerBackendConfig{Targets: []config.LoadBalancerTargetConfig{{Weight: 2}}},
+		},
+		{
+			name: "negative weight",
+			conf: config.LoadBalancerBackendConfig{Targets: []config.LoadBalancerTargetConfig{{TargetAddr: "127.0.0.1:3000", Weight: -1}}},
+		},
+		{
+			name: "negative maxConnections",
+			conf: config.LoadBalancerBackendConfig{Targets: []config.LoadBalancerTargetConfig{{TargetAddr: "127.0.0.1:3000", MaxConnections: -1}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Name = "test-load-balancer"
+
+			if _, err := newLoadBalancerBackend(tt.conf); err == nil {
+				t.Error("expected newLoadBalancerBackend() to fail")
+			}
+		})
+	}
+}
+
+func TestLoadBalancerBackend_Handle_RoundRobin(t *testing.T) {
+	backend, dialedAddrs := newTestLoadBalancerBackend(t, "roundRobin", []config.LoadBalancerTargetConfig{
+		{TargetAddr: "10.0.0.1:22"},
+		{TargetAddr: "10.0.0.2:22"},
+		{TargetAddr: "10.0.0.3:22"},
+	})
+
+	got := handleTestConnections(t, backend, dialedAddrs, 4, "192.0.2.1")
+	want := []string{"10.0.0.1:22", "10.0.0.2:22", "10.0.0.3:22", "10.0.0.1:22"}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("dialed %v, want %v", got, want)
+	}
+}
+
+func TestLoadBalancerBackend_Handle_WeightedRoundRobin(t *testing.T) {
+	backend, dialedAddrs := newTestLoadBalancerBackend(t, "weightedRoundRobin", []config.LoadBalancerTargetConfig{
+		{TargetAddr: "10.0.0.1:22", Weight: 3},
+		{TargetAddr: "10.0.0.2:22"},
+	})
+
+	// The heavy target doesn't get all of its picks in a row
+	got := handleTestConnections(t, backend, dialedAddrs, 8, "192.0.2.1")
+	want := []string{
+		"10.0.0.1:22", "10.0.0.1:22", "10.0.0.2:22", "10.0.0.1:22",
+		"10.0.0.1:22", "10.0.0.1:22", "10.0.0.2:22", "10.0.0.1:22",
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("dialed %v, want %v", got, want)
+	}
+}
+
+func TestLoadBalancerBackend_Handle_LeastConnections(t *testing.T) {
+	backend, dialedAddrs := newTestLoadBalancerBackend(t, "leastConnections", []config.LoadBalancerTargetConfig{
+		{TargetAddr: "10.0.0.1:22", Weight: 2},
+		{TargetAddr: "10.0.0.2:22"},
+	})
+
+	// The first target takes twice as many connections as the second one
+	got := handleTestConnections(t, backend, dialedAddrs, 6, "192.0.2.1")
+
+	counts := map[string]int{}
+	for _, addr := range got {
+		counts[addr]++
+	}
+
+	if counts["10.0.0.1:22"] != 4 || counts["10.0.0.2:22"] != 2 {
+		t.Errorf("dialed %v, want 4 connections to the first and 2 to the second target", got)
+	}
+}
+
+func TestLoadBalancerBackend_Handle_RandomTwoChoices(t *testing.T) {
+	backend, dialedAddrs := newTestLoadBalancerBackend(t, "randomTwoChoices", []config.LoadBalancerTargetConfig{
+		{TargetAddr: "10.0.0.1:22"},
+		{TargetAddr: "10.0.0.2:22"},
+		{TargetAddr: "10.0.0.3:22"},
+	})
+
+	// Always choose between the first two targets, so the third one never gets picked
+	backend.random = func(int) int { return 0 }
+
+	got := handleTestConnections(t, backend, dialedAddrs, 4, "192.0.2.1")
+	want := []string{"10.0.0.1:22", "10.0.0.2:22", "10.0.0.1:22", "10.0.0.2:22"}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("dialed %v, want %v", got, want)
+	}
+}
+
+func TestLoadBalancerBackend_Handle_SourceHash(t *testing.T) {
+	targets := []config.LoadBalancerTargetConfig{
+		{TargetAddr: "10.0.0.1:22"},
+		{TargetAddr: "10.0.0.2:22"},
+		{TargetAddr: "10.0.0.3:22"},
+	}
+
+	backend, dialedAddrs := newTestLoadBalancerBackend(t, "sourceHash", targets)
+
+	picked := map[string]string{}
+	used := map[string]bool{}
+
+	for i := range 30 {
+		source := fmt.Sprintf("192.0.2.%d", i)
+
+		got := handleTestConnections(t, backend, dialedAddrs, 3, source)
+		if got[0] != got[1] || got[0] != got[2] {
+			t.Errorf("source %s got different targets %v", source, got)
+		}
+
+		picked[source] = got[0]
+		used[got[0]] = true
+	}
+
+	if len(used) != len(targets) {
+		t.Errorf("sources only got spread over targets %v", used)
+	}
+
+	// Removing a target only moves the sources of that target
+	smallerBackend, smallerDialedAddrs := newTestLoadBalancerBackend(t, "sourceHash", targets[:2])
+
+	for source, addr := range picked {
+		got := handleTestConnections(t, smallerBackend, smallerDialedAddrs, 1, source)[0]
+		if addr != targets[2].TargetAddr && got != addr {
+			t.Errorf("source %s moved from %s to %s", source, addr, got)
+		}
+	}
+}
+
+func TestLoadBalancerBackend_Handle_MaxConnections(t *testing.T) {
+	backend, dialedAddrs := newTestLoadBalancerBackend(t, "roundRobin", []config.LoadBalancerTargetConfig{
+		{TargetAddr: "10.0.0.1:22", MaxConnections: 1},
+		{TargetAddr: "10.0.0.2:22", MaxConnections: 2},
+	})
+
+	got := handleTestConnections(t, backend, dialedAddrs, 3, "192.0.2.1")
+	want := []string{"10.0.0.1:22", "10.0.0.2:22", "10.0.0.2:22"}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("dialed %v, want %v", got, want)
+	}
+
+	// All targets are full, so the next connection gets closed without dialing
+	incomingConn, testConn := net.Pipe()
+	defer testConn.Close()
+
+	backend.Handle(incomingConn)
+
+	if _, err := testConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF for connection without target, got: %v", err)
+	}
+
+	select {
+	case addr := <-dialedAddrs:
+		t.Errorf("dialed %s although all targets are full", addr)
+	default:
+	}
+}
+
+func TestLoadBalancerBackend_Handle_DialFailureFreesTarget(t *testing.T) {
+	backend, err := newLoadBalancerBackend(config.LoadBalancerBackendConfig{
+		Name:    "test-load-balancer",
+		Targets: []config.LoadBalancerTargetConfig{{TargetAddr: "10.0.0.1:22", MaxConnections: 1}},
+	})
+	if err != nil {
+		t.Fatalf("newLoadBalancerBackend() failed: %v", err)
+	}
+
+	backend.dialer = &mockDialer{
+		mockDialTimeout: func(_, _ string, _ time.Duration) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	for range 2 {
+		incomingConn, testConn := net.Pipe()
+		defer testConn.Close()
+
+		reportingConn := &dialFailureConn{Conn: incomingConn}
+		backend.Handle(reportingConn)
+
+		if reportingConn.reportedDialFailures != 1 {
+			t.Errorf("reported %d dial failures, want 1", reportingConn.reportedDialFailures)
+		}
+	}
+
+	if active := backend.targets[0].active(); active != 0 {
+		t.Errorf("target has %d active connections after failed dials, want 0", active)
+	}
+}
+
+func TestLoadBalancerBackend_Close_ClosesActiveConnections(t *testing.T) {
+	backend, dialedAddrs := newTestLoadBalancerBackend(t, "roundRobin", []config.LoadBalancerTargetConfig{
+		{TargetAddr: "10.0.0.1:22"},
+		{TargetAddr: "10.0.0.2:22"},
+	})
+
+	testConns := make([]net.Conn, 0, 2)
+
+	for range 2 {
+		incomingConn, testConn := net.Pipe()
+		defer testConn.Close()
+
+		backend.Handle(incomingConn)
+		<-dialedAddrs
+
+		testConns = append(testConns, testConn)
+	}
+
+	if err := backend.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	for i, testConn := range testConns {
+		if _, err := testConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Errorf("connection %d: expected io.EOF after Close(), got: %v", i, err)
+		}
+	}
+
+	for _, target := range backend.targets {
+		if target.activeConnections.Len() != 0 {
+			t.Errorf("target %s has %d active connections after Close(), want 0", target.addr, target.activeConnections.Len())
+		}
+	}
+}
+
+func TestLoadBalancerBackend_Handle_SkipsTargetsDown(t *testing.T) {
+	backend, dialedAddrs := newTestLoadBalancerBackend(t, "roundRobin", []config.LoadBalancerTargetConfig{
+		{TargetAddr: "10.0.0.1:22"},
+		{TargetAddr: "10.0.0.2:22"},
+		{TargetAddr: "10.0.0.3:22"},
+	})
+
+	backend.targets[1].health = newDownTargetHealth()
+
+	got := handleTestConnections(t, backend, dialedAddrs, 3, "192.0.2.1")
+	want := "[10.0.0.1:22 10.0.0.3:22 10.0.0.1:22]"
+
+	if fmt.Sprint(got) != want {
+		t.Errorf("dialed %v, want %v", got, want)
+	}
+
+	// If all targets are down, they still get tried
+	backend.targets[0].health = newDownTargetHealth()
+	backend.targets[2].health = newDownTargetHealth()
+
+	if backend.isHealthy() {
+		t.Error("isHealthy() = true with all targets down")
+	}
+
+	if got = handleTestConnections(t, backend, dialedAddrs, 1, "192.0.2.1"); len(got) != 1 {
+		t.Errorf("dialed %v, want a target although all are down", got)
+	}
+}
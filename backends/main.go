@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"sync"
 
 	"github.com/sateffen/pluggo/config"
 )
@@ -14,14 +15,25 @@ type Backend interface {
 	Close() error
 }
 
+// PacketBackend is implemented by backends that can forward datagram based connections as well,
+// like the sessions created by the udp frontend.
+type PacketBackend interface {
+	Backend
+	HandlePacket(connection net.Conn)
+}
+
 type BackendList struct {
-	list map[string]Backend
+	list        map[string]Backend
+	routedMutex sync.Mutex
+	routed      map[string]bool
 }
 
 // NewBackendList creates a new BackendList, filling it with backend instances based on provided BackendConfigs.
 func NewBackendList(conf config.BackendConfigs) (*BackendList, error) {
 	bl := BackendList{
-		list: make(map[string]Backend),
+		list:        make(map[string]Backend),
+		routedMutex: sync.Mutex{},
+		routed:      make(map[string]bool),
 	}
 
 	for _, echoConf := range conf.Echo {
@@ -29,7 +41,21 @@ func NewBackendList(conf config.BackendConfigs) (*BackendList, error) {
 	}
 
 	for _, tcpForwarderConf := range conf.TCPForwarder {
-		bl.list[tcpForwarderConf.Name] = newTCPForwarderBackend(tcpForwarderConf)
+		tcpForwarderBackend, err := newTCPForwarderBackend(tcpForwarderConf)
+		if err != nil {
+			return nil, fmt.Errorf("could not create backend '%s': %w", tcpForwarderConf.Name, err)
+		}
+
+		bl.list[tcpForwarderConf.Name] = tcpForwarderBackend
+	}
+
+	for _, tlsForwarderConf := range conf.TLSForwarder {
+		tlsForwarderBackend, err := newTLSForwarderBackend(tlsForwarderConf)
+		if err != nil {
+			return nil, fmt.Errorf("could not create backend '%s': %w", tlsForwarderConf.Name, err)
+		}
+
+		bl.list[tlsForwarderConf.Name] = tlsForwarderBackend
 	}
 
 	for _, wolForwarderConf := range conf.WoLForwarder {
@@ -41,17 +67,62 @@ func NewBackendList(conf config.BackendConfigs) (*BackendList, error) {
 		bl.list[wolForwarderConf.Name] = wolForwarderBackend
 	}
 
+	for _, loadBalancerConf := range conf.LoadBalancer {
+		loadBalancerBackend, err := newLoadBalancerBackend(loadBalancerConf)
+		if err != nil {
+			return nil, fmt.Errorf("could not create backend '%s': %w", loadBalancerConf.Name, err)
+		}
+
+		bl.list[loadBalancerConf.Name] = loadBalancerBackend
+	}
+
+	// Failover backends come last, so their members can refer to all other backends
+	for _, failoverConf := range conf.Failover {
+		failoverBackend, err := newFailoverBackend(failoverConf, &bl)
+		if err != nil {
+			return nil, fmt.Errorf("could not create backend '%s': %w", failoverConf.Name, err)
+		}
+
+		bl.list[failoverConf.Name] = failoverBackend
+	}
+
 	return &bl, nil
 }
 
 // Get returns the backend with given name if present. The second return value indicates whether
-// the value is present, like in a casual map.
+// the value is present, like in a casual map. The backend counts as routed to, so StartHealthChecks
+// starts checking its targets.
 func (bl *BackendList) Get(name string) (Backend, bool) {
+	backend, ok := bl.get(name)
+	if ok {
+		bl.routedMutex.Lock()
+		bl.routed[name] = true
+		bl.routedMutex.Unlock()
+	}
+
+	return backend, ok
+}
+
+// get returns the backend with given name if present, without counting it as routed to.
+func (bl *BackendList) get(name string) (Backend, bool) {
 	backend, ok := bl.list[name]
 
 	return backend, ok
 }
 
+// StartHealthChecks starts the health checks of all backends that got routed to using Get, so targets no
+// frontend uses don't get checked.
+func (bl *BackendList) StartHealthChecks() {
+	bl.routedMutex.Lock()
+	defer bl.routedMutex.Unlock()
+
+	for name := range bl.routed {
+		if checker, ok := bl.list[name].(healthChecker); ok {
+			checker.startHealthChecks()
+		}
+	}
+}
+
 // CloseAll closes all backends and therefore all active connections.
 func (bl *BackendList) CloseAll() {
 	for _, backend := range bl.list {
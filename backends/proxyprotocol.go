@@ -0,0 +1,200 @@
+package backends
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	proxyProtocolV2TypeALPN = 0x01
+	proxyProtocolV2TypeSNI  = 0x02
+	// proxyProtocolV2TypeFrontend is the first type of the range reserved for custom TLVs.
+	proxyProtocolV2TypeFrontend = 0xE0
+)
+
+// proxyProtocolVersion defines which version of the PROXY protocol a forwarder sends to its target.
+type proxyProtocolVersion int
+
+const (
+	// proxyProtocolV1 sends human-readable v1 headers.
+	proxyProtocolV1 proxyProtocolVersion = iota + 1
+	// proxyProtocolV2 sends binary v2 headers, which can carry TLVs.
+	proxyProtocolV2
+)
+
+// proxyHeaderWriter writes PROXY protocol headers announcing the client and frontend addresses of connections
+// to their targets, as configured by a SendProxyProtocolConfig.
+type proxyHeaderWriter struct {
+	version          proxyProtocolVersion
+	sendServerName   bool
+	sendALPN         bool
+	sendFrontendName bool
+}
+
+// newProxyHeaderWriter creates a new proxyHeaderWriter for given config, which sends version "v1" or "v2". If
+// no version is configured, nil is returned, which means no headers get sent. TLVs are "sni", "alpn" and
+// "frontendName", and only supported by v2.
+func newProxyHeaderWriter(conf config.SendProxyProtocolConfig) (*proxyHeaderWriter, error) {
+	writer := &proxyHeaderWriter{version: proxyProtocolV1, sendServerName: false, sendALPN: false, sendFrontendName: false}
+
+	switch conf.SendProxyProtocol {
+	case "":
+		if len(conf.SendProxyProtocolTLVs) > 0 {
+			return nil, errors.New("sendProxyProtocolTLVs without sendProxyProtocol")
+		}
+
+		return nil, nil //nolint:nilnil // no version means no headers
+	case "v1":
+		if len(conf.SendProxyProtocolTLVs) > 0 {
+			return nil, errors.New("sendProxyProtocolTLVs require sendProxyProtocol 'v2'")
+		}
+	case "v2":
+		writer.version = proxyProtocolV2
+	default:
+		return nil, fmt.Errorf("unknown proxy protocol version '%s'", conf.SendProxyProtocol)
+	}
+
+	for _, tlv := range conf.SendProxyProtocolTLVs {
+		switch tlv {
+		case "sni":
+			writer.sendServerName = true
+		case "alpn":
+			writer.sendALPN = true
+		case "frontendName":
+			writer.sendFrontendName = true
+		default:
+			return nil, fmt.Errorf("unknown proxy protocol TLV '%s'", tlv)
+		}
+	}
+
+	return writer, nil
+}
+
+// write writes the PROXY protocol header for given connection to given connection to its target. Writing with
+// a nil proxyHeaderWriter does nothing.
+func (w *proxyHeaderWriter) write(connectionToTarget io.Writer, connection net.Conn) error {
+	if w == nil {
+		return nil
+	}
+
+	var header []byte
+
+	switch w.version {
+	case proxyProtocolV1:
+		header = proxyHeaderV1(connection.RemoteAddr(), connection.LocalAddr())
+	case proxyProtocolV2:
+		header = w.headerV2(connection)
+	default:
+		return fmt.Errorf("unknown proxy protocol version %d", w.version)
+	}
+
+	if _, err := connectionToTarget.Write(header); err != nil {
+		return fmt.Errorf("could not send proxy protocol header: %w", err)
+	}
+
+	return nil
+}
+
+// proxyHeaderV1 returns the human-readable PROXY protocol v1 header for given addresses, like
+// "PROXY TCP4 1.2.3.4 5.6.7.8 1234 80\r\n". Addresses other than TCP are announced as "PROXY UNKNOWN\r\n".
+func proxyHeaderV1(sourceAddr net.Addr, destinationAddr net.Addr) []byte {
+	source, destination, ipv4, ok := proxyHeaderAddrs(sourceAddr, destinationAddr)
+	if !ok {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+
+	protocol := "TCP4"
+	sourceIP, destinationIP := source.IP.String(), destination.IP.String()
+
+	if !ipv4 {
+		// IPv4 addresses mapped to IPv6 have to be written like IPv6 addresses, like "::ffff:1.2.3.4"
+		protocol = "TCP6"
+		sourceIP = netip.AddrFrom16([net.IPv6len]byte(source.IP.To16())).String()
+		destinationIP = netip.AddrFrom16([net.IPv6len]byte(destination.IP.To16())).String()
+	}
+
+	return []byte("PROXY " + protocol + " " + sourceIP + " " + destinationIP + " " +
+		strconv.Itoa(source.Port) + " " + strconv.Itoa(destination.Port) + "\r\n")
+}
+
+// headerV2 returns the binary PROXY protocol v2 header for given connection, followed by the configured TLVs.
+// Connections with addresses other than TCP are announced with the LOCAL command, which makes the target use the
+// addresses of the connection itself.
+func (w *proxyHeaderWriter) headerV2(connection net.Conn) []byte {
+	header := bytes.NewBuffer(helper.ProxyProtocolV2Signature())
+
+	source, destination, ipv4, ok := proxyHeaderAddrs(connection.RemoteAddr(), connection.LocalAddr())
+	if !ok {
+		header.Write([]byte{helper.ProxyProtocolV2Version<<4 | helper.ProxyProtocolV2CommandLocal, 0x00, 0x00, 0x00})
+
+		return header.Bytes()
+	}
+
+	payload := &bytes.Buffer{}
+
+	family := byte(helper.ProxyProtocolV2FamilyTCP6)
+	if ipv4 {
+		family = helper.ProxyProtocolV2FamilyTCP4
+		payload.Write(source.IP.To4())
+		payload.Write(destination.IP.To4())
+	} else {
+		payload.Write(source.IP.To16())
+		payload.Write(destination.IP.To16())
+	}
+
+	payload.Write(binary.BigEndian.AppendUint16(nil, uint16(source.Port)))      //nolint:gosec // ports fit in 16 bits
+	payload.Write(binary.BigEndian.AppendUint16(nil, uint16(destination.Port))) //nolint:gosec // ports fit in 16 bits
+
+	if w.sendALPN {
+		writeProxyHeaderTLV(payload, proxyProtocolV2TypeALPN, helper.ALPN(connection))
+	}
+
+	if w.sendServerName {
+		writeProxyHeaderTLV(payload, proxyProtocolV2TypeSNI, helper.ServerName(connection))
+	}
+
+	if w.sendFrontendName {
+		writeProxyHeaderTLV(payload, proxyProtocolV2TypeFrontend, helper.FrontendName(connection))
+	}
+
+	header.Write([]byte{helper.ProxyProtocolV2Version<<4 | helper.ProxyProtocolV2CommandProxy, family})
+	header.Write(binary.BigEndian.AppendUint16(nil, uint16(payload.Len()))) //nolint:gosec // names and protocols are short
+	header.Write(payload.Bytes())
+
+	return header.Bytes()
+}
+
+// writeProxyHeaderTLV writes a TLV of given type and value to given payload. Empty values are skipped, as the
+// target can't tell them apart from missing ones anyway.
+func writeProxyHeaderTLV(payload *bytes.Buffer, tlvType byte, value string) {
+	if value == "" {
+		return
+	}
+
+	payload.WriteByte(tlvType)
+	payload.Write(binary.BigEndian.AppendUint16(nil, uint16(len(value)))) //nolint:gosec // names and protocols are short
+	payload.WriteString(value)
+}
+
+// proxyHeaderAddrs returns given addresses as TCP addresses for a PROXY protocol header, and whether both are
+// IPv4. Otherwise both have to be written as IPv6 addresses, mapping an IPv4 address to IPv6. The last return
+// value is false if any address isn't a TCP address.
+func proxyHeaderAddrs(sourceAddr net.Addr, destinationAddr net.Addr) (*net.TCPAddr, *net.TCPAddr, bool, bool) {
+	source, sourceOK := sourceAddr.(*net.TCPAddr)
+	destination, destinationOK := destinationAddr.(*net.TCPAddr)
+
+	if !sourceOK || !destinationOK || source.IP == nil || destination.IP == nil {
+		return nil, nil, false, false
+	}
+
+	return source, destination, source.IP.To4() != nil && destination.IP.To4() != nil, true
+}
@@ -0,0 +1,215 @@
+package backends
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+// proxyTestConn is a net.Conn with given addresses, that knows its frontend, server name and ALPN.
+type proxyTestConn struct {
+	net.Conn
+
+	remoteAddr   net.Addr
+	localAddr    net.Addr
+	frontendName string
+	serverName   string
+	alpn         string
+}
+
+func (c *proxyTestConn) RemoteAddr() net.Addr { return c.remoteAddr }
+func (c *proxyTestConn) LocalAddr() net.Addr  { return c.localAddr }
+func (c *proxyTestConn) FrontendName() string { return c.frontendName }
+func (c *proxyTestConn) ServerName() string   { return c.serverName }
+
+func (c *proxyTestConn) ConnectionState() tls.ConnectionState {
+	return tls.ConnectionState{NegotiatedProtocol: c.alpn}
+}
+
+// errorWriter is an io.Writer failing every write.
+type errorWriter struct{}
+
+func (errorWriter) Write(_ []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+// newProxyTestConn creates a proxyTestConn with given TCP addresses, announcing the frontend "ssh", server name
+// "nas.example.com" and ALPN "h2".
+func newProxyTestConn(remoteAddr string, localAddr string) *proxyTestConn {
+	return &proxyTestConn{
+		remoteAddr:   net.TCPAddrFromAddrPort(netip.MustParseAddrPort(remoteAddr)),
+		localAddr:    net.TCPAddrFromAddrPort(netip.MustParseAddrPort(localAddr)),
+		frontendName: "ssh",
+		serverName:   "nas.example.com",
+		alpn:         "h2",
+	}
+}
+
+func TestNewProxyHeaderWriter(t *testing.T) {
+	writer, err := newProxyHeaderWriter(config.SendProxyProtocolConfig{})
+	if err != nil || writer != nil {
+		t.Errorf("newProxyHeaderWriter() without version = %v, %v, want nil, nil", writer, err)
+	}
+
+	writer, err = newProxyHeaderWriter(config.SendProxyProtocolConfig{
+		SendProxyProtocol:     "v2",
+		SendProxyProtocolTLVs: []string{"sni", "frontendName"},
+	})
+	if err != nil {
+		t.Fatalf("newProxyHeaderWriter() failed: %v", err)
+	}
+
+	if writer.version != proxyProtocolV2 || !writer.sendServerName || writer.sendALPN || !writer.sendFrontendName {
+		t.Errorf("newProxyHeaderWriter() = %+v, want v2 with sni and frontendName", writer)
+	}
+}
+
+func TestNewProxyHeaderWriter_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.SendProxyProtocolConfig
+	}{
+		{name: "unknown version", conf: config.SendProxyProtocolConfig{SendProxyProtocol: "v3"}},
+		{name: "unknown TLV", conf: config.SendProxyProtocolConfig{SendProxyProtocol: "v2", SendProxyProtocolTLVs: []string{"ssl"}}},
+		{name: "TLVs with v1", conf: config.SendProxyProtocolConfig{SendProxyProtocol: "v1", SendProxyProtocolTLVs: []string{"sni"}}},
+		{name: "TLVs without version", conf: config.SendProxyProtocolConfig{SendProxyProtocolTLVs: []string{"sni"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newProxyHeaderWriter(tt.conf); err == nil {
+				t.Error("expected newProxyHeaderWriter() to fail")
+			}
+		})
+	}
+}
+
+func TestProxyHeaderWriter_Write_V1(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection *proxyTestConn
+		want       string
+	}{
+		{
+			name:       "ipv4",
+			connection: newProxyTestConn("192.0.2.1:51000", "198.51.100.1:22"),
+			want:       "PROXY TCP4 192.0.2.1 198.51.100.1 51000 22\r\n",
+		},
+		{
+			name:       "ipv6",
+			connection: newProxyTestConn("[2001:db8::1]:51000", "[2001:db8::2]:22"),
+			want:       "PROXY TCP6 2001:db8::1 2001:db8::2 51000 22\r\n",
+		},
+		{
+			name:       "mixed",
+			connection: newProxyTestConn("192.0.2.1:51000", "[2001:db8::2]:22"),
+			want:       "PROXY TCP6 ::ffff:192.0.2.1 2001:db8::2 51000 22\r\n",
+		},
+		{
+			name: "unix",
+			connection: &proxyTestConn{
+				remoteAddr: &net.UnixAddr{Name: "@", Net: "unix"},
+				localAddr:  &net.UnixAddr{Name: "/run/pluggo.sock", Net: "unix"},
+			},
+			want: "PROXY UNKNOWN\r\n",
+		},
+	}
+
+	writer := &proxyHeaderWriter{version: proxyProtocolV1}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := &bytes.Buffer{}
+			if err := writer.write(header, tt.connection); err != nil {
+				t.Fatalf("write() failed: %v", err)
+			}
+
+			if header.String() != tt.want {
+				t.Errorf("write() wrote %q, want %q", header.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyHeaderWriter_Write_V2(t *testing.T) {
+	signature := helper.ProxyProtocolV2Signature()
+
+	tests := []struct {
+		name       string
+		writer     *proxyHeaderWriter
+		connection *proxyTestConn
+		want       []byte
+	}{
+		{
+			name:       "ipv4 without TLVs",
+			writer:     &proxyHeaderWriter{version: proxyProtocolV2},
+			connection: newProxyTestConn("192.0.2.1:51000", "198.51.100.1:22"),
+			want: append(signature, 0x21, 0x11, 0x00, 0x0C,
+				192, 0, 2, 1, 198, 51, 100, 1, 0xC7, 0x38, 0x00, 0x16),
+		},
+		{
+			name:       "ipv4 with TLVs",
+			writer:     &proxyHeaderWriter{version: proxyProtocolV2, sendServerName: true, sendALPN: true, sendFrontendName: true},
+			connection: newProxyTestConn("192.0.2.1:51000", "198.51.100.1:22"),
+			want: append(append(append(append(signature, 0x21, 0x11, 0x00, 0x29,
+				192, 0, 2, 1, 198, 51, 100, 1, 0xC7, 0x38, 0x00, 0x16,
+				0x01, 0x00, 0x02, 'h', '2',
+				0x02, 0x00, 0x0F), "nas.example.com"...),
+				0xE0, 0x00, 0x03), "ssh"...),
+		},
+		{
+			name:   "ipv6 skipping empty TLVs",
+			writer: &proxyHeaderWriter{version: proxyProtocolV2, sendServerName: true},
+			connection: &proxyTestConn{
+				remoteAddr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1},
+				localAddr:  &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 2},
+			},
+			want: append(signature, 0x21, 0x21, 0x00, 0x24,
+				0x20, 0x01, 0x0D, 0xB8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xFF, 0xFF, 192, 0, 2, 2,
+				0x00, 0x01, 0x00, 0x02),
+		},
+		{
+			name:   "unix",
+			writer: &proxyHeaderWriter{version: proxyProtocolV2, sendServerName: true},
+			connection: &proxyTestConn{
+				remoteAddr: &net.UnixAddr{Name: "@", Net: "unix"},
+				localAddr:  &net.UnixAddr{Name: "/run/pluggo.sock", Net: "unix"},
+			},
+			want: append(signature, 0x20, 0x00, 0x00, 0x00),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := &bytes.Buffer{}
+			if err := tt.writer.write(header, tt.connection); err != nil {
+				t.Fatalf("write() failed: %v", err)
+			}
+
+			if !bytes.Equal(header.Bytes(), tt.want) {
+				t.Errorf("write() wrote %x, want %x", header.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyHeaderWriter_Write_Errors(t *testing.T) {
+	connection := newProxyTestConn("192.0.2.1:51000", "198.51.100.1:22")
+
+	var writer *proxyHeaderWriter
+	if err := writer.write(errorWriter{}, connection); err != nil {
+		t.Errorf("write() with nil writer failed: %v", err)
+	}
+
+	writer = &proxyHeaderWriter{version: proxyProtocolV1}
+	if err := writer.write(errorWriter{}, connection); err == nil {
+		t.Error("expected write() to fail")
+	}
+}
@@ -2,6 +2,7 @@ package backends
 
 import (
 	"container/list"
+	"fmt"
 	"log/slog"
 	"net"
 	"sync"
@@ -13,22 +14,47 @@ import (
 
 const tcpDialTimeout = 10 * time.Second
 
+// tcpDownTargetDialTimeout is the dial timeout for targets the health check found down.
+const tcpDownTargetDialTimeout = time.Second
+
 type tcpForwarderBackend struct {
 	name              string
 	activeConnections *list.List
 	connectionsMutex  sync.Mutex
 	targetAddr        string
 	dialer            dialer
+	health            *targetHealth
+	proxyHeader       *proxyHeaderWriter
 }
 
 // newTCPForwarderBackend creates a new instance of tcpForwarderBackend, preparing it with all necessary dependencies.
-func newTCPForwarderBackend(conf config.TCPForwarderBackendConfig) *tcpForwarderBackend {
+// If a health check is configured, the target starts getting checked right away.
+func newTCPForwarderBackend(conf config.TCPForwarderBackendConfig) (*tcpForwarderBackend, error) {
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options: %w", err)
+	}
+
+	proxyHeader, err := newProxyHeaderWriter(conf.SendProxyProtocolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy protocol options: %w", err)
+	}
+
+	targetDialer := defaultDialer{socketOptions: socketOptions}
+
+	check, err := newHealthCheck(conf.HealthCheck, targetDialer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid health check: %w", err)
+	}
+
 	return &tcpForwarderBackend{
 		name:              conf.Name,
 		activeConnections: list.New(),
 		targetAddr:        conf.TargetAddr,
-		dialer:            defaultDialer{},
-	}
+		dialer:            targetDialer,
+		health:            check.watch(conf.Name, conf.TargetAddr),
+		proxyHeader:       proxyHeader,
+	}, nil
 }
 
 // GetName returns the name of the current tcpForwarderBackend instance.
@@ -36,8 +62,10 @@ func (be *tcpForwarderBackend) GetName() string {
 	return be.name
 }
 
-// Close closes all active connections managed by this tcpForwarderBackend instance.
+// Close closes all active connections managed by this tcpForwarderBackend instance, and stops checking its target.
 func (be *tcpForwarderBackend) Close() error {
+	be.health.stop()
+
 	be.connectionsMutex.Lock()
 	connections := make([]*helper.PipeHelper, 0, be.activeConnections.Len())
 	for e := be.activeConnections.Front(); e != nil; e = e.Next() {
@@ -58,15 +86,34 @@ func (be *tcpForwarderBackend) Close() error {
 // a pipe will get generated, else the connection gets closed.
 // Handle takes ownership of given connection.
 func (be *tcpForwarderBackend) Handle(connection net.Conn) {
-	connectionToTarget, err := be.dialer.DialTimeout("tcp", be.targetAddr, tcpDialTimeout)
+	be.handle(connection, "tcp")
+}
+
+// HandlePacket handles given datagram connection like Handle does, but forwards the datagrams to
+// the target host via udp.
+// HandlePacket takes ownership of given connection.
+func (be *tcpForwarderBackend) HandlePacket(connection net.Conn) {
+	be.handle(connection, "udp")
+}
+
+// handle dials the target host using given network and pipes given connection to it. If the connection asks for
+// a specific target port, that port is used instead of the configured one. If configured, a PROXY protocol header
+// gets sent to the target before piping starts.
+func (be *tcpForwarderBackend) handle(connection net.Conn, network string) {
+	targetAddr := helper.TargetAddr(connection, be.targetAddr)
+
+	connectionToTarget, err := be.dial(network, targetAddr)
 	if err != nil {
 		slog.Info(
 			"backend could not connect to target",
-			slog.String("targetAddr", be.targetAddr),
+			slog.String("targetAddr", targetAddr),
+			slog.String("network", network),
 			slog.String("name", be.name),
 			slog.Any("error", err),
 		)
 
+		helper.ReportDialFailure(connection)
+
 		if err = connection.Close(); err != nil {
 			slog.Warn("could not properly close incoming connection after dialer timeout", slog.Any("error", err))
 		}
@@ -74,6 +121,25 @@ func (be *tcpForwarderBackend) Handle(connection net.Conn) {
 		return
 	}
 
+	// PROXY protocol headers only work for streams, datagrams get forwarded untouched
+	if network == "tcp" {
+		if err = be.proxyHeader.write(connectionToTarget, connection); err != nil {
+			slog.Info("backend could not send proxy protocol header", slog.String("name", be.name), slog.Any("error", err))
+
+			if err = connectionToTarget.Close(); err != nil {
+				slog.Debug("could not properly close target connection", slog.Any("error", err))
+			}
+
+			helper.ReportDialFailure(connection)
+
+			if err = connection.Close(); err != nil {
+				slog.Warn("could not properly close incoming connection", slog.Any("error", err))
+			}
+
+			return
+		}
+	}
+
 	pipeHelper := helper.NewPipeHelper(connection, connectionToTarget)
 
 	be.connectionsMutex.Lock()
@@ -87,3 +153,33 @@ func (be *tcpForwarderBackend) Handle(connection net.Conn) {
 		be.connectionsMutex.Unlock()
 	})
 }
+
+// startHealthChecks starts checking the target, if a health check is configured.
+func (be *tcpForwarderBackend) startHealthChecks() {
+	be.health.start()
+}
+
+// isHealthy reports whether the health check found the target healthy. Targets without health check are always
+// healthy.
+func (be *tcpForwarderBackend) isHealthy() bool {
+	return be.health.isHealthy()
+}
+
+// dial dials given address using given network. Targets the health check found down still get dialed, but with a
+// short timeout, so connections fail fast instead of waiting for the full timeout if the target is still down. The
+// health check only knows the configured target address, so addresses with another port asked for by the connection
+// get dialed without looking at it.
+func (be *tcpForwarderBackend) dial(network string, targetAddr string) (net.Conn, error) {
+	if targetAddr == be.targetAddr && !be.isHealthy() {
+		slog.Warn(
+			"backend target is down, trying it with a short timeout",
+			slog.String("name", be.name),
+			slog.String("targetAddr", targetAddr),
+			slog.Duration("timeout", tcpDownTargetDialTimeout),
+		)
+
+		return be.dialer.DialTimeout(network, targetAddr, tcpDownTargetDialTimeout)
+	}
+
+	return be.dialer.DialTimeout(network, targetAddr, tcpDialTimeout)
+}
@@ -7,14 +7,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sateffen/pluggo/backends/helper"
 	"github.com/sateffen/pluggo/config"
 )
 
 func TestTCPForwarderBackend_GetName(t *testing.T) {
-	backend := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
 		Name:       "test-tcp-forwarder",
 		TargetAddr: "127.0.0.1:3000",
 	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
 
 	if got := backend.GetName(); got != "test-tcp-forwarder" {
 		t.Errorf("GetName() = %q, want %q", got, "test-tcp-forwarder")
@@ -44,10 +48,13 @@ func TestTCPForwarderBackend_Handle_SuccessfulDial(t *testing.T) {
 		},
 	}
 
-	backend := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
 		Name:       "test-forwarder",
 		TargetAddr: "127.0.0.2:3000",
 	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
 	backend.dialer = mockDialer
 
 	// Create incoming connection
@@ -99,10 +106,13 @@ func TestTCPForwarderBackend_Handle_DialFailure(t *testing.T) {
 		},
 	}
 
-	backend := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
 		Name:       "test-forwarder",
 		TargetAddr: "127.0.04:3000",
 	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
 	backend.dialer = mockDialer
 
 	incomingBackendConn, incomingTestConn := net.Pipe()
@@ -125,11 +135,88 @@ func TestTCPForwarderBackend_Handle_DialFailure(t *testing.T) {
 	}
 }
 
+// dialFailureConn is a net.Conn counting the dial failures reported for it.
+type dialFailureConn struct {
+	net.Conn
+
+	reportedDialFailures int
+}
+
+func (c *dialFailureConn) ReportDialFailure() {
+	c.reportedDialFailures++
+}
+
+func TestTCPForwarderBackend_Handle_DialFailureGetsReported(t *testing.T) {
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+		Name:       "test-forwarder",
+		TargetAddr: "127.0.0.4:3000",
+	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
+	backend.dialer = &mockDialer{
+		mockDialTimeout: func(_, _ string, _ time.Duration) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	incomingBackendConn, incomingTestConn := net.Pipe()
+	defer incomingTestConn.Close()
+
+	connection := &dialFailureConn{Conn: incomingBackendConn}
+	backend.Handle(connection)
+
+	if connection.reportedDialFailures != 1 {
+		t.Errorf("reported dial failures = %d, want 1", connection.reportedDialFailures)
+	}
+}
+
+// targetPortConn is a net.Conn asking for a specific target port.
+type targetPortConn struct {
+	net.Conn
+
+	targetPort int
+}
+
+func (c *targetPortConn) TargetPort() int {
+	return c.targetPort
+}
+
+func TestTCPForwarderBackend_Handle_UsesTargetPortOfConnection(t *testing.T) {
+	dialedAddr := make(chan string, 1)
+
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+		Name:       "test-forwarder",
+		TargetAddr: "127.0.0.4:5000",
+	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
+	backend.dialer = &mockDialer{
+		mockDialTimeout: func(_, address string, _ time.Duration) (net.Conn, error) {
+			dialedAddr <- address
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	incomingBackendConn, incomingTestConn := net.Pipe()
+	defer incomingTestConn.Close()
+
+	backend.Handle(&targetPortConn{Conn: incomingBackendConn, targetPort: 5007})
+
+	if got := <-dialedAddr; got != "127.0.0.4:5007" {
+		t.Errorf("dialed %q, want %q", got, "127.0.0.4:5007")
+	}
+}
+
 func TestTCPForwarderBackend_Handle_TracksActiveConnections(t *testing.T) {
-	backend := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
 		Name:       "test-forwarder",
 		TargetAddr: "example.com:80",
 	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
 
 	// Initially no connections
 	if backend.activeConnections.Len() != 0 {
@@ -184,10 +271,13 @@ func TestTCPForwarderBackend_Handle_RemovesConnectionOnClose(t *testing.T) {
 	targetBackendEnd, targetClientEnd := net.Pipe()
 	defer targetClientEnd.Close()
 
-	backend := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
 		Name:       "test-forwarder",
 		TargetAddr: "example.com:80",
 	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
 
 	backend.dialer = &mockDialer{
 		mockDialTimeout: func(_, _ string, _ time.Duration) (net.Conn, error) {
@@ -223,10 +313,13 @@ func TestTCPForwarderBackend_Close_ClosesActiveConnections(t *testing.T) {
 	targetBackendEnd, targetClientEnd := net.Pipe()
 	defer targetClientEnd.Close()
 
-	backend := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
 		Name:       "test-forwarder",
 		TargetAddr: "example.com:80",
 	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
 	backend.dialer = &mockDialer{
 		mockDialTimeout: func(_, _ string, _ time.Duration) (net.Conn, error) {
 			return targetBackendEnd, nil
@@ -262,11 +355,15 @@ func TestTCPForwarderBackend_Close_ClosesActiveConnections(t *testing.T) {
 	}
 }
 
-func TestTCPForwarderBackend_Close_Empty(_ *testing.T) {
-	backend := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+func TestTCPForwarderBackend_Close_Empty(t *testing.T) {
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
 		Name:       "test-forwarder",
 		TargetAddr: "example.com:80",
 	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
+
 	// Should not panic or deadlock with no active connections
 	backend.Close()
 }
@@ -276,10 +373,13 @@ func TestTCPForwarderBackend_Handle_BidirectionalDataFlow(t *testing.T) {
 	defer targetBackendEnd.Close()
 	defer targetClientEnd.Close()
 
-	backend := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
 		Name:       "test-forwarder",
 		TargetAddr: "127.0.0.4:3000",
 	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
 
 	backend.dialer = &mockDialer{
 		mockDialTimeout: func(_, _ string, _ time.Duration) (net.Conn, error) {
@@ -333,3 +433,148 @@ func TestTCPForwarderBackend_Handle_BidirectionalDataFlow(t *testing.T) {
 		}
 	}
 }
+
+func TestTCPForwarderBackend_HandlePacket_DialsUDP(t *testing.T) {
+	targetClientEnd, targetBackendEnd := net.Pipe()
+	defer targetClientEnd.Close()
+	defer targetBackendEnd.Close()
+
+	mockDialer := &mockDialer{
+		mockDialTimeout: func(network, address string, _ time.Duration) (net.Conn, error) {
+			if network != "udp" {
+				t.Errorf("dial network = %q, want %q", network, "udp")
+			}
+			if address != "127.0.0.2:53" {
+				t.Errorf("dial address = %q, want %q", address, "127.0.0.2:53")
+			}
+			return targetBackendEnd, nil
+		},
+	}
+
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+		Name:       "test-forwarder",
+		TargetAddr: "127.0.0.2:53",
+	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
+	backend.dialer = mockDialer
+
+	incomingBackendConn, incomingTestConn := net.Pipe()
+	defer incomingBackendConn.Close()
+	defer incomingTestConn.Close()
+
+	backend.HandlePacket(incomingBackendConn)
+
+	testData := []byte("datagram")
+	go func() {
+		incomingTestConn.Write(testData)
+	}()
+
+	readBuffer := make([]byte, len(testData))
+	n, err := io.ReadFull(targetClientEnd, readBuffer)
+	if err != nil {
+		t.Fatalf("failed to read from target: %v", err)
+	}
+
+	if string(readBuffer[:n]) != string(testData) {
+		t.Errorf("target received %q, want %q", string(readBuffer[:n]), string(testData))
+	}
+}
+
+func TestTCPForwarderBackend_Handle_TriesTargetDownWithShortTimeout(t *testing.T) {
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+		Name:       "test-forwarder",
+		TargetAddr: "127.0.0.1:3000",
+	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
+
+	backend.health = newDownTargetHealth()
+
+	tests := []struct {
+		name        string
+		targetPort  int
+		wantAddr    string
+		wantTimeout time.Duration
+	}{
+		{name: "configured port", targetPort: 0, wantAddr: "127.0.0.1:3000", wantTimeout: tcpDownTargetDialTimeout},
+		// The health check doesn't know other ports, so they get the full timeout
+		{name: "port of connection", targetPort: 8080, wantAddr: "127.0.0.1:8080", wantTimeout: tcpDialTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dialedAddr string
+			var dialTimeout time.Duration
+			backend.dialer = &mockDialer{
+				mockDialTimeout: func(_, address string, timeout time.Duration) (net.Conn, error) {
+					dialedAddr = address
+					dialTimeout = timeout
+					return nil, net.ErrClosed
+				},
+			}
+
+			incomingConn, testConn := net.Pipe()
+			defer testConn.Close()
+
+			backend.Handle(&targetPortConn{Conn: incomingConn, targetPort: tt.targetPort})
+
+			if dialedAddr != tt.wantAddr {
+				t.Errorf("dialed %q, want %q", dialedAddr, tt.wantAddr)
+			}
+			if dialTimeout != tt.wantTimeout {
+				t.Errorf("dialed with timeout %v, want %v", dialTimeout, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestTCPForwarderBackend_Handle_SendsProxyProtocolHeader(t *testing.T) {
+	backend, err := newTCPForwarderBackend(config.TCPForwarderBackendConfig{
+		Name:       "test-forwarder",
+		TargetAddr: "127.0.0.1:3000",
+		SendProxyProtocolConfig: config.SendProxyProtocolConfig{
+			SendProxyProtocol:     "v2",
+			SendProxyProtocolTLVs: []string{"frontendName"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("newTCPForwarderBackend() failed: %v", err)
+	}
+	defer backend.Close()
+
+	for _, network := range []string{"tcp", "udp"} {
+		targetBackendEnd, targetClientEnd := net.Pipe()
+
+		backend.dialer = &mockDialer{
+			mockDialTimeout: func(_, _ string, _ time.Duration) (net.Conn, error) {
+				return targetBackendEnd, nil
+			},
+		}
+
+		incomingBackendConn, incomingTestConn := net.Pipe()
+
+		connection := newProxyTestConn("192.0.2.1:51000", "198.51.100.1:22")
+		connection.Conn = incomingBackendConn
+
+		go backend.handle(connection, network)
+		go incomingTestConn.Write([]byte("SSH"))
+
+		// Streams start with the header, datagrams get forwarded without
+		want := "SSH"
+		if network == "tcp" {
+			want = string(append(helper.ProxyProtocolV2Signature(), 0x21, 0x11, 0x00, 0x12,
+				192, 0, 2, 1, 198, 51, 100, 1, 0xC7, 0x38, 0x00, 0x16, 0xE0, 0x00, 0x03, 's', 's', 'h')) + want
+		}
+
+		received := make([]byte, len(want))
+		if _, err = io.ReadFull(targetClientEnd, received); err != nil || string(received) != want {
+			t.Errorf("target received %q via %s, %v, want %q", received, network, err, want)
+		}
+
+		incomingTestConn.Close()
+		targetClientEnd.Close()
+	}
+}
@@ -0,0 +1,282 @@
+package backends
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const tlsForwarderHandshakeTimeout = 10 * time.Second
+
+// errSPKIPinMismatch is returned by handshakes with targets whose certificates match none of the pinned SPKI hashes.
+var errSPKIPinMismatch = errors.New("no target certificate matches the pinned SPKI hashes")
+
+type tlsForwarderBackend struct {
+	name              string
+	activeConnections *list.List
+	connectionsMutex  sync.Mutex
+	targetAddr        string
+	tlsConfig         *tls.Config
+	dialer            dialer
+}
+
+// newTLSForwarderBackend creates a new instance of tlsForwarderBackend, preparing it with all necessary dependencies.
+// The server name defaults to the host of the target address.
+func newTLSForwarderBackend(conf config.TLSForwarderBackendConfig) (*tlsForwarderBackend, error) {
+	tlsConfig, err := newClientTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options: %w", err)
+	}
+
+	return &tlsForwarderBackend{
+		name:              conf.Name,
+		activeConnections: list.New(),
+		connectionsMutex:  sync.Mutex{},
+		targetAddr:        conf.TargetAddr,
+		tlsConfig:         tlsConfig,
+		dialer:            defaultDialer{socketOptions: socketOptions},
+	}, nil
+}
+
+// newClientTLSConfig creates the tls.Config for connecting to the target of given backend config. Certificates get
+// verified against the CA bundle if configured, else against the system roots. Skipping the verification is only
+// allowed with pinned SPKI hashes, so the target is still authenticated.
+func newClientTLSConfig(conf config.TLSForwarderBackendConfig) (*tls.Config, error) {
+	serverName := conf.ServerName
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(conf.TargetAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid targetAddr '%s': %w", conf.TargetAddr, err)
+		}
+
+		serverName = host
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         conf.ALPN,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: conf.SkipVerify, //nolint:gosec // only allowed with pinned SPKI hashes, checked below
+	}
+
+	if conf.CAFile != "" {
+		caBundle, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("CA bundle '%s' contains no certificates", conf.CAFile)
+		}
+	}
+
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate '%s': %w", conf.CertFile, err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	pins, err := parseSPKIPins(conf.PinnedSPKI)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.SkipVerify && len(pins) == 0 {
+		return nil, errors.New("skipVerify requires pinnedSPKI")
+	}
+
+	if len(pins) > 0 {
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, certificate := range state.PeerCertificates {
+				if slices.Contains(pins, sha256.Sum256(certificate.RawSubjectPublicKeyInfo)) {
+					return nil
+				}
+			}
+
+			return errSPKIPinMismatch
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// parseSPKIPins decodes given base64 encoded SHA-256 hashes of SubjectPublicKeyInfos.
+func parseSPKIPins(encodedPins []string) ([][sha256.Size]byte, error) {
+	pins := make([][sha256.Size]byte, 0, len(encodedPins))
+
+	for _, encodedPin := range encodedPins {
+		pin, err := base64.StdEncoding.DecodeString(encodedPin)
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("pinned SPKI '%s' is no base64 encoded SHA-256 hash", encodedPin)
+		}
+
+		pins = append(pins, [sha256.Size]byte(pin))
+	}
+
+	return pins, nil
+}
+
+// GetName returns the name of the current tlsForwarderBackend instance.
+func (be *tlsForwarderBackend) GetName() string {
+	return be.name
+}
+
+// Close closes all active connections managed by this tlsForwarderBackend instance.
+func (be *tlsForwarderBackend) Close() error {
+	be.connectionsMutex.Lock()
+	connections := make([]*helper.PipeHelper, 0, be.activeConnections.Len())
+	for e := be.activeConnections.Front(); e != nil; e = e.Next() {
+		if pipeHelper, ok := e.Value.(*helper.PipeHelper); ok {
+			connections = append(connections, pipeHelper)
+		}
+	}
+	be.connectionsMutex.Unlock()
+
+	for _, conn := range connections {
+		conn.Close()
+	}
+
+	return nil
+}
+
+// Handle handles given connection by dialing the target host and doing a TLS handshake with it. If both succeed,
+// a pipe will get generated, else the connection gets closed. If the connection asks for a specific target port,
+// that port is used instead of the configured one.
+// Handle takes ownership of given connection.
+func (be *tlsForwarderBackend) Handle(connection net.Conn) {
+	targetAddr := helper.TargetAddr(connection, be.targetAddr)
+
+	connectionToTarget, err := be.dialer.DialTimeout("tcp", targetAddr, tcpDialTimeout)
+	if err != nil {
+		slog.Info(
+			"backend could not connect to target",
+			slog.String("targetAddr", targetAddr),
+			slog.String("name", be.name),
+			slog.Any("error", err),
+		)
+
+		be.fail(connection)
+
+		return
+	}
+
+	tlsConnection, err := be.handshake(connectionToTarget)
+	if err != nil {
+		slog.Warn(
+			"backend tls handshake with target failed",
+			slog.String("targetAddr", targetAddr),
+			slog.String("serverName", be.tlsConfig.ServerName),
+			slog.String("name", be.name),
+			slog.Any("error", err),
+		)
+
+		if err = connectionToTarget.Close(); err != nil {
+			slog.Debug("could not properly close target connection after failed handshake", slog.Any("error", err))
+		}
+
+		be.fail(connection)
+
+		return
+	}
+
+	pipeHelper := helper.NewPipeHelper(connection, tlsConnection)
+
+	be.connectionsMutex.Lock()
+	listElement := be.activeConnections.PushBack(pipeHelper)
+	be.connectionsMutex.Unlock()
+
+	//nolint:gosec // if an error happens here, the matrix is broken
+	pipeHelper.OnClose(func() {
+		be.connectionsMutex.Lock()
+		be.activeConnections.Remove(listElement)
+		be.connectionsMutex.Unlock()
+	})
+}
+
+// fail reports the failed connection attempt for given connection, and closes it.
+func (be *tlsForwarderBackend) fail(connection net.Conn) {
+	helper.ReportDialFailure(connection)
+
+	if err := connection.Close(); err != nil {
+		slog.Warn("could not properly close incoming connection after failing to connect", slog.Any("error", err))
+	}
+}
+
+// handshake does the TLS handshake on given connection to the target. If the handshake fails or takes longer than
+// tlsForwarderHandshakeTimeout, an error describing the cause is returned.
+func (be *tlsForwarderBackend) handshake(connectionToTarget net.Conn) (*tls.Conn, error) {
+	tlsConnection := tls.Client(connectionToTarget, be.tlsConfig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), tlsForwarderHandshakeTimeout)
+	defer cancel()
+
+	if err := tlsConnection.HandshakeContext(ctx); err != nil {
+		return nil, describeHandshakeError(err, be.tlsConfig.ServerName)
+	}
+
+	connectionState := tlsConnection.ConnectionState()
+	slog.Debug(
+		"backend tls handshake with target succeeded",
+		slog.String("name", be.name),
+		slog.String("alpn", connectionState.NegotiatedProtocol),
+		slog.String("tlsVersion", tls.VersionName(connectionState.Version)),
+		slog.String("cipherSuite", tls.CipherSuiteName(connectionState.CipherSuite)),
+	)
+
+	return tlsConnection, nil
+}
+
+// describeHandshakeError wraps given handshake error with a description of its cause, as the errors of crypto/tls
+// alone are hard to make sense of.
+func describeHandshakeError(err error, serverName string) error {
+	var (
+		unknownAuthorityErr x509.UnknownAuthorityError
+		hostnameErr         x509.HostnameError
+		invalidErr          x509.CertificateInvalidError
+		recordHeaderErr     tls.RecordHeaderError
+		opErr               *net.OpError
+	)
+
+	switch {
+	case errors.Is(err, errSPKIPinMismatch):
+		return err
+	case errors.As(err, &unknownAuthorityErr):
+		return fmt.Errorf("target certificate isn't signed by a trusted CA: %w", err)
+	case errors.As(err, &hostnameErr):
+		return fmt.Errorf("target certificate isn't valid for server name '%s': %w", serverName, err)
+	case errors.As(err, &invalidErr):
+		return fmt.Errorf("target certificate is invalid: %w", err)
+	case errors.As(err, &recordHeaderErr):
+		return fmt.Errorf("target doesn't speak TLS: %w", err)
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		// Alerts sent by the target, like missing client certificates, come as *net.OpError
+		return fmt.Errorf("target rejected the handshake: %w", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("target didn't complete the handshake within %v: %w", tlsForwarderHandshakeTimeout, err)
+	default:
+		return fmt.Errorf("tls handshake failed: %w", err)
+	}
+}
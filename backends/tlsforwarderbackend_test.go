@@ -0,0 +1,386 @@
+package backends
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// testCertificate is a self-signed certificate written to files, usable for servers and clients.
+type testCertificate struct {
+	certFile    string
+	keyFile     string
+	certificate tls.Certificate
+	pool        *x509.CertPool
+	spkiPin     string
+}
+
+// generateTestCertificate generates a self-signed certificate for given DNS name, and writes it to given dir.
+func generateTestCertificate(t *testing.T, dir string, dnsName string) testCertificate {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	testCert := testCertificate{
+		certFile: filepath.Join(dir, dnsName+".crt"),
+		keyFile:  filepath.Join(dir, dnsName+".key"),
+		pool:     x509.NewCertPool(),
+	}
+
+	if err = os.WriteFile(testCert.certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("could not write certificate: %v", err)
+	}
+	if err = os.WriteFile(testCert.keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("could not write key: %v", err)
+	}
+
+	if testCert.certificate, err = tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatalf("could not load key pair: %v", err)
+	}
+
+	parsedCert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatalf("could not parse certificate: %v", err)
+	}
+
+	testCert.pool.AddCert(parsedCert)
+	spkiHash := sha256.Sum256(parsedCert.RawSubjectPublicKeyInfo)
+	testCert.spkiPin = base64.StdEncoding.EncodeToString(spkiHash[:])
+
+	return testCert
+}
+
+// startTestTLSTarget starts a TLS server with given config, that echoes all data of its connections. The
+// connection states of completed handshakes get sent to the returned channel.
+func startTestTLSTarget(t *testing.T, tlsConfig *tls.Config) (string, chan tls.ConnectionState) {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	states := make(chan tls.ConnectionState, 10)
+
+	go func() {
+		for {
+			connection, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+
+			go func() {
+				defer connection.Close()
+
+				tlsConnection, ok := connection.(*tls.Conn)
+				if !ok || tlsConnection.Handshake() != nil {
+					return
+				}
+
+				states <- tlsConnection.ConnectionState()
+				io.Copy(tlsConnection, tlsConnection)
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), states
+}
+
+func TestTLSForwarderBackend_GetName(t *testing.T) {
+	backend, err := newTLSForwarderBackend(config.TLSForwarderBackendConfig{
+		Name:       "test-tls-forwarder",
+		TargetAddr: "example.com:443",
+	})
+	if err != nil {
+		t.Fatalf("newTLSForwarderBackend() failed: %v", err)
+	}
+
+	if got := backend.GetName(); got != "test-tls-forwarder" {
+		t.Errorf("GetName() = %q, want %q", got, "test-tls-forwarder")
+	}
+
+	if got := backend.tlsConfig.ServerName; got != "example.com" {
+		t.Errorf("ServerName = %q, want it to default to %q", got, "example.com")
+	}
+}
+
+func TestTLSForwarderBackend_NewTLSForwarderBackend_InvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	testCert := generateTestCertificate(t, dir, "localhost")
+
+	emptyFile := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(emptyFile, nil, 0o600); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		conf config.TLSForwarderBackendConfig
+	}{
+		{name: "targetAddr without port", conf: config.TLSForwarderBackendConfig{TargetAddr: "localhost"}},
+		{name: "missing CA bundle", conf: config.TLSForwarderBackendConfig{CAFile: filepath.Join(dir, "missing.pem")}},
+		{name: "empty CA bundle", conf: config.TLSForwarderBackendConfig{CAFile: emptyFile}},
+		{name: "certFile without keyFile", conf: config.TLSForwarderBackendConfig{CertFile: testCert.certFile}},
+		{name: "pin no base64", conf: config.TLSForwarderBackendConfig{PinnedSPKI: []string{"not base64!"}}},
+		{name: "pin no sha256", conf: config.TLSForwarderBackendConfig{PinnedSPKI: []string{"AAAA"}}},
+		{name: "skipVerify without pins", conf: config.TLSForwarderBackendConfig{SkipVerify: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Name = "test-tls-forwarder"
+			if tt.conf.TargetAddr == "" {
+				tt.conf.TargetAddr = "localhost:443"
+			}
+
+			if _, err := newTLSForwarderBackend(tt.conf); err == nil {
+				t.Error("expected newTLSForwarderBackend() to fail")
+			}
+		})
+	}
+}
+
+func TestTLSForwarderBackend_Handle_ForwardsOverTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := generateTestCertificate(t, dir, "target.test")
+	clientCert := generateTestCertificate(t, dir, "client.test")
+
+	targetAddr, states := startTestTLSTarget(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert.certificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCert.pool,
+		NextProtos:   []string{"imap"},
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	backend, err := newTLSForwarderBackend(config.TLSForwarderBackendConfig{
+		Name:       "test-tls-forwarder",
+		TargetAddr: targetAddr,
+		ServerName: "target.test",
+		CAFile:     serverCert.certFile,
+		CertFile:   clientCert.certFile,
+		KeyFile:    clientCert.keyFile,
+		PinnedSPKI: []string{clientCert.spkiPin, serverCert.spkiPin},
+		ALPN:       []string{"imap"},
+	})
+	if err != nil {
+		t.Fatalf("newTLSForwarderBackend() failed: %v", err)
+	}
+	defer backend.Close()
+
+	incomingConn, testConn := net.Pipe()
+	defer testConn.Close()
+
+	go backend.Handle(incomingConn)
+
+	if _, err = testConn.Write([]byte("ping")); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+
+	answer := make([]byte, 4)
+	if _, err = io.ReadFull(testConn, answer); err != nil || string(answer) != "ping" {
+		t.Errorf("got answer %q, %v, want %q", answer, err, "ping")
+	}
+
+	state := <-states
+	if state.ServerName != "target.test" || state.NegotiatedProtocol != "imap" || len(state.PeerCertificates) != 1 {
+		t.Errorf(
+			"target saw server name %q, alpn %q and %d client certificates, want %q, %q and 1",
+			state.ServerName, state.NegotiatedProtocol, len(state.PeerCertificates), "target.test", "imap",
+		)
+	}
+}
+
+func TestTLSForwarderBackend_Handshake_DescribesFailures(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := generateTestCertificate(t, dir, "target.test")
+	otherCert := generateTestCertificate(t, dir, "other.test")
+
+	targetAddr, _ := startTestTLSTarget(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert.certificate},
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	// TLS 1.2 makes the target reject missing client certificates during the handshake
+	mTLSTargetAddr, _ := startTestTLSTarget(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert.certificate},
+		ClientAuth:   tls.RequireAnyClientCert,
+		MinVersion:   tls.VersionTLS12,
+		MaxVersion:   tls.VersionTLS12,
+	})
+
+	plainTargetAddr := startTestLineServer(t, "SSH-2.0-OpenSSH_9.6\r\n")
+
+	tests := []struct {
+		name    string
+		conf    config.TLSForwarderBackendConfig
+		wantErr string
+	}{
+		{
+			name:    "unknown CA",
+			conf:    config.TLSForwarderBackendConfig{TargetAddr: targetAddr, ServerName: "target.test"},
+			wantErr: "isn't signed by a trusted CA",
+		},
+		{
+			name:    "wrong server name",
+			conf:    config.TLSForwarderBackendConfig{TargetAddr: targetAddr, ServerName: "other.test", CAFile: serverCert.certFile},
+			wantErr: "isn't valid for server name 'other.test'",
+		},
+		{
+			name: "pin mismatch",
+			conf: config.TLSForwarderBackendConfig{
+				TargetAddr: targetAddr,
+				PinnedSPKI: []string{otherCert.spkiPin},
+				SkipVerify: true,
+			},
+			wantErr: "pinned SPKI hashes",
+		},
+		{
+			name: "missing client certificate",
+			conf: config.TLSForwarderBackendConfig{
+				TargetAddr: mTLSTargetAddr,
+				ServerName: "target.test",
+				CAFile:     serverCert.certFile,
+			},
+			wantErr: "target rejected the handshake",
+		},
+		{
+			name:    "no TLS",
+			conf:    config.TLSForwarderBackendConfig{TargetAddr: plainTargetAddr},
+			wantErr: "target doesn't speak TLS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Name = "test-tls-forwarder"
+
+			backend, err := newTLSForwarderBackend(tt.conf)
+			if err != nil {
+				t.Fatalf("newTLSForwarderBackend() failed: %v", err)
+			}
+
+			connectionToTarget, err := net.Dial("tcp", tt.conf.TargetAddr)
+			if err != nil {
+				t.Fatalf("could not dial target: %v", err)
+			}
+			defer connectionToTarget.Close()
+
+			// The plain target only answers after receiving a line
+			if tt.conf.TargetAddr == plainTargetAddr {
+				connectionToTarget.Write([]byte("\n"))
+			}
+
+			if _, err = backend.handshake(connectionToTarget); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("handshake() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSForwarderBackend_Handle_ReportsFailedHandshake(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := generateTestCertificate(t, dir, "target.test")
+
+	targetAddr, _ := startTestTLSTarget(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert.certificate},
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	backend, err := newTLSForwarderBackend(config.TLSForwarderBackendConfig{
+		Name:       "test-tls-forwarder",
+		TargetAddr: targetAddr,
+		ServerName: "target.test",
+	})
+	if err != nil {
+		t.Fatalf("newTLSForwarderBackend() failed: %v", err)
+	}
+
+	incomingConn, testConn := net.Pipe()
+	defer testConn.Close()
+
+	reportingConn := &dialFailureConn{Conn: incomingConn}
+	go backend.Handle(reportingConn)
+
+	if _, err = testConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF after failed handshake, got: %v", err)
+	}
+
+	if reportingConn.reportedDialFailures != 1 {
+		t.Errorf("reported %d dial failures, want 1", reportingConn.reportedDialFailures)
+	}
+}
+
+func TestTLSForwarderBackend_Handle_DialFails(t *testing.T) {
+	backend, err := newTLSForwarderBackend(config.TLSForwarderBackendConfig{
+		Name:       "test-tls-forwarder",
+		TargetAddr: "192.168.0.2:993",
+	})
+	if err != nil {
+		t.Fatalf("newTLSForwarderBackend() failed: %v", err)
+	}
+
+	backend.dialer = &mockDialer{
+		mockDialTimeout: func(_, address string, _ time.Duration) (net.Conn, error) {
+			if address != "192.168.0.2:993" {
+				t.Errorf("dialed %q, want %q", address, "192.168.0.2:993")
+			}
+
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	incomingConn, testConn := net.Pipe()
+	defer testConn.Close()
+
+	reportingConn := &dialFailureConn{Conn: incomingConn}
+	backend.Handle(reportingConn)
+
+	if reportingConn.reportedDialFailures != 1 {
+		t.Errorf("reported %d dial failures, want 1", reportingConn.reportedDialFailures)
+	}
+}
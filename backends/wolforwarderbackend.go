@@ -16,6 +16,7 @@ const wolDialTimeout = 2 * time.Second
 const wolTimeAfterMagicPacket = 5 * time.Second
 const wolMaxDialRetryCount = 50
 const wolTimeBetweenRetries = 500 * time.Millisecond
+const wolPacketResendInterval = 30 * time.Second
 
 type wolForwarderBackend struct {
 	name              string
@@ -25,6 +26,9 @@ type wolForwarderBackend struct {
 	targetAddr        string
 	dialer            dialer
 	sleeper           sleeper
+	wolSentMutex      sync.Mutex
+	wolSentAt         time.Time
+	proxyHeader       *proxyHeaderWriter
 }
 
 // newWoLForwarderBackend creates a new instance of wolForwarderBackend, preparing it with all necessary dependencies.
@@ -34,13 +38,24 @@ func newWoLForwarderBackend(conf config.WoLForwarderBackendConfig) (*wolForwarde
 		return nil, fmt.Errorf("could not create WoL helper: %w", err)
 	}
 
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options: %w", err)
+	}
+
+	proxyHeader, err := newProxyHeaderWriter(conf.SendProxyProtocolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy protocol options: %w", err)
+	}
+
 	return &wolForwarderBackend{
 		name:              conf.Name,
 		activeConnections: list.New(),
 		wolSender:         wolHelper,
 		targetAddr:        conf.TargetAddr,
-		dialer:            defaultDialer{},
+		dialer:            defaultDialer{socketOptions: socketOptions},
 		sleeper:           defaultSleeper{},
+		proxyHeader:       proxyHeader,
 	}, nil
 }
 
@@ -68,18 +83,24 @@ func (be *wolForwarderBackend) Close() error {
 }
 
 // Handle handles given connection by trying to dial the target host. If the target host is reachable,
-// a pipe will get generated, else the connection gets closed.
+// a pipe will get generated, else the connection gets closed. If the connection asks for a specific target port,
+// that port is used instead of the configured one. If configured, a PROXY protocol header gets sent to the target
+// before piping starts.
 // Handle takes ownership of given connection.
 func (be *wolForwarderBackend) Handle(connection net.Conn) {
-	connectionToTarget, err := be.tryDial()
+	targetAddr := helper.TargetAddr(connection, be.targetAddr)
+
+	connectionToTarget, err := be.tryDial(targetAddr)
 	if err != nil {
 		slog.Info(
 			"backend could not connect to target",
-			slog.String("targetAddr", be.targetAddr),
+			slog.String("targetAddr", targetAddr),
 			slog.String("name", be.name),
 			slog.Any("error", err),
 		)
 
+		helper.ReportDialFailure(connection)
+
 		if err = connection.Close(); err != nil {
 			slog.Warn("could not properly close incoming connection after dialer timeout", slog.Any("error", err))
 		}
@@ -87,6 +108,67 @@ func (be *wolForwarderBackend) Handle(connection net.Conn) {
 		return
 	}
 
+	if err = be.proxyHeader.write(connectionToTarget, connection); err != nil {
+		slog.Info("backend could not send proxy protocol header", slog.String("name", be.name), slog.Any("error", err))
+
+		if err = connectionToTarget.Close(); err != nil {
+			slog.Debug("could not properly close target connection", slog.Any("error", err))
+		}
+
+		helper.ReportDialFailure(connection)
+
+		if err = connection.Close(); err != nil {
+			slog.Warn("could not properly close incoming connection", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	be.pipe(connection, connectionToTarget)
+}
+
+// HandlePacket handles given datagram connection by forwarding it to the target host via udp. Because
+// a udp dial can't tell whether the target is awake, a wake-on-lan magic-packet gets sent for new
+// connections right away (at most once per wolPacketResendInterval) and forwarding starts immediately.
+// Datagrams sent while the target is still asleep are lost, so clients are expected to retransmit.
+// HandlePacket takes ownership of given connection.
+func (be *wolForwarderBackend) HandlePacket(connection net.Conn) {
+	be.wolSentMutex.Lock()
+	if time.Since(be.wolSentAt) >= wolPacketResendInterval {
+		if err := be.wolSender.SendWoLPacket(); err != nil {
+			slog.Warn("could not send wol magic paket", slog.String("name", be.name), slog.Any("error", err))
+		} else {
+			be.wolSentAt = time.Now()
+		}
+	}
+	be.wolSentMutex.Unlock()
+
+	targetAddr := helper.TargetAddr(connection, be.targetAddr)
+
+	connectionToTarget, err := be.dialer.DialTimeout("udp", targetAddr, wolDialTimeout)
+	if err != nil {
+		slog.Info(
+			"backend could not connect to target",
+			slog.String("targetAddr", targetAddr),
+			slog.String("network", "udp"),
+			slog.String("name", be.name),
+			slog.Any("error", err),
+		)
+
+		helper.ReportDialFailure(connection)
+
+		if err = connection.Close(); err != nil {
+			slog.Warn("could not properly close incoming connection after dialer timeout", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	be.pipe(connection, connectionToTarget)
+}
+
+// pipe creates a pipe between given connections and tracks it as active connection until it gets closed.
+func (be *wolForwarderBackend) pipe(connection net.Conn, connectionToTarget net.Conn) {
 	pipeHelper := helper.NewPipeHelper(connection, connectionToTarget)
 
 	be.connectionsMutex.Lock()
@@ -101,18 +183,18 @@ func (be *wolForwarderBackend) Handle(connection net.Conn) {
 	})
 }
 
-// tryDial tries to dial the target host. If successful, the generated connection gets returned. Otherwise
-// a wake-on-lan magic-packet is sent and we try to connect to the target host for some time. If a connection
-// is establised, we return it, else we return an error.
-func (be *wolForwarderBackend) tryDial() (net.Conn, error) {
+// tryDial tries to dial the target host at given address. If successful, the generated connection gets returned.
+// Otherwise a wake-on-lan magic-packet is sent and we try to connect to the target host for some time. If a
+// connection is establised, we return it, else we return an error.
+func (be *wolForwarderBackend) tryDial(targetAddr string) (net.Conn, error) {
 	// First, try a quick connection to see if target is already awake
-	targetConnection, err := be.dialer.DialTimeout("tcp", be.targetAddr, wolDialTimeout)
+	targetConnection, err := be.dialer.DialTimeout("tcp", targetAddr, wolDialTimeout)
 	if err == nil {
 		return targetConnection, nil
 	}
 
 	// Target is unreachable - send WoL packet and retry
-	slog.Debug("failed to connect to host, sending wol to wake it up", slog.String("targetAddr", be.targetAddr))
+	slog.Debug("failed to connect to host, sending wol to wake it up", slog.String("targetAddr", targetAddr))
 	err = be.wolSender.SendWoLPacket()
 	if err != nil {
 		return nil, fmt.Errorf("could not send wol magic paket: %w", err)
@@ -123,14 +205,14 @@ func (be *wolForwarderBackend) tryDial() (net.Conn, error) {
 
 	// Then we retry for something ~2min, else we give up.
 	for i := range wolMaxDialRetryCount {
-		slog.Debug("trying to connect to host", slog.String("targetAddr", be.targetAddr), slog.Int("retryCount", i))
+		slog.Debug("trying to connect to host", slog.String("targetAddr", targetAddr), slog.Int("retryCount", i))
 
 		be.sleeper.Sleep(wolTimeBetweenRetries)
-		targetConnection, err = be.dialer.DialTimeout("tcp", be.targetAddr, wolDialTimeout)
+		targetConnection, err = be.dialer.DialTimeout("tcp", targetAddr, wolDialTimeout)
 		if err == nil {
 			return targetConnection, nil
 		}
 	}
 
-	return nil, fmt.Errorf("timeout while waiting for target with addr '%s'", be.targetAddr)
+	return nil, fmt.Errorf("timeout while waiting for target with addr '%s'", targetAddr)
 }
@@ -57,7 +57,7 @@ func TestWoLForwarderBackend_TryDial_TargetAlreadyAwake(t *testing.T) {
 	backend.wolSender = mockWoL
 
 	// Call tryDial
-	conn, err := backend.tryDial()
+	conn, err := backend.tryDial(backend.targetAddr)
 
 	// Should succeed immediately
 	if err != nil {
@@ -116,7 +116,7 @@ func TestWoLForwarderBackend_TryDial_WakesTargetAndSucceeds(t *testing.T) {
 	backend.sleeper = mockSleeper
 	backend.wolSender = mockWoL
 
-	conn, err := backend.tryDial()
+	conn, err := backend.tryDial(backend.targetAddr)
 
 	// Should succeed
 	if err != nil {
@@ -176,7 +176,7 @@ func TestWoLForwarderBackend_TryDial_WoLSendFails(t *testing.T) {
 	backend.sleeper = mockSleeper
 	backend.wolSender = mockWoL
 
-	conn, err := backend.tryDial()
+	conn, err := backend.tryDial(backend.targetAddr)
 
 	// Should fail
 	if err == nil {
@@ -223,7 +223,7 @@ func TestWoLForwarderBackend_TryDial_TimeoutAfterRetries(t *testing.T) {
 	backend.sleeper = mockSleeper
 	backend.wolSender = mockWoL
 
-	conn, err := backend.tryDial()
+	conn, err := backend.tryDial(backend.targetAddr)
 
 	// Should fail with timeout
 	if err == nil {
@@ -418,3 +418,93 @@ func TestWoLForwarderBackend_Handle_DialFailure(t *testing.T) {
 		t.Errorf("expected 0 bytes read, got %d", n)
 	}
 }
+
+func TestWoLForwarderBackend_HandlePacket_SendsWoLOncePerInterval(t *testing.T) {
+	dialedNetworks := make(chan string, 2)
+	mockDialer := &mockDialer{
+		mockDialTimeout: func(network, _ string, _ time.Duration) (net.Conn, error) {
+			dialedNetworks <- network
+			targetBackendEnd, targetClientEnd := net.Pipe()
+			targetClientEnd.Close()
+			return targetBackendEnd, nil
+		},
+	}
+
+	mockSleeper := &mockSleeper{trackCalls: true}
+	mockWoL := &mockWoLSender{}
+
+	backend, err := newWoLForwarderBackend(config.WoLForwarderBackendConfig{
+		Name:             "test-wol",
+		TargetAddr:       "127.0.0.8:51820",
+		WoLMACAddr:       "00:11:22:33:44:55",
+		WoLBroadcastAddr: "255.255.255.255:9",
+	})
+	if err != nil {
+		t.Fatalf("newWoLForwarderBackend() failed: %v", err)
+	}
+	backend.dialer = mockDialer
+	backend.sleeper = mockSleeper
+	backend.wolSender = mockWoL
+
+	for range 2 {
+		incomingBackendConn, incomingTestConn := net.Pipe()
+		defer incomingTestConn.Close()
+
+		backend.HandlePacket(incomingBackendConn)
+	}
+
+	for range 2 {
+		if network := <-dialedNetworks; network != "udp" {
+			t.Errorf("dial network = %q, want %q", network, "udp")
+		}
+	}
+
+	// Only the first session should have sent a magic packet
+	if mockWoL.sendCount != 1 {
+		t.Errorf("WoL send count = %d, want 1", mockWoL.sendCount)
+	}
+
+	// Forwarding datagrams must not wait for the target to come up
+	if len(mockSleeper.sleepCalls) != 0 {
+		t.Errorf("sleep called %d times, want 0", len(mockSleeper.sleepCalls))
+	}
+}
+
+func TestWoLForwarderBackend_Handle_SendsProxyProtocolHeader(t *testing.T) {
+	targetBackendEnd, targetClientEnd := net.Pipe()
+	defer targetClientEnd.Close()
+
+	backend, err := newWoLForwarderBackend(config.WoLForwarderBackendConfig{
+		Name:                    "test-wol",
+		TargetAddr:              "127.0.0.6:80",
+		WoLMACAddr:              "00:11:22:33:44:55",
+		WoLBroadcastAddr:        "255.255.255.255:9",
+		SendProxyProtocolConfig: config.SendProxyProtocolConfig{SendProxyProtocol: "v1"},
+	})
+	if err != nil {
+		t.Fatalf("newWoLForwarderBackend() failed: %v", err)
+	}
+	defer backend.Close()
+
+	backend.dialer = &mockDialer{
+		mockDialTimeout: func(_, _ string, _ time.Duration) (net.Conn, error) {
+			return targetBackendEnd, nil
+		},
+	}
+
+	incomingBackendConn, incomingTestConn := net.Pipe()
+	defer incomingTestConn.Close()
+
+	connection := newProxyTestConn("192.0.2.1:51000", "198.51.100.1:80")
+	connection.Conn = incomingBackendConn
+
+	go backend.Handle(connection)
+	go incomingTestConn.Write([]byte("GET"))
+
+	want := "PROXY TCP4 192.0.2.1 198.51.100.1 51000 80\r\nGET"
+	received := make([]byte, len(want))
+
+	if _, err = io.ReadFull(targetClientEnd, received); err != nil || string(received) != want {
+		t.Errorf("target received %q, %v, want %q", received, err, want)
+	}
+}
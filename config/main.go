@@ -2,27 +2,289 @@ package config
 
 import (
 	"log/slog"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
+type AccessListConfig struct {
+	Allow       []string `toml:"allow"`
+	Deny        []string `toml:"deny"`
+	ResetDenied bool     `toml:"resetDenied"`
+}
+
+type ConnectionLimitsConfig struct {
+	ConnectionRate         float64 `toml:"connectionRate"`
+	ConnectionBurst        int     `toml:"connectionBurst"`
+	MaxConnections         int     `toml:"maxConnections"`
+	SourceConnectionRate   float64 `toml:"sourceConnectionRate"`
+	SourceConnectionBurst  int     `toml:"sourceConnectionBurst"`
+	SourceMaxConnections   int     `toml:"sourceMaxConnections"`
+	SourceIPv6PrefixLength int     `toml:"sourceIPv6PrefixLength"`
+}
+
+type GlobalLimitsConfig struct {
+	MaxConnections int `toml:"maxConnections"`
+}
+
+type BansConfig struct {
+	MaxRetry         int           `toml:"maxRetry"`
+	FindTime         time.Duration `toml:"findTime"`
+	BanTime          time.Duration `toml:"banTime"`
+	IPv6PrefixLength int           `toml:"ipv6PrefixLength"`
+	StateFile        string        `toml:"stateFile"`
+	ControlSocket    string        `toml:"controlSocket"`
+}
+
+type SocketOptionsConfig struct {
+	KeepAliveIdle     time.Duration `toml:"keepAliveIdle"`
+	KeepAliveInterval time.Duration `toml:"keepAliveInterval"`
+	KeepAliveCount    int           `toml:"keepAliveCount"`
+	NoDelay           *bool         `toml:"noDelay"`
+	UserTimeout       time.Duration `toml:"userTimeout"`
+	ReusePort         bool          `toml:"reusePort"`
+	FreeBind          bool          `toml:"freeBind"`
+	FastOpen          bool          `toml:"fastOpen"`
+	DeferAccept       time.Duration `toml:"deferAccept"`
+	ReceiveBufferSize int           `toml:"receiveBufferSize"`
+	SendBufferSize    int           `toml:"sendBufferSize"`
+	DSCP              int           `toml:"dscp"`
+}
+
+type SendProxyProtocolConfig struct {
+	SendProxyProtocol     string   `toml:"sendProxyProtocol"`
+	SendProxyProtocolTLVs []string `toml:"sendProxyProtocolTLVs"`
+}
+
+type ListenConfig struct {
+	BindRetryInterval    time.Duration `toml:"bindRetryInterval"`
+	BindRetryMaxInterval time.Duration `toml:"bindRetryMaxInterval"`
+	BindFailureFatal     bool          `toml:"bindFailureFatal"`
+	ReserveFD            bool          `toml:"reserveFD"`
+}
+
 type TCPFrontendConfig struct {
-	Name       string `toml:"name"`
-	ListenAddr string `toml:"listenAddr"`
+	Name                        string        `toml:"name"`
+	ListenAddr                  string        `toml:"listenAddr"`
+	ListenAddrs                 []string      `toml:"listenAddrs"`
+	KeepDestinationPort         bool          `toml:"keepDestinationPort"`
+	Target                      string        `toml:"target"`
+	ProxyProtocol               bool          `toml:"proxyProtocol"`
+	ProxyProtocolTimeout        time.Duration `toml:"proxyProtocolTimeout"`
+	ProxyProtocolTrustedSources []string      `toml:"proxyProtocolTrustedSources"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+	SocketOptionsConfig
+}
+
+type UDPFrontendConfig struct {
+	Name        string        `toml:"name"`
+	ListenAddr  string        `toml:"listenAddr"`
+	Target      string        `toml:"target"`
+	IdleTimeout time.Duration `toml:"idleTimeout"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+}
+
+type UnixFrontendConfig struct {
+	Name        string `toml:"name"`
+	SocketPath  string `toml:"socketPath"`
+	SocketMode  string `toml:"socketMode"`
+	SocketOwner string `toml:"socketOwner"`
+	SocketGroup string `toml:"socketGroup"`
+	Target      string `toml:"target"`
+
+	ConnectionLimitsConfig
+}
+
+type TLSCertificateConfig struct {
+	CertFile string `toml:"certFile"`
+	KeyFile  string `toml:"keyFile"`
+}
+
+type TLSFrontendConfig struct {
+	Name         string                 `toml:"name"`
+	ListenAddr   string                 `toml:"listenAddr"`
+	Target       string                 `toml:"target"`
+	Certificates []TLSCertificateConfig `toml:"certificates"`
+	MinVersion   string                 `toml:"minVersion"`
+	CipherSuites []string               `toml:"cipherSuites"`
+	ALPN         []string               `toml:"alpn"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+	SocketOptionsConfig
+}
+
+type SNIFrontendConfig struct {
+	Name       string            `toml:"name"`
+	ListenAddr string            `toml:"listenAddr"`
+	Routes     map[string]string `toml:"routes"`
+	Default    string            `toml:"default"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+	SocketOptionsConfig
+}
+
+type MuxRuleConfig struct {
+	Protocol string `toml:"protocol"`
+	Prefix   string `toml:"prefix"`
+	Regex    string `toml:"regex"`
+	Target   string `toml:"target"`
+}
+
+type MuxFrontendConfig struct {
+	Name       string          `toml:"name"`
+	ListenAddr string          `toml:"listenAddr"`
+	Rules      []MuxRuleConfig `toml:"rules"`
+	Timeout    time.Duration   `toml:"timeout"`
+	Default    string          `toml:"default"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+	SocketOptionsConfig
+}
+
+type HTTPRouteConfig struct {
+	Host       string `toml:"host"`
+	PathPrefix string `toml:"pathPrefix"`
 	Target     string `toml:"target"`
 }
 
+type HTTPFrontendConfig struct {
+	Name       string            `toml:"name"`
+	ListenAddr string            `toml:"listenAddr"`
+	Routes     []HTTPRouteConfig `toml:"routes"`
+	Default    string            `toml:"default"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+	SocketOptionsConfig
+}
+
+type DestinationRuleConfig struct {
+	Destination string `toml:"destination"`
+	Target      string `toml:"target"`
+}
+
+type ProxyUserConfig struct {
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+type SOCKS5FrontendConfig struct {
+	Name           string                  `toml:"name"`
+	ListenAddr     string                  `toml:"listenAddr"`
+	Rules          []DestinationRuleConfig `toml:"rules"`
+	Unmatched      string                  `toml:"unmatched"`
+	Users          []ProxyUserConfig       `toml:"users"`
+	ConnectTimeout time.Duration           `toml:"connectTimeout"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+	SocketOptionsConfig
+}
+
+type HTTPConnectFrontendConfig struct {
+	Name           string                  `toml:"name"`
+	ListenAddr     string                  `toml:"listenAddr"`
+	Rules          []DestinationRuleConfig `toml:"rules"`
+	Unmatched      string                  `toml:"unmatched"`
+	Users          []ProxyUserConfig       `toml:"users"`
+	ConnectTimeout time.Duration           `toml:"connectTimeout"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+	SocketOptionsConfig
+}
+
+type TransparentFrontendConfig struct {
+	Name       string                  `toml:"name"`
+	ListenAddr string                  `toml:"listenAddr"`
+	Mode       string                  `toml:"mode"`
+	Rules      []DestinationRuleConfig `toml:"rules"`
+	Default    string                  `toml:"default"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+	SocketOptionsConfig
+}
+
+type WebSocketRouteConfig struct {
+	Path   string `toml:"path"`
+	Target string `toml:"target"`
+}
+
+type WebSocketFrontendConfig struct {
+	Name         string                 `toml:"name"`
+	ListenAddr   string                 `toml:"listenAddr"`
+	Routes       []WebSocketRouteConfig `toml:"routes"`
+	BearerToken  string                 `toml:"bearerToken"`
+	PingInterval time.Duration          `toml:"pingInterval"`
+
+	AccessListConfig
+	ConnectionLimitsConfig
+	SocketOptionsConfig
+}
+
 type FrontendConfigs struct {
-	TCP []TCPFrontendConfig `toml:"tcp"`
+	TCP         []TCPFrontendConfig         `toml:"tcp"`
+	UDP         []UDPFrontendConfig         `toml:"udp"`
+	Unix        []UnixFrontendConfig        `toml:"unix"`
+	TLS         []TLSFrontendConfig         `toml:"tls"`
+	SNI         []SNIFrontendConfig         `toml:"sni"`
+	Mux         []MuxFrontendConfig         `toml:"mux"`
+	HTTP        []HTTPFrontendConfig        `toml:"http"`
+	SOCKS5      []SOCKS5FrontendConfig      `toml:"socks5"`
+	HTTPConnect []HTTPConnectFrontendConfig `toml:"httpConnect"`
+	Transparent []TransparentFrontendConfig `toml:"transparent"`
+	WebSocket   []WebSocketFrontendConfig   `toml:"webSocket"`
 }
 
 type EchoBackendConfig struct {
 	Name string `toml:"name"`
 }
 
+type HealthCheckConfig struct {
+	Type             string        `toml:"type"`
+	Interval         time.Duration `toml:"interval"`
+	Timeout          time.Duration `toml:"timeout"`
+	Jitter           time.Duration `toml:"jitter"`
+	Rise             int           `toml:"rise"`
+	Fall             int           `toml:"fall"`
+	Send             string        `toml:"send"`
+	Expect           string        `toml:"expect"`
+	HTTPPath         string        `toml:"httpPath"`
+	HTTPHost         string        `toml:"httpHost"`
+	HTTPExpectStatus int           `toml:"httpExpectStatus"`
+	TLSServerName    string        `toml:"tlsServerName"`
+	TLSSkipVerify    bool          `toml:"tlsSkipVerify"`
+}
+
 type TCPForwarderBackendConfig struct {
-	Name       string `toml:"name"`
-	TargetAddr string `toml:"targetAddr"`
+	Name        string             `toml:"name"`
+	TargetAddr  string             `toml:"targetAddr"`
+	HealthCheck *HealthCheckConfig `toml:"healthCheck"`
+
+	SendProxyProtocolConfig
+	SocketOptionsConfig
+}
+
+type TLSForwarderBackendConfig struct {
+	Name       string   `toml:"name"`
+	TargetAddr string   `toml:"targetAddr"`
+	ServerName string   `toml:"serverName"`
+	CAFile     string   `toml:"caFile"`
+	CertFile   string   `toml:"certFile"`
+	KeyFile    string   `toml:"keyFile"`
+	PinnedSPKI []string `toml:"pinnedSPKI"`
+	SkipVerify bool     `toml:"skipVerify"`
+	ALPN       []string `toml:"alpn"`
+
+	SocketOptionsConfig
 }
 
 type WoLForwarderBackendConfig struct {
@@ -30,17 +292,57 @@ type WoLForwarderBackendConfig struct {
 	TargetAddr       string `toml:"targetAddr"`
 	WoLMACAddr       string `toml:"wolMACAddr"`
 	WoLBroadcastAddr string `toml:"wolBroadcastAddr"`
+
+	SendProxyProtocolConfig
+	SocketOptionsConfig
+}
+
+type LoadBalancerTargetConfig struct {
+	TargetAddr     string `toml:"targetAddr"`
+	Weight         int    `toml:"weight"`
+	MaxConnections int    `toml:"maxConnections"`
+}
+
+type LoadBalancerBackendConfig struct {
+	Name        string                     `toml:"name"`
+	Strategy    string                     `toml:"strategy"`
+	Targets     []LoadBalancerTargetConfig `toml:"targets"`
+	HealthCheck *HealthCheckConfig         `toml:"healthCheck"`
+
+	SocketOptionsConfig
+}
+
+type FailoverMemberConfig struct {
+	TargetAddr string `toml:"targetAddr"`
+	Backend    string `toml:"backend"`
+}
+
+type FailoverBackendConfig struct {
+	Name          string                 `toml:"name"`
+	Members       []FailoverMemberConfig `toml:"members"`
+	Failback      string                 `toml:"failback"`
+	FailbackDelay time.Duration          `toml:"failbackDelay"`
+	HealthCheck   *HealthCheckConfig     `toml:"healthCheck"`
+
+	SocketOptionsConfig
 }
 
 type BackendConfigs struct {
 	Echo         []EchoBackendConfig         `toml:"echo"`
 	TCPForwarder []TCPForwarderBackendConfig `toml:"tcpForwarder"`
+	TLSForwarder []TLSForwarderBackendConfig `toml:"tlsForwarder"`
 	WoLForwarder []WoLForwarderBackendConfig `toml:"wolForwarder"`
+	LoadBalancer []LoadBalancerBackendConfig `toml:"loadBalancer"`
+	Failover     []FailoverBackendConfig     `toml:"failover"`
 }
 
 type Config struct {
-	Frontends FrontendConfigs `toml:"frontends"`
-	Backends  BackendConfigs  `toml:"backends"`
+	AccessControl AccessListConfig   `toml:"accessControl"`
+	Limits        GlobalLimitsConfig `toml:"limits"`
+	Bans          BansConfig         `toml:"bans"`
+	Listen        ListenConfig       `toml:"listen"`
+	Frontends     FrontendConfigs    `toml:"frontends"`
+	Backends      BackendConfigs     `toml:"backends"`
 }
 
 // LoadConfig loads the file from given path and parses it as toml file, decoding it
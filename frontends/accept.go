@@ -0,0 +1,121 @@
+package frontends
+
+import (
+	"log/slog"
+	"net"
+	"time"
+)
+
+const (
+	minAcceptRetryDelay       = 5 * time.Millisecond
+	maxAcceptRetryDelay       = time.Second
+	acceptErrorReportInterval = 10 * time.Second
+)
+
+// connectionGate decides whether a connection accepted by a frontend gets handled. Gates may wrap the connection,
+// for example to notice when it gets closed. Connections that aren't admitted have to be closed by the gate.
+type connectionGate interface {
+	admit(connection net.Conn) (net.Conn, bool)
+}
+
+// acceptErrorReporter logs accept errors with its message, but at most once per acceptErrorReportInterval, so
+// a listener failing over and over doesn't flood the log. Errors in between are only counted.
+type acceptErrorReporter struct {
+	message    string
+	addr       string
+	suppressed uint64
+	lastReport time.Time
+	now        func() time.Time
+}
+
+// report logs given accept error, or counts it if the last report is too recent.
+func (aer *acceptErrorReporter) report(err error) {
+	now := aer.now()
+	if now.Sub(aer.lastReport) < acceptErrorReportInterval {
+		aer.suppressed++
+		return
+	}
+
+	slog.Error(
+		aer.message,
+		slog.String("listenAddr", aer.addr),
+		slog.Uint64("suppressedErrors", aer.suppressed),
+		slog.Any("error", err),
+	)
+
+	aer.suppressed = 0
+	aer.lastReport = now
+}
+
+// acceptConnections accepts connections from given listener and passes each of them to handle, if all given
+// gates admit them in order.
+// acceptConnections blocks the current thread by starting an endless loop accepting new connections, and only
+// returns when accepting fails and isClosed reports that the listener got closed on purpose. All other
+// errors get logged rate limited, and the loop keeps accepting connections after an exponentially growing
+// delay. If the process runs out of file descriptors, pending connections get shed using given fdReserve,
+// which may be nil.
+func acceptConnections(
+	listener streamListener,
+	isClosed func() bool,
+	reserve *fdReserve,
+	handle func(connection net.Conn),
+	gates ...connectionGate,
+) {
+	reporter := acceptErrorReporter{
+		message:    "could not accept connection",
+		addr:       listener.Addr().String(),
+		suppressed: 0,
+		lastReport: time.Time{},
+		now:        time.Now,
+	}
+
+	var retryDelay time.Duration
+
+	for {
+		connection, err := listener.Accept()
+
+		if err != nil {
+			// Exit the loop if the listener doesn't exist anymore
+			if isClosed() {
+				return
+			}
+
+			reporter.report(err)
+
+			if isFDLimitError(err) && reserve.shed(listener) {
+				continue
+			}
+
+			retryDelay = nextAcceptRetryDelay(retryDelay)
+			time.Sleep(retryDelay)
+
+			continue
+		}
+
+		retryDelay = 0
+
+		if admittedConnection, ok := admitConnection(connection, gates); ok {
+			handle(admittedConnection)
+		}
+	}
+}
+
+// nextAcceptRetryDelay returns the delay to wait after another failed accept, given the delay waited after
+// the previous one, or 0 if the previous accept succeeded.
+func nextAcceptRetryDelay(retryDelay time.Duration) time.Duration {
+	return min(max(retryDelay*2, minAcceptRetryDelay), maxAcceptRetryDelay)
+}
+
+// admitConnection passes given connection through all given gates, and reports whether all of them admitted it.
+func admitConnection(connection net.Conn, gates []connectionGate) (net.Conn, bool) {
+	for _, gate := range gates {
+		var ok bool
+
+		connection, ok = gate.admit(connection)
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return connection, true
+}
@@ -0,0 +1,111 @@
+package frontends
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcceptErrorReporter_Report_RateLimits(t *testing.T) {
+	now := time.Now()
+	reporter := acceptErrorReporter{
+		message:    "could not accept connection",
+		addr:       "127.0.0.1:8080",
+		suppressed: 0,
+		lastReport: time.Time{},
+		now: func() time.Time {
+			return now
+		},
+	}
+
+	reporter.report(errors.New("first"))
+	if reporter.suppressed != 0 || !reporter.lastReport.Equal(now) {
+		t.Fatalf("first error didn't get reported, suppressed = %d", reporter.suppressed)
+	}
+
+	reporter.report(errors.New("second"))
+	reporter.report(errors.New("third"))
+	if reporter.suppressed != 2 {
+		t.Errorf("suppressed = %d, want 2", reporter.suppressed)
+	}
+
+	now = now.Add(acceptErrorReportInterval)
+	reporter.report(errors.New("fourth"))
+	if reporter.suppressed != 0 || !reporter.lastReport.Equal(now) {
+		t.Errorf("error after report interval didn't get reported, suppressed = %d", reporter.suppressed)
+	}
+}
+
+func TestAcceptConnections_BacksOffOnErrors(t *testing.T) {
+	var acceptCount atomic.Int64
+	var closed atomic.Bool
+
+	listener := &mockStreamListener{
+		mockAccept: func() (net.Conn, error) {
+			acceptCount.Add(1)
+			return nil, errors.New("accept failed")
+		},
+	}
+
+	acceptDone := make(chan struct{})
+	go func() {
+		acceptConnections(listener, closed.Load, nil, func(net.Conn) {
+			t.Error("handle called for failed accept")
+		})
+		close(acceptDone)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	closed.Store(true)
+
+	select {
+	case <-acceptDone:
+	case <-time.After(2 * maxAcceptRetryDelay):
+		t.Fatal("acceptConnections didn't return after listener got closed")
+	}
+
+	// With delays of 5ms, 10ms, 20ms, 40ms, ... only a handful of attempts fit into 100ms
+	if count := acceptCount.Load(); count > 10 {
+		t.Errorf("Accept() called %d times, want backoff between attempts", count)
+	}
+}
+
+func TestAcceptConnections_ResetsBackoffAfterSuccess(t *testing.T) {
+	var closed atomic.Bool
+	attempts := 0
+
+	listener := &mockStreamListener{}
+	listener.mockAccept = func() (net.Conn, error) {
+		attempts++
+
+		switch {
+		case attempts >= 20:
+			closed.Store(true)
+			return nil, net.ErrClosed
+		case attempts%2 == 0:
+			_, serverSide := net.Pipe()
+			return serverSide, nil
+		default:
+			return nil, errors.New("accept failed")
+		}
+	}
+
+	start := time.Now()
+	handled := 0
+
+	acceptConnections(listener, closed.Load, nil, func(connection net.Conn) {
+		handled++
+		connection.Close()
+	})
+
+	if handled != 9 {
+		t.Errorf("handled %d connections, want 9", handled)
+	}
+
+	// Every error follows a successful accept, so the delay never grows beyond its minimum
+	if elapsed := time.Since(start); elapsed > 20*minAcceptRetryDelay*2 {
+		t.Errorf("accepting took %v, want backoff to reset after successful accepts", elapsed)
+	}
+}
@@ -0,0 +1,181 @@
+package frontends
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+// accessRules are the parsed allow and deny lists of an access list config.
+type accessRules struct {
+	allow       []netip.Prefix
+	deny        []netip.Prefix
+	resetDenied bool
+}
+
+// newAccessRules parses the allow and deny lists of given config.
+func newAccessRules(conf config.AccessListConfig) (*accessRules, error) {
+	allow, err := parsePrefixes(conf.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allow list: %w", err)
+	}
+
+	deny, err := parsePrefixes(conf.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny list: %w", err)
+	}
+
+	return &accessRules{
+		allow:       allow,
+		deny:        deny,
+		resetDenied: conf.ResetDenied,
+	}, nil
+}
+
+// isEmpty reports whether neither an allow nor a deny list is configured.
+func (r *accessRules) isEmpty() bool {
+	return len(r.allow) == 0 && len(r.deny) == 0
+}
+
+// allows reports whether given address may connect. Denied addresses are always rejected, and if an allow list
+// is configured, only addresses on it are accepted.
+func (r *accessRules) allows(addr netip.Addr) bool {
+	if prefixesContain(r.deny, addr) {
+		return false
+	}
+
+	return len(r.allow) == 0 || prefixesContain(r.allow, addr)
+}
+
+// accessList decides which clients may connect to a frontend. It holds the rules of the frontend itself, and the
+// global default rules used if the frontend has none. Both can be replaced while the frontend is listening.
+type accessList struct {
+	frontendName string
+	mutex        sync.RWMutex
+	own          *accessRules
+	fallback     *accessRules
+}
+
+// newAccessList creates a new accessList for the frontend with given name, that allows every client until
+// rules are set.
+func newAccessList(frontendName string) *accessList {
+	return &accessList{
+		frontendName: frontendName,
+		mutex:        sync.RWMutex{},
+		own:          &accessRules{},
+		fallback:     &accessRules{},
+	}
+}
+
+// set replaces the rules of the frontend and the global default rules.
+func (al *accessList) set(own *accessRules, fallback *accessRules) {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	al.own = own
+	al.fallback = fallback
+}
+
+// rules returns the rules currently in effect.
+func (al *accessList) rules() *accessRules {
+	al.mutex.RLock()
+	defer al.mutex.RUnlock()
+
+	if al.own.isEmpty() {
+		return al.fallback
+	}
+
+	return al.own
+}
+
+// allows reports whether a client with given address may connect. Addresses that aren't IP addresses,
+// like the ones of unix sockets, are always allowed.
+func (al *accessList) allows(remoteAddr net.Addr) bool {
+	if al == nil {
+		return true
+	}
+
+	addr, ok := addrFromNetAddr(remoteAddr)
+	if !ok {
+		return true
+	}
+
+	return al.rules().allows(addr)
+}
+
+// admit reports whether given accepted connection may be handled. Denied connections get closed, with an RST
+// if configured.
+func (al *accessList) admit(connection net.Conn) (net.Conn, bool) {
+	if al.allows(connection.RemoteAddr()) {
+		return connection, true
+	}
+
+	slog.Debug(
+		"denied connection by access list",
+		slog.String("name", al.frontendName),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+	)
+
+	if tcpConnection, ok := helper.FindConn[*net.TCPConn](connection); ok && al.rules().resetDenied {
+		// A linger timeout of 0 makes the close send an RST instead of a FIN
+		if err := tcpConnection.SetLinger(0); err != nil {
+			slog.Debug("could not set linger timeout", slog.Any("error", err))
+		}
+	}
+
+	closeUnroutedConnection(connection)
+
+	return nil, false
+}
+
+// accessListConfigs returns the access list configs of all frontends supporting them by frontend name.
+func accessListConfigs(conf config.FrontendConfigs) map[string]config.AccessListConfig {
+	configs := make(map[string]config.AccessListConfig)
+
+	for _, tcpConf := range conf.TCP {
+		configs[tcpConf.Name] = tcpConf.AccessListConfig
+	}
+
+	for _, tlsConf := range conf.TLS {
+		configs[tlsConf.Name] = tlsConf.AccessListConfig
+	}
+
+	for _, sniConf := range conf.SNI {
+		configs[sniConf.Name] = sniConf.AccessListConfig
+	}
+
+	for _, muxConf := range conf.Mux {
+		configs[muxConf.Name] = muxConf.AccessListConfig
+	}
+
+	for _, httpConf := range conf.HTTP {
+		configs[httpConf.Name] = httpConf.AccessListConfig
+	}
+
+	for _, socks5Conf := range conf.SOCKS5 {
+		configs[socks5Conf.Name] = socks5Conf.AccessListConfig
+	}
+
+	for _, httpConnectConf := range conf.HTTPConnect {
+		configs[httpConnectConf.Name] = httpConnectConf.AccessListConfig
+	}
+
+	for _, transparentConf := range conf.Transparent {
+		configs[transparentConf.Name] = transparentConf.AccessListConfig
+	}
+
+	for _, webSocketConf := range conf.WebSocket {
+		configs[webSocketConf.Name] = webSocketConf.AccessListConfig
+	}
+
+	for _, udpConf := range conf.UDP {
+		configs[udpConf.Name] = udpConf.AccessListConfig
+	}
+
+	return configs
+}
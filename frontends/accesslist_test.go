@@ -0,0 +1,169 @@
+package frontends
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+func TestAccessRules_Allows(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.AccessListConfig
+		addr string
+		want bool
+	}{
+		{name: "no lists", conf: config.AccessListConfig{}, addr: "203.0.113.1", want: true},
+		{name: "allowed", conf: config.AccessListConfig{Allow: []string{"192.168.0.0/16"}}, addr: "192.168.1.1", want: true},
+		{name: "not allowed", conf: config.AccessListConfig{Allow: []string{"192.168.0.0/16"}}, addr: "203.0.113.1", want: false},
+		{name: "denied", conf: config.AccessListConfig{Deny: []string{"203.0.113.0/24"}}, addr: "203.0.113.1", want: false},
+		{name: "not denied", conf: config.AccessListConfig{Deny: []string{"203.0.113.0/24"}}, addr: "198.51.100.1", want: true},
+		{
+			name: "deny wins over allow",
+			conf: config.AccessListConfig{Allow: []string{"192.168.0.0/16"}, Deny: []string{"192.168.1.13"}},
+			addr: "192.168.1.13",
+			want: false,
+		},
+		{name: "ipv6", conf: config.AccessListConfig{Allow: []string{"fd00::/8"}}, addr: "fd00::1", want: true},
+		{name: "ipv4 mapped ipv6", conf: config.AccessListConfig{Allow: []string{"192.168.0.0/16"}}, addr: "::ffff:192.168.1.1", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := newAccessRules(tt.conf)
+			if err != nil {
+				t.Fatalf("newAccessRules() failed: %v", err)
+			}
+
+			if got := rules.allows(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("allows(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessRules_NewAccessRules_InvalidConfig(t *testing.T) {
+	if _, err := newAccessRules(config.AccessListConfig{Allow: []string{"not-a-cidr"}}); err == nil {
+		t.Error("expected newAccessRules() to fail for invalid allow list")
+	}
+
+	if _, err := newAccessRules(config.AccessListConfig{Deny: []string{"192.168.0.0/33"}}); err == nil {
+		t.Error("expected newAccessRules() to fail for invalid deny list")
+	}
+}
+
+func TestAccessList_Allows_UsesFallbackWithoutOwnRules(t *testing.T) {
+	ownRules, _ := newAccessRules(config.AccessListConfig{Allow: []string{"192.168.0.0/16"}})
+	fallbackRules, _ := newAccessRules(config.AccessListConfig{Deny: []string{"0.0.0.0/0"}})
+
+	list := newAccessList("test-frontend")
+	clientAddr := &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 40000}
+
+	if !list.allows(clientAddr) {
+		t.Error("new accessList has to allow every client")
+	}
+
+	list.set(&accessRules{}, fallbackRules)
+	if list.allows(clientAddr) {
+		t.Error("accessList without own rules has to use the fallback rules")
+	}
+
+	list.set(ownRules, fallbackRules)
+	if !list.allows(clientAddr) {
+		t.Error("accessList with own rules has to ignore the fallback rules")
+	}
+
+	if !list.allows(&net.UnixAddr{Name: "/run/pluggo.sock", Net: "unix"}) {
+		t.Error("accessList has to allow clients without IP address")
+	}
+
+	if !(*accessList)(nil).allows(clientAddr) {
+		t.Error("nil accessList has to allow every client")
+	}
+}
+
+func TestAccessList_Admit_ResetsDeniedConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not create tcp listener: %v", err)
+	}
+	defer listener.Close()
+
+	denyRules, _ := newAccessRules(config.AccessListConfig{Deny: []string{"127.0.0.0/8"}, ResetDenied: true})
+	list := newAccessList("test-frontend")
+	list.set(denyRules, &accessRules{})
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial listener: %v", err)
+	}
+	defer clientConn.Close()
+
+	serverConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("could not accept connection: %v", err)
+	}
+
+	if _, ok := list.admit(serverConn); ok {
+		t.Fatal("admit() = true, want false for denied client")
+	}
+
+	clientConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = clientConn.Read(make([]byte, 1)); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("expected connection reset, got: %v", err)
+	}
+}
+
+func TestFrontendList_UpdateAccessLists(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	tcpConf := config.TCPFrontendConfig{Name: "tcp-frontend", ListenAddr: "127.0.0.1:8080", Target: "test-backend"}
+	tcpFrontend, err := newTCPFrontend(tcpConf, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	frontendList := &FrontendList{list: map[string]Frontend{"tcp-frontend": tcpFrontend}}
+	lanClient := &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 40000}
+	internetClient := &net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 40000}
+
+	tcpConf.Allow = []string{"192.168.0.0/16"}
+	err = frontendList.UpdateAccessLists(&config.Config{Frontends: config.FrontendConfigs{TCP: []config.TCPFrontendConfig{tcpConf}}})
+	if err != nil {
+		t.Fatalf("UpdateAccessLists() failed: %v", err)
+	}
+
+	if !tcpFrontend.accessList.allows(lanClient) || tcpFrontend.accessList.allows(internetClient) {
+		t.Error("UpdateAccessLists() did not apply the access list of the frontend")
+	}
+
+	// Invalid configs must not replace any access list
+	tcpConf.Allow = []string{"not-a-cidr"}
+	err = frontendList.UpdateAccessLists(&config.Config{Frontends: config.FrontendConfigs{TCP: []config.TCPFrontendConfig{tcpConf}}})
+	if err == nil {
+		t.Fatal("expected UpdateAccessLists() to fail for invalid config")
+	}
+
+	if !tcpFrontend.accessList.allows(lanClient) || tcpFrontend.accessList.allows(internetClient) {
+		t.Error("failed UpdateAccessLists() changed the access list of the frontend")
+	}
+
+	// Frontends without own lists use the global default
+	tcpConf.Allow = nil
+	err = frontendList.UpdateAccessLists(&config.Config{
+		AccessControl: config.AccessListConfig{Deny: []string{"192.168.0.0/16"}},
+		Frontends:     config.FrontendConfigs{TCP: []config.TCPFrontendConfig{tcpConf}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateAccessLists() failed: %v", err)
+	}
+
+	if tcpFrontend.accessList.allows(lanClient) || !tcpFrontend.accessList.allows(internetClient) {
+		t.Error("UpdateAccessLists() did not apply the global default")
+	}
+}
@@ -0,0 +1,149 @@
+package frontends
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	banControlSocketMode        = 0o600
+	banControlConnectionTimeout = 10 * time.Second
+	banControlMaxCommandLength  = 256
+)
+
+// banControl serves a unix socket to list and remove the bans of a banList at runtime. Every connection sends a
+// single command line and gets the answer, before the connection gets closed. Supported commands are "list",
+// answered with one "<source> <until> <reason>" line per ban, and "unban <address or CIDR>".
+type banControl struct {
+	socketPath    string
+	bans          *banList
+	listenerMutex sync.RWMutex
+	listener      streamListener
+}
+
+// newBanControl creates a new banControl serving given banList on a unix socket at given path.
+func newBanControl(socketPath string, bans *banList) *banControl {
+	return &banControl{
+		socketPath:    socketPath,
+		bans:          bans,
+		listenerMutex: sync.RWMutex{},
+		listener:      nil,
+	}
+}
+
+// Listen removes a stale socket left behind by a previous run, creates the unix socket only accessible by the
+// current user, and starts serving commands.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+func (bc *banControl) Listen() error {
+	if err := removeStaleSocket(bc.socketPath); err != nil {
+		return fmt.Errorf("can't listen on '%s' for ban control: %w", bc.socketPath, err)
+	}
+
+	bc.listenerMutex.Lock()
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: bc.socketPath, Net: "unix"})
+	if err == nil {
+		bc.listener = listener
+	}
+	bc.listenerMutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("can't listen on '%s' for ban control: %w", bc.socketPath, err)
+	}
+
+	if err = os.Chmod(bc.socketPath, banControlSocketMode); err != nil {
+		return fmt.Errorf("could not change mode of ban control socket: %w", err)
+	}
+
+	slog.Info("ban control started listening", slog.String("socketPath", bc.socketPath))
+
+	acceptConnections(listener, bc.isClosed, nil, func(connection net.Conn) {
+		go bc.serve(connection)
+	})
+
+	return nil
+}
+
+// isClosed reports whether the listener got closed, or never was created.
+func (bc *banControl) isClosed() bool {
+	bc.listenerMutex.RLock()
+	defer bc.listenerMutex.RUnlock()
+
+	return bc.listener == nil
+}
+
+// Close closes the listening instance if existing and removes the socket file.
+func (bc *banControl) Close() error {
+	bc.listenerMutex.Lock()
+	defer func() {
+		bc.listener = nil
+		bc.listenerMutex.Unlock()
+	}()
+
+	if bc.listener == nil {
+		return nil
+	}
+
+	if err := bc.listener.Close(); err != nil {
+		return fmt.Errorf("ban control could not close listener: %w", err)
+	}
+
+	if err := os.Remove(bc.socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("ban control could not remove socket '%s': %w", bc.socketPath, err)
+	}
+
+	return nil
+}
+
+// serve reads a single command from given connection, writes the answer and closes the connection.
+func (bc *banControl) serve(connection net.Conn) {
+	defer connection.Close()
+
+	if err := connection.SetDeadline(time.Now().Add(banControlConnectionTimeout)); err != nil {
+		slog.Debug("could not set deadline of ban control connection", slog.Any("error", err))
+	}
+
+	scanner := bufio.NewScanner(connection)
+	scanner.Buffer(make([]byte, 0, banControlMaxCommandLength), banControlMaxCommandLength)
+
+	if !scanner.Scan() {
+		return
+	}
+
+	if _, err := connection.Write([]byte(bc.execute(scanner.Text()))); err != nil {
+		slog.Debug("could not write ban control answer", slog.Any("error", err))
+	}
+}
+
+// execute executes given command line and returns the answer, ending with a newline.
+func (bc *banControl) execute(commandLine string) string {
+	fields := strings.Fields(commandLine)
+	if len(fields) == 0 {
+		return "error: empty command\n"
+	}
+
+	switch {
+	case fields[0] == "list" && len(fields) == 1:
+		var answer strings.Builder
+		for _, entry := range bc.bans.list() {
+			fmt.Fprintf(&answer, "%s %s %s\n", entry.Source, entry.Until.Format(time.RFC3339), entry.Reason)
+		}
+
+		return answer.String()
+	case fields[0] == "unban" && len(fields) == 2:
+		source, err := bc.bans.unban(fields[1])
+		if err != nil {
+			return fmt.Sprintf("error: %v\n", err)
+		}
+
+		return fmt.Sprintf("unbanned %s\n", source)
+	default:
+		return fmt.Sprintf("error: unknown command '%s', use 'list' or 'unban <address or CIDR>'\n", commandLine)
+	}
+}
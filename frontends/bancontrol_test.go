@@ -0,0 +1,103 @@
+package frontends
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// sendTestBanCommand sends given command to the ban control socket at given path, and returns the answer.
+func sendTestBanCommand(t *testing.T, socketPath string, command string) string {
+	t.Helper()
+
+	connection, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("could not dial ban control: %v", err)
+	}
+	defer connection.Close()
+
+	connection.Write([]byte(command + "\n"))
+	connection.SetReadDeadline(time.Now().Add(time.Second))
+
+	answer, err := io.ReadAll(connection)
+	if err != nil {
+		t.Fatalf("could not read answer: %v", err)
+	}
+
+	return string(answer)
+}
+
+func TestBanControl_Execute(t *testing.T) {
+	bans, _ := newTestBanList(t, config.BansConfig{MaxRetry: 1})
+	bans.strike(netip.MustParsePrefix("192.0.2.1/32"), banReasonEmptyConnection)
+
+	control := newBanControl("", bans)
+
+	tests := []struct {
+		name       string
+		command    string
+		wantPrefix string
+	}{
+		{name: "list", command: "list", wantPrefix: "192.0.2.1/32 "},
+		{name: "unban", command: "unban 192.0.2.1", wantPrefix: "unbanned 192.0.2.1/32\n"},
+		{name: "unban again", command: "unban 192.0.2.1", wantPrefix: "error: "},
+		{name: "list after unban", command: "list", wantPrefix: ""},
+		{name: "unknown command", command: "ban 192.0.2.1", wantPrefix: "error: unknown command"},
+		{name: "empty command", command: " ", wantPrefix: "error: empty command"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer := control.execute(tt.command)
+			if !strings.HasPrefix(answer, tt.wantPrefix) || (tt.wantPrefix == "" && answer != "") {
+				t.Errorf("execute(%q) = %q, want prefix %q", tt.command, answer, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestBanControl_Listen(t *testing.T) {
+	bans, _ := newTestBanList(t, config.BansConfig{MaxRetry: 1})
+	bans.strike(netip.MustParsePrefix("2001:db8::/64"), banReasonDialFailure)
+
+	socketPath := filepath.Join(t.TempDir(), "control.sock")
+	control := newBanControl(socketPath, bans)
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- control.Listen()
+	}()
+
+	// Wait for the socket to appear
+	deadline := time.Now().Add(time.Second)
+	for control.isClosed() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	answer := sendTestBanCommand(t, socketPath, "list")
+	if !strings.HasPrefix(answer, "2001:db8::/64 ") || !strings.HasSuffix(answer, " dialFailure\n") {
+		t.Errorf("got answer %q, want ban of 2001:db8::/64", answer)
+	}
+
+	if answer = sendTestBanCommand(t, socketPath, "unban 2001:db8::/64"); answer != "unbanned 2001:db8::/64\n" {
+		t.Errorf("got answer %q, want confirmation", answer)
+	}
+
+	if err := control.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	if err := <-listenDone; err != nil {
+		t.Errorf("Listen() failed: %v", err)
+	}
+
+	if _, err := net.Dial("unix", socketPath); err == nil {
+		t.Error("ban control socket still accepts connections after Close()")
+	}
+}
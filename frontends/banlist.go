@@ -0,0 +1,470 @@
+package frontends
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	defaultBanFindTime         = 10 * time.Minute
+	defaultBanTime             = time.Hour
+	defaultBanIPv6PrefixLength = 64
+	banStateFileMode           = 0o600
+)
+
+// banReason is the kind of misbehaviour a source got a strike for.
+type banReason int
+
+const (
+	banReasonEmptyConnection banReason = iota
+	banReasonDialFailure
+)
+
+// String returns the name of the reason, as used in logs and the state file.
+func (r banReason) String() string {
+	switch r {
+	case banReasonEmptyConnection:
+		return "emptyConnection"
+	case banReasonDialFailure:
+		return "dialFailure"
+	default:
+		return "unknown"
+	}
+}
+
+// parseBanReason parses the name of a banReason.
+func parseBanReason(name string) (banReason, error) {
+	switch name {
+	case "emptyConnection":
+		return banReasonEmptyConnection, nil
+	case "dialFailure":
+		return banReasonDialFailure, nil
+	default:
+		return 0, fmt.Errorf("unknown ban reason '%s'", name)
+	}
+}
+
+// ban is an active ban of a source.
+type ban struct {
+	until  time.Time
+	reason banReason
+}
+
+// banEntry is a ban of a source, as listed and persisted to the state file.
+type banEntry struct {
+	Source string    `json:"source"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+}
+
+// banList bans sources that misbehave repeatedly, shared by all frontends. Sources get a strike for every
+// connection they close without sending any data, and for every connection a backend couldn't connect to its
+// target for. Sources reaching maxRetry strikes within findTime get banned for banTime. IPv6 sources are
+// grouped by a configurable prefix length, like for the connectionLimiter.
+// Bans are kept in memory, and if a state file is configured, persisted to it on every change.
+type banList struct {
+	conf      config.BansConfig
+	mutex     sync.Mutex
+	strikes   map[netip.Prefix][]time.Time
+	bans      map[netip.Prefix]ban
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// newBanList creates a new banList with given config, and loads the bans of the state file if configured.
+// FindTime, banTime and the IPv6 prefix length default to sane values if not set.
+func newBanList(conf config.BansConfig) (*banList, error) {
+	if conf.MaxRetry < 0 || conf.FindTime < 0 || conf.BanTime < 0 {
+		return nil, errors.New("maxRetry, findTime and banTime must not be negative")
+	}
+
+	if conf.FindTime == 0 {
+		conf.FindTime = defaultBanFindTime
+	}
+
+	if conf.BanTime == 0 {
+		conf.BanTime = defaultBanTime
+	}
+
+	if conf.IPv6PrefixLength == 0 {
+		conf.IPv6PrefixLength = defaultBanIPv6PrefixLength
+	}
+
+	if conf.IPv6PrefixLength < 1 || conf.IPv6PrefixLength > maxIPv6PrefixLength {
+		return nil, fmt.Errorf("invalid ipv6PrefixLength %d", conf.IPv6PrefixLength)
+	}
+
+	bl := &banList{
+		conf:      conf,
+		mutex:     sync.Mutex{},
+		strikes:   make(map[netip.Prefix][]time.Time),
+		bans:      make(map[netip.Prefix]ban),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+
+	if err := bl.load(); err != nil {
+		return nil, fmt.Errorf("could not load bans from '%s': %w", conf.StateFile, err)
+	}
+
+	return bl, nil
+}
+
+// admit reports whether the source of given accepted connection isn't banned. Admitted connections get wrapped,
+// so they can give their source strikes. Connections of banned sources get closed.
+func (bl *banList) admit(connection net.Conn) (net.Conn, bool) {
+	if !bl.isBanned(connection.RemoteAddr()) {
+		return bl.watch(connection), true
+	}
+
+	slog.Debug("rejected connection of banned source", slog.String("remoteAddr", connection.RemoteAddr().String()))
+	closeUnroutedConnection(connection)
+
+	return nil, false
+}
+
+// isBanned reports whether the source of given address is banned. Addresses that aren't IP addresses are never
+// banned.
+func (bl *banList) isBanned(remoteAddr net.Addr) bool {
+	if bl == nil {
+		return false
+	}
+
+	addr, ok := addrFromNetAddr(remoteAddr)
+	if !ok {
+		return false
+	}
+
+	source := sourcePrefix(addr, bl.conf.IPv6PrefixLength)
+
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	activeBan, exists := bl.bans[source]
+	if !exists {
+		return false
+	}
+
+	if bl.now().Before(activeBan.until) {
+		return true
+	}
+
+	delete(bl.bans, source)
+
+	return false
+}
+
+// watch wraps given connection, so it gives its source a strike if it gets closed by the client without sending
+// any data, or if a backend reports that it couldn't connect to its target for it.
+func (bl *banList) watch(connection net.Conn) net.Conn {
+	if bl == nil {
+		return connection
+	}
+
+	addr, ok := addrFromNetAddr(connection.RemoteAddr())
+	if !ok {
+		return connection
+	}
+
+	return &bannableConn{
+		Conn:    connection,
+		list:    bl,
+		source:  sourcePrefix(addr, bl.conf.IPv6PrefixLength),
+		hasRead: atomic.Bool{},
+		struck:  atomic.Bool{},
+	}
+}
+
+// strike gives given source a strike for given reason, and bans it if it reached maxRetry strikes within findTime.
+func (bl *banList) strike(source netip.Prefix, reason banReason) {
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	now := bl.now()
+	bl.sweep(now)
+
+	strikes := append(recentStrikes(bl.strikes[source], now.Add(-bl.conf.FindTime)), now)
+
+	slog.Debug(
+		"source got a strike",
+		slog.String("source", source.String()),
+		slog.String("reason", reason.String()),
+		slog.Int("strikes", len(strikes)),
+	)
+
+	if len(strikes) < bl.conf.MaxRetry {
+		bl.strikes[source] = strikes
+		return
+	}
+
+	delete(bl.strikes, source)
+	bl.bans[source] = ban{until: now.Add(bl.conf.BanTime), reason: reason}
+
+	slog.Warn(
+		"banned source",
+		slog.String("source", source.String()),
+		slog.String("reason", reason.String()),
+		slog.Duration("banTime", bl.conf.BanTime),
+	)
+
+	bl.saveLogged()
+}
+
+// list returns all active bans, ordered by the time they end.
+func (bl *banList) list() []banEntry {
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	return bl.entries(bl.now())
+}
+
+// unban removes the ban of the source given as address or CIDR. Addresses are resolved to their source first,
+// so any address of a banned IPv6 prefix unbans the whole prefix.
+func (bl *banList) unban(sourceOrAddr string) (netip.Prefix, error) {
+	var source netip.Prefix
+
+	if strings.Contains(sourceOrAddr, "/") {
+		prefix, err := netip.ParsePrefix(sourceOrAddr)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("could not parse '%s' as address or CIDR: %w", sourceOrAddr, err)
+		}
+
+		source = prefix.Masked()
+	} else {
+		addr, err := netip.ParseAddr(sourceOrAddr)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("could not parse '%s' as address or CIDR: %w", sourceOrAddr, err)
+		}
+
+		source = sourcePrefix(addr, bl.conf.IPv6PrefixLength)
+	}
+
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	if _, exists := bl.bans[source]; !exists {
+		return netip.Prefix{}, fmt.Errorf("source '%s' is not banned", source)
+	}
+
+	delete(bl.bans, source)
+	delete(bl.strikes, source)
+
+	slog.Info("unbanned source", slog.String("source", source.String()))
+
+	bl.saveLogged()
+
+	return source, nil
+}
+
+// entries returns all bans active at given time, ordered by the time they end. The mutex must be held.
+func (bl *banList) entries(now time.Time) []banEntry {
+	entries := make([]banEntry, 0, len(bl.bans))
+
+	for source, activeBan := range bl.bans {
+		if now.Before(activeBan.until) {
+			entries = append(entries, banEntry{
+				Source: source.String(),
+				Until:  activeBan.until,
+				Reason: activeBan.reason.String(),
+			})
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b banEntry) int {
+		return a.Until.Compare(b.Until)
+	})
+
+	return entries
+}
+
+// sweep forgets all expired bans and strikes, so the state doesn't grow forever. It only runs once per findTime.
+// The mutex must be held.
+func (bl *banList) sweep(now time.Time) {
+	if now.Sub(bl.lastSweep) < bl.conf.FindTime {
+		return
+	}
+
+	for source, activeBan := range bl.bans {
+		if !now.Before(activeBan.until) {
+			delete(bl.bans, source)
+		}
+	}
+
+	for source, strikes := range bl.strikes {
+		if len(recentStrikes(strikes, now.Add(-bl.conf.FindTime))) == 0 {
+			delete(bl.strikes, source)
+		}
+	}
+
+	bl.lastSweep = now
+}
+
+// load reads the bans persisted to the state file, if one is configured and exists. Expired bans get ignored.
+func (bl *banList) load() error {
+	if bl.conf.StateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(bl.conf.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []banEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	now := bl.now()
+
+	for _, entry := range entries {
+		source, parseErr := netip.ParsePrefix(entry.Source)
+		if parseErr != nil {
+			return fmt.Errorf("invalid source: %w", parseErr)
+		}
+
+		reason, parseErr := parseBanReason(entry.Reason)
+		if parseErr != nil {
+			return parseErr
+		}
+
+		if now.Before(entry.Until) {
+			bl.bans[source.Masked()] = ban{until: entry.Until, reason: reason}
+		}
+	}
+
+	return nil
+}
+
+// saveLogged persists the active bans to the state file, if one is configured. Errors only get logged, as the
+// bans stay active in memory anyway. The mutex must be held.
+func (bl *banList) saveLogged() {
+	if bl.conf.StateFile == "" {
+		return
+	}
+
+	if err := bl.save(); err != nil {
+		slog.Error("could not save bans", slog.String("stateFile", bl.conf.StateFile), slog.Any("error", err))
+	}
+}
+
+// save persists the active bans to the state file. The file gets replaced atomically, so a crash never leaves
+// a partially written file behind. The mutex must be held.
+func (bl *banList) save() error {
+	data, err := json.MarshalIndent(bl.entries(bl.now()), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(bl.conf.StateFile, data, banStateFileMode)
+}
+
+// writeFileAtomic writes given data to a temporary file next to given path, and renames it to given path
+// afterwards. That way, the file at given path is either replaced completely or not at all.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tempFile.Write(data)
+	if err == nil {
+		err = tempFile.Chmod(mode)
+	}
+
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tempFile.Name(), path)
+	}
+
+	if err != nil {
+		if removeErr := os.Remove(tempFile.Name()); removeErr != nil {
+			slog.Debug("could not remove temporary file", slog.String("path", tempFile.Name()), slog.Any("error", removeErr))
+		}
+	}
+
+	return err
+}
+
+// recentStrikes returns the strikes of given list that happened after given time. The list is ordered by time.
+func recentStrikes(strikes []time.Time, after time.Time) []time.Time {
+	for i, strike := range strikes {
+		if strike.After(after) {
+			return strikes[i:]
+		}
+	}
+
+	return nil
+}
+
+// bannableConn is a connection admitted by a banList, that gives its source a strike if the client closes it
+// without sending any data, or if a backend couldn't connect to its target for it. A connection gives at most
+// one strike.
+type bannableConn struct {
+	net.Conn
+
+	list    *banList
+	source  netip.Prefix
+	hasRead atomic.Bool
+	struck  atomic.Bool
+}
+
+// Read reads from the underlying connection, and gives a strike if the client closed it without sending any data.
+func (c *bannableConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	if n > 0 {
+		c.hasRead.Store(true)
+	} else if (errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)) && !c.hasRead.Load() {
+		c.giveStrike(banReasonEmptyConnection)
+	}
+
+	return n, err
+}
+
+// ReportDialFailure gives a strike, as a backend couldn't connect to its target for the connection.
+func (c *bannableConn) ReportDialFailure() {
+	c.giveStrike(banReasonDialFailure)
+}
+
+// CloseWrite shuts down the writing side of the underlying connection, if it supports that.
+func (c *bannableConn) CloseWrite() error {
+	if halfCloser, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return halfCloser.CloseWrite()
+	}
+
+	return errors.ErrUnsupported
+}
+
+// NetConn returns the underlying connection.
+func (c *bannableConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// giveStrike gives the source of the connection a strike for given reason, unless it already got one.
+func (c *bannableConn) giveStrike(reason banReason) {
+	if c.struck.CompareAndSwap(false, true) {
+		c.list.strike(c.source, reason)
+	}
+}
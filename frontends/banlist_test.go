@@ -0,0 +1,270 @@
+package frontends
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+// newTestBanList creates a banList with given config, whose clock is controlled by the returned function
+// advancing it.
+func newTestBanList(t *testing.T, conf config.BansConfig) (*banList, func(time.Duration)) {
+	t.Helper()
+
+	bans, err := newBanList(conf)
+	if err != nil {
+		t.Fatalf("newBanList() failed: %v", err)
+	}
+
+	now := time.Now()
+	bans.now = func() time.Time {
+		return now
+	}
+
+	return bans, func(d time.Duration) {
+		now = now.Add(d)
+	}
+}
+
+func TestBanList_NewBanList_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.BansConfig
+	}{
+		{name: "negative maxRetry", conf: config.BansConfig{MaxRetry: -1}},
+		{name: "negative banTime", conf: config.BansConfig{MaxRetry: 3, BanTime: -time.Second}},
+		{name: "prefix length too long", conf: config.BansConfig{MaxRetry: 3, IPv6PrefixLength: 129}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newBanList(tt.conf); err == nil {
+				t.Error("expected newBanList() to fail")
+			}
+		})
+	}
+}
+
+func TestBanList_Strike_BansAfterMaxRetry(t *testing.T) {
+	bans, advance := newTestBanList(t, config.BansConfig{MaxRetry: 3, FindTime: time.Minute, BanTime: time.Hour})
+	source := netip.MustParsePrefix("192.0.2.1/32")
+	clientAddr := testClientAddr("192.0.2.1")
+
+	bans.strike(source, banReasonEmptyConnection)
+	bans.strike(source, banReasonEmptyConnection)
+
+	// Strikes older than findTime don't count anymore
+	advance(2 * time.Minute)
+	bans.strike(source, banReasonEmptyConnection)
+	bans.strike(source, banReasonDialFailure)
+
+	if bans.isBanned(clientAddr) {
+		t.Fatal("isBanned() = true, want false with only two recent strikes")
+	}
+
+	bans.strike(source, banReasonDialFailure)
+	if !bans.isBanned(clientAddr) {
+		t.Fatal("isBanned() = false, want true after three strikes")
+	}
+
+	if bans.isBanned(testClientAddr("192.0.2.2")) {
+		t.Error("isBanned() = true for other source")
+	}
+
+	entries := bans.list()
+	if len(entries) != 1 || entries[0].Source != "192.0.2.1/32" || entries[0].Reason != "dialFailure" {
+		t.Errorf("list() = %+v, want single dialFailure ban of 192.0.2.1/32", entries)
+	}
+
+	advance(time.Hour)
+	if bans.isBanned(clientAddr) {
+		t.Error("isBanned() = true, want false after banTime passed")
+	}
+}
+
+func TestBanList_Unban(t *testing.T) {
+	bans, _ := newTestBanList(t, config.BansConfig{MaxRetry: 1})
+
+	bans.strike(netip.MustParsePrefix("2001:db8:0:1::/64"), banReasonEmptyConnection)
+	bans.strike(netip.MustParsePrefix("192.0.2.1/32"), banReasonEmptyConnection)
+
+	// Any address of a banned IPv6 prefix unbans the whole prefix
+	source, err := bans.unban("2001:db8:0:1::abc")
+	if err != nil {
+		t.Fatalf("unban() failed: %v", err)
+	}
+	if source != netip.MustParsePrefix("2001:db8:0:1::/64") {
+		t.Errorf("unban() = %v, want 2001:db8:0:1::/64", source)
+	}
+
+	if _, err = bans.unban("192.0.2.1/32"); err != nil {
+		t.Fatalf("unban() failed: %v", err)
+	}
+
+	if len(bans.list()) != 0 {
+		t.Errorf("list() = %+v, want no bans", bans.list())
+	}
+
+	if _, err = bans.unban("192.0.2.1"); err == nil {
+		t.Error("expected unban() to fail for source that isn't banned")
+	}
+
+	if _, err = bans.unban("not-an-address"); err == nil {
+		t.Error("expected unban() to fail for invalid address")
+	}
+}
+
+func TestBanList_StateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "bans.json")
+	conf := config.BansConfig{MaxRetry: 1, BanTime: time.Hour, StateFile: stateFile}
+
+	bans, _ := newTestBanList(t, conf)
+	bans.strike(netip.MustParsePrefix("192.0.2.1/32"), banReasonDialFailure)
+
+	fileInfo, err := os.Stat(stateFile)
+	if err != nil {
+		t.Fatalf("state file didn't get written: %v", err)
+	}
+	if fileInfo.Mode().Perm() != banStateFileMode {
+		t.Errorf("state file mode = %v, want %v", fileInfo.Mode().Perm(), os.FileMode(banStateFileMode))
+	}
+
+	restoredBans, err := newBanList(conf)
+	if err != nil {
+		t.Fatalf("newBanList() failed: %v", err)
+	}
+
+	if !restoredBans.isBanned(testClientAddr("192.0.2.1")) {
+		t.Error("ban didn't get restored from state file")
+	}
+
+	if _, err = restoredBans.unban("192.0.2.1"); err != nil {
+		t.Fatalf("unban() failed: %v", err)
+	}
+
+	restoredBans, err = newBanList(conf)
+	if err != nil {
+		t.Fatalf("newBanList() failed: %v", err)
+	}
+
+	if restoredBans.isBanned(testClientAddr("192.0.2.1")) {
+		t.Error("removed ban got restored from state file")
+	}
+}
+
+func TestBanList_StateFile_Invalid(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "bans.json")
+	if err := os.WriteFile(stateFile, []byte("not json"), banStateFileMode); err != nil {
+		t.Fatalf("could not write state file: %v", err)
+	}
+
+	if _, err := newBanList(config.BansConfig{MaxRetry: 1, StateFile: stateFile}); err == nil {
+		t.Error("expected newBanList() to fail for invalid state file")
+	}
+}
+
+func TestBanList_Admit(t *testing.T) {
+	bans, _ := newTestBanList(t, config.BansConfig{MaxRetry: 1})
+	bans.strike(netip.MustParsePrefix("192.0.2.1/32"), banReasonEmptyConnection)
+
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+
+	if _, ok := bans.admit(&mockAddrConn{Conn: serverSide, remoteAddr: testClientAddr("192.0.2.1")}); ok {
+		t.Error("admit() = true, want false for banned source")
+	}
+
+	clientSide.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := clientSide.Read(make([]byte, 1)); err == nil {
+		t.Error("connection of banned source didn't get closed")
+	}
+
+	_, otherServerSide := net.Pipe()
+	if _, ok := bans.admit(&mockAddrConn{Conn: otherServerSide, remoteAddr: testClientAddr("192.0.2.2")}); !ok {
+		t.Error("admit() = false, want true for other source")
+	}
+
+	if _, ok := (*banList)(nil).admit(&mockAddrConn{Conn: otherServerSide, remoteAddr: testClientAddr("192.0.2.1")}); !ok {
+		t.Error("nil banList has to admit every connection")
+	}
+}
+
+func TestBannableConn_Strikes(t *testing.T) {
+	tests := []struct {
+		name       string
+		use        func(t *testing.T, connection net.Conn, clientSide net.Conn)
+		wantStrike bool
+	}{
+		{
+			name: "closed without data",
+			use: func(_ *testing.T, connection net.Conn, clientSide net.Conn) {
+				clientSide.Close()
+				connection.Read(make([]byte, 1))
+			},
+			wantStrike: true,
+		},
+		{
+			name: "closed after sending data",
+			use: func(_ *testing.T, connection net.Conn, clientSide net.Conn) {
+				go func() {
+					clientSide.Write([]byte("hello"))
+					clientSide.Close()
+				}()
+
+				buffer := make([]byte, 16)
+				connection.Read(buffer)
+				connection.Read(buffer)
+			},
+			wantStrike: false,
+		},
+		{
+			name: "dial failure",
+			use: func(_ *testing.T, connection net.Conn, _ net.Conn) {
+				helper.ReportDialFailure(newBufferedConn(connection, nil))
+			},
+			wantStrike: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bans, _ := newTestBanList(t, config.BansConfig{MaxRetry: 1})
+
+			clientSide, serverSide := net.Pipe()
+			defer clientSide.Close()
+
+			connection := bans.watch(&mockAddrConn{Conn: serverSide, remoteAddr: testClientAddr("192.0.2.1")})
+			defer connection.Close()
+
+			tt.use(t, connection, clientSide)
+
+			if got := bans.isBanned(testClientAddr("192.0.2.1")); got != tt.wantStrike {
+				t.Errorf("isBanned() = %v, want %v", got, tt.wantStrike)
+			}
+		})
+	}
+}
+
+func TestBannableConn_StrikesOnlyOnce(t *testing.T) {
+	bans, _ := newTestBanList(t, config.BansConfig{MaxRetry: 2})
+
+	clientSide, serverSide := net.Pipe()
+	clientSide.Close()
+
+	connection := bans.watch(&mockAddrConn{Conn: serverSide, remoteAddr: testClientAddr("192.0.2.1")})
+	defer connection.Close()
+
+	connection.Read(make([]byte, 1))
+	connection.Read(make([]byte, 1))
+	helper.ReportDialFailure(connection)
+
+	if bans.isBanned(testClientAddr("192.0.2.1")) {
+		t.Error("a single connection gave more than one strike")
+	}
+}
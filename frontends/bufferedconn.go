@@ -0,0 +1,56 @@
+package frontends
+
+import (
+	"bufio"
+	"net"
+)
+
+// bufferedConn is a net.Conn that reads through a bufio.Reader, so bytes that got peeked or buffered while
+// inspecting the start of a connection are replayed to whoever reads from the connection afterwards.
+// Additionally the remote and local address can be overridden, like for connections using the PROXY protocol.
+type bufferedConn struct {
+	net.Conn
+
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+// newBufferedConn creates a new bufferedConn for given connection, reading through given reader. The reader
+// must read from given connection.
+func newBufferedConn(connection net.Conn, reader *bufio.Reader) *bufferedConn {
+	return &bufferedConn{
+		Conn:       connection,
+		reader:     reader,
+		remoteAddr: nil,
+		localAddr:  nil,
+	}
+}
+
+// Read reads from the buffered reader, returning buffered bytes first.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the overridden remote address, or the remote address of the underlying connection.
+func (c *bufferedConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the overridden local address, or the local address of the underlying connection.
+func (c *bufferedConn) LocalAddr() net.Addr {
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+
+	return c.Conn.LocalAddr()
+}
+
+// NetConn returns the underlying connection.
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
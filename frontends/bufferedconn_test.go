@@ -0,0 +1,65 @@
+package frontends
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestBufferedConn_ReplaysPeekedBytes(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	go func() {
+		clientConn.Write([]byte("hello world"))
+	}()
+
+	reader := bufio.NewReader(serverConn)
+	peeked, err := reader.Peek(5)
+	if err != nil {
+		t.Fatalf("Peek() failed: %v", err)
+	}
+	if string(peeked) != "hello" {
+		t.Fatalf("peeked %q, want %q", string(peeked), "hello")
+	}
+
+	bufferedConnection := newBufferedConn(serverConn, reader)
+
+	readBuffer := make([]byte, len("hello world"))
+	if _, err = io.ReadFull(bufferedConnection, readBuffer); err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	if string(readBuffer) != "hello world" {
+		t.Errorf("read %q, want %q", string(readBuffer), "hello world")
+	}
+}
+
+func TestBufferedConn_Addrs(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	bufferedConnection := newBufferedConn(serverConn, bufio.NewReader(serverConn))
+
+	// Without override, the addresses of the underlying connection are used
+	if bufferedConnection.RemoteAddr() != serverConn.RemoteAddr() {
+		t.Errorf("RemoteAddr() = %v, want %v", bufferedConnection.RemoteAddr(), serverConn.RemoteAddr())
+	}
+	if bufferedConnection.LocalAddr() != serverConn.LocalAddr() {
+		t.Errorf("LocalAddr() = %v, want %v", bufferedConnection.LocalAddr(), serverConn.LocalAddr())
+	}
+
+	remoteAddr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234}
+	localAddr := &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 443}
+	bufferedConnection.remoteAddr = remoteAddr
+	bufferedConnection.localAddr = localAddr
+
+	if bufferedConnection.RemoteAddr() != remoteAddr {
+		t.Errorf("RemoteAddr() = %v, want %v", bufferedConnection.RemoteAddr(), remoteAddr)
+	}
+	if bufferedConnection.LocalAddr() != localAddr {
+		t.Errorf("LocalAddr() = %v, want %v", bufferedConnection.LocalAddr(), localAddr)
+	}
+}
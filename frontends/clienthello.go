@@ -0,0 +1,64 @@
+package frontends
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+)
+
+// clientHelloInfo contains the parts of a TLS ClientHello used for routing.
+type clientHelloInfo struct {
+	serverName string
+	alpn       []string
+}
+
+// readOnlyConn is a net.Conn that reads from given reader and discards all writes. It's used to let crypto/tls
+// parse a ClientHello without answering the client.
+type readOnlyConn struct {
+	net.Conn
+
+	reader io.Reader
+}
+
+func (c readOnlyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c readOnlyConn) Write(_ []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+// peekClientHello reads the TLS ClientHello from given connection, without terminating TLS. The returned
+// connection replays all bytes read while parsing, so it can be handed to a backend like the original connection.
+// The ClientHello is parsed by crypto/tls, aborting the handshake as soon as the ClientHello is available.
+func peekClientHello(ctx context.Context, connection net.Conn) (*clientHelloInfo, net.Conn, error) {
+	peekedBytes := &bytes.Buffer{}
+	var helloInfo *clientHelloInfo
+
+	errHelloRead := errors.New("client hello read")
+	tlsConnection := tls.Server(
+		readOnlyConn{Conn: connection, reader: io.TeeReader(connection, peekedBytes)},
+		&tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				helloInfo = &clientHelloInfo{
+					serverName: hello.ServerName,
+					alpn:       hello.SupportedProtos,
+				}
+
+				return nil, errHelloRead
+			},
+		},
+	)
+
+	err := tlsConnection.HandshakeContext(ctx)
+	if helloInfo == nil {
+		return nil, nil, err
+	}
+
+	return helloInfo, newBufferedConn(connection, bufio.NewReader(io.MultiReader(peekedBytes, connection))), nil
+}
@@ -0,0 +1,89 @@
+package frontends
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPeekClientHello_ReadsServerNameAndReplaysBytes(t *testing.T) {
+	certConf := generateTestCertificate(t, t.TempDir(), "nas.example.com")
+	certificate, err := tls.LoadX509KeyPair(certConf.CertFile, certConf.KeyFile)
+	if err != nil {
+		t.Fatalf("could not load test certificate: %v", err)
+	}
+
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+	defer serverSide.Close()
+
+	clientDone := make(chan error, 1)
+	go func() {
+		//nolint:gosec // the test certificate is self-signed
+		clientConn := tls.Client(clientSide, &tls.Config{
+			ServerName:         "nas.example.com",
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h2", "http/1.1"},
+		})
+		clientDone <- clientConn.Handshake()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	helloInfo, replayConnection, err := peekClientHello(ctx, serverSide)
+	if err != nil {
+		t.Fatalf("peekClientHello() failed: %v", err)
+	}
+
+	if helloInfo.serverName != "nas.example.com" {
+		t.Errorf("serverName = %q, want %q", helloInfo.serverName, "nas.example.com")
+	}
+	if !slices.Equal(helloInfo.alpn, []string{"h2", "http/1.1"}) {
+		t.Errorf("alpn = %v, want %v", helloInfo.alpn, []string{"h2", "http/1.1"})
+	}
+
+	// The replayed connection has to contain the full ClientHello, so a real TLS server can complete the handshake
+	serverConn := tls.Server(replayConnection, &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err = serverConn.HandshakeContext(ctx); err != nil {
+		t.Fatalf("handshake on replayed connection failed: %v", err)
+	}
+
+	if err = <-clientDone; err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+}
+
+func TestPeekClientHello_NoTLS(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+	defer serverSide.Close()
+
+	go clientSide.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, _, err := peekClientHello(ctx, serverSide); err == nil {
+		t.Fatal("expected peekClientHello() to fail for non TLS connection")
+	}
+}
+
+func TestPeekClientHello_Timeout(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+	defer serverSide.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := peekClientHello(ctx, serverSide); err == nil {
+		t.Fatal("expected peekClientHello() to fail when no client hello arrives")
+	}
+}
@@ -0,0 +1,489 @@
+package frontends
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	connectionLimitReportInterval = time.Minute
+	connectionLimitSweepInterval  = time.Minute
+	defaultSourceIPv6PrefixLength = 64
+	maxIPv6PrefixLength           = 128
+)
+
+// limitReason is the limit a connection got rejected by.
+type limitReason int
+
+const (
+	limitSourceConnectionRate limitReason = iota
+	limitSourceMaxConnections
+	limitConnectionRate
+	limitMaxConnections
+	limitGlobalMaxConnections
+)
+
+// String returns the name of the limit, as used in logs.
+func (r limitReason) String() string {
+	switch r {
+	case limitSourceConnectionRate:
+		return "sourceConnectionRate"
+	case limitSourceMaxConnections:
+		return "sourceMaxConnections"
+	case limitConnectionRate:
+		return "connectionRate"
+	case limitMaxConnections:
+		return "maxConnections"
+	case limitGlobalMaxConnections:
+		return "globalMaxConnections"
+	default:
+		return "unknown"
+	}
+}
+
+// limitScope selects which limits of a connectionLimiter a connection gets checked against.
+type limitScope int
+
+const (
+	// limitScopeAll checks all limits.
+	limitScopeAll limitScope = iota
+	// limitScopeFrontend checks the limits of the frontend as a whole and the global cap.
+	limitScopeFrontend
+	// limitScopeSource checks the limits per source.
+	limitScopeSource
+)
+
+// tokenBucket limits the rate of events to rate per second, allowing bursts of up to burst events.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a new, full tokenBucket.
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// take takes a token from the bucket, and reports whether there was one.
+func (b *tokenBucket) take(now time.Time) bool {
+	if !b.hasToken(now) {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// hasToken reports whether the bucket has a token left, without taking it.
+func (b *tokenBucket) hasToken(now time.Time) bool {
+	b.refill(now)
+
+	return b.tokens >= 1
+}
+
+// isFull reports whether the bucket is full, so it behaves exactly like a new one.
+func (b *tokenBucket) isFull(now time.Time) bool {
+	b.refill(now)
+
+	return b.tokens >= b.burst
+}
+
+// refill adds the tokens gained since the last refill.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// globalConnectionLimit caps the number of active connections of all frontends together.
+type globalConnectionLimit struct {
+	mutex          sync.Mutex
+	maxConnections int
+	active         int
+}
+
+// newGlobalConnectionLimit creates a new globalConnectionLimit allowing up to given number of active
+// connections. A maxConnections of 0 disables the cap.
+func newGlobalConnectionLimit(conf config.GlobalLimitsConfig) (*globalConnectionLimit, error) {
+	if conf.MaxConnections < 0 {
+		return nil, fmt.Errorf("invalid maxConnections %d", conf.MaxConnections)
+	}
+
+	return &globalConnectionLimit{
+		mutex:          sync.Mutex{},
+		maxConnections: conf.MaxConnections,
+		active:         0,
+	}, nil
+}
+
+// acquire counts a new active connection, and reports whether the cap allows it.
+func (g *globalConnectionLimit) acquire() bool {
+	if g == nil {
+		return true
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.maxConnections > 0 && g.active >= g.maxConnections {
+		return false
+	}
+
+	g.active++
+
+	return true
+}
+
+// release stops counting an active connection.
+func (g *globalConnectionLimit) release() {
+	if g == nil {
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.active--
+}
+
+// sourceLimitState is the state of a single source of a connectionLimiter.
+type sourceLimitState struct {
+	bucket *tokenBucket
+	active int
+}
+
+// connectionLimiter limits the rate of new connections and the number of active connections of a frontend,
+// both per source and for the frontend as a whole. IPv6 sources are grouped by a configurable prefix length,
+// as a single client usually controls a whole prefix. Rejected connections are counted, and the counts get
+// logged at most once per connectionLimitReportInterval.
+type connectionLimiter struct {
+	frontendName string
+	conf         config.ConnectionLimitsConfig
+	global       *globalConnectionLimit
+	mutex        sync.Mutex
+	bucket       *tokenBucket
+	active       int
+	sources      map[netip.Prefix]*sourceLimitState
+	lastSweep    time.Time
+	rejected     map[limitReason]uint64
+	lastReport   time.Time
+	now          func() time.Time
+}
+
+// newConnectionLimiter creates a new connectionLimiter for the frontend with given name. Limits set to 0 are
+// disabled, and bursts default to the rate rounded up.
+func newConnectionLimiter(frontendName string, conf config.ConnectionLimitsConfig) (*connectionLimiter, error) {
+	if conf.ConnectionRate < 0 || conf.ConnectionBurst < 0 || conf.MaxConnections < 0 ||
+		conf.SourceConnectionRate < 0 || conf.SourceConnectionBurst < 0 || conf.SourceMaxConnections < 0 {
+		return nil, errors.New("connection limits must not be negative")
+	}
+
+	if conf.SourceIPv6PrefixLength == 0 {
+		conf.SourceIPv6PrefixLength = defaultSourceIPv6PrefixLength
+	}
+
+	if conf.SourceIPv6PrefixLength < 1 || conf.SourceIPv6PrefixLength > maxIPv6PrefixLength {
+		return nil, fmt.Errorf("invalid sourceIPv6PrefixLength %d", conf.SourceIPv6PrefixLength)
+	}
+
+	conf.ConnectionBurst = defaultBurst(conf.ConnectionRate, conf.ConnectionBurst)
+	conf.SourceConnectionBurst = defaultBurst(conf.SourceConnectionRate, conf.SourceConnectionBurst)
+
+	now := time.Now()
+
+	var bucket *tokenBucket
+	if conf.ConnectionRate > 0 {
+		bucket = newTokenBucket(conf.ConnectionRate, conf.ConnectionBurst, now)
+	}
+
+	return &connectionLimiter{
+		frontendName: frontendName,
+		conf:         conf,
+		global:       nil,
+		mutex:        sync.Mutex{},
+		bucket:       bucket,
+		active:       0,
+		sources:      make(map[netip.Prefix]*sourceLimitState),
+		lastSweep:    now,
+		rejected:     make(map[limitReason]uint64),
+		lastReport:   time.Time{},
+		now:          time.Now,
+	}, nil
+}
+
+// setGlobalLimit makes the connectionLimiter count its connections against given global cap as well.
+func (cl *connectionLimiter) setGlobalLimit(global *globalConnectionLimit) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.global = global
+}
+
+// admit reports whether given accepted connection is within all limits. Admitted connections get wrapped,
+// so closing them releases their slot. Rejected connections get closed.
+func (cl *connectionLimiter) admit(connection net.Conn) (net.Conn, bool) {
+	return cl.admitScoped(connection, limitScopeAll)
+}
+
+// frontendLimits returns a connectionGate only checking the limits of the frontend as a whole and the global cap.
+func (cl *connectionLimiter) frontendLimits() connectionGate {
+	return scopedLimiter{limiter: cl, scope: limitScopeFrontend}
+}
+
+// sourceLimits returns a connectionGate only checking the limits per source. Together with frontendLimits, it
+// checks the same limits as the connectionLimiter itself, but the source can be checked later, like once
+// the client address got read from a PROXY protocol header.
+func (cl *connectionLimiter) sourceLimits() connectionGate {
+	return scopedLimiter{limiter: cl, scope: limitScopeSource}
+}
+
+// admitScoped reports whether given connection is within the limits of given scope. Admitted connections get
+// wrapped, so closing them releases their slot. Rejected connections get closed.
+func (cl *connectionLimiter) admitScoped(connection net.Conn, scope limitScope) (net.Conn, bool) {
+	release, ok := cl.acquireScoped(connection.RemoteAddr(), scope)
+	if !ok {
+		closeUnroutedConnection(connection)
+		return nil, false
+	}
+
+	return &limitedConn{
+		Conn:        connection,
+		releaseOnce: sync.Once{},
+		release:     release,
+	}, true
+}
+
+// acquire takes a slot for a new connection from given address, and reports whether all limits allow it.
+// The returned function releases the slot again, and must be called exactly once when the connection ends.
+func (cl *connectionLimiter) acquire(remoteAddr net.Addr) (func(), bool) {
+	return cl.acquireScoped(remoteAddr, limitScopeAll)
+}
+
+// acquireScoped takes a slot for a new connection from given address, and reports whether the limits of given
+// scope allow it. The returned function releases the slot again, and must be called exactly once when the
+// connection ends.
+func (cl *connectionLimiter) acquireScoped(remoteAddr net.Addr, scope limitScope) (func(), bool) {
+	source, hasSource := cl.sourcePrefix(remoteAddr)
+	hasSource = hasSource && scope != limitScopeFrontend
+	isCounted := scope != limitScopeSource
+
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	now := cl.now()
+	cl.sweep(now)
+
+	reason, ok := cl.check(source, hasSource, isCounted, now)
+	if !ok {
+		cl.reject(reason, remoteAddr, now)
+		return nil, false
+	}
+
+	if isCounted {
+		cl.active++
+	}
+
+	if hasSource {
+		cl.sources[source].active++
+	}
+
+	return func() {
+		cl.release(source, hasSource, isCounted)
+	}, true
+}
+
+// check reports whether a new connection from given source is within all limits, and returns the limit it
+// exceeds otherwise. The limits of the frontend as a whole and the global cap are only checked if the connection
+// gets counted for the frontend. Tokens are only taken once all limits allow the connection, so rejected
+// connections don't use up the rate of admitted ones. It doesn't count the connection as active.
+func (cl *connectionLimiter) check(source netip.Prefix, hasSource bool, isCounted bool, now time.Time) (limitReason, bool) {
+	var sourceBucket *tokenBucket
+
+	if hasSource {
+		state, exists := cl.sources[source]
+		if !exists {
+			state = &sourceLimitState{bucket: nil, active: 0}
+			if cl.conf.SourceConnectionRate > 0 {
+				state.bucket = newTokenBucket(cl.conf.SourceConnectionRate, cl.conf.SourceConnectionBurst, now)
+			}
+
+			cl.sources[source] = state
+		}
+
+		if state.bucket != nil && !state.bucket.hasToken(now) {
+			return limitSourceConnectionRate, false
+		}
+
+		if cl.conf.SourceMaxConnections > 0 && state.active >= cl.conf.SourceMaxConnections {
+			return limitSourceMaxConnections, false
+		}
+
+		sourceBucket = state.bucket
+	}
+
+	if isCounted {
+		if cl.bucket != nil && !cl.bucket.hasToken(now) {
+			return limitConnectionRate, false
+		}
+
+		if cl.conf.MaxConnections > 0 && cl.active >= cl.conf.MaxConnections {
+			return limitMaxConnections, false
+		}
+
+		if !cl.global.acquire() {
+			return limitGlobalMaxConnections, false
+		}
+
+		if cl.bucket != nil {
+			cl.bucket.take(now)
+		}
+	}
+
+	if sourceBucket != nil {
+		sourceBucket.take(now)
+	}
+
+	return 0, true
+}
+
+// release stops counting a connection of given source as active.
+func (cl *connectionLimiter) release(source netip.Prefix, hasSource bool, isCounted bool) {
+	if isCounted {
+		cl.global.release()
+	}
+
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	if isCounted {
+		cl.active--
+	}
+
+	if state, exists := cl.sources[source]; hasSource && exists {
+		state.active--
+	}
+}
+
+// reject counts a connection rejected because of given limit, and logs the counts if the last report is
+// long enough ago.
+func (cl *connectionLimiter) reject(reason limitReason, remoteAddr net.Addr, now time.Time) {
+	cl.rejected[reason]++
+
+	slog.Debug(
+		"rejected connection over limit",
+		slog.String("name", cl.frontendName),
+		slog.String("remoteAddr", remoteAddr.String()),
+		slog.String("limit", reason.String()),
+	)
+
+	if now.Sub(cl.lastReport) < connectionLimitReportInterval {
+		return
+	}
+
+	attrs := []any{slog.String("name", cl.frontendName)}
+	for rejectedReason, count := range cl.rejected {
+		attrs = append(attrs, slog.Uint64(rejectedReason.String(), count))
+	}
+
+	slog.Warn("rejected connections over limit", attrs...)
+
+	clear(cl.rejected)
+	cl.lastReport = now
+}
+
+// sweep forgets all sources without active connections and a full bucket, so the state doesn't grow
+// forever. It only runs once per connectionLimitSweepInterval.
+func (cl *connectionLimiter) sweep(now time.Time) {
+	if now.Sub(cl.lastSweep) < connectionLimitSweepInterval {
+		return
+	}
+
+	for source, state := range cl.sources {
+		if state.active == 0 && (state.bucket == nil || state.bucket.isFull(now)) {
+			delete(cl.sources, source)
+		}
+	}
+
+	cl.lastSweep = now
+}
+
+// sourcePrefix returns the source given address belongs to, grouping IPv6 addresses by the configured prefix
+// length. Sources are only tracked if any source limit is set.
+func (cl *connectionLimiter) sourcePrefix(remoteAddr net.Addr) (netip.Prefix, bool) {
+	if cl.conf.SourceConnectionRate <= 0 && cl.conf.SourceMaxConnections <= 0 {
+		return netip.Prefix{}, false
+	}
+
+	addr, ok := addrFromNetAddr(remoteAddr)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+
+	return sourcePrefix(addr, cl.conf.SourceIPv6PrefixLength), true
+}
+
+// defaultBurst returns given burst, or the rate rounded up if no burst is set.
+func defaultBurst(rate float64, burst int) int {
+	if burst > 0 || rate <= 0 {
+		return burst
+	}
+
+	return int(math.Ceil(rate))
+}
+
+// scopedLimiter is a connectionGate checking the limits of a connectionLimiter of a single scope.
+type scopedLimiter struct {
+	limiter *connectionLimiter
+	scope   limitScope
+}
+
+// admit reports whether given connection is within the limits of the scope.
+func (sl scopedLimiter) admit(connection net.Conn) (net.Conn, bool) {
+	return sl.limiter.admitScoped(connection, sl.scope)
+}
+
+// limitedConn is a connection admitted by a connectionLimiter, that releases its slot when getting closed.
+type limitedConn struct {
+	net.Conn
+
+	releaseOnce sync.Once
+	release     func()
+}
+
+// Close releases the slot of the connection, and closes the underlying connection.
+func (c *limitedConn) Close() error {
+	c.releaseOnce.Do(c.release)
+
+	return c.Conn.Close()
+}
+
+// CloseWrite shuts down the writing side of the underlying connection, if it supports that.
+func (c *limitedConn) CloseWrite() error {
+	if halfCloser, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return halfCloser.CloseWrite()
+	}
+
+	return errors.ErrUnsupported
+}
+
+// NetConn returns the underlying connection.
+func (c *limitedConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,359 @@
+package frontends
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// newTestConnectionLimiter creates a connectionLimiter with given config, whose clock is controlled by
+// the returned function advancing it.
+func newTestConnectionLimiter(t *testing.T, conf config.ConnectionLimitsConfig) (*connectionLimiter, func(time.Duration)) {
+	t.Helper()
+
+	limiter, err := newConnectionLimiter("test-frontend", conf)
+	if err != nil {
+		t.Fatalf("newConnectionLimiter() failed: %v", err)
+	}
+
+	now := time.Now()
+	limiter.now = func() time.Time {
+		return now
+	}
+
+	if limiter.bucket != nil {
+		limiter.bucket.last = now
+	}
+
+	return limiter, func(d time.Duration) {
+		now = now.Add(d)
+	}
+}
+
+// testClientAddr returns a TCP address with given IP.
+func testClientAddr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}
+}
+
+func TestTokenBucket_Take(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(2, 3, now)
+
+	for i := range 3 {
+		if !bucket.take(now) {
+			t.Fatalf("take() #%d = false, want true within burst", i+1)
+		}
+	}
+
+	if bucket.take(now) {
+		t.Fatal("take() = true, want false for empty bucket")
+	}
+
+	// A rate of 2 per second refills one token every 500ms
+	now = now.Add(500 * time.Millisecond)
+	if !bucket.take(now) {
+		t.Error("take() = false, want true after refill")
+	}
+	if bucket.take(now) {
+		t.Error("take() = true, want false after using the refilled token")
+	}
+
+	// The bucket never holds more than the burst
+	now = now.Add(time.Hour)
+	if !bucket.isFull(now) {
+		t.Error("isFull() = false, want true after a long time")
+	}
+	if bucket.tokens != 3 {
+		t.Errorf("tokens = %v, want burst of 3", bucket.tokens)
+	}
+}
+
+func TestConnectionLimiter_NewConnectionLimiter(t *testing.T) {
+	limiter, err := newConnectionLimiter("test-frontend", config.ConnectionLimitsConfig{
+		ConnectionRate:       2.5,
+		SourceConnectionRate: 0.1,
+	})
+	if err != nil {
+		t.Fatalf("newConnectionLimiter() failed: %v", err)
+	}
+
+	if limiter.conf.ConnectionBurst != 3 {
+		t.Errorf("ConnectionBurst = %d, want default of 3", limiter.conf.ConnectionBurst)
+	}
+	if limiter.conf.SourceConnectionBurst != 1 {
+		t.Errorf("SourceConnectionBurst = %d, want default of 1", limiter.conf.SourceConnectionBurst)
+	}
+	if limiter.conf.SourceIPv6PrefixLength != defaultSourceIPv6PrefixLength {
+		t.Errorf("SourceIPv6PrefixLength = %d, want default of %d", limiter.conf.SourceIPv6PrefixLength, defaultSourceIPv6PrefixLength)
+	}
+}
+
+func TestConnectionLimiter_NewConnectionLimiter_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.ConnectionLimitsConfig
+	}{
+		{name: "negative rate", conf: config.ConnectionLimitsConfig{ConnectionRate: -1}},
+		{name: "negative max connections", conf: config.ConnectionLimitsConfig{SourceMaxConnections: -1}},
+		{name: "prefix length too long", conf: config.ConnectionLimitsConfig{SourceIPv6PrefixLength: 129}},
+		{name: "negative prefix length", conf: config.ConnectionLimitsConfig{SourceIPv6PrefixLength: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newConnectionLimiter("test-frontend", tt.conf); err == nil {
+				t.Error("expected newConnectionLimiter() to fail")
+			}
+		})
+	}
+}
+
+func TestConnectionLimiter_Acquire_SourceConnectionRate(t *testing.T) {
+	limiter, advance := newTestConnectionLimiter(t, config.ConnectionLimitsConfig{
+		SourceConnectionRate:  1,
+		SourceConnectionBurst: 2,
+	})
+
+	for i := range 2 {
+		if _, ok := limiter.acquire(testClientAddr("192.0.2.1")); !ok {
+			t.Fatalf("acquire() #%d = false, want true within burst", i+1)
+		}
+	}
+
+	if _, ok := limiter.acquire(testClientAddr("192.0.2.1")); ok {
+		t.Error("acquire() = true, want false over source rate")
+	}
+
+	// Other sources have their own bucket
+	if _, ok := limiter.acquire(testClientAddr("192.0.2.2")); !ok {
+		t.Error("acquire() = false, want true for other source")
+	}
+
+	advance(time.Second)
+	if _, ok := limiter.acquire(testClientAddr("192.0.2.1")); !ok {
+		t.Error("acquire() = false, want true after refill")
+	}
+}
+
+func TestConnectionLimiter_Acquire_SourceMaxConnections(t *testing.T) {
+	limiter, _ := newTestConnectionLimiter(t, config.ConnectionLimitsConfig{
+		SourceMaxConnections: 2,
+	})
+
+	releaseFirst, ok := limiter.acquire(testClientAddr("2001:db8:0:1::1"))
+	if !ok {
+		t.Fatal("acquire() = false, want true")
+	}
+
+	// Addresses of the same /64 count as the same source
+	if _, ok = limiter.acquire(testClientAddr("2001:db8:0:1::2")); !ok {
+		t.Fatal("acquire() = false, want true")
+	}
+
+	if _, ok = limiter.acquire(testClientAddr("2001:db8:0:1::3")); ok {
+		t.Error("acquire() = true, want false over source max connections")
+	}
+
+	if _, ok = limiter.acquire(testClientAddr("2001:db8:0:2::1")); !ok {
+		t.Error("acquire() = false, want true for other /64")
+	}
+
+	releaseFirst()
+	if _, ok = limiter.acquire(testClientAddr("2001:db8:0:1::3")); !ok {
+		t.Error("acquire() = false, want true after release")
+	}
+}
+
+func TestConnectionLimiter_Acquire_FrontendLimits(t *testing.T) {
+	limiter, advance := newTestConnectionLimiter(t, config.ConnectionLimitsConfig{
+		ConnectionRate:  1,
+		ConnectionBurst: 1,
+		MaxConnections:  1,
+	})
+
+	release, ok := limiter.acquire(testClientAddr("192.0.2.1"))
+	if !ok {
+		t.Fatal("acquire() = false, want true")
+	}
+
+	if _, ok = limiter.acquire(testClientAddr("192.0.2.2")); ok {
+		t.Error("acquire() = true, want false over frontend rate")
+	}
+
+	advance(time.Second)
+	if _, ok = limiter.acquire(testClientAddr("192.0.2.2")); ok {
+		t.Error("acquire() = true, want false over frontend max connections")
+	}
+
+	release()
+	advance(time.Second)
+	if _, ok = limiter.acquire(testClientAddr("192.0.2.2")); !ok {
+		t.Error("acquire() = false, want true after release and refill")
+	}
+}
+
+func TestConnectionLimiter_Acquire_GlobalMaxConnections(t *testing.T) {
+	globalLimit, err := newGlobalConnectionLimit(config.GlobalLimitsConfig{MaxConnections: 1})
+	if err != nil {
+		t.Fatalf("newGlobalConnectionLimit() failed: %v", err)
+	}
+
+	firstLimiter, _ := newTestConnectionLimiter(t, config.ConnectionLimitsConfig{})
+	secondLimiter, _ := newTestConnectionLimiter(t, config.ConnectionLimitsConfig{})
+	firstLimiter.setGlobalLimit(globalLimit)
+	secondLimiter.setGlobalLimit(globalLimit)
+
+	release, ok := firstLimiter.acquire(testClientAddr("192.0.2.1"))
+	if !ok {
+		t.Fatal("acquire() = false, want true")
+	}
+
+	if _, ok = secondLimiter.acquire(testClientAddr("192.0.2.2")); ok {
+		t.Error("acquire() = true, want false over global max connections")
+	}
+
+	release()
+	if _, ok = secondLimiter.acquire(testClientAddr("192.0.2.2")); !ok {
+		t.Error("acquire() = false, want true after release")
+	}
+
+	if _, err = newGlobalConnectionLimit(config.GlobalLimitsConfig{MaxConnections: -1}); err == nil {
+		t.Error("expected newGlobalConnectionLimit() to fail for negative maxConnections")
+	}
+}
+
+func TestConnectionLimiter_Acquire_RejectedConnectionsKeepTokens(t *testing.T) {
+	globalLimit, err := newGlobalConnectionLimit(config.GlobalLimitsConfig{MaxConnections: 1})
+	if err != nil {
+		t.Fatalf("newGlobalConnectionLimit() failed: %v", err)
+	}
+
+	limiter, _ := newTestConnectionLimiter(t, config.ConnectionLimitsConfig{
+		ConnectionRate:        0.001,
+		ConnectionBurst:       2,
+		SourceConnectionRate:  0.001,
+		SourceConnectionBurst: 2,
+	})
+	limiter.setGlobalLimit(globalLimit)
+
+	release, ok := limiter.acquire(testClientAddr("192.0.2.1"))
+	if !ok {
+		t.Fatal("acquire() = false, want true")
+	}
+
+	// Connections rejected by a cap must not use up the rate, so the source can connect again once a slot is free
+	for range 3 {
+		if _, ok = limiter.acquire(testClientAddr("192.0.2.1")); ok {
+			t.Fatal("acquire() = true, want false over global max connections")
+		}
+	}
+
+	release()
+	if _, ok = limiter.acquire(testClientAddr("192.0.2.1")); !ok {
+		t.Error("acquire() = false, want true, as rejected connections took no tokens")
+	}
+}
+
+func TestConnectionLimiter_Admit_ReleasesOnClose(t *testing.T) {
+	limiter, _ := newTestConnectionLimiter(t, config.ConnectionLimitsConfig{
+		SourceMaxConnections: 1,
+	})
+
+	_, serverSide := net.Pipe()
+	connection := &mockAddrConn{Conn: serverSide, remoteAddr: testClientAddr("192.0.2.1")}
+
+	admittedConnection, ok := limiter.admit(connection)
+	if !ok {
+		t.Fatal("admit() = false, want true")
+	}
+
+	_, otherServerSide := net.Pipe()
+	if _, ok = limiter.admit(&mockAddrConn{Conn: otherServerSide, remoteAddr: testClientAddr("192.0.2.1")}); ok {
+		t.Fatal("admit() = true, want false over source max connections")
+	}
+
+	// Closing twice must only release the slot once
+	admittedConnection.Close()
+	admittedConnection.Close()
+
+	if limiter.active != 0 {
+		t.Errorf("active = %d, want 0 after close", limiter.active)
+	}
+}
+
+func TestConnectionLimiter_ScopedLimits(t *testing.T) {
+	limiter, _ := newTestConnectionLimiter(t, config.ConnectionLimitsConfig{
+		MaxConnections:       2,
+		SourceMaxConnections: 1,
+	})
+
+	connectFromClient := func(gate connectionGate) (net.Conn, bool) {
+		_, serverSide := net.Pipe()
+		return gate.admit(&mockAddrConn{Conn: serverSide, remoteAddr: testClientAddr("192.0.2.1")})
+	}
+
+	// The frontend limits don't care about the source
+	firstConnection, ok := connectFromClient(limiter.frontendLimits())
+	if !ok {
+		t.Fatal("frontendLimits().admit() = false, want true")
+	}
+	if _, ok = connectFromClient(limiter.frontendLimits()); !ok {
+		t.Fatal("frontendLimits().admit() = false, want true despite source max connections")
+	}
+	if _, ok = connectFromClient(limiter.frontendLimits()); ok {
+		t.Error("frontendLimits().admit() = true, want false over max connections")
+	}
+
+	// The source limits don't care about the frontend
+	sourceConnection, ok := connectFromClient(limiter.sourceLimits())
+	if !ok {
+		t.Fatal("sourceLimits().admit() = false, want true despite max connections")
+	}
+	if _, ok = connectFromClient(limiter.sourceLimits()); ok {
+		t.Error("sourceLimits().admit() = true, want false over source max connections")
+	}
+
+	firstConnection.Close()
+	sourceConnection.Close()
+
+	if limiter.active != 1 {
+		t.Errorf("active = %d, want 1 after closing one counted connection", limiter.active)
+	}
+	if state := limiter.sources[netip.MustParsePrefix("192.0.2.1/32")]; state.active != 0 {
+		t.Errorf("source active = %d, want 0 after closing the source connection", state.active)
+	}
+}
+
+func TestConnectionLimiter_Sweep_ForgetsIdleSources(t *testing.T) {
+	limiter, advance := newTestConnectionLimiter(t, config.ConnectionLimitsConfig{
+		SourceConnectionRate: 1,
+	})
+
+	release, _ := limiter.acquire(testClientAddr("192.0.2.1"))
+	limiter.acquire(testClientAddr("192.0.2.2"))
+	release()
+
+	advance(connectionLimitSweepInterval)
+	limiter.acquire(testClientAddr("192.0.2.3"))
+
+	if _, exists := limiter.sources[netip.MustParsePrefix("192.0.2.1/32")]; exists {
+		t.Error("sweep() kept a source without active connections")
+	}
+	if _, exists := limiter.sources[netip.MustParsePrefix("192.0.2.2/32")]; !exists {
+		t.Error("sweep() forgot a source with active connections")
+	}
+}
+
+// mockAddrConn is a net.Conn with a fixed remote address.
+type mockAddrConn struct {
+	net.Conn
+
+	remoteAddr net.Addr
+}
+
+func (c *mockAddrConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
@@ -0,0 +1,141 @@
+package frontends
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	proxyDefaultConnectTimeout = 3 * time.Minute
+	proxyDirectDialTimeout     = 10 * time.Second
+)
+
+// unmatchedPolicy defines how proxy frontends handle destinations not matching any rule.
+type unmatchedPolicy int
+
+const (
+	unmatchedReject unmatchedPolicy = iota
+	unmatchedDirect
+)
+
+// parseUnmatchedPolicy parses given policy, which is "reject" or "direct". An empty policy defaults to "reject".
+func parseUnmatchedPolicy(policy string) (unmatchedPolicy, error) {
+	switch policy {
+	case "", "reject":
+		return unmatchedReject, nil
+	case "direct":
+		return unmatchedDirect, nil
+	default:
+		return unmatchedReject, fmt.Errorf("unknown unmatched policy '%s'", policy)
+	}
+}
+
+// destinationRule routes proxy requests for matching destinations to its target backend. A rule matches either
+// hostnames, including wildcards like "*.example.com", or IP addresses within a prefix. Optionally the rule
+// only matches a single port.
+type destinationRule struct {
+	destination   string
+	hostname      string
+	wildcard      bool
+	prefix        netip.Prefix
+	port          int
+	targetBackend backends.Backend
+}
+
+// newDestinationRules creates the destinationRules for given configs. A destination is a hostname, IP address
+// or CIDR, optionally followed by a port like "nas.example.com:22" or "[fd00::/8]:22".
+func newDestinationRules(confs []config.DestinationRuleConfig, backendList *backends.BackendList) ([]destinationRule, error) {
+	rules := make([]destinationRule, 0, len(confs))
+
+	for _, ruleConf := range confs {
+		rule, err := newDestinationRule(ruleConf.Destination)
+		if err != nil {
+			return nil, err
+		}
+
+		targetBackend, ok := backendList.Get(ruleConf.Target)
+		if !ok {
+			return nil, fmt.Errorf("target backend '%s' for destination '%s' does not exist", ruleConf.Target, ruleConf.Destination)
+		}
+
+		rule.targetBackend = targetBackend
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// newDestinationRule parses given destination, leaving the target backend empty.
+func newDestinationRule(destination string) (destinationRule, error) {
+	rule := destinationRule{destination: destination}
+
+	host := destination
+	if splitHost, splitPort, err := net.SplitHostPort(destination); err == nil {
+		port, err := strconv.ParseUint(splitPort, 10, 16)
+		if err != nil || port == 0 {
+			return destinationRule{}, fmt.Errorf("invalid port in destination '%s'", destination)
+		}
+
+		host = splitHost
+		rule.port = int(port)
+	}
+
+	if _, err := netip.ParseAddr(host); err == nil || strings.Contains(host, "/") {
+		prefixes, err := parsePrefixes([]string{host})
+		if err != nil {
+			return destinationRule{}, fmt.Errorf("invalid destination '%s': %w", destination, err)
+		}
+
+		rule.prefix = prefixes[0]
+
+		return rule, nil
+	}
+
+	hostname, wildcard, err := parseHostnamePattern(host)
+	if err != nil {
+		return destinationRule{}, fmt.Errorf("invalid destination '%s': %w", destination, err)
+	}
+
+	rule.hostname = hostname
+	rule.wildcard = wildcard
+
+	return rule, nil
+}
+
+// matches reports whether the rule matches given destination host and port. Hostnames are not resolved, so
+// IP rules only match destinations requested by IP address.
+func (r *destinationRule) matches(host string, port int) bool {
+	if r.port != 0 && r.port != port {
+		return false
+	}
+
+	if r.prefix.IsValid() {
+		addr, err := netip.ParseAddr(host)
+		return err == nil && r.prefix.Contains(addr.Unmap())
+	}
+
+	normalizedHost := normalizeHostname(host)
+	if r.wildcard {
+		return strings.HasSuffix(normalizedHost, r.hostname) && len(normalizedHost) > len(r.hostname)
+	}
+
+	return normalizedHost == r.hostname
+}
+
+// matchDestinationRules returns the first rule matching given destination host and port.
+func matchDestinationRules(rules []destinationRule, host string, port int) (*destinationRule, bool) {
+	for i := range rules {
+		if rules[i].matches(host, port) {
+			return &rules[i], true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,98 @@
+package frontends
+
+import (
+	"testing"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+func TestParseUnmatchedPolicy(t *testing.T) {
+	tests := map[string]unmatchedPolicy{
+		"":       unmatchedReject,
+		"reject": unmatchedReject,
+		"direct": unmatchedDirect,
+	}
+
+	for policy, want := range tests {
+		got, err := parseUnmatchedPolicy(policy)
+		if err != nil {
+			t.Errorf("parseUnmatchedPolicy(%q) failed: %v", policy, err)
+		}
+		if got != want {
+			t.Errorf("parseUnmatchedPolicy(%q) = %v, want %v", policy, got, want)
+		}
+	}
+
+	if _, err := parseUnmatchedPolicy("allow"); err == nil {
+		t.Error("expected parseUnmatchedPolicy() to fail for unknown policy")
+	}
+}
+
+func TestDestinationRules_Match(t *testing.T) {
+	backendList := createTestBackendList("nas-ssh", "nas", "lan", "lan6", "web")
+
+	rules, err := newDestinationRules([]config.DestinationRuleConfig{
+		{Destination: "nas.example.com:22", Target: "nas-ssh"},
+		{Destination: "nas.example.com", Target: "nas"},
+		{Destination: "192.168.0.0/24:22", Target: "lan"},
+		{Destination: "[fd00::/8]:22", Target: "lan6"},
+		{Destination: "*.example.com", Target: "web"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newDestinationRules() failed: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		port int
+		want string
+	}{
+		{host: "nas.example.com", port: 22, want: "nas-ssh"},
+		{host: "NAS.example.com.", port: 22, want: "nas-ssh"},
+		{host: "nas.example.com", port: 443, want: "nas"},
+		{host: "192.168.0.10", port: 22, want: "lan"},
+		{host: "192.168.0.10", port: 80, want: ""},
+		{host: "::ffff:192.168.0.10", port: 22, want: "lan"},
+		{host: "fd00::1", port: 22, want: "lan6"},
+		{host: "files.example.com", port: 80, want: "web"},
+		{host: "example.com", port: 80, want: ""},
+		{host: "other.org", port: 22, want: ""},
+	}
+
+	for _, tt := range tests {
+		rule, ok := matchDestinationRules(rules, tt.host, tt.port)
+
+		got := ""
+		if ok {
+			got = rule.targetBackend.GetName()
+		}
+
+		if got != tt.want {
+			t.Errorf("matchDestinationRules(%q, %d) = %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestDestinationRules_NewDestinationRules_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	tests := []struct {
+		name string
+		rule config.DestinationRuleConfig
+	}{
+		{name: "unknown target", rule: config.DestinationRuleConfig{Destination: "nas.example.com", Target: "unknown"}},
+		{name: "invalid port", rule: config.DestinationRuleConfig{Destination: "nas.example.com:ssh", Target: "nas"}},
+		{name: "port zero", rule: config.DestinationRuleConfig{Destination: "nas.example.com:0", Target: "nas"}},
+		{name: "invalid cidr", rule: config.DestinationRuleConfig{Destination: "192.168.0.0/33", Target: "nas"}},
+		{name: "invalid wildcard", rule: config.DestinationRuleConfig{Destination: "nas.*.com", Target: "nas"}},
+		{name: "empty destination", rule: config.DestinationRuleConfig{Destination: "", Target: "nas"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newDestinationRules([]config.DestinationRuleConfig{tt.rule}, backendList); err == nil {
+				t.Error("expected newDestinationRules() to fail")
+			}
+		})
+	}
+}
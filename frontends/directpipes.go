@@ -0,0 +1,60 @@
+package frontends
+
+import (
+	"container/list"
+	"net"
+	"sync"
+
+	"github.com/sateffen/pluggo/backends/helper"
+)
+
+// directPipes tracks the connections a proxy frontend dialed directly, without any backend, so they can get
+// closed together with the frontend, like backends close their active connections.
+type directPipes struct {
+	activeConnections *list.List
+	connectionsMutex  sync.Mutex
+}
+
+// newDirectPipes creates a new, empty directPipes instance.
+func newDirectPipes() *directPipes {
+	return &directPipes{
+		activeConnections: list.New(),
+		connectionsMutex:  sync.Mutex{},
+	}
+}
+
+// pipe pipes given connection to given connection to its target, and tracks the pipe until either side closes.
+func (dp *directPipes) pipe(connection net.Conn, connectionToTarget net.Conn) {
+	pipeHelper := helper.NewPipeHelper(connection, connectionToTarget)
+
+	dp.connectionsMutex.Lock()
+	listElement := dp.activeConnections.PushBack(pipeHelper)
+	dp.connectionsMutex.Unlock()
+
+	untrack := func() {
+		dp.connectionsMutex.Lock()
+		dp.activeConnections.Remove(listElement)
+		dp.connectionsMutex.Unlock()
+	}
+
+	// The pipe might be closed already, if either side closed right away
+	if err := pipeHelper.OnClose(untrack); err != nil {
+		untrack()
+	}
+}
+
+// closeAll closes all tracked pipes.
+func (dp *directPipes) closeAll() {
+	dp.connectionsMutex.Lock()
+	connections := make([]*helper.PipeHelper, 0, dp.activeConnections.Len())
+	for e := dp.activeConnections.Front(); e != nil; e = e.Next() {
+		if pipeHelper, ok := e.Value.(*helper.PipeHelper); ok {
+			connections = append(connections, pipeHelper)
+		}
+	}
+	dp.connectionsMutex.Unlock()
+
+	for _, conn := range connections {
+		conn.Close()
+	}
+}
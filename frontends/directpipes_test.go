@@ -0,0 +1,78 @@
+package frontends
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// countDirectPipes returns the number of pipes tracked by given directPipes.
+func countDirectPipes(pipes *directPipes) int {
+	pipes.connectionsMutex.Lock()
+	defer pipes.connectionsMutex.Unlock()
+
+	return pipes.activeConnections.Len()
+}
+
+// waitForNoDirectPipes waits up to a second for given directPipes to track no pipes anymore, as pipes get
+// forgotten right after their connections got closed.
+func waitForNoDirectPipes(pipes *directPipes) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if countDirectPipes(pipes) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestDirectPipes_CloseAll(t *testing.T) {
+	pipes := newDirectPipes()
+
+	clientSide, connection := net.Pipe()
+	defer clientSide.Close()
+
+	targetSide, connectionToTarget := net.Pipe()
+	defer targetSide.Close()
+
+	pipes.pipe(connection, connectionToTarget)
+
+	if count := countDirectPipes(pipes); count != 1 {
+		t.Fatalf("tracking %d pipes, want 1", count)
+	}
+
+	pipes.closeAll()
+
+	for name, side := range map[string]net.Conn{"client": clientSide, "target": targetSide} {
+		side.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := side.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Errorf("expected io.EOF on %s side after closeAll(), got: %v", name, err)
+		}
+	}
+
+	if !waitForNoDirectPipes(pipes) {
+		t.Error("still tracking pipes after closeAll()")
+	}
+}
+
+func TestDirectPipes_ForgetsClosedPipes(t *testing.T) {
+	pipes := newDirectPipes()
+
+	clientSide, connection := net.Pipe()
+	targetSide, connectionToTarget := net.Pipe()
+	defer targetSide.Close()
+
+	pipes.pipe(connection, connectionToTarget)
+	clientSide.Close()
+
+	targetSide.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := targetSide.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF on target side after client closed, got: %v", err)
+	}
+
+	if !waitForNoDirectPipes(pipes) {
+		t.Error("still tracking the pipe after the client closed")
+	}
+}
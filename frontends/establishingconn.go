@@ -0,0 +1,135 @@
+package frontends
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// establishState is the state of an establishingConn.
+type establishState int
+
+const (
+	establishPending establishState = iota
+	establishSucceeded
+	establishFailed
+)
+
+// establishingConn wraps the client connection of proxy protocols like SOCKS5 or HTTP CONNECT, where the client
+// has to be told whether the connection to its destination succeeded, before any data gets exchanged.
+// As backends don't report whether they could connect to their target, the first read or write of the backend
+// counts as success, as backends only start piping after connecting. Closing the connection before counts
+// as failure, and so does the timeout passing.
+type establishingConn struct {
+	net.Conn
+
+	mutex         sync.Mutex
+	state         establishState
+	timer         *time.Timer
+	onEstablished func() error
+	onFailed      func(timedOut bool)
+}
+
+// newEstablishingConn creates a new establishingConn for given connection. onEstablished gets called once
+// before the first read or write, and onFailed gets called if the connection gets closed before or the timeout
+// passes. In the latter case, the connection gets closed after calling onFailed.
+func newEstablishingConn(
+	connection net.Conn,
+	timeout time.Duration,
+	onEstablished func() error,
+	onFailed func(timedOut bool),
+) *establishingConn {
+	ec := &establishingConn{
+		Conn:          connection,
+		mutex:         sync.Mutex{},
+		state:         establishPending,
+		timer:         nil,
+		onEstablished: onEstablished,
+		onFailed:      onFailed,
+	}
+
+	ec.mutex.Lock()
+	ec.timer = time.AfterFunc(timeout, ec.timeout)
+	ec.mutex.Unlock()
+
+	return ec
+}
+
+// Read establishes the connection if not done yet, and reads from the underlying connection.
+func (ec *establishingConn) Read(b []byte) (int, error) {
+	if err := ec.establish(); err != nil {
+		return 0, err
+	}
+
+	return ec.Conn.Read(b)
+}
+
+// Write establishes the connection if not done yet, and writes to the underlying connection.
+func (ec *establishingConn) Write(b []byte) (int, error) {
+	if err := ec.establish(); err != nil {
+		return 0, err
+	}
+
+	return ec.Conn.Write(b)
+}
+
+// Close reports the failure if the connection isn't established yet, and closes the underlying connection.
+func (ec *establishingConn) Close() error {
+	ec.mutex.Lock()
+	if ec.state == establishPending {
+		ec.timer.Stop()
+		ec.state = establishFailed
+		ec.onFailed(false)
+	}
+	ec.mutex.Unlock()
+
+	return ec.Conn.Close()
+}
+
+// establish calls onEstablished, if the connection is still pending.
+func (ec *establishingConn) establish() error {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+
+	switch ec.state {
+	case establishSucceeded:
+		return nil
+	case establishFailed:
+		return net.ErrClosed
+	case establishPending:
+	}
+
+	ec.timer.Stop()
+
+	if err := ec.onEstablished(); err != nil {
+		ec.state = establishFailed
+		return err
+	}
+
+	ec.state = establishSucceeded
+
+	return nil
+}
+
+// timeout reports the failure and closes the underlying connection, if the connection is still pending.
+func (ec *establishingConn) timeout() {
+	ec.mutex.Lock()
+	if ec.state != establishPending {
+		ec.mutex.Unlock()
+		return
+	}
+
+	ec.state = establishFailed
+	ec.onFailed(true)
+	ec.mutex.Unlock()
+
+	if err := ec.Conn.Close(); err != nil {
+		slog.Debug("could not properly close connection after timeout", slog.Any("error", err))
+	}
+}
+
+// NetConn returns the underlying connection.
+func (ec *establishingConn) NetConn() net.Conn {
+	return ec.Conn
+}
@@ -0,0 +1,124 @@
+package frontends
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEstablishingConn_EstablishesOnFirstRead(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+
+	establishedCount := 0
+	connection := newEstablishingConn(
+		serverSide,
+		time.Minute,
+		func() error {
+			establishedCount++
+			_, err := serverSide.Write([]byte("ok"))
+			return err
+		},
+		func(_ bool) {
+			t.Error("onFailed() got called for established connection")
+		},
+	)
+	defer connection.Close()
+
+	go func() {
+		clientSide.Write([]byte("hello"))
+	}()
+
+	// The answer of onEstablished has to arrive before the data read
+	answer := make([]byte, 2)
+	readDone := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(clientSide, answer)
+		readDone <- err
+	}()
+
+	readBuffer := make([]byte, len("hello"))
+	if _, err := io.ReadFull(connection, readBuffer); err != nil {
+		t.Fatalf("could not read from establishingConn: %v", err)
+	}
+
+	if err := <-readDone; err != nil || string(answer) != "ok" {
+		t.Errorf("client received %q (%v), want %q", string(answer), err, "ok")
+	}
+
+	go io.Copy(io.Discard, clientSide)
+
+	if _, err := connection.Write([]byte("bye")); err != nil {
+		t.Errorf("Write() after establishing failed: %v", err)
+	}
+
+	if establishedCount != 1 {
+		t.Errorf("onEstablished() got called %d times, want 1", establishedCount)
+	}
+}
+
+func TestEstablishingConn_FailsOnCloseBeforeEstablished(t *testing.T) {
+	_, serverSide := net.Pipe()
+
+	failures := make(chan bool, 1)
+	connection := newEstablishingConn(
+		serverSide,
+		time.Minute,
+		func() error {
+			t.Error("onEstablished() got called for failed connection")
+			return nil
+		},
+		func(timedOut bool) {
+			failures <- timedOut
+		},
+	)
+
+	connection.Close()
+
+	select {
+	case timedOut := <-failures:
+		if timedOut {
+			t.Error("onFailed() reported timeout, want close")
+		}
+	default:
+		t.Fatal("onFailed() did not get called")
+	}
+
+	if _, err := connection.Read(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected Read() to fail with net.ErrClosed, got: %v", err)
+	}
+}
+
+func TestEstablishingConn_FailsOnTimeout(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+
+	failures := make(chan bool, 1)
+	newEstablishingConn(
+		serverSide,
+		10*time.Millisecond,
+		func() error {
+			return nil
+		},
+		func(timedOut bool) {
+			failures <- timedOut
+		},
+	)
+
+	select {
+	case timedOut := <-failures:
+		if !timedOut {
+			t.Error("onFailed() reported close, want timeout")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("onFailed() did not get called after timeout")
+	}
+
+	// The underlying connection has to be closed after the timeout
+	clientSide.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := clientSide.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF after timeout, got: %v", err)
+	}
+}
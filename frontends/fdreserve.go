@@ -0,0 +1,133 @@
+package frontends
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fdReserveShedTimeout is how long shedding waits for the pending connection, in case another go-routine
+// accepted it in the meantime.
+const fdReserveShedTimeout = 100 * time.Millisecond
+
+// deadlineListener is a streamListener, whose Accept calls can time out.
+type deadlineListener interface {
+	streamListener
+	SetDeadline(t time.Time) error
+}
+
+// fdReserve holds a file descriptor in reserve for when the process runs out of them. While accepting fails
+// because of the fd limit, pending connections would stay in the backlog and make Accept fail over and over.
+// Releasing the reserved fd allows accepting a single pending connection, to close it right away.
+type fdReserve struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// newFDReserve creates a new fdReserve, reserving a file descriptor by opening the null device.
+func newFDReserve() (*fdReserve, error) {
+	file, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, fmt.Errorf("could not reserve file descriptor: %w", err)
+	}
+
+	return &fdReserve{
+		mutex: sync.Mutex{},
+		file:  file,
+	}, nil
+}
+
+// shed accepts a single pending connection of given listener using the reserved fd, and closes it right
+// away. It reports whether a connection got shed. Listeners that can't time out their Accept calls aren't
+// supported, as Accept would block forever if there is no pending connection anymore.
+// shed is nil-safe, so frontends without an fdReserve never shed connections.
+func (fr *fdReserve) shed(listener streamListener) bool {
+	if fr == nil {
+		return false
+	}
+
+	timeoutListener, ok := listener.(deadlineListener)
+	if !ok {
+		return false
+	}
+
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+
+	if fr.file == nil && !fr.reopen() {
+		return false
+	}
+
+	if err := fr.file.Close(); err != nil {
+		slog.Debug("could not close reserved file descriptor", slog.Any("error", err))
+	}
+	fr.file = nil
+
+	defer fr.reopen()
+
+	if err := timeoutListener.SetDeadline(time.Now().Add(fdReserveShedTimeout)); err != nil {
+		return false
+	}
+
+	connection, err := timeoutListener.Accept()
+
+	if err = errors.Join(err, timeoutListener.SetDeadline(time.Time{})); err != nil {
+		slog.Debug("could not shed connection", slog.Any("error", err))
+	}
+
+	if connection == nil {
+		return false
+	}
+
+	slog.Debug("shed connection over file descriptor limit", slog.String("remoteAddr", connection.RemoteAddr().String()))
+	closeUnroutedConnection(connection)
+
+	return true
+}
+
+// reopen reserves a file descriptor again, after it got used. It reports whether that worked, which might not
+// be the case while the process is still at its fd limit.
+func (fr *fdReserve) reopen() bool {
+	if fr.file != nil {
+		return true
+	}
+
+	file, err := os.Open(os.DevNull)
+	if err != nil {
+		slog.Debug("could not reserve file descriptor again", slog.Any("error", err))
+		return false
+	}
+
+	fr.file = file
+
+	return true
+}
+
+// Close releases the reserved file descriptor.
+func (fr *fdReserve) Close() error {
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+
+	if fr.file == nil {
+		return nil
+	}
+
+	err := fr.file.Close()
+	fr.file = nil
+
+	if err != nil {
+		return fmt.Errorf("could not release reserved file descriptor: %w", err)
+	}
+
+	return nil
+}
+
+// isFDLimitError reports whether given accept error is caused by the process or system running out of file
+// descriptors.
+func isFDLimitError(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
@@ -0,0 +1,107 @@
+package frontends
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFDReserve_Shed(t *testing.T) {
+	reserve, err := newFDReserve()
+	if err != nil {
+		t.Fatalf("newFDReserve() failed: %v", err)
+	}
+	defer reserve.Close()
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer client.Close()
+
+	if !reserve.shed(listener) {
+		t.Fatal("shed() = false, want true with pending connection")
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = client.Read(make([]byte, 1)); err == nil {
+		t.Error("shed connection didn't get closed")
+	}
+
+	if reserve.file == nil {
+		t.Error("file descriptor didn't get reserved again")
+	}
+
+	// Without pending connections, shedding times out instead of blocking forever
+	if reserve.shed(listener) {
+		t.Error("shed() = true, want false without pending connection")
+	}
+}
+
+func TestFDReserve_Shed_Unsupported(t *testing.T) {
+	reserve, err := newFDReserve()
+	if err != nil {
+		t.Fatalf("newFDReserve() failed: %v", err)
+	}
+	defer reserve.Close()
+
+	listener := &mockStreamListener{
+		mockAccept: func() (net.Conn, error) {
+			t.Error("Accept() called on listener without deadline support")
+			return nil, errors.New("unexpected accept")
+		},
+	}
+
+	if reserve.shed(listener) {
+		t.Error("shed() = true, want false for listener without deadline support")
+	}
+
+	if (*fdReserve)(nil).shed(listener) {
+		t.Error("shed() = true, want false for nil fdReserve")
+	}
+}
+
+func TestFDReserve_Close(t *testing.T) {
+	reserve, err := newFDReserve()
+	if err != nil {
+		t.Fatalf("newFDReserve() failed: %v", err)
+	}
+
+	if err = reserve.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	if err = reserve.Close(); err != nil {
+		t.Errorf("second Close() failed: %v", err)
+	}
+}
+
+func TestIsFDLimitError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "EMFILE", err: &net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.EMFILE)}, want: true},
+		{name: "ENFILE", err: fmt.Errorf("wrapped: %w", syscall.ENFILE), want: true},
+		{name: "other error", err: syscall.ECONNABORTED, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFDLimitError(tt.err); got != tt.want {
+				t.Errorf("isFDLimitError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
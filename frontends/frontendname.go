@@ -0,0 +1,41 @@
+package frontends
+
+import (
+	"errors"
+	"net"
+)
+
+// frontendNameGate is a connectionGate admitting all connections, tagging them with the name of the frontend that
+// accepted them, so backends can tell the name to their targets.
+type frontendNameGate string
+
+// admit wraps given connection in a namedConn.
+func (name frontendNameGate) admit(connection net.Conn) (net.Conn, bool) {
+	return &namedConn{Conn: connection, frontendName: string(name)}, true
+}
+
+// namedConn is a connection knowing the name of the frontend that accepted it.
+type namedConn struct {
+	net.Conn
+
+	frontendName string
+}
+
+// FrontendName returns the name of the frontend that accepted the connection.
+func (c *namedConn) FrontendName() string {
+	return c.frontendName
+}
+
+// CloseWrite shuts down the writing side of the underlying connection, if it supports that.
+func (c *namedConn) CloseWrite() error {
+	if halfCloser, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return halfCloser.CloseWrite()
+	}
+
+	return errors.ErrUnsupported
+}
+
+// NetConn returns the underlying connection.
+func (c *namedConn) NetConn() net.Conn {
+	return c.Conn
+}
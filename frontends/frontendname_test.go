@@ -0,0 +1,35 @@
+package frontends
+
+import (
+	"net"
+	"testing"
+
+	"github.com/sateffen/pluggo/backends/helper"
+)
+
+func TestFrontendNameGate_Admit(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	admittedConn, ok := frontendNameGate("ssh").admit(serverConn)
+	if !ok {
+		t.Fatal("admit() didn't admit the connection")
+	}
+
+	// Backends find the name through connections wrapping the admitted one
+	wrappingConn := newBufferedConn(admittedConn, nil)
+
+	if got := helper.FrontendName(wrappingConn); got != "ssh" {
+		t.Errorf("FrontendName() = %q, want %q", got, "ssh")
+	}
+
+	namedConnection, ok := admittedConn.(*namedConn)
+	if !ok {
+		t.Fatalf("admitted connection is %T, want *namedConn", admittedConn)
+	}
+
+	if namedConnection.NetConn() != serverConn {
+		t.Error("NetConn() doesn't return the admitted connection")
+	}
+}
@@ -0,0 +1,151 @@
+package frontends
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sateffen/pluggo/backends"
+)
+
+// hostnameMatcher maps hostnames to values. A hostname can start with a wildcard label like "*.example.com",
+// matching all subdomains of example.com, but not example.com itself. Exact hostnames take precedence over
+// wildcards, and more specific wildcards take precedence over less specific ones.
+type hostnameMatcher[T any] struct {
+	exact    map[string]T
+	wildcard map[string]T
+}
+
+// newHostnameMatcher creates a new, empty hostnameMatcher.
+func newHostnameMatcher[T any]() *hostnameMatcher[T] {
+	return &hostnameMatcher[T]{
+		exact:    make(map[string]T),
+		wildcard: make(map[string]T),
+	}
+}
+
+// set sets the value for given hostname or wildcard hostname, replacing any existing value.
+func (hm *hostnameMatcher[T]) set(hostname string, value T) error {
+	pattern, isWildcard, err := parseHostnamePattern(hostname)
+	if err != nil {
+		return err
+	}
+
+	if isWildcard {
+		hm.wildcard[pattern] = value
+	} else {
+		hm.exact[pattern] = value
+	}
+
+	return nil
+}
+
+// get returns the value set for exactly given hostname or wildcard hostname, without any wildcard matching.
+func (hm *hostnameMatcher[T]) get(hostname string) (T, bool) {
+	normalizedHostname := normalizeHostname(hostname)
+
+	if suffix, isWildcard := strings.CutPrefix(normalizedHostname, "*"); isWildcard {
+		value, ok := hm.wildcard[suffix]
+		return value, ok
+	}
+
+	value, ok := hm.exact[normalizedHostname]
+
+	return value, ok
+}
+
+// lookup returns the value of the most specific entry matching given hostname.
+func (hm *hostnameMatcher[T]) lookup(hostname string) (T, bool) {
+	normalizedHostname := normalizeHostname(hostname)
+
+	if value, ok := hm.exact[normalizedHostname]; ok {
+		return value, true
+	}
+
+	// Walk the labels from left to right, so the most specific wildcard matches first
+	for i := range len(normalizedHostname) {
+		if normalizedHostname[i] != '.' {
+			continue
+		}
+
+		if value, ok := hm.wildcard[normalizedHostname[i:]]; ok {
+			return value, true
+		}
+	}
+
+	var empty T
+
+	return empty, false
+}
+
+// hostnameRoutes maps hostnames to backends, with an optional default backend for hostnames without route.
+type hostnameRoutes struct {
+	hosts          *hostnameMatcher[backends.Backend]
+	defaultBackend backends.Backend
+}
+
+// newHostnameRoutes creates a new hostnameRoutes for given hostname to backend name mapping. If defaultTarget
+// is not empty, the backend with that name is used for all hostnames without matching route.
+func newHostnameRoutes(routes map[string]string, defaultTarget string, backendList *backends.BackendList) (*hostnameRoutes, error) {
+	hr := &hostnameRoutes{
+		hosts:          newHostnameMatcher[backends.Backend](),
+		defaultBackend: nil,
+	}
+
+	for hostname, target := range routes {
+		targetBackend, ok := backendList.Get(target)
+		if !ok {
+			return nil, fmt.Errorf("target backend '%s' for hostname '%s' does not exist", target, hostname)
+		}
+
+		if err := hr.hosts.set(hostname, targetBackend); err != nil {
+			return nil, err
+		}
+	}
+
+	if defaultTarget != "" {
+		defaultBackend, ok := backendList.Get(defaultTarget)
+		if !ok {
+			return nil, fmt.Errorf("default backend '%s' does not exist", defaultTarget)
+		}
+
+		hr.defaultBackend = defaultBackend
+	}
+
+	return hr, nil
+}
+
+// lookup returns the backend for given hostname, falling back to the default backend. The second return value
+// is false, if neither a route matches nor a default backend is configured.
+func (hr *hostnameRoutes) lookup(hostname string) (backends.Backend, bool) {
+	if backend, ok := hr.hosts.lookup(hostname); ok {
+		return backend, true
+	}
+
+	return hr.defaultBackend, hr.defaultBackend != nil
+}
+
+// parseHostnamePattern normalizes given hostname, that can start with a wildcard label like "*.example.com".
+// For wildcards, the returned pattern is the suffix matched by the wildcard, like ".example.com".
+func parseHostnamePattern(hostname string) (string, bool, error) {
+	normalizedHostname := normalizeHostname(hostname)
+
+	if suffix, isWildcard := strings.CutPrefix(normalizedHostname, "*"); isWildcard {
+		if !strings.HasPrefix(suffix, ".") || len(suffix) == 1 || strings.Contains(suffix, "*") {
+			return "", false, fmt.Errorf("invalid wildcard hostname '%s'", hostname)
+		}
+
+		return suffix, true, nil
+	}
+
+	if normalizedHostname == "" || strings.Contains(normalizedHostname, "*") {
+		return "", false, fmt.Errorf("invalid hostname '%s'", hostname)
+	}
+
+	return normalizedHostname, false, nil
+}
+
+// normalizeHostname lowercases given hostname and removes a trailing dot, so "NAS.example.com." and
+// "nas.example.com" match the same route.
+func normalizeHostname(hostname string) string {
+	return strings.TrimSuffix(strings.ToLower(hostname), ".")
+}
@@ -0,0 +1,88 @@
+package frontends
+
+import (
+	"testing"
+)
+
+func TestHostnameRoutes_Lookup(t *testing.T) {
+	backendList := createTestBackendList("nas", "web", "deep", "fallback")
+
+	routes, err := newHostnameRoutes(map[string]string{
+		"nas.example.com":     "nas",
+		"*.example.com":       "web",
+		"*.deep.example.com":  "deep",
+		"Upper.Example.Com":   "nas",
+		"trailing.example.ch": "nas",
+	}, "fallback", backendList)
+	if err != nil {
+		t.Fatalf("newHostnameRoutes() failed: %v", err)
+	}
+
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{hostname: "nas.example.com", want: "nas"},
+		{hostname: "NAS.example.com.", want: "nas"},
+		{hostname: "upper.example.com", want: "nas"},
+		{hostname: "trailing.example.ch.", want: "nas"},
+		{hostname: "files.example.com", want: "web"},
+		{hostname: "a.b.example.com", want: "web"},
+		{hostname: "files.deep.example.com", want: "deep"},
+		{hostname: "deep.example.com", want: "web"},
+		{hostname: "example.com", want: "fallback"},
+		{hostname: "other.org", want: "fallback"},
+		{hostname: "", want: "fallback"},
+	}
+
+	for _, tt := range tests {
+		backend, ok := routes.lookup(tt.hostname)
+		if !ok {
+			t.Errorf("lookup(%q) found no backend, want %q", tt.hostname, tt.want)
+			continue
+		}
+
+		if backend.GetName() != tt.want {
+			t.Errorf("lookup(%q) = %q, want %q", tt.hostname, backend.GetName(), tt.want)
+		}
+	}
+}
+
+func TestHostnameRoutes_Lookup_NoDefault(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	routes, err := newHostnameRoutes(map[string]string{"nas.example.com": "nas"}, "", backendList)
+	if err != nil {
+		t.Fatalf("newHostnameRoutes() failed: %v", err)
+	}
+
+	if backend, ok := routes.lookup("other.example.com"); ok {
+		t.Errorf("lookup() = %q, expected no backend without default", backend.GetName())
+	}
+}
+
+func TestHostnameRoutes_NewHostnameRoutes_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	tests := []struct {
+		name          string
+		routes        map[string]string
+		defaultTarget string
+	}{
+		{name: "unknown backend", routes: map[string]string{"nas.example.com": "unknown"}},
+		{name: "unknown default", routes: map[string]string{}, defaultTarget: "unknown"},
+		{name: "wildcard without dot", routes: map[string]string{"*example.com": "nas"}},
+		{name: "wildcard only", routes: map[string]string{"*.": "nas"}},
+		{name: "wildcard in middle", routes: map[string]string{"nas.*.example.com": "nas"}},
+		{name: "multiple wildcards", routes: map[string]string{"*.*.example.com": "nas"}},
+		{name: "empty hostname", routes: map[string]string{"": "nas"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHostnameRoutes(tt.routes, tt.defaultTarget, backendList); err == nil {
+				t.Error("expected newHostnameRoutes() to fail")
+			}
+		})
+	}
+}
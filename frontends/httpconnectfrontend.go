@@ -0,0 +1,288 @@
+package frontends
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	httpConnectEstablishedResponse = "HTTP/1.1 200 Connection Established\r\n\r\n"
+	httpConnectAuthenticateRealm   = `Basic realm="pluggo"`
+)
+
+type httpConnectFrontend struct {
+	*tcpListeners
+
+	rules          []destinationRule
+	unmatched      unmatchedPolicy
+	users          proxyUsers
+	connectTimeout time.Duration
+	dialer         dialer
+	directPipes    *directPipes
+}
+
+// newHTTPConnectFrontend creates a new instance of an httpConnectFrontend, preparing it with all default dependencies.
+func newHTTPConnectFrontend(conf config.HTTPConnectFrontendConfig, backendList *backends.BackendList) (*httpConnectFrontend, error) {
+	parsedListenAddr, err := net.ResolveTCPAddr("tcp", conf.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+	}
+
+	rules, err := newDestinationRules(conf.Rules, backendList)
+	if err != nil {
+		return nil, fmt.Errorf("could not create rules of frontend '%s': %w", conf.Name, err)
+	}
+
+	unmatched, err := parseUnmatchedPolicy(conf.Unmatched)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config of frontend '%s': %w", conf.Name, err)
+	}
+
+	users, err := newProxyUsers(conf.Users)
+	if err != nil {
+		return nil, fmt.Errorf("invalid users of frontend '%s': %w", conf.Name, err)
+	}
+
+	connectTimeout := conf.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = proxyDefaultConnectTimeout
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options of frontend '%s': %w", conf.Name, err)
+	}
+
+	return &httpConnectFrontend{
+		tcpListeners:   newTCPListeners(conf.Name, "httpconnectfrontend", []*net.TCPAddr{parsedListenAddr}, limiter, socketOptions),
+		rules:          rules,
+		unmatched:      unmatched,
+		users:          users,
+		connectTimeout: connectTimeout,
+		dialer:         defaultDialer{socketOptions: socketOptions},
+		directPipes:    newDirectPipes(),
+	}, nil
+}
+
+// Listen creates a TCP listener, starts listening and accepting connections. Every accepted connection gets
+// its CONNECT request read in its own go-routine, and is handed to the backend matching the requested destination.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen is resilient in that it does not stop accepting connections just because an error happens.
+func (fe *httpConnectFrontend) Listen() error {
+	return fe.listen(func(connection net.Conn) {
+		go fe.handle(connection)
+	}, fe.acceptGates())
+}
+
+// Close closes all listening instances if existing, and all connections it dialed directly.
+func (fe *httpConnectFrontend) Close() error {
+	fe.directPipes.closeAll()
+
+	return fe.tcpListeners.Close()
+}
+
+// handle reads the CONNECT request of given connection, and hands the connection to the backend of the first
+// rule matching the requested destination. Destinations without matching rule get dialed directly or rejected,
+// depending on the configured unmatched policy.
+func (fe *httpConnectFrontend) handle(connection net.Conn) {
+	reader := bufio.NewReaderSize(connection, httpMaxHeaderLength)
+
+	host, port, err := fe.readConnectRequest(connection, reader)
+	if err != nil {
+		slog.Debug(
+			"httpconnectfrontend could not read request",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+
+		return
+	}
+
+	destination := net.JoinHostPort(host, strconv.Itoa(port))
+	// Clients may send data right after their request, so everything already read has to be kept
+	bufferedConnection := newBufferedConn(connection, reader)
+
+	if rule, ok := matchDestinationRules(fe.rules, host, port); ok {
+		slog.Debug(
+			"httpconnectfrontend routed connection",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.String("destination", destination),
+			slog.String("backend", rule.targetBackend.GetName()),
+		)
+
+		rule.targetBackend.Handle(newEstablishingConn(
+			bufferedConnection,
+			fe.connectTimeout,
+			func() error {
+				if _, err := connection.Write([]byte(httpConnectEstablishedResponse)); err != nil {
+					return fmt.Errorf("could not write http response: %w", err)
+				}
+
+				return nil
+			},
+			func(timedOut bool) {
+				status := http.StatusBadGateway
+				if timedOut {
+					status = http.StatusGatewayTimeout
+				}
+
+				if err := writeHTTPErrorResponse(connection, status, nil); err != nil {
+					slog.Debug("could not write http error response", slog.Any("error", err))
+				}
+			},
+		))
+
+		return
+	}
+
+	if fe.unmatched == unmatchedDirect {
+		fe.dialDirect(bufferedConnection, destination)
+		return
+	}
+
+	slog.Debug(
+		"httpconnectfrontend rejected destination without rule",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("destination", destination),
+	)
+	writeHTTPError(connection, http.StatusForbidden, nil)
+}
+
+// readConnectRequest reads the CONNECT request of given connection, checks its credentials, and returns
+// the requested destination. The request gets consumed from given reader. If the request can't be served,
+// the client gets the matching error response and the connection gets closed.
+func (fe *httpConnectFrontend) readConnectRequest(connection net.Conn, reader *bufio.Reader) (string, int, error) {
+	request, header, status, err := readHTTPRequest(connection, reader)
+	if err != nil {
+		if status != 0 {
+			writeHTTPError(connection, status, nil)
+		} else {
+			closeUnroutedConnection(connection)
+		}
+
+		return "", 0, err
+	}
+
+	// readHTTPRequest only peeks, so the already buffered headers get dropped here
+	if _, err = reader.Discard(len(header)); err != nil {
+		closeUnroutedConnection(connection)
+		return "", 0, fmt.Errorf("could not consume request headers: %w", err)
+	}
+
+	if request.Method != http.MethodConnect {
+		writeHTTPError(connection, http.StatusMethodNotAllowed, http.Header{"Allow": {http.MethodConnect}})
+		return "", 0, fmt.Errorf("unsupported method '%s'", request.Method)
+	}
+
+	if fe.users.authRequired() {
+		username, password, ok := parseProxyAuthorization(request.Header.Get("Proxy-Authorization"))
+		if !ok || !fe.users.check(username, password) {
+			writeHTTPError(connection, http.StatusProxyAuthRequired, http.Header{"Proxy-Authenticate": {httpConnectAuthenticateRealm}})
+			return "", 0, fmt.Errorf("missing or invalid credentials for user '%s'", username)
+		}
+	}
+
+	host, port, err := parseConnectAuthority(request.Host)
+	if err != nil {
+		writeHTTPError(connection, http.StatusBadRequest, nil)
+		return "", 0, err
+	}
+
+	return host, port, nil
+}
+
+// dialDirect dials given destination without any backend and pipes given connection to it.
+func (fe *httpConnectFrontend) dialDirect(connection net.Conn, destination string) {
+	connectionToTarget, err := fe.dialer.DialTimeout("tcp", destination, proxyDirectDialTimeout)
+	if err != nil {
+		slog.Debug(
+			"httpconnectfrontend could not dial destination directly",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.String("destination", destination),
+			slog.Any("error", err),
+		)
+
+		status := http.StatusBadGateway
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			status = http.StatusGatewayTimeout
+		}
+
+		writeHTTPError(connection, status, nil)
+
+		return
+	}
+
+	if _, err = connection.Write([]byte(httpConnectEstablishedResponse)); err != nil {
+		slog.Debug("could not write http response", slog.Any("error", err))
+		closeUnroutedConnection(connection)
+		closeUnroutedConnection(connectionToTarget)
+
+		return
+	}
+
+	slog.Debug(
+		"httpconnectfrontend dialed destination directly",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("destination", destination),
+	)
+
+	fe.directPipes.pipe(connection, connectionToTarget)
+}
+
+// parseConnectAuthority parses the authority of a CONNECT request into its host and port.
+func parseConnectAuthority(authority string) (string, int, error) {
+	host, portString, err := net.SplitHostPort(authority)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid destination '%s': %w", authority, err)
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil || port == 0 {
+		return "", 0, fmt.Errorf("invalid port in destination '%s'", authority)
+	}
+
+	if host == "" {
+		return "", 0, fmt.Errorf("missing host in destination '%s'", authority)
+	}
+
+	return host, int(port), nil
+}
+
+// parseProxyAuthorization parses the credentials of given Proxy-Authorization header value, which have to use
+// the Basic scheme.
+func parseProxyAuthorization(value string) (string, string, bool) {
+	scheme, encoded, ok := strings.Cut(value, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(decoded), ":")
+}
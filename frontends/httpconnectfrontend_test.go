@@ -0,0 +1,375 @@
+package frontends
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// sendTestConnectRequest sends given raw request to given address, and returns the connection together with
+// a reader positioned right after the response headers, and the response.
+func sendTestConnectRequest(t *testing.T, addr string, rawRequest string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+
+	clientConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	clientConn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	clientConn.Write([]byte(rawRequest))
+
+	reader := bufio.NewReader(clientConn)
+	response, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatalf("could not read response: %v", err)
+	}
+
+	return clientConn, reader, response
+}
+
+func TestHTTPConnectFrontend_GetName(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newHTTPConnectFrontend(config.HTTPConnectFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:3128",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newHTTPConnectFrontend() failed: %v", err)
+	}
+
+	if got := frontend.GetName(); got != "test-frontend" {
+		t.Errorf("GetName() = %q, want %q", got, "test-frontend")
+	}
+	if frontend.connectTimeout != proxyDefaultConnectTimeout {
+		t.Errorf("connectTimeout = %v, want default %v", frontend.connectTimeout, proxyDefaultConnectTimeout)
+	}
+}
+
+func TestHTTPConnectFrontend_NewHTTPConnectFrontend_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	tests := []struct {
+		name string
+		conf config.HTTPConnectFrontendConfig
+	}{
+		{
+			name: "invalid listenAddr",
+			conf: config.HTTPConnectFrontendConfig{Name: "test-frontend", ListenAddr: "invalid"},
+		},
+		{
+			name: "unknown rule target",
+			conf: config.HTTPConnectFrontendConfig{
+				Name:       "test-frontend",
+				ListenAddr: "127.0.0.1:3128",
+				Rules:      []config.DestinationRuleConfig{{Destination: "nas.example.com", Target: "unknown"}},
+			},
+		},
+		{
+			name: "unknown unmatched policy",
+			conf: config.HTTPConnectFrontendConfig{Name: "test-frontend", ListenAddr: "127.0.0.1:3128", Unmatched: "allow"},
+		},
+		{
+			name: "invalid user",
+			conf: config.HTTPConnectFrontendConfig{
+				Name:       "test-frontend",
+				ListenAddr: "127.0.0.1:3128",
+				Users:      []config.ProxyUserConfig{{Username: ""}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHTTPConnectFrontend(tt.conf, backendList); err == nil {
+				t.Error("expected newHTTPConnectFrontend() to fail")
+			}
+		})
+	}
+}
+
+func TestHTTPConnectFrontend_Listen_RoutesByDestination(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newHTTPConnectFrontend(config.HTTPConnectFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:3128",
+		Rules:      []config.DestinationRuleConfig{{Destination: "nas.example.com:22", Target: "nas"}},
+		Users:      []config.ProxyUserConfig{{Username: "alice", Password: "secret"}},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newHTTPConnectFrontend() failed: %v", err)
+	}
+
+	frontend.rules[0].targetBackend = newAnsweringBackend("nas")
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	credentials := base64.StdEncoding.EncodeToString([]byte("alice:secret"))
+	// Data sent right after the request has to reach the backend as well
+	clientConn, reader, response := sendTestConnectRequest(
+		t,
+		listenAddr,
+		"CONNECT nas.example.com:22 HTTP/1.1\r\nHost: nas.example.com:22\r\nProxy-Authorization: Basic "+credentials+"\r\n\r\nhello",
+	)
+	defer clientConn.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", response.StatusCode, http.StatusOK)
+	}
+
+	clientConn.(*net.TCPConn).CloseWrite()
+
+	answer, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read answer: %v", err)
+	}
+	if string(answer) != "nas:hello" {
+		t.Errorf("got answer %q, want %q", string(answer), "nas:hello")
+	}
+}
+
+func TestHTTPConnectFrontend_Listen_ReportsBackendFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		backend    *mockBackend
+		wantStatus int
+	}{
+		{
+			name:       "backend closes connection",
+			backend:    &mockBackend{name: "nas"},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "backend does not connect in time",
+			backend:    &mockBackend{name: "nas", mockHandle: func(_ net.Conn) {}},
+			wantStatus: http.StatusGatewayTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontend, err := newHTTPConnectFrontend(config.HTTPConnectFrontendConfig{
+				Name:           "test-frontend",
+				ListenAddr:     "127.0.0.1:3128",
+				Rules:          []config.DestinationRuleConfig{{Destination: "nas.example.com", Target: "nas"}},
+				ConnectTimeout: 50 * time.Millisecond,
+			}, createTestBackendList("nas"))
+			if err != nil {
+				t.Fatalf("newHTTPConnectFrontend() failed: %v", err)
+			}
+
+			frontend.rules[0].targetBackend = tt.backend
+
+			listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+			defer func() {
+				frontend.Close()
+				<-listenDone
+			}()
+
+			clientConn, _, response := sendTestConnectRequest(t, listenAddr, "CONNECT nas.example.com:22 HTTP/1.1\r\n\r\n")
+			defer clientConn.Close()
+
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", response.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHTTPConnectFrontend_Listen_RejectsRequests(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newHTTPConnectFrontend(config.HTTPConnectFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:3128",
+		Rules:      []config.DestinationRuleConfig{{Destination: "nas.example.com", Target: "nas"}},
+		Users:      []config.ProxyUserConfig{{Username: "alice", Password: "secret"}},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newHTTPConnectFrontend() failed: %v", err)
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	authorization := "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")) + "\r\n"
+
+	tests := []struct {
+		name       string
+		rawRequest string
+		wantStatus int
+		wantHeader string
+	}{
+		{
+			name:       "missing credentials",
+			rawRequest: "CONNECT nas.example.com:22 HTTP/1.1\r\n\r\n",
+			wantStatus: http.StatusProxyAuthRequired,
+			wantHeader: "Proxy-Authenticate",
+		},
+		{
+			name:       "wrong credentials",
+			rawRequest: "CONNECT nas.example.com:22 HTTP/1.1\r\nProxy-Authorization: Basic YWxpY2U6d3Jvbmc=\r\n\r\n",
+			wantStatus: http.StatusProxyAuthRequired,
+			wantHeader: "Proxy-Authenticate",
+		},
+		{
+			name:       "other method",
+			rawRequest: "GET http://nas.example.com/ HTTP/1.1\r\nHost: nas.example.com\r\n" + authorization + "\r\n",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: "Allow",
+		},
+		{
+			name:       "destination without rule",
+			rawRequest: "CONNECT other.example.com:22 HTTP/1.1\r\n" + authorization + "\r\n",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "destination without port",
+			rawRequest: "CONNECT nas.example.com HTTP/1.1\r\n" + authorization + "\r\n",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, _, response := sendTestConnectRequest(t, listenAddr, tt.rawRequest)
+			defer clientConn.Close()
+
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", response.StatusCode, tt.wantStatus)
+			}
+			if tt.wantHeader != "" && response.Header.Get(tt.wantHeader) == "" {
+				t.Errorf("expected response to contain header %q", tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestHTTPConnectFrontend_Listen_DialsUnmatchedDirectly(t *testing.T) {
+	frontend, err := newHTTPConnectFrontend(config.HTTPConnectFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:3128",
+		Unmatched:  "direct",
+	}, createTestBackendList())
+	if err != nil {
+		t.Fatalf("newHTTPConnectFrontend() failed: %v", err)
+	}
+
+	dialedAddress := make(chan string, 1)
+	frontend.dialer = &mockDialer{
+		mockDialTimeout: func(_, address string, _ time.Duration) (net.Conn, error) {
+			dialedAddress <- address
+
+			clientSide, serverSide := net.Pipe()
+			go func() {
+				defer serverSide.Close()
+				io.Copy(serverSide, serverSide)
+			}()
+
+			return clientSide, nil
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, reader, response := sendTestConnectRequest(t, listenAddr, "CONNECT [2001:db8::1]:443 HTTP/1.1\r\n\r\n")
+	defer clientConn.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	if got := <-dialedAddress; got != "[2001:db8::1]:443" {
+		t.Errorf("dialed %q, want %q", got, "[2001:db8::1]:443")
+	}
+
+	clientConn.Write([]byte("hello"))
+
+	answer := make([]byte, len("hello"))
+	if _, err = io.ReadFull(reader, answer); err != nil {
+		t.Fatalf("could not read answer: %v", err)
+	}
+	if string(answer) != "hello" {
+		t.Errorf("got answer %q, want %q", string(answer), "hello")
+	}
+}
+
+func TestParseProxyAuthorization(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        string
+		wantUsername string
+		wantPassword string
+		wantOK       bool
+	}{
+		{name: "valid", value: "Basic YWxpY2U6c2VjcmV0", wantUsername: "alice", wantPassword: "secret", wantOK: true},
+		{name: "scheme case insensitive", value: "basic YWxpY2U6c2VjcmV0", wantUsername: "alice", wantPassword: "secret", wantOK: true},
+		{name: "colon in password", value: "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:a:b")), wantUsername: "alice", wantPassword: "a:b", wantOK: true},
+		{name: "empty", value: "", wantOK: false},
+		{name: "other scheme", value: "Bearer YWxpY2U6c2VjcmV0", wantOK: false},
+		{name: "invalid base64", value: "Basic !!!", wantOK: false},
+		{name: "missing colon", value: "Basic " + base64.StdEncoding.EncodeToString([]byte("alice")), wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, password, ok := parseProxyAuthorization(tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf("parseProxyAuthorization() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (username != tt.wantUsername || password != tt.wantPassword) {
+				t.Errorf("parseProxyAuthorization() = %q, %q, want %q, %q", username, password, tt.wantUsername, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestParseConnectAuthority(t *testing.T) {
+	tests := []struct {
+		authority string
+		wantHost  string
+		wantPort  int
+		wantErr   bool
+	}{
+		{authority: "nas.example.com:22", wantHost: "nas.example.com", wantPort: 22},
+		{authority: "192.168.0.10:443", wantHost: "192.168.0.10", wantPort: 443},
+		{authority: "[fd00::1]:8443", wantHost: "fd00::1", wantPort: 8443},
+		{authority: "nas.example.com", wantErr: true},
+		{authority: "nas.example.com:0", wantErr: true},
+		{authority: "nas.example.com:70000", wantErr: true},
+		{authority: ":22", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		host, port, err := parseConnectAuthority(tt.authority)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("expected parseConnectAuthority(%q) to fail", tt.authority)
+			}
+
+			continue
+		}
+
+		if err != nil || host != tt.wantHost || port != tt.wantPort {
+			t.Errorf("parseConnectAuthority(%q) = %q, %d, %v, want %q, %d", tt.authority, host, port, err, tt.wantHost, tt.wantPort)
+		}
+	}
+}
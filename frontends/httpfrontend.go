@@ -0,0 +1,221 @@
+package frontends
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	httpHeaderTimeout   = 10 * time.Second
+	httpLingerTimeout   = time.Second
+	httpMaxHeaderLength = 16 * 1024
+)
+
+type httpFrontend struct {
+	*tcpListeners
+
+	routes *httpRoutes
+}
+
+// newHTTPFrontend creates a new instance of an httpFrontend, preparing it with all default dependencies.
+func newHTTPFrontend(conf config.HTTPFrontendConfig, backendList *backends.BackendList) (*httpFrontend, error) {
+	parsedListenAddr, err := net.ResolveTCPAddr("tcp", conf.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+	}
+
+	routes, err := newHTTPRoutes(conf.Routes, conf.Default, backendList)
+	if err != nil {
+		return nil, fmt.Errorf("could not create routes of frontend '%s': %w", conf.Name, err)
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options of frontend '%s': %w", conf.Name, err)
+	}
+
+	return &httpFrontend{
+		tcpListeners: newTCPListeners(conf.Name, "httpfrontend", []*net.TCPAddr{parsedListenAddr}, limiter, socketOptions),
+		routes:       routes,
+	}, nil
+}
+
+// Listen creates a TCP listener, starts listening and accepting connections. Every accepted connection gets
+// routed in its own go-routine, based on the host and path of the first HTTP request on the connection.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen is resilient in that it does not stop accepting connections just because an error happens.
+func (fe *httpFrontend) Listen() error {
+	return fe.listen(func(connection net.Conn) {
+		go fe.route(connection)
+	}, fe.acceptGates())
+}
+
+// route reads the request line and headers of the first request on given connection, and hands the connection
+// to the backend matching the requested host and path. The buffered request gets replayed byte-for-byte, so the
+// backend receives the request exactly like the client sent it. Invalid requests and requests without matching
+// backend get answered with an error status, and the connection gets closed.
+func (fe *httpFrontend) route(connection net.Conn) {
+	reader := bufio.NewReaderSize(connection, httpMaxHeaderLength)
+
+	request, _, status, err := readHTTPRequest(connection, reader)
+	if err != nil {
+		slog.Debug(
+			"httpfrontend could not read request",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+
+		if status != 0 {
+			writeHTTPError(connection, status, nil)
+		} else {
+			closeUnroutedConnection(connection)
+		}
+
+		return
+	}
+
+	host := hostWithoutPort(request.Host)
+
+	targetBackend, ok := fe.routes.lookup(host, request.URL.Path)
+	if !ok {
+		slog.Debug(
+			"httpfrontend found no backend for request",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.String("host", host),
+			slog.String("path", request.URL.Path),
+		)
+		writeHTTPError(connection, http.StatusNotFound, nil)
+
+		return
+	}
+
+	slog.Debug(
+		"httpfrontend routed connection",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("host", host),
+		slog.String("path", request.URL.Path),
+		slog.String("backend", targetBackend.GetName()),
+	)
+
+	targetBackend.Handle(newBufferedConn(connection, reader))
+}
+
+// readHTTPRequest reads the request line and headers from given connection into given reader, without consuming
+// them, and parses them. Besides the parsed request, the raw request line and headers still buffered in given
+// reader are returned, so callers can consume them. If reading or parsing fails, the returned status is the status
+// to answer the client with, or 0 if the client shouldn't get an answer, like when it didn't send its headers in time.
+func readHTTPRequest(connection net.Conn, reader *bufio.Reader) (*http.Request, []byte, int, error) {
+	if err := connection.SetDeadline(time.Now().Add(httpHeaderTimeout)); err != nil {
+		return nil, nil, 0, fmt.Errorf("could not set deadline: %w", err)
+	}
+	defer func() {
+		if err := connection.SetDeadline(time.Time{}); err != nil {
+			slog.Debug("could not reset deadline", slog.Any("error", err))
+		}
+	}()
+
+	header, err := peekHTTPHeader(reader)
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, nil, http.StatusRequestHeaderFieldsTooLarge, errors.New("request headers too large")
+	}
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("could not read request headers: %w", err)
+	}
+
+	request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(header)))
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("could not parse request: %w", err)
+	}
+
+	return request, header, 0, nil
+}
+
+// peekHTTPHeader peeks from given reader until the end of the request headers, and returns the request line
+// and headers. If the headers don't fit into the reader, bufio.ErrBufferFull is returned.
+func peekHTTPHeader(reader *bufio.Reader) ([]byte, error) {
+	headerTerminator := []byte("\r\n\r\n")
+
+	var err error
+
+	for {
+		data, _ := reader.Peek(reader.Buffered())
+
+		if headerEnd := bytes.Index(data, headerTerminator); headerEnd != -1 {
+			return data[:headerEnd+len(headerTerminator)], nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Only wait for more data once the buffered data is known to be incomplete
+		_, err = reader.Peek(len(data) + 1)
+	}
+}
+
+// hostWithoutPort removes the port from given host header value, if present.
+func hostWithoutPort(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return hostname
+	}
+
+	return strings.Trim(host, "[]")
+}
+
+// writeHTTPError answers given connection with an empty response of given status and header, and closes the
+// connection. Before closing, unread request data gets drained for up to httpLingerTimeout, as closing
+// a connection with unread data resets it, which might drop the response before the client reads it.
+func writeHTTPError(connection net.Conn, status int, header http.Header) {
+	if err := writeHTTPErrorResponse(connection, status, header); err != nil {
+		slog.Debug("could not write http error response", slog.Any("error", err))
+	}
+
+	if halfCloser, ok := connection.(interface{ CloseWrite() error }); ok && halfCloser.CloseWrite() == nil {
+		if err := connection.SetReadDeadline(time.Now().Add(httpLingerTimeout)); err == nil {
+			// Errors don't matter here, as the connection gets closed anyway
+			_, _ = io.Copy(io.Discard, connection)
+		}
+	}
+
+	closeUnroutedConnection(connection)
+}
+
+// writeHTTPErrorResponse writes an empty response of given status and header to given writer, telling the client
+// that the connection gets closed.
+func writeHTTPErrorResponse(writer io.Writer, status int, header http.Header) error {
+	var response bytes.Buffer
+
+	fmt.Fprintf(&response, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+
+	if err := header.Write(&response); err != nil {
+		return fmt.Errorf("could not write http header: %w", err)
+	}
+
+	response.WriteString("Connection: close\r\nContent-Length: 0\r\n\r\n")
+
+	if _, err := writer.Write(response.Bytes()); err != nil {
+		return fmt.Errorf("could not write http response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package frontends
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// sendTestRequest sends given raw request to given address, closes the writing side, and returns everything
+// the server answered.
+func sendTestRequest(t *testing.T, addr string, rawRequest string) string {
+	t.Helper()
+
+	clientConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	clientConn.Write([]byte(rawRequest))
+	clientConn.(*net.TCPConn).CloseWrite()
+
+	clientConn.SetReadDeadline(time.Now().Add(time.Second))
+	answer, err := io.ReadAll(clientConn)
+	if err != nil {
+		t.Fatalf("could not read answer: %v", err)
+	}
+
+	return string(answer)
+}
+
+func TestHTTPFrontend_GetName(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newHTTPFrontend(config.HTTPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Default:    "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newHTTPFrontend() failed: %v", err)
+	}
+
+	if got := frontend.GetName(); got != "test-frontend" {
+		t.Errorf("GetName() = %q, want %q", got, "test-frontend")
+	}
+}
+
+func TestHTTPFrontend_NewHTTPFrontend_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	tests := []struct {
+		name string
+		conf config.HTTPFrontendConfig
+	}{
+		{
+			name: "invalid listenAddr",
+			conf: config.HTTPFrontendConfig{Name: "test-frontend", ListenAddr: "invalid", Default: "test-backend"},
+		},
+		{
+			name: "unknown route target",
+			conf: config.HTTPFrontendConfig{
+				Name:       "test-frontend",
+				ListenAddr: "127.0.0.1:8080",
+				Routes:     []config.HTTPRouteConfig{{Host: "nas.example.com", Target: "unknown"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHTTPFrontend(tt.conf, backendList); err == nil {
+				t.Error("expected newHTTPFrontend() to fail")
+			}
+		})
+	}
+}
+
+func TestHTTPFrontend_Listen_RoutesByHostAndPath(t *testing.T) {
+	backendList := createTestBackendList("nas", "nas-api")
+
+	frontend, err := newHTTPFrontend(config.HTTPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Routes: []config.HTTPRouteConfig{
+			{Host: "nas.example.com", Target: "nas"},
+			{Host: "nas.example.com", PathPrefix: "/api", Target: "nas-api"},
+		},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newHTTPFrontend() failed: %v", err)
+	}
+
+	frontend.routes.hosts.exact["nas.example.com"] = []httpPathRoute{
+		{pathPrefix: "/api", targetBackend: newAnsweringBackend("nas-api")},
+		{pathPrefix: "", targetBackend: newAnsweringBackend("nas")},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	tests := []struct {
+		name       string
+		rawRequest string
+		want       string
+	}{
+		{
+			name:       "path prefix",
+			rawRequest: "POST /api/users HTTP/1.1\r\nHost: NAS.example.com:8080\r\nX-Custom:  kept as is \r\nContent-Length: 4\r\n\r\nbody",
+			want:       "nas-api:",
+		},
+		{
+			name:       "host only",
+			rawRequest: "GET /index.html HTTP/1.1\r\nHost: nas.example.com\r\n\r\n",
+			want:       "nas:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The backend has to receive the request byte-for-byte, including the body
+			answer := sendTestRequest(t, listenAddr, tt.rawRequest)
+			if answer != tt.want+tt.rawRequest {
+				t.Errorf("got answer %q, want %q", answer, tt.want+tt.rawRequest)
+			}
+		})
+	}
+}
+
+func TestHTTPFrontend_Listen_AnswersUnroutableRequests(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newHTTPFrontend(config.HTTPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Routes:     []config.HTTPRouteConfig{{Host: "nas.example.com", Target: "nas"}},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newHTTPFrontend() failed: %v", err)
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	tests := []struct {
+		name       string
+		rawRequest string
+		wantStatus int
+	}{
+		{
+			name:       "unknown host",
+			rawRequest: "GET / HTTP/1.1\r\nHost: other.example.com\r\n\r\n",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid request",
+			rawRequest: "hello world\r\n\r\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "headers too large",
+			rawRequest: "GET / HTTP/1.1\r\nHost: nas.example.com\r\nX-Large: " + strings.Repeat("a", httpMaxHeaderLength) + "\r\n\r\n",
+			wantStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer := sendTestRequest(t, listenAddr, tt.rawRequest)
+
+			response, err := http.ReadResponse(bufio.NewReader(strings.NewReader(answer)), nil)
+			if err != nil {
+				t.Fatalf("could not parse answer %q: %v", answer, err)
+			}
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", response.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHTTPFrontend_Listen_AnswersRequestsWithoutBody(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newHTTPFrontend(config.HTTPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Routes:     []config.HTTPRouteConfig{{Host: "nas.example.com", Target: "nas"}},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newHTTPFrontend() failed: %v", err)
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	// The client keeps the connection open, waiting for its response, so the headers have to be complete once
+	// the empty line arrived
+	clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: other.example.com\r\n\r\n"))
+	clientConn.SetReadDeadline(time.Now().Add(time.Second))
+
+	response, err := http.ReadResponse(bufio.NewReader(clientConn), nil)
+	if err != nil {
+		t.Fatalf("could not read response before the header timeout: %v", err)
+	}
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", response.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestHTTPFrontend_Listen_ClosesSilentConnections(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newHTTPFrontend(config.HTTPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Routes:     []config.HTTPRouteConfig{{Host: "nas.example.com", Target: "nas"}},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newHTTPFrontend() failed: %v", err)
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	// The client sends nothing, so the frontend has to close the connection without an answer
+	if answer := sendTestRequest(t, listenAddr, ""); answer != "" {
+		t.Errorf("got answer %q, want none", answer)
+	}
+}
+
+func TestPeekHTTPHeader_DoesNotWaitForMoreData(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+	defer serverSide.Close()
+
+	// The client keeps the connection open, waiting for its response
+	go clientSide.Write([]byte("GET / HTTP/1.1\r\nHost: nas.example.com\r\n\r\n"))
+
+	serverSide.SetReadDeadline(time.Now().Add(time.Second))
+
+	header, err := peekHTTPHeader(bufio.NewReader(serverSide))
+	if err != nil {
+		t.Fatalf("peekHTTPHeader() failed: %v", err)
+	}
+	if string(header) != "GET / HTTP/1.1\r\nHost: nas.example.com\r\n\r\n" {
+		t.Errorf("peekHTTPHeader() = %q, want the complete request", string(header))
+	}
+}
+
+func TestHostWithoutPort(t *testing.T) {
+	tests := map[string]string{
+		"nas.example.com":      "nas.example.com",
+		"nas.example.com:8080": "nas.example.com",
+		"[::1]:8080":           "::1",
+		"[::1]":                "::1",
+		"":                     "",
+	}
+
+	for host, want := range tests {
+		if got := hostWithoutPort(host); got != want {
+			t.Errorf("hostWithoutPort(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package frontends
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/config"
+)
+
+// httpPathRoute routes requests with a path starting with pathPrefix to its target backend.
+type httpPathRoute struct {
+	pathPrefix    string
+	targetBackend backends.Backend
+}
+
+// httpRoutes maps the host and path of HTTP requests to backends, with an optional default backend for
+// requests without route. Hosts are matched like in hostnameMatcher, and for the most specific matching host,
+// the route with the longest matching path prefix wins.
+type httpRoutes struct {
+	hosts          *hostnameMatcher[[]httpPathRoute]
+	defaultBackend backends.Backend
+}
+
+// newHTTPRoutes creates a new httpRoutes for given route configs. If defaultTarget is not empty, the backend
+// with that name is used for all requests without matching route.
+func newHTTPRoutes(confs []config.HTTPRouteConfig, defaultTarget string, backendList *backends.BackendList) (*httpRoutes, error) {
+	hr := &httpRoutes{
+		hosts:          newHostnameMatcher[[]httpPathRoute](),
+		defaultBackend: nil,
+	}
+
+	for _, routeConf := range confs {
+		if routeConf.Host == "" {
+			return nil, errors.New("route without host")
+		}
+
+		if routeConf.PathPrefix != "" && !strings.HasPrefix(routeConf.PathPrefix, "/") {
+			return nil, fmt.Errorf("pathPrefix '%s' of host '%s' does not start with '/'", routeConf.PathPrefix, routeConf.Host)
+		}
+
+		targetBackend, ok := backendList.Get(routeConf.Target)
+		if !ok {
+			return nil, fmt.Errorf("target backend '%s' for host '%s' does not exist", routeConf.Target, routeConf.Host)
+		}
+
+		pathRoutes, _ := hr.hosts.get(routeConf.Host)
+		pathRoutes = append(pathRoutes, httpPathRoute{pathPrefix: routeConf.PathPrefix, targetBackend: targetBackend})
+
+		// Keep the longest prefixes first, so lookup can stop at the first match
+		slices.SortStableFunc(pathRoutes, func(a, b httpPathRoute) int {
+			return len(b.pathPrefix) - len(a.pathPrefix)
+		})
+
+		if err := hr.hosts.set(routeConf.Host, pathRoutes); err != nil {
+			return nil, err
+		}
+	}
+
+	if defaultTarget != "" {
+		defaultBackend, ok := backendList.Get(defaultTarget)
+		if !ok {
+			return nil, fmt.Errorf("default backend '%s' does not exist", defaultTarget)
+		}
+
+		hr.defaultBackend = defaultBackend
+	}
+
+	return hr, nil
+}
+
+// lookup returns the backend for given host and path, falling back to the default backend. The second return
+// value is false, if neither a route matches nor a default backend is configured.
+func (hr *httpRoutes) lookup(host string, path string) (backends.Backend, bool) {
+	pathRoutes, _ := hr.hosts.lookup(host)
+
+	for _, pathRoute := range pathRoutes {
+		if strings.HasPrefix(path, pathRoute.pathPrefix) {
+			return pathRoute.targetBackend, true
+		}
+	}
+
+	return hr.defaultBackend, hr.defaultBackend != nil
+}
@@ -0,0 +1,86 @@
+package frontends
+
+import (
+	"testing"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+func TestHTTPRoutes_Lookup(t *testing.T) {
+	backendList := createTestBackendList("nas", "nas-api", "nas-api-v2", "web", "fallback")
+
+	routes, err := newHTTPRoutes([]config.HTTPRouteConfig{
+		{Host: "nas.example.com", Target: "nas"},
+		{Host: "nas.example.com", PathPrefix: "/api/v2", Target: "nas-api-v2"},
+		{Host: "nas.example.com", PathPrefix: "/api", Target: "nas-api"},
+		{Host: "*.example.com", PathPrefix: "/web", Target: "web"},
+	}, "fallback", backendList)
+	if err != nil {
+		t.Fatalf("newHTTPRoutes() failed: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		path string
+		want string
+	}{
+		{host: "nas.example.com", path: "/", want: "nas"},
+		{host: "NAS.example.com", path: "/index.html", want: "nas"},
+		{host: "nas.example.com", path: "/api/users", want: "nas-api"},
+		{host: "nas.example.com", path: "/api/v2/users", want: "nas-api-v2"},
+		{host: "files.example.com", path: "/web/index.html", want: "web"},
+		{host: "files.example.com", path: "/other", want: "fallback"},
+		{host: "other.org", path: "/", want: "fallback"},
+	}
+
+	for _, tt := range tests {
+		backend, ok := routes.lookup(tt.host, tt.path)
+		if !ok {
+			t.Errorf("lookup(%q, %q) found no backend, want %q", tt.host, tt.path, tt.want)
+			continue
+		}
+
+		if backend.GetName() != tt.want {
+			t.Errorf("lookup(%q, %q) = %q, want %q", tt.host, tt.path, backend.GetName(), tt.want)
+		}
+	}
+}
+
+func TestHTTPRoutes_Lookup_NoDefault(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	routes, err := newHTTPRoutes([]config.HTTPRouteConfig{
+		{Host: "nas.example.com", PathPrefix: "/api", Target: "nas"},
+	}, "", backendList)
+	if err != nil {
+		t.Fatalf("newHTTPRoutes() failed: %v", err)
+	}
+
+	if backend, ok := routes.lookup("nas.example.com", "/"); ok {
+		t.Errorf("lookup() = %q, expected no backend without default", backend.GetName())
+	}
+}
+
+func TestHTTPRoutes_NewHTTPRoutes_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	tests := []struct {
+		name          string
+		route         config.HTTPRouteConfig
+		defaultTarget string
+	}{
+		{name: "missing host", route: config.HTTPRouteConfig{Target: "nas"}},
+		{name: "invalid host", route: config.HTTPRouteConfig{Host: "nas.*.example.com", Target: "nas"}},
+		{name: "relative path prefix", route: config.HTTPRouteConfig{Host: "nas.example.com", PathPrefix: "api", Target: "nas"}},
+		{name: "unknown target", route: config.HTTPRouteConfig{Host: "nas.example.com", Target: "unknown"}},
+		{name: "unknown default", route: config.HTTPRouteConfig{Host: "nas.example.com", Target: "nas"}, defaultTarget: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHTTPRoutes([]config.HTTPRouteConfig{tt.route}, tt.defaultTarget, backendList); err == nil {
+				t.Error("expected newHTTPRoutes() to fail")
+			}
+		})
+	}
+}
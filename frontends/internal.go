@@ -1,19 +1,107 @@
 package frontends
 
-import "net"
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
 
-type tcpListener interface {
+	"github.com/sateffen/pluggo/backends/helper"
+)
+
+type streamListener interface {
 	Accept() (net.Conn, error)
 	Close() error
 	Addr() net.Addr
 }
 
 type tcpListenerFactory interface {
-	ListenTCP(network string, laddr *net.TCPAddr) (tcpListener, error)
+	ListenTCP(network string, laddr *net.TCPAddr) (streamListener, error)
+}
+
+type defaultTCPListenerFactory struct {
+	socketOptions *helper.SocketOptions
+}
+
+func (f defaultTCPListenerFactory) ListenTCP(network string, laddr *net.TCPAddr) (streamListener, error) {
+	listener, err := f.socketOptions.ListenConfig().Listen(context.Background(), network, laddr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("listener for '%s' is no tcp listener", laddr)
+	}
+
+	return &socketOptionsListener{TCPListener: tcpListener, socketOptions: f.socketOptions}, nil
+}
+
+// socketOptionsListener applies the socket options, that don't get inherited from the listening socket, to every
+// accepted connection.
+type socketOptionsListener struct {
+	*net.TCPListener
+	socketOptions *helper.SocketOptions
+}
+
+func (l *socketOptionsListener) Accept() (net.Conn, error) {
+	connection, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+
+	l.socketOptions.ApplyToConn(connection)
+
+	return connection, nil
+}
+
+type unixListenerFactory interface {
+	ListenUnix(network string, laddr *net.UnixAddr) (streamListener, error)
+}
+
+type defaultUnixListenerFactory struct{}
+
+func (defaultUnixListenerFactory) ListenUnix(network string, laddr *net.UnixAddr) (streamListener, error) {
+	listener, err := net.ListenUnix(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+type udpListener interface {
+	ReadFromUDP(b []byte) (int, *net.UDPAddr, error)
+	WriteToUDP(b []byte, addr *net.UDPAddr) (int, error)
+	Close() error
+	LocalAddr() net.Addr
+}
+
+type udpListenerFactory interface {
+	ListenUDP(network string, laddr *net.UDPAddr) (udpListener, error)
 }
 
-type defaultTCPListenerFactory struct{}
+type defaultUDPListenerFactory struct{}
+
+func (defaultUDPListenerFactory) ListenUDP(network string, laddr *net.UDPAddr) (udpListener, error) {
+	return net.ListenUDP(network, laddr)
+}
+
+type dialer interface {
+	DialTimeout(network, address string, timeout time.Duration) (net.Conn, error)
+}
+
+type defaultDialer struct {
+	socketOptions *helper.SocketOptions
+}
+
+func (d defaultDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	connection, err := d.socketOptions.Dialer(timeout).Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	d.socketOptions.ApplyToConn(connection)
 
-func (defaultTCPListenerFactory) ListenTCP(network string, laddr *net.TCPAddr) (tcpListener, error) {
-	return net.ListenTCP(network, laddr)
+	return connection, nil
 }
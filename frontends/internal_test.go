@@ -3,30 +3,32 @@ package frontends
 import (
 	"errors"
 	"net"
+	"testing"
+	"time"
 )
 
-// mockTCPListener implements the tcpListener interface from internal.go.
-type mockTCPListener struct {
+// mockStreamListener implements the streamListener interface from internal.go.
+type mockStreamListener struct {
 	mockAccept func() (net.Conn, error)
 	mockClose  func() error
 	mockAddr   func() net.Addr
 }
 
-func (m *mockTCPListener) Accept() (net.Conn, error) {
+func (m *mockStreamListener) Accept() (net.Conn, error) {
 	if m.mockAccept != nil {
 		return m.mockAccept()
 	}
 	return nil, errors.New("mock listener: no mock implementation for Accept")
 }
 
-func (m *mockTCPListener) Close() error {
+func (m *mockStreamListener) Close() error {
 	if m.mockClose != nil {
 		return m.mockClose()
 	}
 	return nil
 }
 
-func (m *mockTCPListener) Addr() net.Addr {
+func (m *mockStreamListener) Addr() net.Addr {
 	if m.mockAddr != nil {
 		return m.mockAddr()
 	}
@@ -36,16 +38,102 @@ func (m *mockTCPListener) Addr() net.Addr {
 
 // mockTCPListenerFactory implements the tcpListenerFactory interface from internal.go.
 type mockTCPListenerFactory struct {
-	mockListenTCP func(network string, laddr *net.TCPAddr) (tcpListener, error)
+	mockListenTCP func(network string, laddr *net.TCPAddr) (streamListener, error)
 }
 
-func (m *mockTCPListenerFactory) ListenTCP(network string, laddr *net.TCPAddr) (tcpListener, error) {
+func (m *mockTCPListenerFactory) ListenTCP(network string, laddr *net.TCPAddr) (streamListener, error) {
 	if m.mockListenTCP != nil {
 		return m.mockListenTCP(network, laddr)
 	}
 	return nil, errors.New("mock listener factory: no mock implementation for ListenTCP")
 }
 
+// startTestFrontend starts a frontend on a real tcp listener bound to a random local port, and returns the
+// address it listens on. The listener gets handed to the frontend through given listenerFactory field, and
+// listen is the Listen method of the frontend.
+func startTestFrontend(t *testing.T, listenerFactory *tcpListenerFactory, listen func() error) (string, chan error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not create tcp listener: %v", err)
+	}
+
+	*listenerFactory = &mockTCPListenerFactory{
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
+			return listener, nil
+		},
+	}
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- listen()
+		close(listenDone)
+	}()
+
+	return listener.Addr().String(), listenDone
+}
+
+// mockUnixListenerFactory implements the unixListenerFactory interface from internal.go.
+type mockUnixListenerFactory struct {
+	mockListenUnix func(network string, laddr *net.UnixAddr) (streamListener, error)
+}
+
+func (m *mockUnixListenerFactory) ListenUnix(network string, laddr *net.UnixAddr) (streamListener, error) {
+	if m.mockListenUnix != nil {
+		return m.mockListenUnix(network, laddr)
+	}
+	return nil, errors.New("mock listener factory: no mock implementation for ListenUnix")
+}
+
+// mockUDPListenerFactory implements the udpListenerFactory interface from internal.go.
+type mockUDPListenerFactory struct {
+	mockListenUDP func(network string, laddr *net.UDPAddr) (udpListener, error)
+}
+
+func (m *mockUDPListenerFactory) ListenUDP(network string, laddr *net.UDPAddr) (udpListener, error) {
+	if m.mockListenUDP != nil {
+		return m.mockListenUDP(network, laddr)
+	}
+	return nil, errors.New("mock listener factory: no mock implementation for ListenUDP")
+}
+
+// mockUDPListener implements the udpListener interface from internal.go.
+type mockUDPListener struct {
+	mockReadFromUDP func(b []byte) (int, *net.UDPAddr, error)
+}
+
+func (m *mockUDPListener) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	if m.mockReadFromUDP != nil {
+		return m.mockReadFromUDP(b)
+	}
+	return 0, nil, errors.New("mock listener: no mock implementation for ReadFromUDP")
+}
+
+func (m *mockUDPListener) WriteToUDP(b []byte, _ *net.UDPAddr) (int, error) {
+	return len(b), nil
+}
+
+func (m *mockUDPListener) Close() error {
+	return nil
+}
+
+func (m *mockUDPListener) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+}
+
+// mockDialer implements the dialer interface from internal.go.
+type mockDialer struct {
+	mockDialTimeout func(network, address string, timeout time.Duration) (net.Conn, error)
+}
+
+func (m *mockDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	if m.mockDialTimeout != nil {
+		return m.mockDialTimeout(network, address, timeout)
+	}
+	return nil, errors.New("mock dialer: no mock implementation found")
+}
+
 // mockBackend implements the backends.Backend interface for testing.
 type mockBackend struct {
 	name       string
@@ -68,3 +156,18 @@ func (m *mockBackend) Handle(conn net.Conn) {
 func (m *mockBackend) Close() error {
 	return nil
 }
+
+// mockPacketBackend implements the backends.PacketBackend interface for testing.
+type mockPacketBackend struct {
+	mockBackend
+	mockHandlePacket func(conn net.Conn)
+}
+
+func (m *mockPacketBackend) HandlePacket(conn net.Conn) {
+	if m.mockHandlePacket != nil {
+		m.mockHandlePacket(conn)
+		return
+	}
+	// Default: just close the connection
+	conn.Close()
+}
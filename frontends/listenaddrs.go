@@ -0,0 +1,89 @@
+package frontends
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxListenPortRangeSize is the maximum number of ports a single port range may contain, as every port needs
+// its own socket.
+const maxListenPortRangeSize = 1024
+
+// expandListenAddrs returns all addresses given by listenAddr and listenAddrs, expanding port ranges like
+// "0.0.0.0:5000-5010" to one address per port. Empty entries are ignored, but at least one address has to be
+// given.
+func expandListenAddrs(listenAddr string, listenAddrs []string) ([]string, error) {
+	entries := listenAddrs
+	if listenAddr != "" {
+		entries = append([]string{listenAddr}, listenAddrs...)
+	}
+
+	expanded := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry == "" {
+			continue
+		}
+
+		host, ports, err := net.SplitHostPort(entry)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse listen address '%s': %w", entry, err)
+		}
+
+		firstPort, lastPort, err := parsePortRange(ports)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse port of listen address '%s': %w", entry, err)
+		}
+
+		for port := firstPort; port <= lastPort; port++ {
+			expanded = append(expanded, net.JoinHostPort(host, strconv.Itoa(port)))
+		}
+	}
+
+	if len(expanded) == 0 {
+		return nil, errors.New("no listen address given")
+	}
+
+	return expanded, nil
+}
+
+// parsePortRange parses a single port like "5000", or a range of ports like "5000-5010".
+func parsePortRange(ports string) (int, int, error) {
+	first, last, isRange := strings.Cut(ports, "-")
+	if !isRange {
+		last = first
+	}
+
+	firstPort, err := strconv.ParseUint(first, 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port '%s'", first)
+	}
+
+	lastPort, err := strconv.ParseUint(last, 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port '%s'", last)
+	}
+
+	if lastPort < firstPort {
+		return 0, 0, fmt.Errorf("port range '%s' ends before it starts", ports)
+	}
+
+	if lastPort-firstPort >= maxListenPortRangeSize {
+		return 0, 0, fmt.Errorf("port range '%s' has more than %d ports", ports, maxListenPortRangeSize)
+	}
+
+	return int(firstPort), int(lastPort), nil
+}
+
+// closeListeners closes given listeners, logging errors instead of returning them.
+func closeListeners(listeners []streamListener) {
+	for _, listener := range listeners {
+		if err := listener.Close(); err != nil {
+			slog.Warn("could not close listener", slog.Any("error", err))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package frontends
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandListenAddrs(t *testing.T) {
+	tests := []struct {
+		name        string
+		listenAddr  string
+		listenAddrs []string
+		want        []string
+	}{
+		{
+			name:       "single address",
+			listenAddr: "0.0.0.0:2222",
+			want:       []string{"0.0.0.0:2222"},
+		},
+		{
+			name:        "address and list",
+			listenAddr:  "0.0.0.0:2222",
+			listenAddrs: []string{"[::]:2222", "127.0.0.1:22"},
+			want:        []string{"0.0.0.0:2222", "[::]:2222", "127.0.0.1:22"},
+		},
+		{
+			name:        "port range",
+			listenAddrs: []string{"0.0.0.0:5000-5002", "[::1]:6000-6000"},
+			want:        []string{"0.0.0.0:5000", "0.0.0.0:5001", "0.0.0.0:5002", "[::1]:6000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandListenAddrs(tt.listenAddr, tt.listenAddrs)
+			if err != nil {
+				t.Fatalf("expandListenAddrs() failed: %v", err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expandListenAddrs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandListenAddrs_Invalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		listenAddrs []string
+	}{
+		{name: "no address", listenAddrs: nil},
+		{name: "missing port", listenAddrs: []string{"0.0.0.0"}},
+		{name: "invalid port", listenAddrs: []string{"0.0.0.0:ssh"}},
+		{name: "port too large", listenAddrs: []string{"0.0.0.0:65536"}},
+		{name: "reversed range", listenAddrs: []string{"0.0.0.0:5010-5000"}},
+		{name: "open range", listenAddrs: []string{"0.0.0.0:5000-"}},
+		{name: "range too large", listenAddrs: []string{"0.0.0.0:1-65535"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := expandListenAddrs("", tt.listenAddrs); err == nil {
+				t.Error("expected expandListenAddrs() to fail")
+			}
+		})
+	}
+}
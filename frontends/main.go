@@ -15,27 +15,262 @@ type Frontend interface {
 }
 
 type FrontendList struct {
-	list map[string]Frontend
+	list        map[string]Frontend
+	banControl  *banControl
+	listenConf  config.ListenConfig
+	supervisors []*listenSupervisor
+	reserve     *fdReserve
 }
 
-// NewFrontendList creates a new instance of FrontendList, filling it frontend instances based on given configs.
-func NewFrontendList(conf config.FrontendConfigs, backendList *backends.BackendList) (*FrontendList, error) {
+// accessControlledFrontend is a frontend, that checks its clients against an accessList.
+type accessControlledFrontend interface {
+	Frontend
+	getAccessList() *accessList
+}
+
+// limitedFrontend is a frontend, that limits its connections with a connectionLimiter.
+type limitedFrontend interface {
+	Frontend
+	getConnectionLimiter() *connectionLimiter
+}
+
+// banningFrontend is a frontend, that rejects connections of sources banned by a banList.
+type banningFrontend interface {
+	Frontend
+	setBanList(bans *banList)
+}
+
+// sheddingFrontend is a frontend, that sheds pending connections using an fdReserve when out of file descriptors.
+type sheddingFrontend interface {
+	Frontend
+	setFDReserve(reserve *fdReserve)
+}
+
+// NewFrontendList creates a new instance of FrontendList, filling it frontend instances based on given config.
+func NewFrontendList(fullConf *config.Config, backendList *backends.BackendList) (*FrontendList, error) {
 	fl := FrontendList{
-		list: make(map[string]Frontend),
+		list:        make(map[string]Frontend),
+		banControl:  nil,
+		listenConf:  fullConf.Listen,
+		supervisors: nil,
+		reserve:     nil,
 	}
 
+	conf := fullConf.Frontends
+
 	for _, tcpConf := range conf.TCP {
 		tcpFrontend, err := newTCPFrontend(tcpConf, backendList)
 		if err != nil {
 			return nil, fmt.Errorf("could not create frontend '%s': %w", tcpConf.Name, err)
 		}
 
-		fl.list[tcpConf.Name] = tcpFrontend
+		if err = fl.add(tcpFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, tlsConf := range conf.TLS {
+		tlsFrontend, err := newTLSFrontend(tlsConf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", tlsConf.Name, err)
+		}
+
+		if err = fl.add(tlsFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, sniConf := range conf.SNI {
+		sniFrontend, err := newSNIFrontend(sniConf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", sniConf.Name, err)
+		}
+
+		if err = fl.add(sniFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, muxConf := range conf.Mux {
+		muxFrontend, err := newMuxFrontend(muxConf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", muxConf.Name, err)
+		}
+
+		if err = fl.add(muxFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, httpConf := range conf.HTTP {
+		httpFrontend, err := newHTTPFrontend(httpConf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", httpConf.Name, err)
+		}
+
+		if err = fl.add(httpFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, socks5Conf := range conf.SOCKS5 {
+		socks5Frontend, err := newSOCKS5Frontend(socks5Conf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", socks5Conf.Name, err)
+		}
+
+		if err = fl.add(socks5Frontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, httpConnectConf := range conf.HTTPConnect {
+		httpConnectFrontend, err := newHTTPConnectFrontend(httpConnectConf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", httpConnectConf.Name, err)
+		}
+
+		if err = fl.add(httpConnectFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, transparentConf := range conf.Transparent {
+		transparentFrontend, err := newTransparentFrontend(transparentConf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", transparentConf.Name, err)
+		}
+
+		if err = fl.add(transparentFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, webSocketConf := range conf.WebSocket {
+		webSocketFrontend, err := newWebSocketFrontend(webSocketConf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", webSocketConf.Name, err)
+		}
+
+		if err = fl.add(webSocketFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, unixConf := range conf.Unix {
+		unixFrontend, err := newUnixFrontend(unixConf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", unixConf.Name, err)
+		}
+
+		if err = fl.add(unixFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, udpConf := range conf.UDP {
+		udpFrontend, err := newUDPFrontend(udpConf, backendList)
+		if err != nil {
+			return nil, fmt.Errorf("could not create frontend '%s': %w", udpConf.Name, err)
+		}
+
+		if err = fl.add(udpFrontend); err != nil {
+			return nil, err
+		}
+	}
+
+	inheritedFiles, err := listenFdsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("could not read sockets from socket activation: %w", err)
+	}
+
+	applySocketActivation(fl.list, inheritedFiles)
+
+	if err = fl.UpdateAccessLists(fullConf); err != nil {
+		return nil, err
+	}
+
+	globalLimit, err := newGlobalConnectionLimit(fullConf.Limits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid global limits: %w", err)
+	}
+
+	for _, frontend := range fl.list {
+		if limited, ok := frontend.(limitedFrontend); ok {
+			limited.getConnectionLimiter().setGlobalLimit(globalLimit)
+		}
+	}
+
+	if err = fl.setUpBans(fullConf.Bans); err != nil {
+		return nil, err
+	}
+
+	if err = fl.setUpFDReserve(fullConf.Listen); err != nil {
+		return nil, err
 	}
 
 	return &fl, nil
 }
 
+// add adds given frontend to the list. Frontends are identified by their name, so the name has to be unique across
+// all frontend types.
+func (fl *FrontendList) add(frontend Frontend) error {
+	if _, exists := fl.list[frontend.GetName()]; exists {
+		return fmt.Errorf("frontend name '%s' is used more than once", frontend.GetName())
+	}
+
+	fl.list[frontend.GetName()] = frontend
+
+	return nil
+}
+
+// setUpFDReserve reserves a file descriptor shared by all frontends to shed connections with, if enabled.
+func (fl *FrontendList) setUpFDReserve(conf config.ListenConfig) error {
+	if !conf.ReserveFD {
+		return nil
+	}
+
+	reserve, err := newFDReserve()
+	if err != nil {
+		return err
+	}
+
+	for _, frontend := range fl.list {
+		if shedding, ok := frontend.(sheddingFrontend); ok {
+			shedding.setFDReserve(reserve)
+		}
+	}
+
+	fl.reserve = reserve
+
+	return nil
+}
+
+// setUpBans creates the banList shared by all frontends and its control socket, if banning is enabled by
+// a maxRetry greater than 0.
+func (fl *FrontendList) setUpBans(conf config.BansConfig) error {
+	bans, err := newBanList(conf)
+	if err != nil {
+		return fmt.Errorf("invalid bans: %w", err)
+	}
+
+	if conf.MaxRetry == 0 {
+		return nil
+	}
+
+	for _, frontend := range fl.list {
+		if banning, ok := frontend.(banningFrontend); ok {
+			banning.setBanList(bans)
+		}
+	}
+
+	if conf.ControlSocket != "" {
+		fl.banControl = newBanControl(conf.ControlSocket, bans)
+	}
+
+	return nil
+}
+
 // Get returns the backend with given name if present. The second return value indicates whether
 // the value is present, like in a casual map.
 func (fl *FrontendList) Get(name string) (Frontend, bool) {
@@ -44,30 +279,107 @@ func (fl *FrontendList) Get(name string) (Frontend, bool) {
 	return frontend, ok
 }
 
-// ListenAll starts the listener for all Frontends. Each listen starts in its own go-routine.
-// If any frontend has issues while listening, the error will get written to the returned channel.
+// UpdateAccessLists replaces the access lists of all frontends with the ones of given config, which may be
+// done while the frontends are listening. Either all access lists get replaced, or none if any is invalid.
+// Frontends missing in given config only keep the global default.
+func (fl *FrontendList) UpdateAccessLists(conf *config.Config) error {
+	defaultRules, err := newAccessRules(conf.AccessControl)
+	if err != nil {
+		return fmt.Errorf("invalid global access control: %w", err)
+	}
+
+	frontendRules := make(map[string]*accessRules)
+
+	for name, accessListConf := range accessListConfigs(conf.Frontends) {
+		frontendRules[name], err = newAccessRules(accessListConf)
+		if err != nil {
+			return fmt.Errorf("invalid access control of frontend '%s': %w", name, err)
+		}
+	}
+
+	for name, frontend := range fl.list {
+		controlledFrontend, ok := frontend.(accessControlledFrontend)
+		if !ok {
+			continue
+		}
+
+		ownRules, ok := frontendRules[name]
+		if !ok {
+			ownRules = &accessRules{}
+		}
+
+		controlledFrontend.getAccessList().set(ownRules, defaultRules)
+	}
+
+	return nil
+}
+
+// ListenAll starts the listener for all Frontends. Each listen starts in its own go-routine, supervised by
+// a listenSupervisor retrying to listen if it fails. Only if bind failures are configured to be fatal, the error
+// of a frontend failing to listen will get written to the returned channel.
 func (fl *FrontendList) ListenAll() chan error {
-	errChan := make(chan error, len(fl.list))
+	errChan := make(chan error, len(fl.list)+1)
 
 	for _, frontend := range fl.list {
-		go func(fe Frontend) {
-			err := fe.Listen()
+		supervisor := newListenSupervisor(frontend, fl.listenConf)
+		fl.supervisors = append(fl.supervisors, supervisor)
 
-			if err != nil {
-				slog.Warn("tcpfrontend failed to listen", slog.String("name", fe.GetName()), slog.Any("error", err))
+		go func() {
+			if err := supervisor.run(); err != nil {
 				errChan <- err
 			}
-		}(frontend)
+		}()
+	}
+
+	if fl.banControl != nil {
+		go func() {
+			if err := fl.banControl.Listen(); err != nil {
+				slog.Error("ban control failed to listen", slog.Any("error", err))
+
+				if fl.listenConf.BindFailureFatal {
+					errChan <- err
+				}
+			}
+		}()
 	}
 
 	return errChan
 }
 
-// CloseAll closes all listening frontends and therefore stops all listening frontends.
+// States returns the state of every frontend by its name, which is one of "binding", "listening", "failed" and
+// "stopped". Frontends only have a state once ListenAll got called.
+func (fl *FrontendList) States() map[string]string {
+	states := make(map[string]string, len(fl.supervisors))
+
+	for _, supervisor := range fl.supervisors {
+		states[supervisor.frontend.GetName()] = supervisor.getState().String()
+	}
+
+	return states
+}
+
+// CloseAll closes all listening frontends and therefore stops all listening frontends. The ban control socket
+// gets closed and the reserved file descriptor released as well.
 func (fl *FrontendList) CloseAll() {
+	for _, supervisor := range fl.supervisors {
+		supervisor.stop()
+	}
+
+	if fl.banControl != nil {
+		if err := fl.banControl.Close(); err != nil {
+			slog.Warn("couldn't close ban control properly", slog.Any("error", err))
+		}
+	}
+
 	for _, frontend := range fl.list {
 		if err := frontend.Close(); err != nil {
 			slog.Warn("couldn't close frontend properly", slog.String("name", frontend.GetName()), slog.Any("error", err))
 		}
 	}
+
+	if fl.reserve != nil {
+		if err := fl.reserve.Close(); err != nil {
+			slog.Warn("couldn't release reserved file descriptor", slog.Any("error", err))
+		}
+	}
 }
@@ -0,0 +1,22 @@
+package frontends
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+func TestNewFrontendList_DuplicateNames(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	_, err := NewFrontendList(&config.Config{
+		Frontends: config.FrontendConfigs{
+			TCP: []config.TCPFrontendConfig{{Name: "ssh", ListenAddr: "127.0.0.1:2222", Target: "test-backend"}},
+			UDP: []config.UDPFrontendConfig{{Name: "ssh", ListenAddr: "127.0.0.1:2222", Target: "test-backend"}},
+		},
+	}, backendList)
+	if err == nil || !strings.Contains(err.Error(), "used more than once") {
+		t.Errorf("NewFrontendList() = %v, want error for frontends sharing a name", err)
+	}
+}
@@ -0,0 +1,162 @@
+package frontends
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	muxDefaultTimeout = 2 * time.Second
+	muxMaxPeekLength  = 4096
+)
+
+type muxFrontend struct {
+	*tcpListeners
+
+	rules          []muxRule
+	defaultBackend backends.Backend
+	timeout        time.Duration
+}
+
+// newMuxFrontend creates a new instance of an muxFrontend, preparing it with all default dependencies.
+func newMuxFrontend(conf config.MuxFrontendConfig, backendList *backends.BackendList) (*muxFrontend, error) {
+	parsedListenAddr, err := net.ResolveTCPAddr("tcp", conf.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+	}
+
+	rules, err := newMuxRules(conf.Rules, backendList)
+	if err != nil {
+		return nil, fmt.Errorf("could not create rules of frontend '%s': %w", conf.Name, err)
+	}
+
+	var defaultBackend backends.Backend
+	if conf.Default != "" {
+		var ok bool
+		defaultBackend, ok = backendList.Get(conf.Default)
+		if !ok {
+			return nil, fmt.Errorf("default backend '%s' for frontend '%s' does not exist", conf.Default, conf.Name)
+		}
+	}
+
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = muxDefaultTimeout
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options of frontend '%s': %w", conf.Name, err)
+	}
+
+	return &muxFrontend{
+		tcpListeners:   newTCPListeners(conf.Name, "muxfrontend", []*net.TCPAddr{parsedListenAddr}, limiter, socketOptions),
+		rules:          rules,
+		defaultBackend: defaultBackend,
+		timeout:        timeout,
+	}, nil
+}
+
+// Listen creates a TCP listener, starts listening and accepting connections. Every accepted connection gets
+// routed in its own go-routine, based on the protocol detected from the first bytes the client sends.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen is resilient in that it does not stop accepting connections just because an error happens.
+func (fe *muxFrontend) Listen() error {
+	return fe.listen(func(connection net.Conn) {
+		go fe.route(connection)
+	}, fe.acceptGates())
+}
+
+// route sniffs the first bytes of given connection and hands it to the backend of the first matching rule,
+// replaying the sniffed bytes. Connections without matching rule go to the default backend, or get closed
+// if there is none.
+func (fe *muxFrontend) route(connection net.Conn) {
+	reader := bufio.NewReaderSize(connection, muxMaxPeekLength)
+
+	rule, err := fe.sniff(connection, reader)
+	if err != nil {
+		slog.Debug(
+			"muxfrontend could not sniff connection",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+		closeUnroutedConnection(connection)
+
+		return
+	}
+
+	targetBackend := fe.defaultBackend
+	ruleDescription := "default"
+	if rule != nil {
+		targetBackend = rule.targetBackend
+		ruleDescription = rule.description
+	}
+
+	if targetBackend == nil {
+		slog.Debug(
+			"muxfrontend found no backend for connection",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+		)
+		closeUnroutedConnection(connection)
+
+		return
+	}
+
+	slog.Debug(
+		"muxfrontend routed connection",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("rule", ruleDescription),
+		slog.String("backend", targetBackend.GetName()),
+	)
+
+	targetBackend.Handle(newBufferedConn(connection, reader))
+}
+
+// sniff reads from given connection into given reader, until a rule matches or no rule can match anymore.
+// If the timeout passes or muxMaxPeekLength bytes got read before, the rules get checked against the bytes
+// read so far. A nil rule is returned if no rule matches, like for protocols where the server speaks first.
+func (fe *muxFrontend) sniff(connection net.Conn, reader *bufio.Reader) (*muxRule, error) {
+	if err := connection.SetReadDeadline(time.Now().Add(fe.timeout)); err != nil {
+		return nil, fmt.Errorf("could not set read deadline: %w", err)
+	}
+	defer func() {
+		if err := connection.SetReadDeadline(time.Time{}); err != nil {
+			slog.Debug("could not reset read deadline", slog.Any("error", err))
+		}
+	}()
+
+	for {
+		_, err := reader.Peek(reader.Buffered() + 1)
+		data, _ := reader.Peek(reader.Buffered())
+
+		if err != nil {
+			if len(data) == 0 && !errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil, err
+			}
+
+			rule, _ := selectMuxRule(fe.rules, data, true)
+			return rule, nil
+		}
+
+		if rule, needMore := selectMuxRule(fe.rules, data, false); !needMore {
+			return rule, nil
+		}
+	}
+}
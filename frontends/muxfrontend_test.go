@@ -0,0 +1,192 @@
+package frontends
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// newAnsweringBackend creates a mockBackend, that answers with its name followed by everything it received
+// until the client stopped writing.
+func newAnsweringBackend(name string) *mockBackend {
+	return &mockBackend{
+		name: name,
+		mockHandle: func(conn net.Conn) {
+			defer conn.Close()
+
+			conn.Write([]byte(name + ":"))
+			io.Copy(conn, conn)
+		},
+	}
+}
+
+func TestMuxFrontend_GetName(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newMuxFrontend(config.MuxFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8443",
+		Default:    "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newMuxFrontend() failed: %v", err)
+	}
+
+	if got := frontend.GetName(); got != "test-frontend" {
+		t.Errorf("GetName() = %q, want %q", got, "test-frontend")
+	}
+	if frontend.timeout != muxDefaultTimeout {
+		t.Errorf("timeout = %v, want default %v", frontend.timeout, muxDefaultTimeout)
+	}
+}
+
+func TestMuxFrontend_NewMuxFrontend_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	tests := []struct {
+		name string
+		conf config.MuxFrontendConfig
+	}{
+		{
+			name: "invalid listenAddr",
+			conf: config.MuxFrontendConfig{Name: "test-frontend", ListenAddr: "invalid", Default: "test-backend"},
+		},
+		{
+			name: "invalid rule",
+			conf: config.MuxFrontendConfig{
+				Name:       "test-frontend",
+				ListenAddr: "127.0.0.1:8443",
+				Rules:      []config.MuxRuleConfig{{Protocol: "gopher", Target: "test-backend"}},
+			},
+		},
+		{
+			name: "unknown default",
+			conf: config.MuxFrontendConfig{Name: "test-frontend", ListenAddr: "127.0.0.1:8443", Default: "unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newMuxFrontend(tt.conf, backendList); err == nil {
+				t.Error("expected newMuxFrontend() to fail")
+			}
+		})
+	}
+}
+
+func TestMuxFrontend_Listen_RoutesByProtocolAndReplaysBytes(t *testing.T) {
+	backendList := createTestBackendList("ssh", "tls", "http", "fallback")
+
+	frontend, err := newMuxFrontend(config.MuxFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8443",
+		Rules: []config.MuxRuleConfig{
+			{Protocol: "ssh", Target: "ssh"},
+			{Protocol: "tls", Target: "tls"},
+			{Protocol: "http", Target: "http"},
+		},
+		Timeout: 100 * time.Millisecond,
+		Default: "fallback",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newMuxFrontend() failed: %v", err)
+	}
+
+	for i := range frontend.rules {
+		frontend.rules[i].targetBackend = newAnsweringBackend(frontend.rules[i].targetBackend.GetName())
+	}
+	frontend.defaultBackend = newAnsweringBackend("fallback")
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{name: "ssh", payload: "SSH-2.0-OpenSSH_9.6\r\n", want: "ssh:SSH-2.0-OpenSSH_9.6\r\n"},
+		{name: "tls", payload: "\x16\x03\x01\x00\x05hello", want: "tls:\x16\x03\x01\x00\x05hello"},
+		{name: "http", payload: "GET / HTTP/1.1\r\n\r\n", want: "http:GET / HTTP/1.1\r\n\r\n"},
+		{name: "unknown protocol", payload: "hello", want: "fallback:hello"},
+		{name: "server speaks first", payload: "", want: "fallback:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, err := net.Dial("tcp", listenAddr)
+			if err != nil {
+				t.Fatalf("could not dial frontend: %v", err)
+			}
+			defer clientConn.Close()
+
+			if tt.payload != "" {
+				clientConn.Write([]byte(tt.payload))
+			} else {
+				// Wait for the timeout to pass, before closing the writing side
+				time.Sleep(2 * frontend.timeout)
+			}
+			clientConn.(*net.TCPConn).CloseWrite()
+
+			clientConn.SetReadDeadline(time.Now().Add(time.Second))
+			answer, err := io.ReadAll(clientConn)
+			if err != nil {
+				t.Fatalf("could not read answer: %v", err)
+			}
+
+			if string(answer) != tt.want {
+				t.Errorf("got answer %q, want %q", string(answer), tt.want)
+			}
+		})
+	}
+}
+
+func TestMuxFrontend_Listen_ClosesConnectionWithoutDefault(t *testing.T) {
+	backendList := createTestBackendList("ssh")
+
+	frontend, err := newMuxFrontend(config.MuxFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8443",
+		Rules:      []config.MuxRuleConfig{{Protocol: "ssh", Target: "ssh"}},
+		Timeout:    50 * time.Millisecond,
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newMuxFrontend() failed: %v", err)
+	}
+
+	handleCalled := make(chan bool, 1)
+	frontend.rules[0].targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handleCalled <- true
+			conn.Close()
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	clientConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = clientConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF for silent connection without default backend, got: %v", err)
+	}
+
+	if len(handleCalled) != 0 {
+		t.Error("backend.Handle() got called for unmatched connection")
+	}
+}
@@ -0,0 +1,173 @@
+package frontends
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/config"
+)
+
+// muxMatch is the result of matching a muxRule against the first bytes of a connection.
+type muxMatch int
+
+const (
+	muxMatchNo muxMatch = iota
+	muxMatchYes
+	muxMatchNeedMore
+)
+
+// muxRule routes connections starting with matching bytes to its target backend.
+type muxRule struct {
+	description   string
+	match         func(data []byte) muxMatch
+	targetBackend backends.Backend
+}
+
+// newMuxRules creates the muxRules for given configs. Every rule has to configure exactly one of protocol,
+// prefix and regex.
+func newMuxRules(confs []config.MuxRuleConfig, backendList *backends.BackendList) ([]muxRule, error) {
+	rules := make([]muxRule, 0, len(confs))
+
+	for i, ruleConf := range confs {
+		rule, err := newMuxRule(ruleConf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %d: %w", i+1, err)
+		}
+
+		targetBackend, ok := backendList.Get(ruleConf.Target)
+		if !ok {
+			return nil, fmt.Errorf("target backend '%s' for rule %d does not exist", ruleConf.Target, i+1)
+		}
+
+		rule.targetBackend = targetBackend
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// newMuxRule creates the matcher for given rule config, leaving the target backend empty.
+func newMuxRule(conf config.MuxRuleConfig) (muxRule, error) {
+	configuredMatchers := 0
+	for _, value := range []string{conf.Protocol, conf.Prefix, conf.Regex} {
+		if value != "" {
+			configuredMatchers++
+		}
+	}
+
+	if configuredMatchers != 1 {
+		return muxRule{}, errors.New("exactly one of protocol, prefix and regex has to be configured")
+	}
+
+	switch {
+	case conf.Protocol != "":
+		match, err := protocolMatcher(conf.Protocol)
+		if err != nil {
+			return muxRule{}, err
+		}
+
+		return muxRule{description: "protocol " + conf.Protocol, match: match, targetBackend: nil}, nil
+	case conf.Prefix != "":
+		prefix := []byte(conf.Prefix)
+
+		return muxRule{
+			description:   fmt.Sprintf("prefix %q", conf.Prefix),
+			match:         func(data []byte) muxMatch { return matchPrefix(data, prefix) },
+			targetBackend: nil,
+		}, nil
+	default:
+		expression, err := regexp.Compile(conf.Regex)
+		if err != nil {
+			return muxRule{}, fmt.Errorf("could not compile regex '%s': %w", conf.Regex, err)
+		}
+
+		return muxRule{
+			description:   fmt.Sprintf("regex %q", conf.Regex),
+			match:         func(data []byte) muxMatch { return matchRegex(data, expression) },
+			targetBackend: nil,
+		}, nil
+	}
+}
+
+// protocolMatcher returns the matcher for given well known protocol.
+func protocolMatcher(protocol string) (func(data []byte) muxMatch, error) {
+	switch protocol {
+	case "ssh":
+		return func(data []byte) muxMatch { return matchPrefix(data, []byte("SSH-")) }, nil
+	case "tls":
+		// Every TLS connection starts with a handshake record (0x16) of a TLS version 3.x (0x03)
+		return func(data []byte) muxMatch { return matchPrefix(data, []byte{0x16, 0x03}) }, nil
+	case "http":
+		return matchHTTP, nil
+	default:
+		return nil, fmt.Errorf("unknown protocol '%s'", protocol)
+	}
+}
+
+// matchPrefix matches data starting with given prefix. If data is shorter than the prefix, but could still
+// become a match, muxMatchNeedMore gets returned.
+func matchPrefix(data []byte, prefix []byte) muxMatch {
+	if len(data) >= len(prefix) {
+		if bytes.HasPrefix(data, prefix) {
+			return muxMatchYes
+		}
+
+		return muxMatchNo
+	}
+
+	if bytes.HasPrefix(prefix, data) {
+		return muxMatchNeedMore
+	}
+
+	return muxMatchNo
+}
+
+// matchHTTP matches data starting with a HTTP/1.x request line.
+func matchHTTP(data []byte) muxMatch {
+	result := muxMatchNo
+
+	for _, method := range []string{"GET ", "HEAD ", "POST ", "PUT ", "DELETE ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "} {
+		switch matchPrefix(data, []byte(method)) {
+		case muxMatchYes:
+			return muxMatchYes
+		case muxMatchNeedMore:
+			result = muxMatchNeedMore
+		case muxMatchNo:
+		}
+	}
+
+	return result
+}
+
+// matchRegex matches data against given regular expression. As more data might still lead to a match, a
+// regex never reports muxMatchNo on its own.
+func matchRegex(data []byte, expression *regexp.Regexp) muxMatch {
+	if expression.Match(data) {
+		return muxMatchYes
+	}
+
+	return muxMatchNeedMore
+}
+
+// selectMuxRule returns the first rule matching given data. Rules are checked in order, so if an earlier
+// rule needs more data to decide, no later rule gets selected yet. If final is true, no more data is
+// going to arrive, so rules needing more data count as not matching.
+// The second return value reports whether more data is needed to select a rule.
+func selectMuxRule(rules []muxRule, data []byte, final bool) (*muxRule, bool) {
+	for i := range rules {
+		switch rules[i].match(data) {
+		case muxMatchYes:
+			return &rules[i], false
+		case muxMatchNeedMore:
+			if !final {
+				return nil, true
+			}
+		case muxMatchNo:
+		}
+	}
+
+	return nil, false
+}
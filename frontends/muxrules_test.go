@@ -0,0 +1,82 @@
+package frontends
+
+import (
+	"testing"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+func TestMuxRules_NewMuxRules_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	tests := []struct {
+		name string
+		rule config.MuxRuleConfig
+	}{
+		{name: "no matcher", rule: config.MuxRuleConfig{Target: "test-backend"}},
+		{name: "multiple matchers", rule: config.MuxRuleConfig{Protocol: "ssh", Prefix: "SSH-", Target: "test-backend"}},
+		{name: "unknown protocol", rule: config.MuxRuleConfig{Protocol: "gopher", Target: "test-backend"}},
+		{name: "invalid regex", rule: config.MuxRuleConfig{Regex: "(", Target: "test-backend"}},
+		{name: "unknown target", rule: config.MuxRuleConfig{Protocol: "ssh", Target: "unknown"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newMuxRules([]config.MuxRuleConfig{tt.rule}, backendList); err == nil {
+				t.Error("expected newMuxRules() to fail")
+			}
+		})
+	}
+}
+
+func TestMuxRules_SelectMuxRule(t *testing.T) {
+	backendList := createTestBackendList("ssh", "tls", "http", "prefix", "regex")
+
+	rules, err := newMuxRules([]config.MuxRuleConfig{
+		{Protocol: "ssh", Target: "ssh"},
+		{Protocol: "tls", Target: "tls"},
+		{Protocol: "http", Target: "http"},
+		{Prefix: "\x00\x01", Target: "prefix"},
+		{Regex: `^OPENVPN \d+`, Target: "regex"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newMuxRules() failed: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		data         string
+		final        bool
+		wantBackend  string
+		wantNeedMore bool
+	}{
+		{name: "ssh banner", data: "SSH-2.0-OpenSSH_9.6\r\n", wantBackend: "ssh"},
+		{name: "partial ssh banner", data: "SS", wantNeedMore: true},
+		{name: "tls client hello", data: "\x16\x03\x01\x02\x00\x01", wantBackend: "tls"},
+		{name: "http request", data: "GET / HTTP/1.1\r\n", wantBackend: "http"},
+		{name: "partial http method", data: "OPT", wantNeedMore: true},
+		{name: "prefix", data: "\x00\x01\x02", wantBackend: "prefix"},
+		{name: "regex", data: "OPENVPN 2", wantBackend: "regex"},
+		{name: "regex waits for more data", data: "OPENVPN ", wantNeedMore: true},
+		{name: "nothing matches when final", data: "OPENVPN ", final: true},
+		{name: "partial match counts as no match when final", data: "SS", final: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, needMore := selectMuxRule(rules, []byte(tt.data), tt.final)
+
+			if needMore != tt.wantNeedMore {
+				t.Errorf("selectMuxRule() needMore = %v, want %v", needMore, tt.wantNeedMore)
+			}
+
+			gotBackend := ""
+			if rule != nil {
+				gotBackend = rule.targetBackend.GetName()
+			}
+			if gotBackend != tt.wantBackend {
+				t.Errorf("selectMuxRule() selected %q, want %q", gotBackend, tt.wantBackend)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package frontends
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// soOriginalDst is the socket option netfilter provides the original destination of redirected connections with,
+// for IPv4 at level SOL_IP and for IPv6 at level SOL_IPV6.
+const soOriginalDst = 80
+
+// originalDestination returns the address given connection was sent to, before a netfilter REDIRECT rule
+// redirected it to pluggo.
+func originalDestination(connection *net.TCPConn) (*net.TCPAddr, error) {
+	rawConn, err := connection.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("could not access socket: %w", err)
+	}
+
+	localAddr, ok := connection.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return nil, errors.New("connection has no tcp address")
+	}
+
+	var destination *net.TCPAddr
+	var getErr error
+
+	err = rawConn.Control(func(fd uintptr) {
+		if localAddr.IP.To4() != nil {
+			destination, getErr = originalDestinationIPv4(int(fd)) //nolint:gosec // file descriptors fit into int
+		} else {
+			destination, getErr = originalDestinationIPv6(int(fd)) //nolint:gosec // file descriptors fit into int
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not access socket: %w", err)
+	}
+
+	if getErr != nil {
+		return nil, fmt.Errorf("could not get original destination: %w", getErr)
+	}
+
+	return destination, nil
+}
+
+// originalDestinationIPv4 reads the original destination of an IPv4 connection. The kernel writes a sockaddr_in,
+// which fits into the IPv6Mreq struct the syscall package can read.
+func originalDestinationIPv4(fd int) (*net.TCPAddr, error) {
+	mreq, err := syscall.GetsockoptIPv6Mreq(fd, syscall.SOL_IP, soOriginalDst)
+	if err != nil {
+		return nil, err
+	}
+
+	// sockaddr_in consists of the family, the port in network byte order and the address
+	sockaddr := mreq.Multiaddr
+
+	return &net.TCPAddr{
+		IP:   net.IPv4(sockaddr[4], sockaddr[5], sockaddr[6], sockaddr[7]),
+		Port: int(binary.BigEndian.Uint16(sockaddr[2:4])),
+	}, nil
+}
+
+// originalDestinationIPv6 reads the original destination of an IPv6 connection. The kernel writes a sockaddr_in6,
+// which is the start of the IPv6MTUInfo struct the syscall package can read.
+func originalDestinationIPv6(fd int) (*net.TCPAddr, error) {
+	mtuInfo, err := syscall.GetsockoptIPv6MTUInfo(fd, syscall.SOL_IPV6, soOriginalDst)
+	if err != nil {
+		return nil, err
+	}
+
+	// The port is stored in network byte order, but got read as native integer
+	port := make([]byte, 2)
+	binary.NativeEndian.PutUint16(port, mtuInfo.Addr.Port)
+
+	return &net.TCPAddr{
+		IP:   net.IP(mtuInfo.Addr.Addr[:]),
+		Port: int(binary.BigEndian.Uint16(port)),
+	}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package frontends
+
+import (
+	"errors"
+	"net"
+)
+
+// originalDestination fails, as reading the original destination of redirected connections is only supported on
+// linux.
+func originalDestination(_ *net.TCPConn) (*net.TCPAddr, error) {
+	return nil, errors.New("original destinations are only supported on linux")
+}
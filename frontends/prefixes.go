@@ -0,0 +1,81 @@
+package frontends
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// parsePrefixes parses given list of CIDRs like "10.0.0.0/8". Plain addresses are treated as single address
+// prefixes, so "10.0.0.1" equals "10.0.0.1/32".
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse '%s' as address or CIDR: %w", cidr, err)
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse '%s' as address or CIDR: %w", cidr, err)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// prefixesContain reports whether any of given prefixes contains given address.
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addrFromNetAddr returns the IP address of given net.Addr. The second return value is false for addresses
+// without IP, like unix socket addresses.
+func addrFromNetAddr(netAddr net.Addr) (netip.Addr, bool) {
+	switch typedAddr := netAddr.(type) {
+	case *net.TCPAddr:
+		addr, ok := netip.AddrFromSlice(typedAddr.IP)
+		return addr.Unmap(), ok
+	case *net.UDPAddr:
+		addr, ok := netip.AddrFromSlice(typedAddr.IP)
+		return addr.Unmap(), ok
+	default:
+		return netip.Addr{}, false
+	}
+}
+
+// sourcePrefix returns the prefix identifying the source of given address. IPv4 addresses are their own source,
+// while IPv6 addresses get grouped by given prefix length, as a single client usually controls a whole prefix.
+func sourcePrefix(addr netip.Addr, ipv6PrefixLength int) netip.Prefix {
+	addr = addr.Unmap()
+
+	bits := addr.BitLen()
+	if addr.Is6() {
+		bits = min(ipv6PrefixLength, bits)
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	return prefix
+}
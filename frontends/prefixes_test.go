@@ -0,0 +1,83 @@
+package frontends
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := parsePrefixes([]string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32", "10.1.2.3/8"})
+	if err != nil {
+		t.Fatalf("parsePrefixes() failed: %v", err)
+	}
+
+	expected := []string{"10.0.0.0/8", "192.168.1.5/32", "2001:db8::/32", "10.0.0.0/8"}
+	if len(prefixes) != len(expected) {
+		t.Fatalf("got %d prefixes, want %d", len(prefixes), len(expected))
+	}
+
+	for i, prefix := range prefixes {
+		if prefix.String() != expected[i] {
+			t.Errorf("prefix %d = %q, want %q", i, prefix.String(), expected[i])
+		}
+	}
+}
+
+func TestParsePrefixes_Invalid(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0.0/x"} {
+		if _, err := parsePrefixes([]string{cidr}); err == nil {
+			t.Errorf("expected parsePrefixes() to fail for %q", cidr)
+		}
+	}
+}
+
+func TestPrefixesContain(t *testing.T) {
+	prefixes, _ := parsePrefixes([]string{"10.0.0.0/8", "2001:db8::/32"})
+
+	testCases := map[string]bool{
+		"10.1.2.3":         true,
+		"::ffff:10.1.2.3":  true,
+		"11.0.0.1":         false,
+		"2001:db8::1":      true,
+		"2001:db9::1":      false,
+		"::ffff:192.0.2.1": false,
+	}
+
+	for addr, want := range testCases {
+		if got := prefixesContain(prefixes, netip.MustParseAddr(addr)); got != want {
+			t.Errorf("prefixesContain(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestAddrFromNetAddr(t *testing.T) {
+	addr, ok := addrFromNetAddr(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 80})
+	if !ok || addr != netip.MustParseAddr("192.0.2.1") {
+		t.Errorf("addrFromNetAddr(tcp) = %v, %v, want 192.0.2.1, true", addr, ok)
+	}
+
+	addr, ok = addrFromNetAddr(&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53})
+	if !ok || addr != netip.MustParseAddr("2001:db8::1") {
+		t.Errorf("addrFromNetAddr(udp) = %v, %v, want 2001:db8::1, true", addr, ok)
+	}
+
+	if _, ok = addrFromNetAddr(&net.UnixAddr{Name: "/tmp/socket", Net: "unix"}); ok {
+		t.Error("addrFromNetAddr(unix) should not return an address")
+	}
+}
+
+func TestSourcePrefix(t *testing.T) {
+	testCases := map[string]string{
+		"192.0.2.1":          "192.0.2.1/32",
+		"::ffff:192.0.2.1":   "192.0.2.1/32",
+		"2001:db8:0:1::1":    "2001:db8:0:1::/64",
+		"2001:db8:0:1:ab::1": "2001:db8:0:1::/64",
+	}
+
+	for addr, want := range testCases {
+		if got := sourcePrefix(netip.MustParseAddr(addr), 64); got != netip.MustParsePrefix(want) {
+			t.Errorf("sourcePrefix(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
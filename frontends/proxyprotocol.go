@@ -0,0 +1,180 @@
+package frontends
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/sateffen/pluggo/backends/helper"
+)
+
+// proxyProtocolV1MaxLength is the maximum length of a PROXY protocol v1 header, including the trailing CRLF.
+const proxyProtocolV1MaxLength = 107
+
+// proxyProtocolV2HeaderLength is the length of the fixed part of a PROXY protocol v2 header.
+const proxyProtocolV2HeaderLength = 16
+
+const (
+	proxyProtocolV2AddrLenIPv4 = 12
+	proxyProtocolV2AddrLenIPv6 = 36
+)
+
+// proxyHeader contains the addresses parsed from a PROXY protocol header. Both addresses are nil, if the
+// header doesn't carry addresses, like for health checks of the load balancer.
+type proxyHeader struct {
+	sourceAddr      net.Addr
+	destinationAddr net.Addr
+}
+
+// readProxyHeader reads a PROXY protocol v1 or v2 header from given reader. All bytes following the header
+// stay in the reader.
+func readProxyHeader(reader *bufio.Reader) (*proxyHeader, error) {
+	firstByte, err := reader.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("could not read proxy protocol header: %w", err)
+	}
+
+	switch firstByte[0] {
+	case 'P':
+		return readProxyHeaderV1(reader)
+	case helper.ProxyProtocolV2Signature()[0]:
+		return readProxyHeaderV2(reader)
+	default:
+		return nil, errors.New("connection does not start with a proxy protocol header")
+	}
+}
+
+// readProxyHeaderV1 reads a human-readable PROXY protocol v1 header like "PROXY TCP4 1.2.3.4 5.6.7.8 1234 80\r\n".
+func readProxyHeaderV1(reader *bufio.Reader) (*proxyHeader, error) {
+	line := make([]byte, 0, proxyProtocolV1MaxLength)
+
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == proxyProtocolV1MaxLength {
+			return nil, errors.New("proxy protocol v1 header too long")
+		}
+
+		nextByte, err := reader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("could not read proxy protocol v1 header: %w", err)
+		}
+
+		line = append(line, nextByte)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if fields[0] != "PROXY" || len(fields) < 2 {
+		return nil, errors.New("invalid proxy protocol v1 header")
+	}
+
+	if fields[1] == "UNKNOWN" {
+		return &proxyHeader{sourceAddr: nil, destinationAddr: nil}, nil
+	}
+
+	//nolint:mnd // a v1 header consists of exactly six fields
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("invalid proxy protocol v1 header")
+	}
+
+	sourceAddr, err := parseProxyHeaderV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+
+	destinationAddr, err := parseProxyHeaderV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxyHeader{sourceAddr: sourceAddr, destinationAddr: destinationAddr}, nil
+}
+
+// parseProxyHeaderV1Addr parses given ip and port from a PROXY protocol v1 header.
+func parseProxyHeaderV1Addr(ip string, port string) (*net.TCPAddr, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("invalid address '%s' in proxy protocol v1 header", ip)
+	}
+
+	parsedPort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port '%s' in proxy protocol v1 header", port)
+	}
+
+	return &net.TCPAddr{IP: parsedIP, Port: int(parsedPort)}, nil
+}
+
+// readProxyHeaderV2 reads a binary PROXY protocol v2 header. TLVs following the addresses get skipped.
+func readProxyHeaderV2(reader *bufio.Reader) (*proxyHeader, error) {
+	header := make([]byte, proxyProtocolV2HeaderLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("could not read proxy protocol v2 header: %w", err)
+	}
+
+	signature := helper.ProxyProtocolV2Signature()
+	if !bytes.Equal(header[:len(signature)], signature) {
+		return nil, errors.New("invalid proxy protocol v2 signature")
+	}
+
+	versionAndCommand := header[12]
+	family := header[13]
+	payloadLength := binary.BigEndian.Uint16(header[14:16])
+
+	if versionAndCommand>>4 != helper.ProxyProtocolV2Version {
+		return nil, errors.New("unsupported proxy protocol v2 version")
+	}
+
+	payload := make([]byte, payloadLength)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, fmt.Errorf("could not read proxy protocol v2 addresses: %w", err)
+	}
+
+	//nolint:mnd // the lower four bits are the command
+	switch versionAndCommand & 0x0F {
+	case helper.ProxyProtocolV2CommandLocal:
+		return &proxyHeader{sourceAddr: nil, destinationAddr: nil}, nil
+	case helper.ProxyProtocolV2CommandProxy:
+		return parseProxyHeaderV2Addrs(family, payload)
+	default:
+		return nil, errors.New("unsupported proxy protocol v2 command")
+	}
+}
+
+// parseProxyHeaderV2Addrs parses the addresses from the payload of a PROXY protocol v2 header. For address
+// families other than TCP over IPv4 and IPv6, the addresses are ignored.
+func parseProxyHeaderV2Addrs(family byte, payload []byte) (*proxyHeader, error) {
+	var ipLength int
+
+	switch family {
+	case helper.ProxyProtocolV2FamilyTCP4:
+		if len(payload) < proxyProtocolV2AddrLenIPv4 {
+			return nil, errors.New("proxy protocol v2 header too short for ipv4 addresses")
+		}
+		ipLength = net.IPv4len
+	case helper.ProxyProtocolV2FamilyTCP6:
+		if len(payload) < proxyProtocolV2AddrLenIPv6 {
+			return nil, errors.New("proxy protocol v2 header too short for ipv6 addresses")
+		}
+		ipLength = net.IPv6len
+	default:
+		return &proxyHeader{sourceAddr: nil, destinationAddr: nil}, nil
+	}
+
+	portOffset := 2 * ipLength
+
+	return &proxyHeader{
+		sourceAddr: &net.TCPAddr{
+			IP:   net.IP(bytes.Clone(payload[:ipLength])),
+			Port: int(binary.BigEndian.Uint16(payload[portOffset : portOffset+2])),
+		},
+		destinationAddr: &net.TCPAddr{
+			IP:   net.IP(bytes.Clone(payload[ipLength:portOffset])),
+			Port: int(binary.BigEndian.Uint16(payload[portOffset+2 : portOffset+4])),
+		},
+	}, nil
+}
@@ -0,0 +1,187 @@
+package frontends
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/sateffen/pluggo/backends/helper"
+)
+
+// buildProxyHeaderV2 builds a PROXY protocol v2 header with given command, family and payload.
+func buildProxyHeaderV2(command byte, family byte, payload []byte) []byte {
+	header := append([]byte(nil), helper.ProxyProtocolV2Signature()...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+
+	return append(header, payload...)
+}
+
+func TestReadProxyHeader_V1(t *testing.T) {
+	testCases := map[string]struct {
+		header          string
+		wantSource      string
+		wantDestination string
+	}{
+		"tcp4": {
+			header:          "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+			wantSource:      "192.0.2.1:56324",
+			wantDestination: "198.51.100.1:443",
+		},
+		"tcp6": {
+			header:          "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n",
+			wantSource:      "[2001:db8::1]:56324",
+			wantDestination: "[2001:db8::2]:443",
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(testCase.header + "payload"))
+
+			header, err := readProxyHeader(reader)
+			if err != nil {
+				t.Fatalf("readProxyHeader() failed: %v", err)
+			}
+
+			if header.sourceAddr.String() != testCase.wantSource {
+				t.Errorf("sourceAddr = %q, want %q", header.sourceAddr.String(), testCase.wantSource)
+			}
+			if header.destinationAddr.String() != testCase.wantDestination {
+				t.Errorf("destinationAddr = %q, want %q", header.destinationAddr.String(), testCase.wantDestination)
+			}
+
+			// Everything after the header has to stay in the reader
+			rest, _ := io.ReadAll(reader)
+			if string(rest) != "payload" {
+				t.Errorf("remaining data = %q, want %q", string(rest), "payload")
+			}
+		})
+	}
+}
+
+func TestReadProxyHeader_V1Unknown(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n"))
+
+	header, err := readProxyHeader(reader)
+	if err != nil {
+		t.Fatalf("readProxyHeader() failed: %v", err)
+	}
+
+	if header.sourceAddr != nil || header.destinationAddr != nil {
+		t.Errorf("expected no addresses for UNKNOWN, got %v and %v", header.sourceAddr, header.destinationAddr)
+	}
+}
+
+func TestReadProxyHeader_V1Invalid(t *testing.T) {
+	testCases := map[string]string{
+		"too long":        "PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n",
+		"missing fields":  "PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n",
+		"unknown family":  "PROXY UDP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+		"invalid address": "PROXY TCP4 192.0.2.x 198.51.100.1 56324 443\r\n",
+		"invalid port":    "PROXY TCP4 192.0.2.1 198.51.100.1 99999 443\r\n",
+		"wrong keyword":   "PRAXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+		"truncated":       "PROXY TCP4 192.0.2.1",
+		"no header":       "GET / HTTP/1.1\r\n",
+	}
+
+	for name, input := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readProxyHeader(bufio.NewReader(strings.NewReader(input))); err == nil {
+				t.Error("expected readProxyHeader() to fail")
+			}
+		})
+	}
+}
+
+func TestReadProxyHeader_V2TCP4WithTLVs(t *testing.T) {
+	payload := []byte{
+		192, 0, 2, 1, // source address
+		198, 51, 100, 1, // destination address
+		0xDC, 0x04, // source port 56324
+		0x01, 0xBB, // destination port 443
+		0x02, 0x00, 0x03, 'f', 'o', 'o', // authority TLV, which gets skipped
+	}
+	input := append(buildProxyHeaderV2(helper.ProxyProtocolV2CommandProxy, helper.ProxyProtocolV2FamilyTCP4, payload), []byte("payload")...)
+	reader := bufio.NewReader(bytes.NewReader(input))
+
+	header, err := readProxyHeader(reader)
+	if err != nil {
+		t.Fatalf("readProxyHeader() failed: %v", err)
+	}
+
+	if header.sourceAddr.String() != "192.0.2.1:56324" {
+		t.Errorf("sourceAddr = %q, want %q", header.sourceAddr.String(), "192.0.2.1:56324")
+	}
+	if header.destinationAddr.String() != "198.51.100.1:443" {
+		t.Errorf("destinationAddr = %q, want %q", header.destinationAddr.String(), "198.51.100.1:443")
+	}
+
+	rest, _ := io.ReadAll(reader)
+	if string(rest) != "payload" {
+		t.Errorf("remaining data = %q, want %q", string(rest), "payload")
+	}
+}
+
+func TestReadProxyHeader_V2TCP6(t *testing.T) {
+	payload := make([]byte, 0, proxyProtocolV2AddrLenIPv6)
+	payload = append(payload, net.ParseIP("2001:db8::1")...)
+	payload = append(payload, net.ParseIP("2001:db8::2")...)
+	payload = binary.BigEndian.AppendUint16(payload, 56324)
+	payload = binary.BigEndian.AppendUint16(payload, 443)
+
+	header, err := readProxyHeader(bufio.NewReader(bytes.NewReader(
+		buildProxyHeaderV2(helper.ProxyProtocolV2CommandProxy, helper.ProxyProtocolV2FamilyTCP6, payload),
+	)))
+	if err != nil {
+		t.Fatalf("readProxyHeader() failed: %v", err)
+	}
+
+	if header.sourceAddr.String() != "[2001:db8::1]:56324" {
+		t.Errorf("sourceAddr = %q, want %q", header.sourceAddr.String(), "[2001:db8::1]:56324")
+	}
+	if header.destinationAddr.String() != "[2001:db8::2]:443" {
+		t.Errorf("destinationAddr = %q, want %q", header.destinationAddr.String(), "[2001:db8::2]:443")
+	}
+}
+
+func TestReadProxyHeader_V2Local(t *testing.T) {
+	header, err := readProxyHeader(bufio.NewReader(bytes.NewReader(
+		buildProxyHeaderV2(helper.ProxyProtocolV2CommandLocal, 0x00, nil),
+	)))
+	if err != nil {
+		t.Fatalf("readProxyHeader() failed: %v", err)
+	}
+
+	if header.sourceAddr != nil || header.destinationAddr != nil {
+		t.Errorf("expected no addresses for LOCAL, got %v and %v", header.sourceAddr, header.destinationAddr)
+	}
+}
+
+func TestReadProxyHeader_V2Invalid(t *testing.T) {
+	invalidSignature := buildProxyHeaderV2(helper.ProxyProtocolV2CommandProxy, helper.ProxyProtocolV2FamilyTCP4, make([]byte, 12))
+	invalidSignature[3] = 0x00
+
+	invalidVersion := buildProxyHeaderV2(helper.ProxyProtocolV2CommandProxy, helper.ProxyProtocolV2FamilyTCP4, make([]byte, 12))
+	invalidVersion[12] = 0x11
+
+	testCases := map[string][]byte{
+		"invalid signature": invalidSignature,
+		"invalid version":   invalidVersion,
+		"unknown command":   buildProxyHeaderV2(0x2, helper.ProxyProtocolV2FamilyTCP4, make([]byte, 12)),
+		"short payload":     buildProxyHeaderV2(helper.ProxyProtocolV2CommandProxy, helper.ProxyProtocolV2FamilyTCP4, make([]byte, 4)),
+		"truncated payload": buildProxyHeaderV2(helper.ProxyProtocolV2CommandProxy, helper.ProxyProtocolV2FamilyTCP4, make([]byte, 12))[:20],
+	}
+
+	for name, input := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readProxyHeader(bufio.NewReader(bytes.NewReader(input))); err == nil {
+				t.Error("expected readProxyHeader() to fail")
+			}
+		})
+	}
+}
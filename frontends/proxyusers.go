@@ -0,0 +1,54 @@
+package frontends
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// proxyCredentialMaxLength is the maximum length of usernames and passwords, as SOCKS5 can't transmit longer ones.
+const proxyCredentialMaxLength = 255
+
+// proxyUsers maps the usernames of users allowed to use a proxy frontend to their passwords. If empty,
+// no authentication is required.
+type proxyUsers map[string]string
+
+// newProxyUsers creates the proxyUsers for given configs.
+func newProxyUsers(confs []config.ProxyUserConfig) (proxyUsers, error) {
+	users := make(proxyUsers, len(confs))
+
+	for _, userConf := range confs {
+		if userConf.Username == "" {
+			return nil, errors.New("user without username")
+		}
+
+		if len(userConf.Username) > proxyCredentialMaxLength || len(userConf.Password) > proxyCredentialMaxLength {
+			return nil, fmt.Errorf("username or password of user '%s' is longer than %d bytes", userConf.Username, proxyCredentialMaxLength)
+		}
+
+		if _, exists := users[userConf.Username]; exists {
+			return nil, fmt.Errorf("user '%s' is configured multiple times", userConf.Username)
+		}
+
+		users[userConf.Username] = userConf.Password
+	}
+
+	return users, nil
+}
+
+// authRequired reports whether users have to authenticate.
+func (pu proxyUsers) authRequired() bool {
+	return len(pu) > 0
+}
+
+// check reports whether given credentials belong to a configured user.
+func (pu proxyUsers) check(username string, password string) bool {
+	expectedPassword, ok := pu[username]
+
+	// Compare even for unknown users, so the timing doesn't tell which users exist
+	passwordMatches := subtle.ConstantTimeCompare([]byte(expectedPassword), []byte(password)) == 1
+
+	return ok && passwordMatches
+}
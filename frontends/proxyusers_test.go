@@ -0,0 +1,70 @@
+package frontends
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+func TestProxyUsers_Check(t *testing.T) {
+	users, err := newProxyUsers([]config.ProxyUserConfig{
+		{Username: "alice", Password: "secret"},
+		{Username: "bob", Password: ""},
+	})
+	if err != nil {
+		t.Fatalf("newProxyUsers() failed: %v", err)
+	}
+
+	if !users.authRequired() {
+		t.Error("authRequired() = false, want true with configured users")
+	}
+
+	tests := []struct {
+		username string
+		password string
+		want     bool
+	}{
+		{username: "alice", password: "secret", want: true},
+		{username: "alice", password: "wrong", want: false},
+		{username: "alice", password: "", want: false},
+		{username: "bob", password: "", want: true},
+		{username: "mallory", password: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := users.check(tt.username, tt.password); got != tt.want {
+			t.Errorf("check(%q, %q) = %v, want %v", tt.username, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestProxyUsers_NoUsers(t *testing.T) {
+	users, err := newProxyUsers(nil)
+	if err != nil {
+		t.Fatalf("newProxyUsers() failed: %v", err)
+	}
+
+	if users.authRequired() {
+		t.Error("authRequired() = true, want false without users")
+	}
+}
+
+func TestProxyUsers_NewProxyUsers_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		users []config.ProxyUserConfig
+	}{
+		{name: "empty username", users: []config.ProxyUserConfig{{Username: "", Password: "secret"}}},
+		{name: "duplicate username", users: []config.ProxyUserConfig{{Username: "alice"}, {Username: "alice"}}},
+		{name: "password too long", users: []config.ProxyUserConfig{{Username: "alice", Password: strings.Repeat("a", 256)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newProxyUsers(tt.users); err == nil {
+				t.Error("expected newProxyUsers() to fail")
+			}
+		})
+	}
+}
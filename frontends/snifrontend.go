@@ -0,0 +1,128 @@
+package frontends
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const sniClientHelloTimeout = 10 * time.Second
+
+type sniFrontend struct {
+	*tcpListeners
+
+	routes *hostnameRoutes
+}
+
+// newSNIFrontend creates a new instance of an sniFrontend, preparing it with all default dependencies.
+func newSNIFrontend(conf config.SNIFrontendConfig, backendList *backends.BackendList) (*sniFrontend, error) {
+	parsedListenAddr, err := net.ResolveTCPAddr("tcp", conf.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+	}
+
+	routes, err := newHostnameRoutes(conf.Routes, conf.Default, backendList)
+	if err != nil {
+		return nil, fmt.Errorf("could not create routes of frontend '%s': %w", conf.Name, err)
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options of frontend '%s': %w", conf.Name, err)
+	}
+
+	return &sniFrontend{
+		tcpListeners: newTCPListeners(conf.Name, "snifrontend", []*net.TCPAddr{parsedListenAddr}, limiter, socketOptions),
+		routes:       routes,
+	}, nil
+}
+
+// Listen creates a TCP listener, starts listening and accepting connections. Every accepted connection gets
+// routed in its own go-routine, based on the server name the client requests in its TLS ClientHello.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen is resilient in that it does not stop accepting connections just because an error happens.
+func (fe *sniFrontend) Listen() error {
+	return fe.listen(func(connection net.Conn) {
+		go fe.route(connection)
+	}, fe.acceptGates())
+}
+
+// route reads the ClientHello of given connection and hands the still encrypted connection to the backend
+// matching the requested server name. If no ClientHello arrives within sniClientHelloTimeout, or no backend
+// matches, the connection gets closed.
+func (fe *sniFrontend) route(connection net.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), sniClientHelloTimeout)
+	defer cancel()
+
+	helloInfo, replayConnection, err := peekClientHello(ctx, connection)
+	if err != nil {
+		slog.Debug(
+			"snifrontend could not read client hello",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+		closeUnroutedConnection(connection)
+
+		return
+	}
+
+	targetBackend, ok := fe.routes.lookup(helloInfo.serverName)
+	if !ok {
+		slog.Debug(
+			"snifrontend found no backend for server name",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.String("serverName", helloInfo.serverName),
+		)
+		closeUnroutedConnection(connection)
+
+		return
+	}
+
+	slog.Debug(
+		"snifrontend routed connection",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("serverName", helloInfo.serverName),
+		slog.Any("alpn", helloInfo.alpn),
+		slog.String("backend", targetBackend.GetName()),
+	)
+
+	targetBackend.Handle(&serverNameConn{Conn: replayConnection, serverName: helloInfo.serverName})
+}
+
+// serverNameConn is a connection routed by SNI, knowing the server name the client asked for.
+type serverNameConn struct {
+	net.Conn
+
+	serverName string
+}
+
+// ServerName returns the server name the client asked for in its ClientHello.
+func (c *serverNameConn) ServerName() string {
+	return c.serverName
+}
+
+// NetConn returns the underlying connection.
+func (c *serverNameConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// closeUnroutedConnection closes given connection, that couldn't be routed to any backend.
+func closeUnroutedConnection(connection net.Conn) {
+	if err := connection.Close(); err != nil {
+		slog.Debug("could not properly close unrouted connection", slog.Any("error", err))
+	}
+}
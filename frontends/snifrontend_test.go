@@ -0,0 +1,244 @@
+package frontends
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+// newTLSTerminatingBackend creates a mockBackend, that terminates TLS with given certificate and answers
+// with its name, so tests can verify the routed connection is untouched.
+func newTLSTerminatingBackend(t *testing.T, name string, certConf config.TLSCertificateConfig) *mockBackend {
+	t.Helper()
+
+	certificate, err := tls.LoadX509KeyPair(certConf.CertFile, certConf.KeyFile)
+	if err != nil {
+		t.Fatalf("could not load test certificate: %v", err)
+	}
+
+	return &mockBackend{
+		name: name,
+		mockHandle: func(conn net.Conn) {
+			defer conn.Close()
+
+			tlsConn := tls.Server(conn, &tls.Config{
+				Certificates: []tls.Certificate{certificate},
+				MinVersion:   tls.VersionTLS12,
+			})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+
+			tlsConn.Write([]byte(name))
+		},
+	}
+}
+
+func TestSNIFrontend_GetName(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newSNIFrontend(config.SNIFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8443",
+		Default:    "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newSNIFrontend() failed: %v", err)
+	}
+
+	if got := frontend.GetName(); got != "test-frontend" {
+		t.Errorf("GetName() = %q, want %q", got, "test-frontend")
+	}
+}
+
+func TestSNIFrontend_NewSNIFrontend_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	tests := []struct {
+		name string
+		conf config.SNIFrontendConfig
+	}{
+		{
+			name: "invalid listenAddr",
+			conf: config.SNIFrontendConfig{Name: "test-frontend", ListenAddr: "invalid", Default: "test-backend"},
+		},
+		{
+			name: "unknown route target",
+			conf: config.SNIFrontendConfig{
+				Name:       "test-frontend",
+				ListenAddr: "127.0.0.1:8443",
+				Routes:     map[string]string{"nas.example.com": "unknown"},
+			},
+		},
+		{
+			name: "unknown default",
+			conf: config.SNIFrontendConfig{Name: "test-frontend", ListenAddr: "127.0.0.1:8443", Default: "unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSNIFrontend(tt.conf, backendList); err == nil {
+				t.Error("expected newSNIFrontend() to fail")
+			}
+		})
+	}
+}
+
+func TestSNIFrontend_Listen_RoutesByServerName(t *testing.T) {
+	certDir := t.TempDir()
+	backendList := createTestBackendList("nas", "web", "fallback")
+
+	frontend, err := newSNIFrontend(config.SNIFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8443",
+		Routes: map[string]string{
+			"nas.example.com": "nas",
+			"*.example.com":   "web",
+		},
+		Default: "fallback",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newSNIFrontend() failed: %v", err)
+	}
+
+	certConf := generateTestCertificate(t, certDir, "example.com", "*.example.com", "other.org")
+	frontend.routes.hosts.exact["nas.example.com"] = newTLSTerminatingBackend(t, "nas", certConf)
+	frontend.routes.hosts.wildcard[".example.com"] = newTLSTerminatingBackend(t, "web", certConf)
+	frontend.routes.defaultBackend = newTLSTerminatingBackend(t, "fallback", certConf)
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{serverName: "nas.example.com", want: "nas"},
+		{serverName: "files.example.com", want: "web"},
+		{serverName: "other.org", want: "fallback"},
+	}
+
+	for _, tt := range tests {
+		//nolint:gosec // the test certificate is self-signed
+		clientConn, err := tls.Dial("tcp", listenAddr, &tls.Config{
+			ServerName:         tt.serverName,
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			t.Fatalf("could not dial frontend with server name %q: %v", tt.serverName, err)
+		}
+
+		answer, err := io.ReadAll(clientConn)
+		clientConn.Close()
+		if err != nil {
+			t.Fatalf("could not read answer for server name %q: %v", tt.serverName, err)
+		}
+
+		if string(answer) != tt.want {
+			t.Errorf("server name %q got routed to %q, want %q", tt.serverName, string(answer), tt.want)
+		}
+	}
+}
+
+func TestSNIFrontend_Listen_ClosesUnroutableConnection(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newSNIFrontend(config.SNIFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8443",
+		Routes:     map[string]string{"nas.example.com": "nas"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newSNIFrontend() failed: %v", err)
+	}
+
+	handleCalled := make(chan bool, 1)
+	frontend.routes.hosts.exact["nas.example.com"] = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handleCalled <- true
+			conn.Close()
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	for _, payload := range []string{"SSH-2.0-OpenSSH_9.6\r\n", ""} {
+		clientConn, err := net.Dial("tcp", listenAddr)
+		if err != nil {
+			t.Fatalf("could not dial frontend: %v", err)
+		}
+
+		if payload == "" {
+			// A real ClientHello for a server name without route and without default backend
+			//nolint:gosec // the handshake never completes anyway
+			tlsConn := tls.Client(clientConn, &tls.Config{ServerName: "other.example.com", InsecureSkipVerify: true})
+			tlsConn.SetDeadline(time.Now().Add(time.Second))
+			if err = tlsConn.Handshake(); err == nil {
+				t.Error("expected handshake with unroutable server name to fail")
+			}
+		} else {
+			clientConn.Write([]byte(payload))
+			clientConn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err = clientConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+				t.Errorf("expected io.EOF for non TLS connection, got: %v", err)
+			}
+		}
+
+		clientConn.Close()
+	}
+
+	if len(handleCalled) != 0 {
+		t.Error("backend.Handle() got called for unroutable connection")
+	}
+}
+
+func TestSNIFrontend_Listen_TellsServerNameToBackend(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newSNIFrontend(config.SNIFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8443",
+		Routes:     map[string]string{"nas.example.com": "nas"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newSNIFrontend() failed: %v", err)
+	}
+
+	names := make(chan [2]string, 1)
+	frontend.routes.hosts.exact["nas.example.com"] = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			names <- [2]string{helper.ServerName(conn), helper.FrontendName(conn)}
+			conn.Close()
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	//nolint:gosec // the handshake never completes anyway
+	clientConn, err := tls.Dial("tcp", listenAddr, &tls.Config{ServerName: "nas.example.com", InsecureSkipVerify: true})
+	if err == nil {
+		clientConn.Close()
+	}
+
+	if got := <-names; got != [2]string{"nas.example.com", "test-frontend"} {
+		t.Errorf("backend got server name %q and frontend name %q, want %q and %q", got[0], got[1], "nas.example.com", "test-frontend")
+	}
+}
@@ -0,0 +1,162 @@
+package frontends
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket activation, see sd_listen_fds(3).
+const listenFdsStart = 3
+
+// socketActivatable is implemented by frontends that can use a listener inherited by systemd socket activation
+// instead of binding their own socket.
+type socketActivatable interface {
+	useInheritedFile(file *os.File)
+}
+
+// inheritedListenerFactory creates listeners from a file descriptor inherited by systemd socket activation. It
+// implements the tcpListenerFactory, unixListenerFactory and udpListenerFactory interfaces, ignoring the
+// addresses passed to it, as the socket is already bound.
+// Listeners hold their own duplicate of the file descriptor, so the inherited file gets closed as soon as a
+// listener got created from it. If creating the listener fails, the file is kept for the next attempt.
+type inheritedListenerFactory struct {
+	file *os.File
+}
+
+func (f inheritedListenerFactory) ListenTCP(_ string, _ *net.TCPAddr) (streamListener, error) {
+	return f.listenStream()
+}
+
+func (f inheritedListenerFactory) ListenUnix(_ string, _ *net.UnixAddr) (streamListener, error) {
+	return f.listenStream()
+}
+
+func (f inheritedListenerFactory) ListenUDP(_ string, _ *net.UDPAddr) (udpListener, error) {
+	packetConn, err := net.FilePacketConn(f.file)
+	if err != nil {
+		return nil, err
+	}
+
+	udpConn, ok := packetConn.(*net.UDPConn)
+	if !ok {
+		if closeErr := packetConn.Close(); closeErr != nil {
+			slog.Warn("could not close inherited packet connection", slog.Any("error", closeErr))
+		}
+
+		return nil, fmt.Errorf("inherited file descriptor '%s' is no udp socket", f.file.Name())
+	}
+
+	closeInheritedFiles([]*os.File{f.file})
+
+	return udpConn, nil
+}
+
+// listenStream creates a stream listener from the inherited file, and closes the file afterwards.
+func (f inheritedListenerFactory) listenStream() (streamListener, error) {
+	listener, err := net.FileListener(f.file)
+	if err != nil {
+		return nil, err
+	}
+
+	closeInheritedFiles([]*os.File{f.file})
+
+	return listener, nil
+}
+
+// listenFdsFromEnv returns the file descriptors passed by systemd socket activation, grouped by their name
+// from LISTEN_FDNAMES. The environment variables get removed afterwards, so child processes don't inherit them.
+func listenFdsFromEnv() (map[string][]*os.File, error) {
+	defer func() {
+		for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			if err := os.Unsetenv(key); err != nil {
+				slog.Warn("could not unset environment variable", slog.String("key", key), slog.Any("error", err))
+			}
+		}
+	}()
+
+	return parseListenFds(os.Getenv, os.Getpid(), listenFdsStart)
+}
+
+// parseListenFds parses the socket activation environment variables read by given getenv. The variables are
+// only respected if LISTEN_PID matches given pid. File descriptors start at given firstFd. File descriptors
+// without name get the name "unknown", like sd_listen_fds_with_names(3) does.
+func parseListenFds(getenv func(key string) string, pid int, firstFd int) (map[string][]*os.File, error) {
+	files := make(map[string][]*os.File)
+
+	listenPid := getenv("LISTEN_PID")
+	if listenPid == "" {
+		return files, nil
+	}
+
+	if parsedPid, err := strconv.Atoi(listenPid); err != nil || parsedPid != pid {
+		slog.Debug("ignoring socket activation for other process", slog.String("listenPid", listenPid))
+		return files, nil
+	}
+
+	fdCount, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || fdCount < 0 {
+		return nil, errors.New("LISTEN_FDS is not a valid number")
+	}
+
+	var names []string
+	if fdNames := getenv("LISTEN_FDNAMES"); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	for i := range fdCount {
+		fd := firstFd + i
+
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		syscall.CloseOnExec(fd)
+		files[name] = append(files[name], os.NewFile(uintptr(fd), name))
+	}
+
+	return files, nil
+}
+
+// applySocketActivation passes the inherited files to the frontends with matching name. Frontends without
+// matching file keep binding their own socket. Inherited files not matching any frontend get logged and closed.
+func applySocketActivation(frontendList map[string]Frontend, files map[string][]*os.File) {
+	for name, frontendFiles := range files {
+		frontend, ok := frontendList[name]
+		if !ok {
+			slog.Warn("no frontend found for inherited socket", slog.String("name", name))
+			closeInheritedFiles(frontendFiles)
+			continue
+		}
+
+		activatable, ok := frontend.(socketActivatable)
+		if !ok {
+			slog.Warn("frontend does not support socket activation", slog.String("name", name))
+			closeInheritedFiles(frontendFiles)
+			continue
+		}
+
+		if len(frontendFiles) > 1 {
+			slog.Warn("multiple sockets inherited for frontend, using the first one", slog.String("name", name))
+			closeInheritedFiles(frontendFiles[1:])
+		}
+
+		slog.Info("frontend uses socket from socket activation", slog.String("name", name))
+		activatable.useInheritedFile(frontendFiles[0])
+	}
+}
+
+// closeInheritedFiles closes given files, logging errors instead of returning them.
+func closeInheritedFiles(files []*os.File) {
+	for _, file := range files {
+		if err := file.Close(); err != nil {
+			slog.Warn("could not close inherited socket", slog.String("name", file.Name()), slog.Any("error", err))
+		}
+	}
+}
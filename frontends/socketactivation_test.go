@@ -0,0 +1,227 @@
+//go:build linux
+
+package frontends
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// createInheritedFds creates a file descriptor for each given listener, duplicated to consecutive numbers
+// starting at firstFd, like systemd passes them to the process.
+func createInheritedFds(t *testing.T, firstFd int, listeners ...interface{ File() (*os.File, error) }) {
+	t.Helper()
+
+	for i, listener := range listeners {
+		file, err := listener.File()
+		if err != nil {
+			t.Fatalf("could not get file of listener: %v", err)
+		}
+
+		if err = syscall.Dup3(int(file.Fd()), firstFd+i, 0); err != nil {
+			t.Fatalf("could not duplicate file descriptor: %v", err)
+		}
+		file.Close()
+	}
+}
+
+// testEnv returns a getenv function serving given values.
+func testEnv(values map[string]string) func(key string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
+
+func TestParseListenFds_NoSocketActivation(t *testing.T) {
+	files, err := parseListenFds(testEnv(map[string]string{}), os.Getpid(), listenFdsStart)
+	if err != nil {
+		t.Fatalf("parseListenFds() failed: %v", err)
+	}
+
+	if len(files) != 0 {
+		t.Errorf("parseListenFds() returned %d names, want 0", len(files))
+	}
+}
+
+func TestParseListenFds_OtherPid(t *testing.T) {
+	files, err := parseListenFds(testEnv(map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid() + 1),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "test-frontend",
+	}), os.Getpid(), listenFdsStart)
+	if err != nil {
+		t.Fatalf("parseListenFds() failed: %v", err)
+	}
+
+	if len(files) != 0 {
+		t.Errorf("parseListenFds() returned %d names for other pid, want 0", len(files))
+	}
+}
+
+func TestParseListenFds_InvalidFdCount(t *testing.T) {
+	_, err := parseListenFds(testEnv(map[string]string{
+		"LISTEN_PID": strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS": "many",
+	}), os.Getpid(), listenFdsStart)
+
+	if err == nil {
+		t.Fatal("expected parseListenFds() to fail with invalid LISTEN_FDS")
+	}
+}
+
+func TestParseListenFds_GroupsFilesByName(t *testing.T) {
+	firstListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("could not create listener: %v", err)
+	}
+	defer firstListener.Close()
+
+	secondListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("could not create listener: %v", err)
+	}
+	defer secondListener.Close()
+
+	thirdListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("could not create listener: %v", err)
+	}
+	defer thirdListener.Close()
+
+	const firstFd = 200
+	createInheritedFds(t, firstFd, firstListener, secondListener, thirdListener)
+
+	files, err := parseListenFds(testEnv(map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "3",
+		"LISTEN_FDNAMES": "first frontend:second frontend",
+	}), os.Getpid(), firstFd)
+	if err != nil {
+		t.Fatalf("parseListenFds() failed: %v", err)
+	}
+
+	expectedAddrs := map[string]string{
+		"first frontend":  firstListener.Addr().String(),
+		"second frontend": secondListener.Addr().String(),
+		"unknown":         thirdListener.Addr().String(),
+	}
+
+	for name, expectedAddr := range expectedAddrs {
+		if len(files[name]) != 1 {
+			t.Fatalf("got %d files for %q, want 1", len(files[name]), name)
+		}
+
+		listener, err := inheritedListenerFactory{file: files[name][0]}.ListenTCP("tcp", nil)
+		if err != nil {
+			t.Fatalf("could not create listener from inherited file %q: %v", name, err)
+		}
+
+		if listener.Addr().String() != expectedAddr {
+			t.Errorf("inherited listener %q listens on %q, want %q", name, listener.Addr().String(), expectedAddr)
+		}
+		listener.Close()
+
+		if err = files[name][0].Close(); err == nil {
+			t.Errorf("expected inherited file %q to be closed after creating the listener", name)
+		}
+	}
+}
+
+func TestApplySocketActivation_FrontendUsesInheritedSocket(t *testing.T) {
+	inheritedListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("could not create listener: %v", err)
+	}
+	defer inheritedListener.Close()
+
+	inheritedFile, err := inheritedListener.File()
+	if err != nil {
+		t.Fatalf("could not get file of listener: %v", err)
+	}
+
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:1",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	handleCalled := make(chan bool, 1)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handleCalled <- true
+			conn.Close()
+		},
+	}
+
+	applySocketActivation(map[string]Frontend{"test-frontend": frontend}, map[string][]*os.File{
+		"test-frontend": {inheritedFile},
+	})
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- frontend.Listen()
+		close(listenDone)
+	}()
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	// The frontend should accept on the inherited socket, not on its configured listenAddr
+	clientConn, err := net.Dial("tcp", inheritedListener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial inherited socket: %v", err)
+	}
+	defer clientConn.Close()
+
+	<-handleCalled
+}
+
+func TestApplySocketActivation_ClosesUnmatchedFiles(t *testing.T) {
+	inheritedListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("could not create listener: %v", err)
+	}
+	defer inheritedListener.Close()
+
+	inheritedFile, err := inheritedListener.File()
+	if err != nil {
+		t.Fatalf("could not get file of listener: %v", err)
+	}
+
+	applySocketActivation(map[string]Frontend{}, map[string][]*os.File{
+		"unknown-frontend": {inheritedFile},
+	})
+
+	if err = inheritedFile.Close(); err == nil {
+		t.Error("expected inherited file of unknown frontend to be closed already")
+	}
+}
+
+func TestInheritedListenerFactory_ListenUDPOnStreamSocket(t *testing.T) {
+	inheritedListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("could not create listener: %v", err)
+	}
+	defer inheritedListener.Close()
+
+	inheritedFile, err := inheritedListener.File()
+	if err != nil {
+		t.Fatalf("could not get file of listener: %v", err)
+	}
+	defer inheritedFile.Close()
+
+	if _, err = (inheritedListenerFactory{file: inheritedFile}).ListenUDP("udp", nil); err == nil {
+		t.Fatal("expected ListenUDP() to fail for an inherited tcp socket")
+	}
+}
@@ -0,0 +1,214 @@
+package frontends
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// This file implements the parts of SOCKS5 (RFC 1928) and its username/password authentication (RFC 1929)
+// used by the socks5Frontend.
+
+const (
+	socks5GreetingHeaderLength = 2
+	socks5AuthHeaderLength     = 2
+	socks5RequestHeaderLength  = 4
+	socks5PortLength           = 2
+)
+
+const (
+	socks5Version     = 0x05
+	socks5AuthVersion = 0x01
+
+	socks5MethodNoAuth       = 0x00
+	socks5MethodUserPass     = 0x02
+	socks5MethodNoAcceptable = 0xFF
+
+	socks5AuthSucceeded = 0x00
+	socks5AuthFailed    = 0x01
+
+	socks5CommandConnect = 0x01
+
+	socks5AddrTypeIPv4   = 0x01
+	socks5AddrTypeDomain = 0x03
+	socks5AddrTypeIPv6   = 0x04
+
+	socks5ReplySucceeded               = 0x00
+	socks5ReplyGeneralFailure          = 0x01
+	socks5ReplyNotAllowed              = 0x02
+	socks5ReplyNetworkUnreachable      = 0x03
+	socks5ReplyHostUnreachable         = 0x04
+	socks5ReplyConnectionRefused       = 0x05
+	socks5ReplyTTLExpired              = 0x06
+	socks5ReplyCommandNotSupported     = 0x07
+	socks5ReplyAddressTypeNotSupported = 0x08
+)
+
+var errSOCKS5AddressTypeNotSupported = errors.New("socks5 address type not supported")
+
+// socks5Request is a request sent by a SOCKS5 client after authentication.
+type socks5Request struct {
+	command byte
+	host    string
+	port    int
+}
+
+// address returns the destination of the request as address to dial.
+func (r *socks5Request) address() string {
+	return net.JoinHostPort(r.host, strconv.Itoa(r.port))
+}
+
+// readSOCKS5Greeting reads the greeting of a SOCKS5 client, and returns the authentication methods it offers.
+func readSOCKS5Greeting(reader io.Reader) ([]byte, error) {
+	header := make([]byte, socks5GreetingHeaderLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("could not read socks5 greeting: %w", err)
+	}
+
+	if header[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported socks version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return nil, fmt.Errorf("could not read socks5 authentication methods: %w", err)
+	}
+
+	return methods, nil
+}
+
+// readSOCKS5Credentials reads the username and password sent by a SOCKS5 client, see RFC 1929.
+func readSOCKS5Credentials(reader io.Reader) (string, string, error) {
+	header := make([]byte, socks5AuthHeaderLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return "", "", fmt.Errorf("could not read socks5 credentials: %w", err)
+	}
+
+	if header[0] != socks5AuthVersion {
+		return "", "", fmt.Errorf("unsupported socks5 authentication version %d", header[0])
+	}
+
+	username := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, username); err != nil {
+		return "", "", fmt.Errorf("could not read socks5 username: %w", err)
+	}
+
+	passwordLength := make([]byte, 1)
+	if _, err := io.ReadFull(reader, passwordLength); err != nil {
+		return "", "", fmt.Errorf("could not read socks5 password: %w", err)
+	}
+
+	password := make([]byte, passwordLength[0])
+	if _, err := io.ReadFull(reader, password); err != nil {
+		return "", "", fmt.Errorf("could not read socks5 password: %w", err)
+	}
+
+	return string(username), string(password), nil
+}
+
+// readSOCKS5Request reads the request of a SOCKS5 client. If the client uses an unknown address type,
+// errSOCKS5AddressTypeNotSupported is returned.
+func readSOCKS5Request(reader io.Reader) (*socks5Request, error) {
+	header := make([]byte, socks5RequestHeaderLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("could not read socks5 request: %w", err)
+	}
+
+	if header[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported socks version %d", header[0])
+	}
+
+	var host string
+
+	switch header[3] {
+	case socks5AddrTypeIPv4, socks5AddrTypeIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if header[3] == socks5AddrTypeIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+
+		if _, err := io.ReadFull(reader, ip); err != nil {
+			return nil, fmt.Errorf("could not read socks5 destination address: %w", err)
+		}
+
+		host = ip.String()
+	case socks5AddrTypeDomain:
+		domainLength := make([]byte, 1)
+		if _, err := io.ReadFull(reader, domainLength); err != nil {
+			return nil, fmt.Errorf("could not read socks5 destination address: %w", err)
+		}
+
+		domain := make([]byte, domainLength[0])
+		if _, err := io.ReadFull(reader, domain); err != nil {
+			return nil, fmt.Errorf("could not read socks5 destination address: %w", err)
+		}
+
+		host = string(domain)
+	default:
+		return nil, errSOCKS5AddressTypeNotSupported
+	}
+
+	port := make([]byte, socks5PortLength)
+	if _, err := io.ReadFull(reader, port); err != nil {
+		return nil, fmt.Errorf("could not read socks5 destination port: %w", err)
+	}
+
+	return &socks5Request{
+		command: header[1],
+		host:    host,
+		port:    int(binary.BigEndian.Uint16(port)),
+	}, nil
+}
+
+// writeSOCKS5Reply writes a reply with given code to a SOCKS5 request. The bound address is reported as
+// 0.0.0.0:0, unless given bindAddr is a TCP address.
+func writeSOCKS5Reply(writer io.Writer, reply byte, bindAddr net.Addr) error {
+	addrType := byte(socks5AddrTypeIPv4)
+	ip := net.IPv4zero.To4()
+	port := 0
+
+	if tcpAddr, ok := bindAddr.(*net.TCPAddr); ok {
+		port = tcpAddr.Port
+
+		if ipv4 := tcpAddr.IP.To4(); ipv4 != nil {
+			ip = ipv4
+		} else if ipv6 := tcpAddr.IP.To16(); ipv6 != nil {
+			addrType = socks5AddrTypeIPv6
+			ip = ipv6
+		}
+	}
+
+	message := make([]byte, 0, socks5RequestHeaderLength+len(ip)+socks5PortLength)
+	message = append(message, socks5Version, reply, 0x00, addrType)
+	message = append(message, ip...)
+	message = binary.BigEndian.AppendUint16(message, uint16(port)) //nolint:gosec // ports always fit into uint16
+
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("could not write socks5 reply: %w", err)
+	}
+
+	return nil
+}
+
+// socks5ReplyForDialError returns the SOCKS5 reply code matching the reason, why dialing a destination failed.
+func socks5ReplyForDialError(err error) byte {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return socks5ReplyConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return socks5ReplyNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.As(err, &dnsErr):
+		return socks5ReplyHostUnreachable
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return socks5ReplyTTLExpired
+	default:
+		return socks5ReplyGeneralFailure
+	}
+}
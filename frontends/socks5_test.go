@@ -0,0 +1,168 @@
+package frontends
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestReadSOCKS5Greeting(t *testing.T) {
+	methods, err := readSOCKS5Greeting(bytes.NewReader([]byte{0x05, 0x02, 0x00, 0x02}))
+	if err != nil {
+		t.Fatalf("readSOCKS5Greeting() failed: %v", err)
+	}
+
+	if !bytes.Equal(methods, []byte{socks5MethodNoAuth, socks5MethodUserPass}) {
+		t.Errorf("readSOCKS5Greeting() = %v, want [0 2]", methods)
+	}
+
+	if _, err = readSOCKS5Greeting(bytes.NewReader([]byte{0x04, 0x01, 0x00})); err == nil {
+		t.Error("expected readSOCKS5Greeting() to fail for socks4")
+	}
+
+	if _, err = readSOCKS5Greeting(bytes.NewReader([]byte{0x05, 0x02, 0x00})); err == nil {
+		t.Error("expected readSOCKS5Greeting() to fail for truncated methods")
+	}
+}
+
+func TestReadSOCKS5Credentials(t *testing.T) {
+	message := []byte{0x01, 0x05}
+	message = append(message, "alice"...)
+	message = append(message, 0x06)
+	message = append(message, "secret"...)
+
+	username, password, err := readSOCKS5Credentials(bytes.NewReader(message))
+	if err != nil {
+		t.Fatalf("readSOCKS5Credentials() failed: %v", err)
+	}
+
+	if username != "alice" || password != "secret" {
+		t.Errorf("readSOCKS5Credentials() = %q, %q, want %q, %q", username, password, "alice", "secret")
+	}
+
+	if _, _, err = readSOCKS5Credentials(bytes.NewReader([]byte{0x02, 0x00, 0x00})); err == nil {
+		t.Error("expected readSOCKS5Credentials() to fail for unknown version")
+	}
+}
+
+func TestReadSOCKS5Request(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+		want    string
+	}{
+		{
+			name:    "ipv4",
+			message: []byte{0x05, 0x01, 0x00, 0x01, 192, 168, 0, 10, 0x00, 0x16},
+			want:    "192.168.0.10:22",
+		},
+		{
+			name:    "ipv6",
+			message: append(append([]byte{0x05, 0x01, 0x00, 0x04}, net.ParseIP("fd00::1")...), 0x01, 0xBB),
+			want:    "[fd00::1]:443",
+		},
+		{
+			name:    "domain",
+			message: append(append([]byte{0x05, 0x01, 0x00, 0x03, 0x0F}, "nas.example.com"...), 0x00, 0x50),
+			want:    "nas.example.com:80",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := readSOCKS5Request(bytes.NewReader(tt.message))
+			if err != nil {
+				t.Fatalf("readSOCKS5Request() failed: %v", err)
+			}
+
+			if request.command != socks5CommandConnect {
+				t.Errorf("command = %d, want %d", request.command, socks5CommandConnect)
+			}
+			if got := request.address(); got != tt.want {
+				t.Errorf("address() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSOCKS5Request_UnknownAddressType(t *testing.T) {
+	_, err := readSOCKS5Request(bytes.NewReader([]byte{0x05, 0x01, 0x00, 0x05, 0x00, 0x00}))
+	if !errors.Is(err, errSOCKS5AddressTypeNotSupported) {
+		t.Errorf("expected errSOCKS5AddressTypeNotSupported, got: %v", err)
+	}
+}
+
+func TestWriteSOCKS5Reply(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    byte
+		bindAddr net.Addr
+		want     []byte
+	}{
+		{
+			name:     "without address",
+			reply:    socks5ReplyNotAllowed,
+			bindAddr: nil,
+			want:     []byte{0x05, 0x02, 0x00, 0x01, 0, 0, 0, 0, 0x00, 0x00},
+		},
+		{
+			name:     "ipv4 address",
+			reply:    socks5ReplySucceeded,
+			bindAddr: &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 40000},
+			want:     []byte{0x05, 0x00, 0x00, 0x01, 192, 168, 0, 1, 0x9C, 0x40},
+		},
+		{
+			name:     "ipv6 address",
+			reply:    socks5ReplySucceeded,
+			bindAddr: &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 443},
+			want:     append(append([]byte{0x05, 0x00, 0x00, 0x04}, net.ParseIP("fd00::1")...), 0x01, 0xBB),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := writeSOCKS5Reply(&buffer, tt.reply, tt.bindAddr); err != nil {
+				t.Fatalf("writeSOCKS5Reply() failed: %v", err)
+			}
+
+			if !bytes.Equal(buffer.Bytes(), tt.want) {
+				t.Errorf("writeSOCKS5Reply() wrote %v, want %v", buffer.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSOCKS5ReplyForDialError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want byte
+	}{
+		{name: "connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: socks5ReplyConnectionRefused},
+		{name: "network unreachable", err: fmt.Errorf("dial: %w", syscall.ENETUNREACH), want: socks5ReplyNetworkUnreachable},
+		{name: "host unreachable", err: fmt.Errorf("dial: %w", syscall.EHOSTUNREACH), want: socks5ReplyHostUnreachable},
+		{name: "unknown host", err: &net.DNSError{Err: "no such host", Name: "nas.invalid", IsNotFound: true}, want: socks5ReplyHostUnreachable},
+		{name: "dns timeout", err: &net.DNSError{Err: "timeout", Name: "nas.invalid", IsTimeout: true}, want: socks5ReplyHostUnreachable},
+		{name: "dial timeout", err: &net.OpError{Op: "dial", Err: timeoutError{}}, want: socks5ReplyTTLExpired},
+		{name: "other", err: errors.New("something"), want: socks5ReplyGeneralFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := socks5ReplyForDialError(tt.err); got != tt.want {
+				t.Errorf("socks5ReplyForDialError() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,276 @@
+package frontends
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const socks5HandshakeTimeout = 10 * time.Second
+
+type socks5Frontend struct {
+	*tcpListeners
+
+	rules          []destinationRule
+	unmatched      unmatchedPolicy
+	users          proxyUsers
+	connectTimeout time.Duration
+	dialer         dialer
+	directPipes    *directPipes
+}
+
+// newSOCKS5Frontend creates a new instance of an socks5Frontend, preparing it with all default dependencies.
+func newSOCKS5Frontend(conf config.SOCKS5FrontendConfig, backendList *backends.BackendList) (*socks5Frontend, error) {
+	parsedListenAddr, err := net.ResolveTCPAddr("tcp", conf.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+	}
+
+	rules, err := newDestinationRules(conf.Rules, backendList)
+	if err != nil {
+		return nil, fmt.Errorf("could not create rules of frontend '%s': %w", conf.Name, err)
+	}
+
+	unmatched, err := parseUnmatchedPolicy(conf.Unmatched)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config of frontend '%s': %w", conf.Name, err)
+	}
+
+	users, err := newProxyUsers(conf.Users)
+	if err != nil {
+		return nil, fmt.Errorf("invalid users of frontend '%s': %w", conf.Name, err)
+	}
+
+	connectTimeout := conf.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = proxyDefaultConnectTimeout
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options of frontend '%s': %w", conf.Name, err)
+	}
+
+	return &socks5Frontend{
+		tcpListeners:   newTCPListeners(conf.Name, "socks5frontend", []*net.TCPAddr{parsedListenAddr}, limiter, socketOptions),
+		rules:          rules,
+		unmatched:      unmatched,
+		users:          users,
+		connectTimeout: connectTimeout,
+		dialer:         defaultDialer{socketOptions: socketOptions},
+		directPipes:    newDirectPipes(),
+	}, nil
+}
+
+// Listen creates a TCP listener, starts listening and accepting connections. Every accepted connection gets
+// its SOCKS5 handshake done in its own go-routine, and is handed to the backend matching the requested destination.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen is resilient in that it does not stop accepting connections just because an error happens.
+func (fe *socks5Frontend) Listen() error {
+	return fe.listen(func(connection net.Conn) {
+		go fe.handle(connection)
+	}, fe.acceptGates())
+}
+
+// Close closes all listening instances if existing, and all connections dialed directly.
+func (fe *socks5Frontend) Close() error {
+	fe.directPipes.closeAll()
+
+	return fe.tcpListeners.Close()
+}
+
+// handle does the SOCKS5 handshake for given connection, and hands the connection to the backend of the first
+// rule matching the requested destination. Destinations without matching rule get dialed directly or rejected,
+// depending on the configured unmatched policy.
+func (fe *socks5Frontend) handle(connection net.Conn) {
+	request, err := fe.negotiate(connection)
+	if err != nil {
+		slog.Debug(
+			"socks5frontend handshake failed",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+		closeUnroutedConnection(connection)
+
+		return
+	}
+
+	if rule, ok := matchDestinationRules(fe.rules, request.host, request.port); ok {
+		slog.Debug(
+			"socks5frontend routed connection",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.String("destination", request.address()),
+			slog.String("backend", rule.targetBackend.GetName()),
+		)
+
+		rule.targetBackend.Handle(newEstablishingConn(
+			connection,
+			fe.connectTimeout,
+			func() error {
+				return writeSOCKS5Reply(connection, socks5ReplySucceeded, nil)
+			},
+			func(timedOut bool) {
+				reply := byte(socks5ReplyHostUnreachable)
+				if timedOut {
+					reply = socks5ReplyTTLExpired
+				}
+
+				if err := writeSOCKS5Reply(connection, reply, nil); err != nil {
+					slog.Debug("could not write socks5 failure reply", slog.Any("error", err))
+				}
+			},
+		))
+
+		return
+	}
+
+	if fe.unmatched == unmatchedDirect {
+		fe.dialDirect(connection, request)
+		return
+	}
+
+	slog.Debug(
+		"socks5frontend rejected destination without rule",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("destination", request.address()),
+	)
+	rejectSOCKS5Request(connection, socks5ReplyNotAllowed)
+}
+
+// negotiate does the SOCKS5 handshake for given connection including authentication, and returns the request
+// of the client. If the handshake fails, the client gets the matching reply, if any.
+func (fe *socks5Frontend) negotiate(connection net.Conn) (*socks5Request, error) {
+	if err := connection.SetDeadline(time.Now().Add(socks5HandshakeTimeout)); err != nil {
+		return nil, fmt.Errorf("could not set deadline: %w", err)
+	}
+	defer func() {
+		if err := connection.SetDeadline(time.Time{}); err != nil {
+			slog.Debug("could not reset deadline", slog.Any("error", err))
+		}
+	}()
+
+	methods, err := readSOCKS5Greeting(connection)
+	if err != nil {
+		return nil, err
+	}
+
+	method := byte(socks5MethodNoAuth)
+	if fe.users.authRequired() {
+		method = socks5MethodUserPass
+	}
+
+	if !slices.Contains(methods, method) {
+		if _, err = connection.Write([]byte{socks5Version, socks5MethodNoAcceptable}); err != nil {
+			return nil, fmt.Errorf("could not write socks5 method selection: %w", err)
+		}
+
+		return nil, errors.New("client does not offer the required authentication method")
+	}
+
+	if _, err = connection.Write([]byte{socks5Version, method}); err != nil {
+		return nil, fmt.Errorf("could not write socks5 method selection: %w", err)
+	}
+
+	if method == socks5MethodUserPass {
+		if err = fe.authenticate(connection); err != nil {
+			return nil, err
+		}
+	}
+
+	request, err := readSOCKS5Request(connection)
+	if errors.Is(err, errSOCKS5AddressTypeNotSupported) {
+		return nil, errors.Join(err, writeSOCKS5Reply(connection, socks5ReplyAddressTypeNotSupported, nil))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if request.command != socks5CommandConnect {
+		return nil, errors.Join(
+			fmt.Errorf("unsupported socks5 command %d", request.command),
+			writeSOCKS5Reply(connection, socks5ReplyCommandNotSupported, nil),
+		)
+	}
+
+	return request, nil
+}
+
+// authenticate reads the credentials sent by the client and checks them against the configured users.
+func (fe *socks5Frontend) authenticate(connection net.Conn) error {
+	username, password, err := readSOCKS5Credentials(connection)
+	if err != nil {
+		return err
+	}
+
+	if !fe.users.check(username, password) {
+		if _, err = connection.Write([]byte{socks5AuthVersion, socks5AuthFailed}); err != nil {
+			return fmt.Errorf("could not write socks5 authentication status: %w", err)
+		}
+
+		return fmt.Errorf("invalid credentials for user '%s'", username)
+	}
+
+	if _, err = connection.Write([]byte{socks5AuthVersion, socks5AuthSucceeded}); err != nil {
+		return fmt.Errorf("could not write socks5 authentication status: %w", err)
+	}
+
+	return nil
+}
+
+// dialDirect dials the requested destination without any backend and pipes given connection to it.
+func (fe *socks5Frontend) dialDirect(connection net.Conn, request *socks5Request) {
+	connectionToTarget, err := fe.dialer.DialTimeout("tcp", request.address(), proxyDirectDialTimeout)
+	if err != nil {
+		slog.Debug(
+			"socks5frontend could not dial destination directly",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.String("destination", request.address()),
+			slog.Any("error", err),
+		)
+		rejectSOCKS5Request(connection, socks5ReplyForDialError(err))
+
+		return
+	}
+
+	if err = writeSOCKS5Reply(connection, socks5ReplySucceeded, connectionToTarget.LocalAddr()); err != nil {
+		slog.Debug("could not write socks5 reply", slog.Any("error", err))
+		closeUnroutedConnection(connection)
+		closeUnroutedConnection(connectionToTarget)
+
+		return
+	}
+
+	slog.Debug(
+		"socks5frontend dialed destination directly",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("destination", request.address()),
+	)
+
+	fe.directPipes.pipe(connection, connectionToTarget)
+}
+
+// rejectSOCKS5Request answers the request of given connection with given reply, and closes the connection.
+func rejectSOCKS5Request(connection net.Conn, reply byte) {
+	if err := writeSOCKS5Reply(connection, reply, nil); err != nil {
+		slog.Debug("could not write socks5 reply", slog.Any("error", err))
+	}
+
+	closeUnroutedConnection(connection)
+}
@@ -0,0 +1,323 @@
+package frontends
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// dialTestSOCKS5 connects to given SOCKS5 frontend, optionally authenticates with given credentials, and requests
+// a connection to given domain and port. It returns the connection and the reply code of the request.
+func dialTestSOCKS5(t *testing.T, addr string, credentials []string, command byte, domain string, port byte) (net.Conn, byte) {
+	t.Helper()
+
+	clientConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	clientConn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	method := byte(socks5MethodNoAuth)
+	if credentials != nil {
+		method = socks5MethodUserPass
+	}
+
+	clientConn.Write([]byte{socks5Version, 0x01, method})
+
+	selection := make([]byte, 2)
+	if _, err = io.ReadFull(clientConn, selection); err != nil {
+		t.Fatalf("could not read method selection: %v", err)
+	}
+	if selection[1] != method {
+		return clientConn, selection[1]
+	}
+
+	if credentials != nil {
+		message := []byte{socks5AuthVersion, byte(len(credentials[0]))}
+		message = append(message, credentials[0]...)
+		message = append(message, byte(len(credentials[1])))
+		message = append(message, credentials[1]...)
+		clientConn.Write(message)
+
+		status := make([]byte, 2)
+		if _, err = io.ReadFull(clientConn, status); err != nil {
+			t.Fatalf("could not read authentication status: %v", err)
+		}
+		if status[1] != socks5AuthSucceeded {
+			return clientConn, status[1]
+		}
+	}
+
+	request := []byte{socks5Version, command, 0x00, socks5AddrTypeDomain, byte(len(domain))}
+	request = append(request, domain...)
+	request = append(request, 0x00, port)
+	clientConn.Write(request)
+
+	reply := make([]byte, 10)
+	if _, err = io.ReadFull(clientConn, reply); err != nil {
+		t.Fatalf("could not read reply: %v", err)
+	}
+
+	return clientConn, reply[1]
+}
+
+func TestSOCKS5Frontend_GetName(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newSOCKS5Frontend(config.SOCKS5FrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:1080",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newSOCKS5Frontend() failed: %v", err)
+	}
+
+	if got := frontend.GetName(); got != "test-frontend" {
+		t.Errorf("GetName() = %q, want %q", got, "test-frontend")
+	}
+	if frontend.connectTimeout != proxyDefaultConnectTimeout {
+		t.Errorf("connectTimeout = %v, want default %v", frontend.connectTimeout, proxyDefaultConnectTimeout)
+	}
+}
+
+func TestSOCKS5Frontend_NewSOCKS5Frontend_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	tests := []struct {
+		name string
+		conf config.SOCKS5FrontendConfig
+	}{
+		{
+			name: "invalid listenAddr",
+			conf: config.SOCKS5FrontendConfig{Name: "test-frontend", ListenAddr: "invalid"},
+		},
+		{
+			name: "unknown rule target",
+			conf: config.SOCKS5FrontendConfig{
+				Name:       "test-frontend",
+				ListenAddr: "127.0.0.1:1080",
+				Rules:      []config.DestinationRuleConfig{{Destination: "nas.example.com", Target: "unknown"}},
+			},
+		},
+		{
+			name: "unknown unmatched policy",
+			conf: config.SOCKS5FrontendConfig{Name: "test-frontend", ListenAddr: "127.0.0.1:1080", Unmatched: "allow"},
+		},
+		{
+			name: "invalid user",
+			conf: config.SOCKS5FrontendConfig{
+				Name:       "test-frontend",
+				ListenAddr: "127.0.0.1:1080",
+				Users:      []config.ProxyUserConfig{{Username: ""}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSOCKS5Frontend(tt.conf, backendList); err == nil {
+				t.Error("expected newSOCKS5Frontend() to fail")
+			}
+		})
+	}
+}
+
+func TestSOCKS5Frontend_Listen_RoutesByDestination(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newSOCKS5Frontend(config.SOCKS5FrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:1080",
+		Rules:      []config.DestinationRuleConfig{{Destination: "nas.example.com", Target: "nas"}},
+		Users:      []config.ProxyUserConfig{{Username: "alice", Password: "secret"}},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newSOCKS5Frontend() failed: %v", err)
+	}
+
+	frontend.rules[0].targetBackend = newAnsweringBackend("nas")
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, reply := dialTestSOCKS5(t, listenAddr, []string{"alice", "secret"}, socks5CommandConnect, "nas.example.com", 22)
+	defer clientConn.Close()
+
+	if reply != socks5ReplySucceeded {
+		t.Fatalf("got reply %d, want %d", reply, socks5ReplySucceeded)
+	}
+
+	clientConn.Write([]byte("hello"))
+	clientConn.(*net.TCPConn).CloseWrite()
+
+	answer, err := io.ReadAll(clientConn)
+	if err != nil {
+		t.Fatalf("could not read answer: %v", err)
+	}
+	if string(answer) != "nas:hello" {
+		t.Errorf("got answer %q, want %q", string(answer), "nas:hello")
+	}
+}
+
+func TestSOCKS5Frontend_Listen_ReportsBackendFailure(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newSOCKS5Frontend(config.SOCKS5FrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:1080",
+		Rules:      []config.DestinationRuleConfig{{Destination: "nas.example.com", Target: "nas"}},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newSOCKS5Frontend() failed: %v", err)
+	}
+
+	// The backends of createTestBackendList echo, so use one that fails to reach its target instead
+	frontend.rules[0].targetBackend = &mockBackend{name: "nas"}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, reply := dialTestSOCKS5(t, listenAddr, nil, socks5CommandConnect, "nas.example.com", 22)
+	defer clientConn.Close()
+
+	if reply != socks5ReplyHostUnreachable {
+		t.Errorf("got reply %d, want %d", reply, socks5ReplyHostUnreachable)
+	}
+}
+
+func TestSOCKS5Frontend_Listen_RejectsRequests(t *testing.T) {
+	backendList := createTestBackendList("nas")
+
+	frontend, err := newSOCKS5Frontend(config.SOCKS5FrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:1080",
+		Rules:      []config.DestinationRuleConfig{{Destination: "nas.example.com", Target: "nas"}},
+		Users:      []config.ProxyUserConfig{{Username: "alice", Password: "secret"}},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newSOCKS5Frontend() failed: %v", err)
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	tests := []struct {
+		name        string
+		credentials []string
+		command     byte
+		domain      string
+		want        byte
+	}{
+		{
+			name:        "no authentication offered",
+			credentials: nil,
+			command:     socks5CommandConnect,
+			domain:      "nas.example.com",
+			want:        socks5MethodNoAcceptable,
+		},
+		{
+			name:        "wrong password",
+			credentials: []string{"alice", "wrong"},
+			command:     socks5CommandConnect,
+			domain:      "nas.example.com",
+			want:        socks5AuthFailed,
+		},
+		{
+			name:        "destination without rule",
+			credentials: []string{"alice", "secret"},
+			command:     socks5CommandConnect,
+			domain:      "other.example.com",
+			want:        socks5ReplyNotAllowed,
+		},
+		{
+			name:        "bind command",
+			credentials: []string{"alice", "secret"},
+			command:     0x02,
+			domain:      "nas.example.com",
+			want:        socks5ReplyCommandNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, reply := dialTestSOCKS5(t, listenAddr, tt.credentials, tt.command, tt.domain, 22)
+			defer clientConn.Close()
+
+			if reply != tt.want {
+				t.Errorf("got reply %d, want %d", reply, tt.want)
+			}
+
+			// The frontend has to close the connection afterwards
+			if _, err := clientConn.Read(make([]byte, 1)); err != io.EOF {
+				t.Errorf("expected io.EOF, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestSOCKS5Frontend_Listen_DialsUnmatchedDirectly(t *testing.T) {
+	backendList := createTestBackendList()
+
+	frontend, err := newSOCKS5Frontend(config.SOCKS5FrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:1080",
+		Unmatched:  "direct",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newSOCKS5Frontend() failed: %v", err)
+	}
+
+	dialedAddress := make(chan string, 1)
+	frontend.dialer = &mockDialer{
+		mockDialTimeout: func(_, address string, _ time.Duration) (net.Conn, error) {
+			dialedAddress <- address
+
+			clientSide, serverSide := net.Pipe()
+			go func() {
+				defer serverSide.Close()
+				io.Copy(serverSide, serverSide)
+			}()
+
+			return clientSide, nil
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, reply := dialTestSOCKS5(t, listenAddr, nil, socks5CommandConnect, "files.example.org", 80)
+	defer clientConn.Close()
+
+	if reply != socks5ReplySucceeded {
+		t.Fatalf("got reply %d, want %d", reply, socks5ReplySucceeded)
+	}
+	if got := <-dialedAddress; got != "files.example.org:80" {
+		t.Errorf("dialed %q, want %q", got, "files.example.org:80")
+	}
+
+	clientConn.Write([]byte("hello"))
+
+	answer := make([]byte, len("hello"))
+	if _, err = io.ReadFull(clientConn, answer); err != nil {
+		t.Fatalf("could not read answer: %v", err)
+	}
+	if !bytes.Equal(answer, []byte("hello")) {
+		t.Errorf("got answer %q, want %q", string(answer), "hello")
+	}
+}
@@ -0,0 +1,166 @@
+package frontends
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+)
+
+// stdioAddr is the address of both ends of a stdioConn.
+type stdioAddr struct{}
+
+// Network returns the name of the network of the stdioAddr.
+func (stdioAddr) Network() string {
+	return "stdio"
+}
+
+// String returns the string form of the stdioAddr.
+func (stdioAddr) String() string {
+	return "stdio"
+}
+
+// stdioConn is a net.Conn reading from stdin and writing to stdout, like for pluggo being used as ssh ProxyCommand.
+type stdioConn struct {
+	stdin           *os.File
+	stdout          *os.File
+	closeOnce       sync.Once
+	closeStdoutOnce sync.Once
+}
+
+// Read reads from stdin.
+func (c *stdioConn) Read(b []byte) (int, error) {
+	return c.stdin.Read(b)
+}
+
+// Write writes to stdout.
+func (c *stdioConn) Write(b []byte) (int, error) {
+	return c.stdout.Write(b)
+}
+
+// Close closes stdin and stdout. Closing a stdioConn again does nothing, as backends like the echo backend close
+// the same connection twice.
+func (c *stdioConn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		err = errors.Join(c.stdin.Close(), c.closeStdout())
+	})
+
+	return err
+}
+
+// CloseWrite closes stdout, so the other side sees the end of the stream, while stdin can still be read.
+func (c *stdioConn) CloseWrite() error {
+	return c.closeStdout()
+}
+
+// closeStdout closes stdout, unless it already got closed by CloseWrite or Close, as closing a file twice fails.
+func (c *stdioConn) closeStdout() error {
+	var err error
+
+	c.closeStdoutOnce.Do(func() {
+		err = c.stdout.Close()
+	})
+
+	return err
+}
+
+// LocalAddr returns the stdioAddr.
+func (c *stdioConn) LocalAddr() net.Addr {
+	return stdioAddr{}
+}
+
+// RemoteAddr returns the stdioAddr.
+func (c *stdioConn) RemoteAddr() net.Addr {
+	return stdioAddr{}
+}
+
+// SetDeadline sets the read and write deadline, if stdin and stdout support deadlines, like pipes do.
+func (c *stdioConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.SetReadDeadline(t), c.SetWriteDeadline(t))
+}
+
+// SetReadDeadline sets the deadline of stdin.
+func (c *stdioConn) SetReadDeadline(t time.Time) error {
+	return c.stdin.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of stdout.
+func (c *stdioConn) SetWriteDeadline(t time.Time) error {
+	return c.stdout.SetWriteDeadline(t)
+}
+
+// closeNotifyConn is a connection, that closes its closed channel when it gets closed.
+type closeNotifyConn struct {
+	net.Conn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Close closes the underlying connection and notifies everyone waiting for it.
+func (c *closeNotifyConn) Close() error {
+	err := c.Conn.Close()
+
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	return err
+}
+
+// NetConn returns the underlying connection.
+func (c *closeNotifyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// ServeStdio hands a single connection made of given stdin and stdout to given backend, like inetd does. If stdin
+// is a socket, like for systemd units with Accept=yes, the socket is used directly, so the backend sees the real
+// address of the client.
+// ServeStdio blocks the current thread until the backend closed the connection, which happens when either side
+// closes it.
+func ServeStdio(targetBackend backends.Backend, stdin *os.File, stdout *os.File) {
+	var connection net.Conn = &stdioConn{
+		stdin:           stdin,
+		stdout:          stdout,
+		closeOnce:       sync.Once{},
+		closeStdoutOnce: sync.Once{},
+	}
+
+	if socketConnection, err := net.FileConn(stdin); err == nil {
+		slog.Debug("stdin is a socket, using it directly", slog.String("remoteAddr", socketConnection.RemoteAddr().String()))
+
+		// The socket got duplicated, so the original file descriptors aren't needed anymore
+		if err = connection.Close(); err != nil {
+			slog.Debug("could not close stdin and stdout", slog.Any("error", err))
+		}
+
+		connection = socketConnection
+	}
+
+	serveConn(targetBackend, connection)
+}
+
+// serveConn hands given connection to given backend, and blocks until the backend closed it.
+func serveConn(targetBackend backends.Backend, connection net.Conn) {
+	notifyingConnection := &closeNotifyConn{
+		Conn:      connection,
+		closeOnce: sync.Once{},
+		closed:    make(chan struct{}),
+	}
+
+	slog.Debug(
+		"serving single connection",
+		slog.String("target", targetBackend.GetName()),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+	)
+
+	targetBackend.Handle(notifyingConnection)
+
+	<-notifyingConnection.closed
+}
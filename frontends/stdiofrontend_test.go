@@ -0,0 +1,140 @@
+package frontends
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestServeStdio_Pipes(t *testing.T) {
+	backendList := createTestBackendList("echo-backend")
+	echoBackend, _ := backendList.Get("echo-backend")
+
+	stdin, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("could not create stdin pipe: %v", err)
+	}
+
+	stdoutReader, stdout, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("could not create stdout pipe: %v", err)
+	}
+	defer stdoutReader.Close()
+
+	serveDone := make(chan struct{})
+	go func() {
+		ServeStdio(echoBackend, stdin, stdout)
+		close(serveDone)
+	}()
+
+	if _, err = stdinWriter.Write([]byte("hello")); err != nil {
+		t.Fatalf("could not write to stdin: %v", err)
+	}
+
+	stdoutReader.SetReadDeadline(time.Now().Add(time.Second))
+
+	answer := make([]byte, 5)
+	if _, err = io.ReadFull(stdoutReader, answer); err != nil {
+		t.Fatalf("could not read from stdout: %v", err)
+	}
+
+	if string(answer) != "hello" {
+		t.Errorf("got %q, want echoed %q", answer, "hello")
+	}
+
+	// Closing stdin ends the connection, like ssh does when it exits
+	stdinWriter.Close()
+
+	select {
+	case <-serveDone:
+	case <-time.After(time.Second):
+		t.Fatal("ServeStdio() didn't return after stdin got closed")
+	}
+}
+
+func TestServeStdio_Socket(t *testing.T) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer client.Close()
+
+	accepted, err := listener.AcceptTCP()
+	if err != nil {
+		t.Fatalf("could not accept: %v", err)
+	}
+
+	// Like inetd, pass the same socket as stdin and stdout
+	socketFile, err := accepted.File()
+	accepted.Close()
+	if err != nil {
+		t.Fatalf("could not get socket file: %v", err)
+	}
+
+	handledRemoteAddr := make(chan net.Addr, 1)
+	targetBackend := &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handledRemoteAddr <- conn.RemoteAddr()
+			conn.Close()
+		},
+	}
+
+	serveDone := make(chan struct{})
+	go func() {
+		ServeStdio(targetBackend, socketFile, socketFile)
+		close(serveDone)
+	}()
+
+	select {
+	case remoteAddr := <-handledRemoteAddr:
+		if remoteAddr.String() != client.LocalAddr().String() {
+			t.Errorf("RemoteAddr() = %v, want address of client %v", remoteAddr, client.LocalAddr())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection didn't get handled")
+	}
+
+	select {
+	case <-serveDone:
+	case <-time.After(time.Second):
+		t.Fatal("ServeStdio() didn't return after the backend closed the connection")
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = client.Read(make([]byte, 1)); err == nil {
+		t.Error("socket didn't get closed")
+	}
+}
+
+func TestStdioConn_CloseAfterCloseWrite(t *testing.T) {
+	stdin, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("could not create stdin pipe: %v", err)
+	}
+	defer stdinWriter.Close()
+
+	stdoutReader, stdout, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("could not create stdout pipe: %v", err)
+	}
+	defer stdoutReader.Close()
+
+	connection := &stdioConn{stdin: stdin, stdout: stdout}
+
+	if err = connection.CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite() failed: %v", err)
+	}
+
+	// stdout already got closed by CloseWrite, which must not make Close fail
+	if err = connection.Close(); err != nil {
+		t.Errorf("Close() after CloseWrite() failed: %v", err)
+	}
+}
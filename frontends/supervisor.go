@@ -0,0 +1,155 @@
+package frontends
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	defaultBindRetryInterval    = time.Second
+	defaultBindRetryMaxInterval = time.Minute
+)
+
+// listenState is the state of a supervised frontend.
+type listenState int
+
+const (
+	listenStateBinding listenState = iota
+	listenStateListening
+	listenStateFailed
+	listenStateStopped
+)
+
+// String returns the name of the state, as used in logs.
+func (s listenState) String() string {
+	switch s {
+	case listenStateBinding:
+		return "binding"
+	case listenStateListening:
+		return "listening"
+	case listenStateFailed:
+		return "failed"
+	case listenStateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// listenNotifier is implemented by frontends, that can tell when they started listening.
+type listenNotifier interface {
+	setOnListening(callback func())
+}
+
+// listenSupervisor keeps a frontend listening. If the frontend fails to listen, for example because its address
+// isn't available yet, listening gets retried with an exponential backoff, unless bind failures are configured
+// to be fatal.
+type listenSupervisor struct {
+	frontend Frontend
+	conf     config.ListenConfig
+	mutex    sync.Mutex
+	state    listenState
+	stopped  chan struct{}
+	stopOnce sync.Once
+	after    func(d time.Duration) <-chan time.Time
+}
+
+// newListenSupervisor creates a new listenSupervisor for given frontend. The retry intervals default to sane
+// values if not set.
+func newListenSupervisor(frontend Frontend, conf config.ListenConfig) *listenSupervisor {
+	if conf.BindRetryInterval <= 0 {
+		conf.BindRetryInterval = defaultBindRetryInterval
+	}
+
+	if conf.BindRetryMaxInterval < conf.BindRetryInterval {
+		conf.BindRetryMaxInterval = max(defaultBindRetryMaxInterval, conf.BindRetryInterval)
+	}
+
+	ls := &listenSupervisor{
+		frontend: frontend,
+		conf:     conf,
+		mutex:    sync.Mutex{},
+		state:    listenStateBinding,
+		stopped:  make(chan struct{}),
+		stopOnce: sync.Once{},
+		after:    time.After,
+	}
+
+	if notifier, ok := frontend.(listenNotifier); ok {
+		notifier.setOnListening(func() {
+			ls.setState(listenStateListening, nil)
+		})
+	}
+
+	return ls
+}
+
+// run lets the frontend listen until it gets closed, retrying failed attempts. An error is only returned if bind
+// failures are fatal.
+// run blocks the current thread until the frontend got closed, or a fatal error happened.
+func (ls *listenSupervisor) run() error {
+	retryInterval := ls.conf.BindRetryInterval
+
+	for {
+		ls.setState(listenStateBinding, nil)
+
+		err := ls.frontend.Listen()
+		if err == nil {
+			ls.setState(listenStateStopped, nil)
+			return nil
+		}
+
+		ls.setState(listenStateFailed, err)
+
+		if ls.conf.BindFailureFatal {
+			return fmt.Errorf("frontend '%s' failed to listen: %w", ls.frontend.GetName(), err)
+		}
+
+		slog.Info("retrying to listen", slog.String("name", ls.frontend.GetName()), slog.Duration("retryInterval", retryInterval))
+
+		select {
+		case <-ls.stopped:
+			ls.setState(listenStateStopped, nil)
+			return nil
+		case <-ls.after(retryInterval):
+		}
+
+		retryInterval = min(retryInterval*2, ls.conf.BindRetryMaxInterval)
+	}
+}
+
+// stop stops retrying to listen. The frontend itself has to be closed separately.
+func (ls *listenSupervisor) stop() {
+	ls.stopOnce.Do(func() {
+		close(ls.stopped)
+	})
+}
+
+// getState returns the current state of the frontend.
+func (ls *listenSupervisor) getState() listenState {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	return ls.state
+}
+
+// setState sets the state of the frontend, and logs the change.
+func (ls *listenSupervisor) setState(state listenState, err error) {
+	ls.mutex.Lock()
+	changed := ls.state != state
+	ls.state = state
+	ls.mutex.Unlock()
+
+	switch {
+	case state == listenStateFailed:
+		slog.Warn("frontend failed to listen", slog.String("name", ls.frontend.GetName()), slog.Any("error", err))
+	case state == listenStateListening && changed:
+		slog.Info("frontend changed state", slog.String("name", ls.frontend.GetName()), slog.String("state", state.String()))
+	case changed:
+		slog.Debug("frontend changed state", slog.String("name", ls.frontend.GetName()), slog.String("state", state.String()))
+	}
+}
@@ -0,0 +1,185 @@
+package frontends
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// mockFrontend implements the Frontend and listenNotifier interfaces.
+type mockFrontend struct {
+	mockListen  func() error
+	onListening func()
+}
+
+func (m *mockFrontend) GetName() string {
+	return "test-frontend"
+}
+
+func (m *mockFrontend) Listen() error {
+	return m.mockListen()
+}
+
+func (m *mockFrontend) Close() error {
+	return nil
+}
+
+func (m *mockFrontend) setOnListening(callback func()) {
+	m.onListening = callback
+}
+
+func TestListenSupervisor_Run_RetriesWithBackoff(t *testing.T) {
+	listenCount := 0
+	closed := make(chan struct{})
+	frontend := &mockFrontend{}
+	frontend.mockListen = func() error {
+		listenCount++
+		if listenCount <= 3 {
+			return errors.New("cannot assign requested address")
+		}
+
+		frontend.onListening()
+		<-closed
+
+		return nil
+	}
+
+	supervisor := newListenSupervisor(frontend, config.ListenConfig{
+		BindRetryInterval:    time.Second,
+		BindRetryMaxInterval: 3 * time.Second,
+	})
+
+	var retryIntervals []time.Duration
+	supervisor.after = func(d time.Duration) <-chan time.Time {
+		retryIntervals = append(retryIntervals, d)
+
+		ready := make(chan time.Time, 1)
+		ready <- time.Now()
+
+		return ready
+	}
+
+	runDone := make(chan error, 1)
+	go func() {
+		runDone <- supervisor.run()
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for supervisor.getState() != listenStateListening && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if state := supervisor.getState(); state != listenStateListening {
+		t.Fatalf("state = %s, want listening", state)
+	}
+
+	close(closed)
+
+	if err := <-runDone; err != nil {
+		t.Errorf("run() returned error: %v", err)
+	}
+
+	if state := supervisor.getState(); state != listenStateStopped {
+		t.Errorf("state = %s, want stopped", state)
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	if !slices.Equal(retryIntervals, want) {
+		t.Errorf("retry intervals = %v, want %v", retryIntervals, want)
+	}
+}
+
+func TestListenSupervisor_Run_FatalBindFailure(t *testing.T) {
+	frontend := &mockFrontend{
+		mockListen: func() error {
+			return errors.New("address already in use")
+		},
+	}
+
+	supervisor := newListenSupervisor(frontend, config.ListenConfig{BindFailureFatal: true})
+
+	if err := supervisor.run(); err == nil {
+		t.Error("expected run() to fail for fatal bind failure")
+	}
+
+	if state := supervisor.getState(); state != listenStateFailed {
+		t.Errorf("state = %s, want failed", state)
+	}
+}
+
+func TestListenSupervisor_Stop_EndsRetrying(t *testing.T) {
+	frontend := &mockFrontend{
+		mockListen: func() error {
+			return errors.New("address already in use")
+		},
+	}
+
+	supervisor := newListenSupervisor(frontend, config.ListenConfig{BindRetryInterval: time.Hour})
+
+	runDone := make(chan error, 1)
+	go func() {
+		runDone <- supervisor.run()
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for supervisor.getState() != listenStateFailed && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	supervisor.stop()
+	supervisor.stop()
+
+	select {
+	case err := <-runDone:
+		if err != nil {
+			t.Errorf("run() returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run() did not return after stop()")
+	}
+
+	if state := supervisor.getState(); state != listenStateStopped {
+		t.Errorf("state = %s, want stopped", state)
+	}
+}
+
+func TestNewListenSupervisor_Defaults(t *testing.T) {
+	supervisor := newListenSupervisor(&mockFrontend{}, config.ListenConfig{})
+
+	if supervisor.conf.BindRetryInterval != defaultBindRetryInterval {
+		t.Errorf("BindRetryInterval = %v, want %v", supervisor.conf.BindRetryInterval, defaultBindRetryInterval)
+	}
+	if supervisor.conf.BindRetryMaxInterval != defaultBindRetryMaxInterval {
+		t.Errorf("BindRetryMaxInterval = %v, want %v", supervisor.conf.BindRetryMaxInterval, defaultBindRetryMaxInterval)
+	}
+}
+
+func TestFrontendList_States(t *testing.T) {
+	frontend := &mockFrontend{
+		mockListen: func() error {
+			return errors.New("address already in use")
+		},
+	}
+
+	frontendList := &FrontendList{list: map[string]Frontend{"test-frontend": frontend}}
+
+	if states := frontendList.States(); len(states) != 0 {
+		t.Errorf("States() before ListenAll() = %v, want none", states)
+	}
+
+	frontendList.listenConf = config.ListenConfig{BindRetryInterval: time.Hour}
+	frontendList.ListenAll()
+	defer frontendList.CloseAll()
+
+	deadline := time.Now().Add(time.Second)
+	for frontendList.States()["test-frontend"] != "failed" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if state := frontendList.States()["test-frontend"]; state != "failed" {
+		t.Errorf("States()[test-frontend] = %q, want failed", state)
+	}
+}
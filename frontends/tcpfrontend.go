@@ -1,29 +1,62 @@
 package frontends
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
 	"sync"
+	"time"
 
 	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
 	"github.com/sateffen/pluggo/config"
 )
 
+const proxyProtocolDefaultTimeout = 5 * time.Second
+
 type tcpFrontend struct {
-	name            string
-	targetBackend   backends.Backend
-	listenerMutex   sync.RWMutex
-	listenAddr      *net.TCPAddr
-	listener        tcpListener
-	listenerFactory tcpListenerFactory
+	*tcpListeners
+
+	targetBackend               backends.Backend
+	proxyProtocol               bool
+	proxyProtocolTimeout        time.Duration
+	proxyProtocolTrustedSources []netip.Prefix
+	keepDestinationPort         bool
 }
 
 // newTCPFrontend creates a new instance of an tcpFrontend, preparing it with all default dependencies.
 func newTCPFrontend(conf config.TCPFrontendConfig, backendList *backends.BackendList) (*tcpFrontend, error) {
-	parsedListenAddr, err := net.ResolveTCPAddr("tcp", conf.ListenAddr)
+	listenAddrs, err := expandListenAddrs(conf.ListenAddr, conf.ListenAddrs)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+		return nil, fmt.Errorf("invalid listen addresses of frontend '%s': %w", conf.Name, err)
+	}
+
+	parsedListenAddrs := make([]*net.TCPAddr, 0, len(listenAddrs))
+	for _, listenAddr := range listenAddrs {
+		parsedListenAddr, resolveErr := net.ResolveTCPAddr("tcp", listenAddr)
+		if resolveErr != nil {
+			return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", listenAddr, conf.Name, resolveErr)
+		}
+
+		parsedListenAddrs = append(parsedListenAddrs, parsedListenAddr)
+	}
+
+	proxyProtocolTrustedSources, err := parsePrefixes(conf.ProxyProtocolTrustedSources)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse proxyProtocolTrustedSources of frontend '%s': %w", conf.Name, err)
+	}
+
+	if conf.ProxyProtocol && len(proxyProtocolTrustedSources) == 0 {
+		return nil, fmt.Errorf("frontend '%s' requires proxyProtocolTrustedSources to use the proxy protocol", conf.Name)
+	}
+
+	proxyProtocolTimeout := conf.ProxyProtocolTimeout
+	if proxyProtocolTimeout <= 0 {
+		proxyProtocolTimeout = proxyProtocolDefaultTimeout
 	}
 
 	targetBackend, ok := backendList.Get(conf.Target)
@@ -31,74 +64,272 @@ func newTCPFrontend(conf config.TCPFrontendConfig, backendList *backends.Backend
 		return nil, fmt.Errorf("target backend '%s' for frontend '%s' does not exist", conf.Target, conf.Name)
 	}
 
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options of frontend '%s': %w", conf.Name, err)
+	}
+
 	return &tcpFrontend{
-		name:            conf.Name,
-		targetBackend:   targetBackend,
-		listenerMutex:   sync.RWMutex{},
-		listenAddr:      parsedListenAddr,
-		listener:        nil,
-		listenerFactory: defaultTCPListenerFactory{},
+		tcpListeners:                newTCPListeners(conf.Name, "tcpfrontend", parsedListenAddrs, limiter, socketOptions),
+		targetBackend:               targetBackend,
+		proxyProtocol:               conf.ProxyProtocol,
+		proxyProtocolTimeout:        proxyProtocolTimeout,
+		proxyProtocolTrustedSources: proxyProtocolTrustedSources,
+		keepDestinationPort:         conf.KeepDestinationPort,
 	}, nil
 }
 
-// GetName returns the name of the current wolForwarderBackend instance.
-func (fe *tcpFrontend) GetName() string {
-	return fe.name
-}
-
-// Listen creates a TCP listener, starts listening and accepting connections.
-// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen creates a TCP listener for every listen address, starts listening and accepting connections. If any
+// address can't be bound, none is listened on.
+// Listen blocks the current thread by starting an endless loop accepting new connections per listener.
 // Listen is resilient in that it does not stop accepting connections just because an error happens.
 func (fe *tcpFrontend) Listen() error {
-	fe.listenerMutex.Lock()
-	listener, err := fe.listenerFactory.ListenTCP("tcp", fe.listenAddr)
-	fe.listener = listener
-	fe.listenerMutex.Unlock()
+	return fe.listen(fe.handle, fe.acceptGates())
+}
 
-	if err != nil {
-		return fmt.Errorf("can't listen on '%s' for frontend '%s': %w", fe.listenAddr, fe.name, err)
+// acceptGates returns the gates connections have to pass right after getting accepted. With the PROXY protocol, the
+// address of the client is only known once the header got read, so the gates checking it run afterwards, see
+// clientGates.
+func (fe *tcpFrontend) acceptGates() []connectionGate {
+	if fe.proxyProtocol {
+		return []connectionGate{fe.limiter.frontendLimits(), frontendNameGate(fe.name)}
 	}
 
-	slog.Info("tcpfrontend started listening", slog.String("name", fe.name), slog.String("listenAddr", fe.listenAddr.String()))
+	return fe.tcpListeners.acceptGates()
+}
 
-	for {
-		//nolint:govet // shadowing "err" is fine
-		connection, err := listener.Accept()
-
-		if err != nil {
-			// Exit the loop if the listener doesn't exist anymore
-			fe.listenerMutex.RLock()
-			if fe.listener == nil {
-				fe.listenerMutex.RUnlock()
-				break
-			}
-			fe.listenerMutex.RUnlock()
+// clientGates returns the gates given connection has to pass once the PROXY protocol header got read, checking the
+// address of the client announced in it. Trusted sources never get banned, as connections without client address,
+// like health checks of the proxy, would get the proxy banned otherwise.
+func (fe *tcpFrontend) clientGates(connection net.Conn) []connectionGate {
+	if fe.isTrustedSource(connection.RemoteAddr()) {
+		return []connectionGate{fe.accessList, fe.limiter.sourceLimits()}
+	}
+
+	return []connectionGate{fe.accessList, fe.bans, fe.limiter.sourceLimits()}
+}
+
+// handle passes given connection to the target backend. If the PROXY protocol is enabled, the header gets read
+// in a separate go-routine first, so slow clients don't block accepting other connections.
+func (fe *tcpFrontend) handle(connection net.Conn) {
+	if !fe.proxyProtocol {
+		fe.handleConnection(connection)
+		return
+	}
+
+	go fe.handleProxyProtocol(connection)
+}
+
+// handleConnection passes given connection to the target backend. If the destination port should be kept,
+// the connection asks the backend to connect to the port it arrived on.
+func (fe *tcpFrontend) handleConnection(connection net.Conn) {
+	if fe.keepDestinationPort {
+		connection = &destinationPortConn{Conn: connection}
+	}
+
+	fe.targetBackend.Handle(connection)
+}
+
+// handleProxyProtocol reads the PROXY protocol header of given connection and passes the connection to the target
+// backend, with the addresses from the header as remote and local address. Connections from sources that are not
+// trusted get passed without reading a header, so they can't spoof their address, and get closed if they start
+// with a header anyway. If reading the header fails or takes longer than the configured timeout, the connection
+// gets closed.
+func (fe *tcpFrontend) handleProxyProtocol(connection net.Conn) {
+	if !fe.isTrustedSource(connection.RemoteAddr()) {
+		slog.Debug(
+			"connection from untrusted source, not reading proxy protocol header",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+		)
 
-			slog.Error("could not accept connection", slog.Any("error", err))
-			continue
+		fe.handleClientConnection(newUntrustedSourceConn(fe.name, connection))
+		return
+	}
+
+	proxiedConnection, err := fe.readProxiedConnection(connection)
+	if err != nil {
+		slog.Debug(
+			"tcpfrontend could not read proxy protocol header",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+
+		if err = connection.Close(); err != nil {
+			slog.Debug("could not properly close connection after invalid proxy protocol header", slog.Any("error", err))
 		}
 
-		fe.targetBackend.Handle(connection)
+		return
 	}
 
-	return nil
+	fe.handleClientConnection(proxiedConnection)
+}
+
+// handleClientConnection passes given connection to the target backend, if it passes all clientGates. The remote
+// address of the connection has to be the address of the client, as announced by the PROXY protocol header.
+func (fe *tcpFrontend) handleClientConnection(connection net.Conn) {
+	if admittedConnection, ok := admitConnection(connection, fe.clientGates(connection)); ok {
+		fe.handleConnection(admittedConnection)
+	}
 }
 
-// Close closes the listening instance if existing.
-func (fe *tcpFrontend) Close() error {
-	fe.listenerMutex.Lock()
-	defer func() {
-		fe.listener = nil
-		fe.listenerMutex.Unlock()
-	}()
+// isTrustedSource reports whether given address may send a PROXY protocol header.
+func (fe *tcpFrontend) isTrustedSource(remoteAddr net.Addr) bool {
+	addr, ok := addrFromNetAddr(remoteAddr)
+
+	return ok && prefixesContain(fe.proxyProtocolTrustedSources, addr)
+}
 
-	if fe.listener == nil {
-		return nil
+// readProxiedConnection reads the PROXY protocol header from given connection within the configured timeout,
+// and returns the connection with the addresses from the header as remote and local address.
+func (fe *tcpFrontend) readProxiedConnection(connection net.Conn) (net.Conn, error) {
+	if err := connection.SetReadDeadline(time.Now().Add(fe.proxyProtocolTimeout)); err != nil {
+		return nil, fmt.Errorf("could not set read deadline: %w", err)
 	}
 
-	if err := fe.listener.Close(); err != nil {
-		return fmt.Errorf("tcpfrontend could not close listener: %w", err)
+	reader := bufio.NewReader(connection)
+
+	header, err := readProxyHeader(reader)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	if err = connection.SetReadDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("could not reset read deadline: %w", err)
+	}
+
+	proxiedConnection := newBufferedConn(connection, reader)
+	if header.sourceAddr != nil {
+		proxiedConnection.remoteAddr = header.sourceAddr
+		proxiedConnection.localAddr = header.destinationAddr
+	}
+
+	return proxiedConnection, nil
+}
+
+// destinationPortConn is a connection asking the backend to connect to the port the connection arrived on. For
+// connections using the PROXY protocol, that's the destination port from the header.
+type destinationPortConn struct {
+	net.Conn
+}
+
+// TargetPort returns the port of the local address of the connection.
+func (c *destinationPortConn) TargetPort() int {
+	if localAddr, ok := c.LocalAddr().(*net.TCPAddr); ok {
+		return localAddr.Port
+	}
+
+	return 0
+}
+
+// CloseWrite shuts down the writing side of the underlying connection, if it supports that.
+func (c *destinationPortConn) CloseWrite() error {
+	if halfCloser, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return halfCloser.CloseWrite()
+	}
+
+	return errors.ErrUnsupported
+}
+
+// NetConn returns the underlying connection.
+func (c *destinationPortConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// errUntrustedProxyHeader is returned when reading from a connection of an untrusted source, that starts with a
+// PROXY protocol header.
+var errUntrustedProxyHeader = errors.New("untrusted source sent a proxy protocol header")
+
+// untrustedSourceConn is a connection from a source that is not trusted to send a PROXY protocol header. Reading
+// from it fails if the connection starts with a PROXY protocol signature, so the header never reaches the backend.
+// The check happens on the first read, so protocols where the server speaks first don't wait for the client.
+type untrustedSourceConn struct {
+	*bufferedConn
+
+	frontendName string
+	checkOnce    sync.Once
+	checkErr     error
+}
+
+// newUntrustedSourceConn wraps given connection of an untrusted source of the frontend with given name.
+func newUntrustedSourceConn(frontendName string, connection net.Conn) *untrustedSourceConn {
+	return &untrustedSourceConn{
+		bufferedConn: newBufferedConn(connection, bufio.NewReader(connection)),
+		frontendName: frontendName,
+		checkOnce:    sync.Once{},
+		checkErr:     nil,
+	}
+}
+
+// Read checks that the connection doesn't start with a PROXY protocol signature on the first call, and reads
+// from the connection afterwards. Once a signature got found, every read fails and the connection gets closed.
+func (c *untrustedSourceConn) Read(b []byte) (int, error) {
+	c.checkOnce.Do(func() {
+		c.checkErr = checkNoProxySignature(c.reader)
+		if c.checkErr == nil {
+			return
+		}
+
+		slog.Info(
+			"closed connection from untrusted source sending a proxy protocol header",
+			slog.String("name", c.frontendName),
+			slog.String("remoteAddr", c.RemoteAddr().String()),
+		)
+
+		if err := c.Close(); err != nil {
+			slog.Debug("could not properly close connection after untrusted proxy protocol header", slog.Any("error", err))
+		}
+	})
+
+	if c.checkErr != nil {
+		return 0, c.checkErr
+	}
+
+	return c.bufferedConn.Read(b)
+}
+
+// CloseWrite shuts down the writing side of the underlying connection, if it supports that.
+func (c *untrustedSourceConn) CloseWrite() error {
+	if halfCloser, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return halfCloser.CloseWrite()
+	}
+
+	return errors.ErrUnsupported
+}
+
+// checkNoProxySignature waits for the first bytes of given reader, until they either start with a PROXY protocol
+// v1 or v2 signature, or can't be the start of one anymore. Only the former results in an error, the bytes stay
+// in the reader either way. If the reader fails before that, the error is left for the following read.
+func checkNoProxySignature(reader *bufio.Reader) error {
+	signatures := [][]byte{[]byte("PROXY "), helper.ProxyProtocolV2Signature()}
+
+	for {
+		// Waits for at least one more byte, but reads all data already sent
+		if _, err := reader.Peek(reader.Buffered() + 1); err != nil {
+			return nil
+		}
+
+		data, _ := reader.Peek(reader.Buffered())
+		undecided := false
+
+		for _, signature := range signatures {
+			if bytes.HasPrefix(data, signature) {
+				return errUntrustedProxyHeader
+			}
+
+			if bytes.HasPrefix(signature, data) {
+				undecided = true
+			}
+		}
+
+		if !undecided {
+			return nil
+		}
+	}
 }
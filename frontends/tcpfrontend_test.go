@@ -2,12 +2,15 @@ package frontends
 
 import (
 	"errors"
+	"io"
 	"net"
+	"slices"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
 	"github.com/sateffen/pluggo/config"
 )
 
@@ -82,7 +85,7 @@ func TestTCPFrontend_Listen_ListenTCPFails(t *testing.T) {
 
 	// Replace factory with mock that fails
 	frontend.listenerFactory = &mockTCPListenerFactory{
-		mockListenTCP: func(_ string, _ *net.TCPAddr) (tcpListener, error) {
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
 			return nil, errors.New("failed to listen")
 		},
 	}
@@ -123,7 +126,7 @@ func TestTCPFrontend_Listen_AcceptsConnectionsAndHandles(t *testing.T) {
 	// Mock listener that accepts once then blocks
 	acceptCount := 0
 	acceptShouldBlock := make(chan bool)
-	mockListener := &mockTCPListener{
+	mockListener := &mockStreamListener{
 		mockAccept: func() (net.Conn, error) {
 			acceptCount++
 			if acceptCount == 1 {
@@ -140,7 +143,7 @@ func TestTCPFrontend_Listen_AcceptsConnectionsAndHandles(t *testing.T) {
 	}
 
 	frontend.listenerFactory = &mockTCPListenerFactory{
-		mockListenTCP: func(_ string, _ *net.TCPAddr) (tcpListener, error) {
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
 			return mockListener, nil
 		},
 	}
@@ -203,7 +206,7 @@ func TestTCPFrontend_Listen_AcceptErrorContinuesLoop(t *testing.T) {
 	// Mock listener that fails once, then succeeds, then blocks
 	acceptCount := 0
 	acceptShouldBlock := make(chan bool)
-	mockListener := &mockTCPListener{
+	mockListener := &mockStreamListener{
 		mockAccept: func() (net.Conn, error) {
 			acceptCount++
 			switch acceptCount {
@@ -226,7 +229,7 @@ func TestTCPFrontend_Listen_AcceptErrorContinuesLoop(t *testing.T) {
 	}
 
 	frontend.listenerFactory = &mockTCPListenerFactory{
-		mockListenTCP: func(_ string, _ *net.TCPAddr) (tcpListener, error) {
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
 			return mockListener, nil
 		},
 	}
@@ -272,7 +275,7 @@ func TestTCPFrontend_Close_ExitsListenLoop(t *testing.T) {
 
 	closeCalled := make(chan bool, 1)
 	acceptShouldBlock := make(chan bool)
-	mockListener := &mockTCPListener{
+	mockListener := &mockStreamListener{
 		mockAccept: func() (net.Conn, error) {
 			// Block until Close() is called
 			<-acceptShouldBlock
@@ -286,7 +289,7 @@ func TestTCPFrontend_Close_ExitsListenLoop(t *testing.T) {
 	}
 
 	frontend.listenerFactory = &mockTCPListenerFactory{
-		mockListenTCP: func(_ string, _ *net.TCPAddr) (tcpListener, error) {
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
 			return mockListener, nil
 		},
 	}
@@ -357,7 +360,7 @@ func TestTCPFrontend_Close_DoubleClose(t *testing.T) {
 
 	closeCallCount := 0
 	acceptShouldBlock := make(chan bool)
-	mockListener := &mockTCPListener{
+	mockListener := &mockStreamListener{
 		mockAccept: func() (net.Conn, error) {
 			<-acceptShouldBlock
 			return nil, errors.New("closed")
@@ -370,7 +373,7 @@ func TestTCPFrontend_Close_DoubleClose(t *testing.T) {
 	}
 
 	frontend.listenerFactory = &mockTCPListenerFactory{
-		mockListenTCP: func(_ string, _ *net.TCPAddr) (tcpListener, error) {
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
 			return mockListener, nil
 		},
 	}
@@ -417,7 +420,7 @@ func TestTCPFrontend_Close_CloseError(t *testing.T) {
 	}
 
 	acceptShouldBlock := make(chan bool)
-	mockListener := &mockTCPListener{
+	mockListener := &mockStreamListener{
 		mockAccept: func() (net.Conn, error) {
 			<-acceptShouldBlock
 			return nil, errors.New("closed")
@@ -429,7 +432,7 @@ func TestTCPFrontend_Close_CloseError(t *testing.T) {
 	}
 
 	frontend.listenerFactory = &mockTCPListenerFactory{
-		mockListenTCP: func(_ string, _ *net.TCPAddr) (tcpListener, error) {
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
 			return mockListener, nil
 		},
 	}
@@ -467,7 +470,7 @@ func TestTCPFrontend_ConcurrentClose(t *testing.T) {
 	closeCallCount := 0
 	var closeCountMutex sync.Mutex
 	acceptShouldBlock := make(chan bool)
-	mockListener := &mockTCPListener{
+	mockListener := &mockStreamListener{
 		mockAccept: func() (net.Conn, error) {
 			<-acceptShouldBlock
 			return nil, errors.New("closed")
@@ -486,7 +489,7 @@ func TestTCPFrontend_ConcurrentClose(t *testing.T) {
 	}
 
 	frontend.listenerFactory = &mockTCPListenerFactory{
-		mockListenTCP: func(_ string, _ *net.TCPAddr) (tcpListener, error) {
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
 			return mockListener, nil
 		},
 	}
@@ -520,3 +523,677 @@ func TestTCPFrontend_ConcurrentClose(t *testing.T) {
 		t.Errorf("listener.Close() called %d times, want 1", finalCount)
 	}
 }
+
+func TestTCPFrontend_NewTCPFrontend_InvalidProxyProtocolTrustedSources(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	_, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                        "test-frontend",
+		ListenAddr:                  "127.0.0.1:8080",
+		Target:                      "test-backend",
+		ProxyProtocol:               true,
+		ProxyProtocolTrustedSources: []string{"not-a-cidr"},
+	}, backendList)
+
+	if err == nil {
+		t.Fatal("expected newTCPFrontend() to fail with invalid trusted sources")
+	}
+}
+
+func TestTCPFrontend_NewTCPFrontend_ProxyProtocolWithoutTrustedSources(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	_, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:          "test-frontend",
+		ListenAddr:    "127.0.0.1:8080",
+		Target:        "test-backend",
+		ProxyProtocol: true,
+	}, backendList)
+
+	if err == nil {
+		t.Fatal("expected newTCPFrontend() to fail without trusted sources")
+	}
+}
+
+func TestTCPFrontend_Listen_ProxyProtocolFromTrustedSource(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                        "test-frontend",
+		ListenAddr:                  "127.0.0.1:8080",
+		Target:                      "test-backend",
+		ProxyProtocol:               true,
+		ProxyProtocolTrustedSources: []string{"127.0.0.0/8"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	handledConnections := make(chan net.Conn, 1)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handledConnections <- conn
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	clientConn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\npayload"))
+
+	var handledConnection net.Conn
+	select {
+	case handledConnection = <-handledConnections:
+		defer handledConnection.Close()
+	case <-time.After(time.Second):
+		t.Fatal("backend.Handle() was not called in appropriate time")
+	}
+
+	if handledConnection.RemoteAddr().String() != "192.0.2.1:56324" {
+		t.Errorf("RemoteAddr() = %q, want %q", handledConnection.RemoteAddr().String(), "192.0.2.1:56324")
+	}
+	if handledConnection.LocalAddr().String() != "198.51.100.1:443" {
+		t.Errorf("LocalAddr() = %q, want %q", handledConnection.LocalAddr().String(), "198.51.100.1:443")
+	}
+
+	readBuffer := make([]byte, len("payload"))
+	if _, err = io.ReadFull(handledConnection, readBuffer); err != nil {
+		t.Fatalf("could not read from handled connection: %v", err)
+	}
+	if string(readBuffer) != "payload" {
+		t.Errorf("backend received %q, want %q", string(readBuffer), "payload")
+	}
+}
+
+func TestTCPFrontend_Listen_ProxyProtocolFromUntrustedSource(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                        "test-frontend",
+		ListenAddr:                  "127.0.0.1:8080",
+		Target:                      "test-backend",
+		ProxyProtocol:               true,
+		ProxyProtocolTrustedSources: []string{"10.0.0.0/8"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	handledConnections := make(chan net.Conn, 1)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handledConnections <- conn
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	tests := []struct {
+		name       string
+		data       string
+		wantReject bool
+	}{
+		{
+			name:       "proxy protocol v1 header",
+			data:       "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+			wantReject: true,
+		},
+		{
+			name:       "proxy protocol v2 header",
+			data:       string(buildProxyHeaderV2(helper.ProxyProtocolV2CommandProxy, helper.ProxyProtocolV2FamilyTCP4, make([]byte, 12))),
+			wantReject: true,
+		},
+		{
+			name:       "other data",
+			data:       "PROPFIND / HTTP/1.1\r\n",
+			wantReject: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, err := net.Dial("tcp", listenAddr)
+			if err != nil {
+				t.Fatalf("could not dial frontend: %v", err)
+			}
+			defer clientConn.Close()
+
+			var handledConnection net.Conn
+			select {
+			case handledConnection = <-handledConnections:
+				defer handledConnection.Close()
+			case <-time.After(time.Second):
+				t.Fatal("backend.Handle() was not called in appropriate time")
+			}
+
+			// Untrusted sources get passed before sending anything, so the server can speak first
+			clientConn.Write([]byte(tt.data))
+
+			if handledConnection.RemoteAddr().String() != clientConn.LocalAddr().String() {
+				t.Errorf("RemoteAddr() = %q, want %q", handledConnection.RemoteAddr().String(), clientConn.LocalAddr().String())
+			}
+
+			readBuffer := make([]byte, len(tt.data))
+			_, err = io.ReadFull(handledConnection, readBuffer)
+
+			if tt.wantReject {
+				if !errors.Is(err, errUntrustedProxyHeader) {
+					t.Errorf("reading spoofed header returned error %v, want %v", err, errUntrustedProxyHeader)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("could not read from handled connection: %v", err)
+			}
+			if string(readBuffer) != tt.data {
+				t.Errorf("backend received %q, want %q", string(readBuffer), tt.data)
+			}
+		})
+	}
+}
+
+func TestTCPFrontend_Listen_ProxyProtocolTimeout(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                        "test-frontend",
+		ListenAddr:                  "127.0.0.1:8080",
+		Target:                      "test-backend",
+		ProxyProtocol:               true,
+		ProxyProtocolTimeout:        50 * time.Millisecond,
+		ProxyProtocolTrustedSources: []string{"127.0.0.0/8"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	handleCalled := make(chan bool, 1)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handleCalled <- true
+			conn.Close()
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	// Send nothing, the frontend should close the connection after the timeout
+	clientConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = clientConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF after proxy protocol timeout, got: %v", err)
+	}
+
+	if len(handleCalled) != 0 {
+		t.Error("backend.Handle() got called without proxy protocol header")
+	}
+}
+
+func TestTCPFrontend_Listen_ClosesDeniedConnections(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	denyRules, _ := newAccessRules(config.AccessListConfig{Allow: []string{"192.168.0.0/16"}})
+	frontend.accessList.set(denyRules, &accessRules{})
+
+	handleCalled := make(chan bool, 1)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handleCalled <- true
+			conn.Close()
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	clientConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = clientConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF for denied connection, got: %v", err)
+	}
+
+	if len(handleCalled) != 0 {
+		t.Error("backend.Handle() got called for denied connection")
+	}
+}
+
+func TestTCPFrontend_Listen_ProxyProtocolChecksAccessListOnClient(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                        "test-frontend",
+		ListenAddr:                  "127.0.0.1:8080",
+		Target:                      "test-backend",
+		ProxyProtocol:               true,
+		ProxyProtocolTrustedSources: []string{"127.0.0.0/8"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	// The proxy itself isn't on the allow list, only the client announced in the header
+	allowRules, _ := newAccessRules(config.AccessListConfig{Allow: []string{"192.0.2.0/24"}})
+	frontend.accessList.set(allowRules, &accessRules{})
+
+	handledConnections := make(chan net.Conn, 2)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handledConnections <- conn
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	allowedConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer allowedConn.Close()
+
+	allowedConn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"))
+
+	select {
+	case conn := <-handledConnections:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("backend.Handle() did not get called for allowed client")
+	}
+
+	deniedConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer deniedConn.Close()
+
+	deniedConn.Write([]byte("PROXY TCP4 203.0.113.1 198.51.100.1 56324 443\r\n"))
+
+	deniedConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = deniedConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF for denied client, got: %v", err)
+	}
+
+	if len(handledConnections) != 0 {
+		t.Error("backend.Handle() got called for denied client")
+	}
+}
+
+func TestTCPFrontend_Listen_ClosesConnectionsOverLimit(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                   "test-frontend",
+		ListenAddr:             "127.0.0.1:8080",
+		Target:                 "test-backend",
+		ConnectionLimitsConfig: config.ConnectionLimitsConfig{SourceMaxConnections: 1},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	handledConns := make(chan net.Conn, 2)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handledConns <- conn
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	firstConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer firstConn.Close()
+
+	var handledConn net.Conn
+	select {
+	case handledConn = <-handledConns:
+	case <-time.After(time.Second):
+		t.Fatal("backend.Handle() did not get called for first connection")
+	}
+
+	secondConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer secondConn.Close()
+
+	secondConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = secondConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF for connection over limit, got: %v", err)
+	}
+
+	// Closing the first connection frees its slot
+	handledConn.Close()
+
+	thirdConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer thirdConn.Close()
+
+	select {
+	case conn := <-handledConns:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Error("backend.Handle() did not get called after the slot got freed")
+	}
+}
+
+func TestTCPFrontend_Listen_ProxyProtocolLimitsPerClient(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                        "test-frontend",
+		ListenAddr:                  "127.0.0.1:8080",
+		Target:                      "test-backend",
+		ProxyProtocol:               true,
+		ProxyProtocolTrustedSources: []string{"127.0.0.0/8"},
+		ConnectionLimitsConfig:      config.ConnectionLimitsConfig{SourceMaxConnections: 1},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	handledConnections := make(chan net.Conn, 3)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handledConnections <- conn
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	// All connections come from the same proxy, but only the client announced in the header counts
+	for _, clientIP := range []string{"192.0.2.1", "192.0.2.2"} {
+		clientConn, dialErr := net.Dial("tcp", listenAddr)
+		if dialErr != nil {
+			t.Fatalf("could not dial frontend: %v", dialErr)
+		}
+		defer clientConn.Close()
+
+		clientConn.Write([]byte("PROXY TCP4 " + clientIP + " 198.51.100.1 56324 443\r\n"))
+
+		select {
+		case conn := <-handledConnections:
+			defer conn.Close()
+		case <-time.After(time.Second):
+			t.Fatalf("backend.Handle() did not get called for client %s", clientIP)
+		}
+	}
+
+	limitedConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer limitedConn.Close()
+
+	limitedConn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56325 443\r\n"))
+
+	limitedConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = limitedConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF for client over limit, got: %v", err)
+	}
+}
+
+func TestTCPFrontend_Listen_ProxyProtocolBansClientsOnly(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                        "test-frontend",
+		ListenAddr:                  "127.0.0.1:8080",
+		Target:                      "test-backend",
+		ProxyProtocol:               true,
+		ProxyProtocolTrustedSources: []string{"127.0.0.0/8"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	bans, _ := newTestBanList(t, config.BansConfig{MaxRetry: 1})
+	frontend.setBanList(bans)
+
+	// The backend reads until the client closes, which gives clients sending no data a strike
+	handledConnections := make(chan bool, 2)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+				handledConnections <- true
+			}()
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	localHeader := append(helper.ProxyProtocolV2Signature(), 0x20, 0x00, 0x00, 0x00)
+	clientHeader := []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n")
+
+	// A health check of the proxy announces no client, and a client sends nothing after the header
+	for _, header := range [][]byte{localHeader, clientHeader} {
+		clientConn, dialErr := net.Dial("tcp", listenAddr)
+		if dialErr != nil {
+			t.Fatalf("could not dial frontend: %v", dialErr)
+		}
+
+		clientConn.Write(header)
+		clientConn.Close()
+
+		select {
+		case <-handledConnections:
+		case <-time.After(time.Second):
+			t.Fatal("backend.Handle() did not get called in appropriate time")
+		}
+	}
+
+	if bans.isBanned(testClientAddr("127.0.0.1")) {
+		t.Error("trusted proxy got banned")
+	}
+	if !bans.isBanned(testClientAddr("192.0.2.1")) {
+		t.Error("client announced in the header didn't get banned")
+	}
+
+	bannedConn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer bannedConn.Close()
+
+	bannedConn.Write(clientHeader)
+
+	bannedConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = bannedConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF for banned client, got: %v", err)
+	}
+}
+
+func TestTCPFrontend_NewTCPFrontend_InvalidSocketOptions(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	_, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                "test-frontend",
+		ListenAddr:          "127.0.0.1:8080",
+		Target:              "test-backend",
+		SocketOptionsConfig: config.SocketOptionsConfig{DSCP: 64},
+	}, backendList)
+
+	if err == nil {
+		t.Fatal("expected newTCPFrontend() to fail with invalid socket options")
+	}
+}
+
+func TestTCPFrontend_Listen_MultipleListenAddrs(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:                "test-frontend",
+		ListenAddrs:         []string{"127.0.0.1:5000-5001"},
+		KeepDestinationPort: true,
+		Target:              "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	if len(frontend.listenAddrs) != 2 {
+		t.Fatalf("got %d listen addresses, want 2", len(frontend.listenAddrs))
+	}
+
+	// Every configured address gets its own real listener on a random port
+	frontend.listenerFactory = &mockTCPListenerFactory{
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
+			return net.Listen("tcp", "127.0.0.1:0")
+		},
+	}
+
+	targetPorts := make(chan int, 2)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			if provider, ok := conn.(interface{ TargetPort() int }); ok {
+				targetPorts <- provider.TargetPort()
+			}
+			conn.Close()
+		},
+	}
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- frontend.Listen()
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for frontend.isClosed() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	frontend.listenerMutex.RLock()
+	listeners := slices.Clone(frontend.listeners)
+	frontend.listenerMutex.RUnlock()
+
+	for _, listener := range listeners {
+		clientConn, dialErr := net.Dial("tcp", listener.Addr().String())
+		if dialErr != nil {
+			t.Fatalf("could not dial frontend: %v", dialErr)
+		}
+		clientConn.Close()
+
+		select {
+		case port := <-targetPorts:
+			if want := listener.Addr().(*net.TCPAddr).Port; port != want {
+				t.Errorf("got target port %d, want destination port %d", port, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("backend.Handle() did not get called for %s", listener.Addr())
+		}
+	}
+
+	frontend.Close()
+
+	select {
+	case err = <-listenDone:
+		if err != nil {
+			t.Errorf("Listen() returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Listen() did not return after Close()")
+	}
+}
+
+func TestTCPFrontend_Listen_ClosesListenersIfAnyFails(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTCPFrontend(config.TCPFrontendConfig{
+		Name:        "test-frontend",
+		ListenAddrs: []string{"127.0.0.1:5000", "127.0.0.1:5001"},
+		Target:      "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTCPFrontend() failed: %v", err)
+	}
+
+	closeCount := 0
+	frontend.listenerFactory = &mockTCPListenerFactory{
+		mockListenTCP: func(_ string, laddr *net.TCPAddr) (streamListener, error) {
+			if laddr.Port == 5001 {
+				return nil, errors.New("address already in use")
+			}
+
+			return &mockStreamListener{
+				mockClose: func() error {
+					closeCount++
+					return nil
+				},
+			}, nil
+		},
+	}
+
+	if err = frontend.Listen(); err == nil {
+		t.Fatal("expected Listen() to fail")
+	}
+
+	if closeCount != 1 {
+		t.Errorf("closed %d listeners, want the one that got created", closeCount)
+	}
+
+	if !frontend.isClosed() {
+		t.Error("frontend has listeners after failing to listen")
+	}
+}
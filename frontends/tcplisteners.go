@@ -0,0 +1,174 @@
+package frontends
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/sateffen/pluggo/backends/helper"
+)
+
+// tcpListeners is embedded by all frontends listening on TCP addresses. It binds a listener for every listen
+// address, accepts connections, and passes the ones admitted by the gates to the handler of the frontend, so
+// frontends only have to provide their handler.
+type tcpListeners struct {
+	name            string
+	kind            string
+	accessList      *accessList
+	limiter         *connectionLimiter
+	bans            *banList
+	reserve         *fdReserve
+	listenerMutex   sync.RWMutex
+	listenAddrs     []*net.TCPAddr
+	listeners       []streamListener
+	listenerFactory tcpListenerFactory
+	onListening     func()
+}
+
+// newTCPListeners creates a new instance of tcpListeners for the frontend with given name, binding its sockets
+// with given socketOptions. The kind of the frontend, like "tlsfrontend", prefixes its log messages.
+func newTCPListeners(
+	name string,
+	kind string,
+	listenAddrs []*net.TCPAddr,
+	limiter *connectionLimiter,
+	socketOptions *helper.SocketOptions,
+) *tcpListeners {
+	return &tcpListeners{
+		name:            name,
+		kind:            kind,
+		accessList:      newAccessList(name),
+		limiter:         limiter,
+		bans:            nil,
+		reserve:         nil,
+		listenerMutex:   sync.RWMutex{},
+		listenAddrs:     listenAddrs,
+		listeners:       nil,
+		listenerFactory: defaultTCPListenerFactory{socketOptions: socketOptions},
+		onListening:     func() {},
+	}
+}
+
+// GetName returns the name of the frontend.
+func (tl *tcpListeners) GetName() string {
+	return tl.name
+}
+
+// setOnListening registers a callback that gets called every time the frontend started listening.
+func (tl *tcpListeners) setOnListening(callback func()) {
+	tl.onListening = callback
+}
+
+// listen creates a TCP listener for every listen address, starts listening and accepting connections. Every
+// connection admitted by given gates is passed to handle, which has to start its own go-routine for work that
+// might block. If any address can't be bound, none is listened on.
+// listen blocks the current thread by starting an endless loop accepting new connections per listener.
+// listen is resilient in that it does not stop accepting connections just because an error happens.
+func (tl *tcpListeners) listen(handle func(connection net.Conn), gates []connectionGate) error {
+	tl.listenerMutex.Lock()
+	listeners, err := tl.createListeners()
+	tl.listeners = listeners
+	tl.listenerMutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("can't listen for frontend '%s': %w", tl.name, err)
+	}
+
+	var acceptGroup sync.WaitGroup
+
+	for i, listener := range listeners {
+		slog.Info(tl.kind+" started listening", slog.String("name", tl.name), slog.String("listenAddr", tl.listenAddrs[i].String()))
+
+		acceptGroup.Go(func() {
+			acceptConnections(listener, tl.isClosed, tl.reserve, handle, gates...)
+		})
+	}
+
+	tl.onListening()
+
+	acceptGroup.Wait()
+
+	return nil
+}
+
+// createListeners creates a TCP listener for every listen address. If any fails, the already created ones get
+// closed again.
+func (tl *tcpListeners) createListeners() ([]streamListener, error) {
+	listeners := make([]streamListener, 0, len(tl.listenAddrs))
+
+	for _, listenAddr := range tl.listenAddrs {
+		listener, err := tl.listenerFactory.ListenTCP("tcp", listenAddr)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("can't listen on '%s': %w", listenAddr, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// useInheritedFile makes the frontend use given socket inherited by systemd socket activation, instead of binding
+// its own sockets. The inherited socket replaces all configured listen addresses.
+func (tl *tcpListeners) useInheritedFile(file *os.File) {
+	tl.listenerFactory = inheritedListenerFactory{file: file}
+	tl.listenAddrs = tl.listenAddrs[:1]
+}
+
+// getAccessList returns the accessList deciding which clients may connect to the frontend.
+func (tl *tcpListeners) getAccessList() *accessList {
+	return tl.accessList
+}
+
+// getConnectionLimiter returns the connectionLimiter limiting the connections of the frontend.
+func (tl *tcpListeners) getConnectionLimiter() *connectionLimiter {
+	return tl.limiter
+}
+
+// setBanList makes the frontend reject connections of sources banned by given banList, and give strikes to sources
+// misbehaving.
+func (tl *tcpListeners) setBanList(bans *banList) {
+	tl.bans = bans
+}
+
+// setFDReserve makes the frontend shed pending connections using given fdReserve, if the process runs out of file
+// descriptors.
+func (tl *tcpListeners) setFDReserve(reserve *fdReserve) {
+	tl.reserve = reserve
+}
+
+// acceptGates returns the gates connections have to pass right after getting accepted, checking the access list,
+// bans and connection limits.
+func (tl *tcpListeners) acceptGates() []connectionGate {
+	return []connectionGate{tl.accessList, tl.bans, tl.limiter, frontendNameGate(tl.name)}
+}
+
+// isClosed reports whether the listeners got closed, or never were created.
+func (tl *tcpListeners) isClosed() bool {
+	tl.listenerMutex.RLock()
+	defer tl.listenerMutex.RUnlock()
+
+	return tl.listeners == nil
+}
+
+// Close closes all listening instances if existing.
+func (tl *tcpListeners) Close() error {
+	tl.listenerMutex.Lock()
+	defer func() {
+		tl.listeners = nil
+		tl.listenerMutex.Unlock()
+	}()
+
+	var closeErr error
+
+	for _, listener := range tl.listeners {
+		if err := listener.Close(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("%s could not close listener: %w", tl.kind, err)
+		}
+	}
+
+	return closeErr
+}
@@ -0,0 +1,184 @@
+package frontends
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const tlsHandshakeTimeout = 10 * time.Second
+
+type tlsFrontend struct {
+	*tcpListeners
+
+	targetBackend backends.Backend
+	tlsConfig     *tls.Config
+}
+
+// newTLSFrontend creates a new instance of an tlsFrontend, preparing it with all default dependencies.
+func newTLSFrontend(conf config.TLSFrontendConfig, backendList *backends.BackendList) (*tlsFrontend, error) {
+	parsedListenAddr, err := net.ResolveTCPAddr("tcp", conf.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+	}
+
+	tlsConfig, err := newServerTLSConfig(conf)
+	if err != nil {
+		return nil, fmt.Errorf("could not create tls config of frontend '%s': %w", conf.Name, err)
+	}
+
+	targetBackend, ok := backendList.Get(conf.Target)
+	if !ok {
+		return nil, fmt.Errorf("target backend '%s' for frontend '%s' does not exist", conf.Target, conf.Name)
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options of frontend '%s': %w", conf.Name, err)
+	}
+
+	return &tlsFrontend{
+		tcpListeners:  newTCPListeners(conf.Name, "tlsfrontend", []*net.TCPAddr{parsedListenAddr}, limiter, socketOptions),
+		targetBackend: targetBackend,
+		tlsConfig:     tlsConfig,
+	}, nil
+}
+
+// Listen creates a TCP listener, starts listening and accepting connections. Every accepted connection
+// gets its TLS handshake done in its own go-routine, and is handed to the target backend decrypted.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen is resilient in that it does not stop accepting connections just because an error happens.
+func (fe *tlsFrontend) Listen() error {
+	return fe.listen(func(connection net.Conn) {
+		go fe.handshake(connection)
+	}, fe.acceptGates())
+}
+
+// handshake does the TLS handshake for given connection and hands the decrypted connection to the target backend.
+// If the handshake fails or takes longer than tlsHandshakeTimeout, the connection gets closed.
+func (fe *tlsFrontend) handshake(connection net.Conn) {
+	tlsConnection := tls.Server(connection, fe.tlsConfig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+
+	if err := tlsConnection.HandshakeContext(ctx); err != nil {
+		slog.Debug(
+			"tlsfrontend handshake failed",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+
+		if err = tlsConnection.Close(); err != nil {
+			slog.Debug("could not properly close connection after failed handshake", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	connectionState := tlsConnection.ConnectionState()
+	slog.Debug(
+		"tlsfrontend accepted connection",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("serverName", connectionState.ServerName),
+		slog.String("alpn", connectionState.NegotiatedProtocol),
+		slog.String("tlsVersion", tls.VersionName(connectionState.Version)),
+		slog.String("cipherSuite", tls.CipherSuiteName(connectionState.CipherSuite)),
+	)
+
+	fe.targetBackend.Handle(tlsConnection)
+}
+
+// newServerTLSConfig creates the tls.Config for given frontend config. If multiple certificates are configured,
+// the certificate matching the SNI of the client gets selected, falling back to the first certificate.
+func newServerTLSConfig(conf config.TLSFrontendConfig) (*tls.Config, error) {
+	if len(conf.Certificates) == 0 {
+		return nil, errors.New("no certificates configured")
+	}
+
+	certificates := make([]tls.Certificate, 0, len(conf.Certificates))
+	for _, certConf := range conf.Certificates {
+		certificate, err := tls.LoadX509KeyPair(certConf.CertFile, certConf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load certificate '%s': %w", certConf.CertFile, err)
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	minVersion, err := parseTLSVersion(conf.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherSuites, err := parseCipherSuites(conf.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:gosec // the minimum version is configurable by the admin, defaulting to TLS 1.2
+	return &tls.Config{
+		Certificates: certificates,
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+		NextProtos:   conf.ALPN,
+	}, nil
+}
+
+// parseTLSVersion parses given version string like "1.2" to its tls.Version* value. An empty string
+// defaults to TLS 1.2.
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	default:
+		return 0, fmt.Errorf("unknown tls version '%s'", version)
+	}
+}
+
+// parseCipherSuites resolves given cipher suite names like "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256" to their ids.
+// Only cipher suites considered secure by crypto/tls are allowed. An empty list keeps the defaults of crypto/tls.
+// Cipher suites of TLS 1.3 are not configurable, so they are always enabled.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	availableSuites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		availableSuites[suite.Name] = suite.ID
+	}
+
+	cipherSuites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := availableSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite '%s'", name)
+		}
+
+		cipherSuites = append(cipherSuites, id)
+	}
+
+	return cipherSuites, nil
+}
@@ -0,0 +1,310 @@
+package frontends
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// generateTestCertificate creates a self-signed certificate for given dns names in given directory, and returns
+// the config pointing to the created cert and key file.
+func generateTestCertificate(t *testing.T, dir string, dnsNames ...string) config.TLSCertificateConfig {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, dnsNames[0]+".crt")
+	keyFile := filepath.Join(dir, dnsNames[0]+".key")
+
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600); err != nil {
+		t.Fatalf("could not write certificate: %v", err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("could not write key: %v", err)
+	}
+
+	return config.TLSCertificateConfig{CertFile: certFile, KeyFile: keyFile}
+}
+
+func TestTLSFrontend_GetName(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTLSFrontend(config.TLSFrontendConfig{
+		Name:         "test-frontend",
+		ListenAddr:   "127.0.0.1:8443",
+		Target:       "test-backend",
+		Certificates: []config.TLSCertificateConfig{generateTestCertificate(t, t.TempDir(), "example.com")},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTLSFrontend() failed: %v", err)
+	}
+
+	if got := frontend.GetName(); got != "test-frontend" {
+		t.Errorf("GetName() = %q, want %q", got, "test-frontend")
+	}
+}
+
+func TestTLSFrontend_NewTLSFrontend_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+	certificate := generateTestCertificate(t, t.TempDir(), "example.com")
+
+	testCases := map[string]config.TLSFrontendConfig{
+		"invalid listen address": {
+			ListenAddr:   "invalid-address",
+			Target:       "test-backend",
+			Certificates: []config.TLSCertificateConfig{certificate},
+		},
+		"no certificates": {
+			ListenAddr: "127.0.0.1:8443",
+			Target:     "test-backend",
+		},
+		"missing certificate file": {
+			ListenAddr:   "127.0.0.1:8443",
+			Target:       "test-backend",
+			Certificates: []config.TLSCertificateConfig{{CertFile: "/does/not/exist.crt", KeyFile: certificate.KeyFile}},
+		},
+		"unknown min version": {
+			ListenAddr:   "127.0.0.1:8443",
+			Target:       "test-backend",
+			Certificates: []config.TLSCertificateConfig{certificate},
+			MinVersion:   "2.0",
+		},
+		"insecure cipher suite": {
+			ListenAddr:   "127.0.0.1:8443",
+			Target:       "test-backend",
+			Certificates: []config.TLSCertificateConfig{certificate},
+			CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"},
+		},
+		"non-existent backend": {
+			ListenAddr:   "127.0.0.1:8443",
+			Target:       "non-existent-backend",
+			Certificates: []config.TLSCertificateConfig{certificate},
+		},
+	}
+
+	for name, conf := range testCases {
+		t.Run(name, func(t *testing.T) {
+			conf.Name = "test-frontend"
+			if _, err := newTLSFrontend(conf, backendList); err == nil {
+				t.Error("expected newTLSFrontend() to fail")
+			}
+		})
+	}
+}
+
+func TestTLSFrontend_NewTLSFrontend_AppliesPolicy(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTLSFrontend(config.TLSFrontendConfig{
+		Name:         "test-frontend",
+		ListenAddr:   "127.0.0.1:8443",
+		Target:       "test-backend",
+		Certificates: []config.TLSCertificateConfig{generateTestCertificate(t, t.TempDir(), "example.com")},
+		MinVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		ALPN:         []string{"h2", "http/1.1"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTLSFrontend() failed: %v", err)
+	}
+
+	if frontend.tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %x, want %x", frontend.tlsConfig.MinVersion, tls.VersionTLS13)
+	}
+	if len(frontend.tlsConfig.CipherSuites) != 1 || frontend.tlsConfig.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("CipherSuites = %v, want [%x]", frontend.tlsConfig.CipherSuites, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256)
+	}
+	if len(frontend.tlsConfig.NextProtos) != 2 {
+		t.Errorf("NextProtos = %v, want [h2 http/1.1]", frontend.tlsConfig.NextProtos)
+	}
+}
+
+func TestTLSFrontend_Listen_TerminatesTLSAndSelectsCertificateBySNI(t *testing.T) {
+	certDir := t.TempDir()
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTLSFrontend(config.TLSFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8443",
+		Target:     "test-backend",
+		Certificates: []config.TLSCertificateConfig{
+			generateTestCertificate(t, certDir, "first.example.com"),
+			generateTestCertificate(t, certDir, "second.example.com"),
+		},
+		ALPN: []string{"pluggo"},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTLSFrontend() failed: %v", err)
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	for _, serverName := range []string{"first.example.com", "second.example.com", "unknown.example.com"} {
+		//nolint:gosec // the test certificates are self-signed, we verify the presented certificate manually
+		clientConn, err := tls.Dial("tcp", listenAddr, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"pluggo"},
+		})
+		if err != nil {
+			t.Fatalf("could not dial frontend: %v", err)
+		}
+		defer clientConn.Close()
+
+		connectionState := clientConn.ConnectionState()
+
+		// Unknown names fall back to the first certificate
+		wantName := serverName
+		if serverName == "unknown.example.com" {
+			wantName = "first.example.com"
+		}
+		if got := connectionState.PeerCertificates[0].Subject.CommonName; got != wantName {
+			t.Errorf("presented certificate for %q = %q, want %q", serverName, got, wantName)
+		}
+		if connectionState.NegotiatedProtocol != "pluggo" {
+			t.Errorf("NegotiatedProtocol = %q, want %q", connectionState.NegotiatedProtocol, "pluggo")
+		}
+
+		// The echo backend receives the decrypted data, so we should get back what we sent
+		testData := []byte("hello " + serverName)
+		if _, err = clientConn.Write(testData); err != nil {
+			t.Fatalf("could not write to frontend: %v", err)
+		}
+
+		readBuffer := make([]byte, len(testData))
+		if _, err = io.ReadFull(clientConn, readBuffer); err != nil {
+			t.Fatalf("could not read echoed data: %v", err)
+		}
+		if string(readBuffer) != string(testData) {
+			t.Errorf("client received %q, want %q", string(readBuffer), string(testData))
+		}
+	}
+}
+
+func TestTLSFrontend_Listen_RejectsVersionBelowMinimum(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTLSFrontend(config.TLSFrontendConfig{
+		Name:         "test-frontend",
+		ListenAddr:   "127.0.0.1:8443",
+		Target:       "test-backend",
+		Certificates: []config.TLSCertificateConfig{generateTestCertificate(t, t.TempDir(), "example.com")},
+		MinVersion:   "1.3",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTLSFrontend() failed: %v", err)
+	}
+
+	handleCalled := make(chan bool, 1)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handleCalled <- true
+			conn.Close()
+		},
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	//nolint:gosec // we want to test that old versions get rejected
+	_, err = tls.Dial("tcp", listenAddr, &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	})
+	if err == nil {
+		t.Fatal("expected handshake with TLS 1.2 to fail")
+	}
+
+	select {
+	case <-handleCalled:
+		t.Error("backend.Handle() got called for failed handshake")
+	case <-time.After(50 * time.Millisecond):
+		// Success
+	}
+}
+
+func TestTLSFrontend_Listen_ListenTCPFails(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTLSFrontend(config.TLSFrontendConfig{
+		Name:         "test-frontend",
+		ListenAddr:   "127.0.0.1:8443",
+		Target:       "test-backend",
+		Certificates: []config.TLSCertificateConfig{generateTestCertificate(t, t.TempDir(), "example.com")},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTLSFrontend() failed: %v", err)
+	}
+
+	frontend.listenerFactory = &mockTCPListenerFactory{
+		mockListenTCP: func(_ string, _ *net.TCPAddr) (streamListener, error) {
+			return nil, errors.New("failed to listen")
+		},
+	}
+
+	if err = frontend.Listen(); err == nil {
+		t.Fatal("expected Listen() to fail when ListenTCP fails")
+	}
+}
+
+func TestTLSFrontend_Close_NoListener(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newTLSFrontend(config.TLSFrontendConfig{
+		Name:         "test-frontend",
+		ListenAddr:   "127.0.0.1:8443",
+		Target:       "test-backend",
+		Certificates: []config.TLSCertificateConfig{generateTestCertificate(t, t.TempDir(), "example.com")},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTLSFrontend() failed: %v", err)
+	}
+
+	if err = frontend.Close(); err != nil {
+		t.Errorf("Close() with no listener should return nil, got: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package frontends
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+// transparentMode defines how a transparentFrontend gets the connections intercepted for it.
+type transparentMode int
+
+const (
+	// transparentModeRedirect is for connections redirected by a netfilter REDIRECT rule, whose original
+	// destination has to be read from the socket.
+	transparentModeRedirect transparentMode = iota
+	// transparentModeTProxy is for connections redirected by a netfilter TPROXY rule to a transparent socket,
+	// whose local address is the original destination.
+	transparentModeTProxy
+)
+
+// parseTransparentMode parses given mode, which is "redirect" or "tproxy". An empty mode defaults to "redirect".
+func parseTransparentMode(mode string) (transparentMode, error) {
+	switch mode {
+	case "", "redirect":
+		return transparentModeRedirect, nil
+	case "tproxy":
+		return transparentModeTProxy, nil
+	default:
+		return transparentModeRedirect, fmt.Errorf("unknown mode '%s'", mode)
+	}
+}
+
+type transparentFrontend struct {
+	*tcpListeners
+
+	mode           transparentMode
+	rules          []destinationRule
+	defaultBackend backends.Backend
+}
+
+// newTransparentFrontend creates a new instance of an transparentFrontend, preparing it with all default
+// dependencies. Its rules may only match IP addresses and CIDRs, as the original destination of a connection
+// is always an IP address.
+func newTransparentFrontend(conf config.TransparentFrontendConfig, backendList *backends.BackendList) (*transparentFrontend, error) {
+	parsedListenAddr, err := net.ResolveTCPAddr("tcp", conf.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+	}
+
+	mode, err := parseTransparentMode(conf.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config of frontend '%s': %w", conf.Name, err)
+	}
+
+	rules, err := newDestinationRules(conf.Rules, backendList)
+	if err != nil {
+		return nil, fmt.Errorf("could not create rules of frontend '%s': %w", conf.Name, err)
+	}
+
+	for _, rule := range rules {
+		if !rule.prefix.IsValid() {
+			return nil, fmt.Errorf("destination '%s' of frontend '%s' is no IP address or CIDR", rule.destination, conf.Name)
+		}
+	}
+
+	var defaultBackend backends.Backend
+	if conf.Default != "" {
+		var ok bool
+
+		defaultBackend, ok = backendList.Get(conf.Default)
+		if !ok {
+			return nil, fmt.Errorf("default backend '%s' for frontend '%s' does not exist", conf.Default, conf.Name)
+		}
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options of frontend '%s': %w", conf.Name, err)
+	}
+
+	if mode == transparentModeTProxy {
+		socketOptions.EnableTransparent()
+	}
+
+	return &transparentFrontend{
+		tcpListeners:   newTCPListeners(conf.Name, "transparentfrontend", []*net.TCPAddr{parsedListenAddr}, limiter, socketOptions),
+		mode:           mode,
+		rules:          rules,
+		defaultBackend: defaultBackend,
+	}, nil
+}
+
+// Listen creates a TCP listener, starts listening and accepting connections. Every accepted connection is handed
+// to the backend matching the destination it originally was sent to.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen is resilient in that it does not stop accepting connections just because an error happens.
+func (fe *transparentFrontend) Listen() error {
+	return fe.listen(fe.route, fe.acceptGates())
+}
+
+// route hands given connection to the backend matching its original destination, or the default backend if no
+// rule matches. The backend is asked to connect to the original destination port. If the original destination
+// is unknown, or no backend matches, the connection gets closed.
+func (fe *transparentFrontend) route(connection net.Conn) {
+	destinationConnection, err := fe.withOriginalDestination(connection)
+	if err != nil {
+		slog.Debug(
+			"transparentfrontend could not get original destination",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+		closeUnroutedConnection(connection)
+
+		return
+	}
+
+	destination, ok := destinationConnection.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		closeUnroutedConnection(connection)
+		return
+	}
+
+	targetBackend := fe.defaultBackend
+	if rule, matched := matchDestinationRules(fe.rules, destination.IP.String(), destination.Port); matched {
+		targetBackend = rule.targetBackend
+	}
+
+	if targetBackend == nil {
+		slog.Debug(
+			"transparentfrontend found no backend for destination",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.String("destination", destination.String()),
+		)
+		closeUnroutedConnection(connection)
+
+		return
+	}
+
+	slog.Debug(
+		"transparentfrontend accepted connection",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("destination", destination.String()),
+		slog.String("target", targetBackend.GetName()),
+	)
+
+	targetBackend.Handle(&destinationPortConn{Conn: destinationConnection})
+}
+
+// withOriginalDestination returns given connection with the original destination as its local address. For
+// connections intercepted by TPROXY, that's already the case.
+func (fe *transparentFrontend) withOriginalDestination(connection net.Conn) (net.Conn, error) {
+	switch fe.mode {
+	case transparentModeTProxy:
+		return connection, nil
+	case transparentModeRedirect:
+		tcpConnection, ok := helper.FindConn[*net.TCPConn](connection)
+		if !ok {
+			return nil, errors.New("connection is no tcp connection")
+		}
+
+		destination, err := originalDestination(tcpConnection)
+		if err != nil {
+			return nil, err
+		}
+
+		destinationConnection := newBufferedConn(connection, bufio.NewReader(connection))
+		destinationConnection.localAddr = destination
+
+		return destinationConnection, nil
+	default:
+		return nil, fmt.Errorf("unknown mode %d", fe.mode)
+	}
+}
@@ -0,0 +1,246 @@
+package frontends
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+// newTestTransparentFrontend creates a transparentFrontend in given mode, routing 192.0.2.0/24 and port 22 of
+// 198.51.100.1 to the returned mock backends, with the last one as default.
+func newTestTransparentFrontend(t *testing.T, mode string) (*transparentFrontend, []*mockBackend) {
+	t.Helper()
+
+	backendList := createTestBackendList("subnet-backend", "ssh-backend", "default-backend")
+
+	frontend, err := newTransparentFrontend(config.TransparentFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:0",
+		Mode:       mode,
+		Rules: []config.DestinationRuleConfig{
+			{Destination: "192.0.2.0/24", Target: "subnet-backend"},
+			{Destination: "198.51.100.1:22", Target: "ssh-backend"},
+		},
+		Default: "default-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newTransparentFrontend() failed: %v", err)
+	}
+
+	mockBackends := []*mockBackend{{name: "subnet-backend"}, {name: "ssh-backend"}, {name: "default-backend"}}
+	frontend.rules[0].targetBackend = mockBackends[0]
+	frontend.rules[1].targetBackend = mockBackends[1]
+	frontend.defaultBackend = mockBackends[2]
+
+	return frontend, mockBackends
+}
+
+// newTestInterceptedConn returns a connection that got intercepted on its way to given destination.
+func newTestInterceptedConn(destination string) (net.Conn, net.Conn) {
+	clientSide, serverSide := net.Pipe()
+
+	connection := newBufferedConn(serverSide, bufio.NewReader(serverSide))
+	connection.remoteAddr = testClientAddr("203.0.113.1")
+	connection.localAddr, _ = net.ResolveTCPAddr("tcp", destination)
+
+	return connection, clientSide
+}
+
+func TestParseTransparentMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    transparentMode
+		wantErr bool
+	}{
+		{mode: "", want: transparentModeRedirect},
+		{mode: "redirect", want: transparentModeRedirect},
+		{mode: "tproxy", want: transparentModeTProxy},
+		{mode: "nat", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := parseTransparentMode(tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTransparentMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseTransparentMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransparentFrontend_NewTransparentFrontend_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	tests := []struct {
+		name string
+		conf config.TransparentFrontendConfig
+	}{
+		{
+			name: "invalid listenAddr",
+			conf: config.TransparentFrontendConfig{ListenAddr: "not-an-address"},
+		},
+		{
+			name: "unknown mode",
+			conf: config.TransparentFrontendConfig{ListenAddr: "127.0.0.1:8080", Mode: "nat"},
+		},
+		{
+			name: "hostname destination",
+			conf: config.TransparentFrontendConfig{
+				ListenAddr: "127.0.0.1:8080",
+				Rules:      []config.DestinationRuleConfig{{Destination: "nas.example.com", Target: "test-backend"}},
+			},
+		},
+		{
+			name: "unknown rule target",
+			conf: config.TransparentFrontendConfig{
+				ListenAddr: "127.0.0.1:8080",
+				Rules:      []config.DestinationRuleConfig{{Destination: "192.0.2.1", Target: "missing"}},
+			},
+		},
+		{
+			name: "unknown default",
+			conf: config.TransparentFrontendConfig{ListenAddr: "127.0.0.1:8080", Default: "missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Name = "test-frontend"
+
+			if _, err := newTransparentFrontend(tt.conf, backendList); err == nil {
+				t.Error("expected newTransparentFrontend() to fail")
+			}
+		})
+	}
+}
+
+func TestTransparentFrontend_Route_TProxy(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		wantBackend int
+	}{
+		{name: "subnet rule", destination: "192.0.2.17:443", wantBackend: 0},
+		{name: "port rule", destination: "198.51.100.1:22", wantBackend: 1},
+		{name: "port rule with other port uses default", destination: "198.51.100.1:80", wantBackend: 2},
+		{name: "unmatched uses default", destination: "[2001:db8::1]:80", wantBackend: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontend, mockBackends := newTestTransparentFrontend(t, "tproxy")
+
+			handledBy := make(chan int, 1)
+			targetPorts := make(chan int, 1)
+
+			for i, backend := range mockBackends {
+				backend.mockHandle = func(conn net.Conn) {
+					handledBy <- i
+
+					if provider, ok := conn.(interface{ TargetPort() int }); ok {
+						targetPorts <- provider.TargetPort()
+					}
+
+					conn.Close()
+				}
+			}
+
+			connection, clientSide := newTestInterceptedConn(tt.destination)
+			defer clientSide.Close()
+
+			frontend.route(connection)
+
+			if got := <-handledBy; got != tt.wantBackend {
+				t.Errorf("connection handled by backend %d, want %d", got, tt.wantBackend)
+			}
+
+			destination, _ := net.ResolveTCPAddr("tcp", tt.destination)
+			if got := <-targetPorts; got != destination.Port {
+				t.Errorf("TargetPort() = %d, want %d", got, destination.Port)
+			}
+		})
+	}
+}
+
+func TestTransparentFrontend_Route_NoBackendClosesConnection(t *testing.T) {
+	frontend, _ := newTestTransparentFrontend(t, "tproxy")
+	frontend.defaultBackend = nil
+
+	connection, clientSide := newTestInterceptedConn("203.0.113.50:80")
+	defer clientSide.Close()
+
+	frontend.route(connection)
+
+	clientSide.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := clientSide.Read(make([]byte, 1)); err == nil {
+		t.Error("unrouted connection didn't get closed")
+	}
+}
+
+func TestTransparentFrontend_Route_RedirectWithoutOriginalDestination(t *testing.T) {
+	frontend, mockBackends := newTestTransparentFrontend(t, "redirect")
+	for _, backend := range mockBackends {
+		backend.mockHandle = func(net.Conn) {
+			t.Error("connection without original destination got handled")
+		}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer client.Close()
+
+	connection, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("could not accept: %v", err)
+	}
+
+	// The connection didn't get redirected, so there is no original destination to read
+	frontend.route(connection)
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = client.Read(make([]byte, 1)); err == nil {
+		t.Error("connection without original destination didn't get closed")
+	}
+}
+
+func TestFindConn_UnwrapsFrontendConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer listener.Close()
+
+	connection, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer connection.Close()
+
+	wrapped := &destinationPortConn{Conn: newBufferedConn(connection, bufio.NewReader(connection))}
+	if found, ok := helper.FindConn[*net.TCPConn](wrapped); !ok || found != connection {
+		t.Error("helper.FindConn[*net.TCPConn]() didn't find wrapped tcp connection")
+	}
+
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+
+	if _, ok := helper.FindConn[*net.TCPConn](serverSide); ok {
+		t.Error("helper.FindConn[*net.TCPConn]() found tcp connection in pipe")
+	}
+}
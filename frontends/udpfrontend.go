@@ -0,0 +1,462 @@
+package frontends
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/config"
+)
+
+const udpDefaultIdleTimeout = 60 * time.Second
+const udpMaxDatagramSize = 65535
+const udpSessionQueueSize = 64
+
+type udpFrontend struct {
+	name            string
+	targetBackend   backends.PacketBackend
+	idleTimeout     time.Duration
+	accessList      *accessList
+	limiter         *connectionLimiter
+	bans            *banList
+	listenerMutex   sync.RWMutex
+	listenAddr      *net.UDPAddr
+	listener        udpListener
+	listenerFactory udpListenerFactory
+	onListening     func()
+	sessionsMutex   sync.Mutex
+	sessions        map[string]*udpSession
+}
+
+// newUDPFrontend creates a new instance of an udpFrontend, preparing it with all default dependencies.
+func newUDPFrontend(conf config.UDPFrontendConfig, backendList *backends.BackendList) (*udpFrontend, error) {
+	parsedListenAddr, err := net.ResolveUDPAddr("udp", conf.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+	}
+
+	targetBackend, ok := backendList.Get(conf.Target)
+	if !ok {
+		return nil, fmt.Errorf("target backend '%s' for frontend '%s' does not exist", conf.Target, conf.Name)
+	}
+
+	packetBackend, ok := targetBackend.(backends.PacketBackend)
+	if !ok {
+		return nil, fmt.Errorf("target backend '%s' for frontend '%s' does not support udp", conf.Target, conf.Name)
+	}
+
+	idleTimeout := conf.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = udpDefaultIdleTimeout
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	return &udpFrontend{
+		name:            conf.Name,
+		targetBackend:   packetBackend,
+		idleTimeout:     idleTimeout,
+		accessList:      newAccessList(conf.Name),
+		limiter:         limiter,
+		bans:            nil,
+		listenerMutex:   sync.RWMutex{},
+		listenAddr:      parsedListenAddr,
+		listener:        nil,
+		listenerFactory: defaultUDPListenerFactory{},
+		onListening:     func() {},
+		sessionsMutex:   sync.Mutex{},
+		sessions:        make(map[string]*udpSession),
+	}, nil
+}
+
+// GetName returns the name of the current udpFrontend instance.
+func (fe *udpFrontend) GetName() string {
+	return fe.name
+}
+
+// setOnListening registers a callback that gets called every time the udpFrontend started listening.
+func (fe *udpFrontend) setOnListening(callback func()) {
+	fe.onListening = callback
+}
+
+// Listen creates a UDP listener and starts reading datagrams. Every client address gets its own session,
+// which is handed to the target backend when the first datagram of that client arrives. Sessions are
+// closed after they were idle for the configured idle timeout.
+// Listen blocks the current thread by starting an endless loop reading datagrams.
+// Listen is resilient in that it does not stop reading datagrams just because an error happens, but waits a growing
+// delay before reading again.
+func (fe *udpFrontend) Listen() error {
+	fe.listenerMutex.Lock()
+	listener, err := fe.listenerFactory.ListenUDP("udp", fe.listenAddr)
+	fe.listener = listener
+	fe.listenerMutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("can't listen on '%s' for frontend '%s': %w", fe.listenAddr, fe.name, err)
+	}
+
+	slog.Info("udpfrontend started listening", slog.String("name", fe.name), slog.String("listenAddr", fe.listenAddr.String()))
+	fe.onListening()
+
+	reporter := acceptErrorReporter{
+		message:    "could not read datagram",
+		addr:       fe.listenAddr.String(),
+		suppressed: 0,
+		lastReport: time.Time{},
+		now:        time.Now,
+	}
+
+	readBuffer := make([]byte, udpMaxDatagramSize)
+
+	var retryDelay time.Duration
+
+	for {
+		//nolint:govet // shadowing "err" is fine
+		n, clientAddr, err := listener.ReadFromUDP(readBuffer)
+
+		if err != nil {
+			// Exit the loop if the listener doesn't exist anymore
+			fe.listenerMutex.RLock()
+			if fe.listener == nil {
+				fe.listenerMutex.RUnlock()
+				break
+			}
+			fe.listenerMutex.RUnlock()
+
+			// Like failing accepts, failing reads get logged rate limited and retried after a growing delay
+			reporter.report(err)
+
+			retryDelay = nextAcceptRetryDelay(retryDelay)
+			time.Sleep(retryDelay)
+
+			continue
+		}
+
+		retryDelay = 0
+
+		fe.dispatch(listener, clientAddr, readBuffer[:n])
+	}
+
+	return nil
+}
+
+// useInheritedFile makes the udpFrontend use given socket inherited by systemd socket activation,
+// instead of binding its own socket.
+func (fe *udpFrontend) useInheritedFile(file *os.File) {
+	fe.listenerFactory = inheritedListenerFactory{file: file}
+}
+
+// getAccessList returns the accessList deciding which clients may connect to the udpFrontend.
+func (fe *udpFrontend) getAccessList() *accessList {
+	return fe.accessList
+}
+
+// getConnectionLimiter returns the connectionLimiter limiting the connections of the udpFrontend.
+func (fe *udpFrontend) getConnectionLimiter() *connectionLimiter {
+	return fe.limiter
+}
+
+// setBanList makes the udpFrontend reject connections of sources banned by given banList, and give strikes to
+// sources misbehaving.
+func (fe *udpFrontend) setBanList(bans *banList) {
+	fe.bans = bans
+}
+
+// Close closes the listening instance if existing, and all sessions that are still active.
+func (fe *udpFrontend) Close() error {
+	fe.listenerMutex.Lock()
+	defer func() {
+		fe.listener = nil
+		fe.listenerMutex.Unlock()
+	}()
+
+	fe.sessionsMutex.Lock()
+	sessions := make([]*udpSession, 0, len(fe.sessions))
+	for _, session := range fe.sessions {
+		sessions = append(sessions, session)
+	}
+	fe.sessionsMutex.Unlock()
+
+	for _, session := range sessions {
+		session.Close()
+	}
+
+	if fe.listener == nil {
+		return nil
+	}
+
+	if err := fe.listener.Close(); err != nil {
+		return fmt.Errorf("udpfrontend could not close listener: %w", err)
+	}
+
+	return nil
+}
+
+// dispatch passes given datagram to the session of given client. If the client has no session yet,
+// a new one gets created and handed to the target backend, if the accessList allows the client, the client
+// isn't banned and the connectionLimiter has a free slot for it.
+func (fe *udpFrontend) dispatch(listener udpListener, clientAddr *net.UDPAddr, datagram []byte) {
+	sessionKey := clientAddr.String()
+
+	fe.sessionsMutex.Lock()
+	session, exists := fe.sessions[sessionKey]
+	if !exists {
+		if !fe.accessList.allows(clientAddr) {
+			fe.sessionsMutex.Unlock()
+			slog.Debug("denied datagram by access list", slog.String("name", fe.name), slog.String("clientAddr", sessionKey))
+
+			return
+		}
+
+		if fe.bans.isBanned(clientAddr) {
+			fe.sessionsMutex.Unlock()
+			slog.Debug("dropped datagram of banned source", slog.String("name", fe.name), slog.String("clientAddr", sessionKey))
+
+			return
+		}
+
+		release, ok := fe.limiter.acquire(clientAddr)
+		if !ok {
+			fe.sessionsMutex.Unlock()
+			return
+		}
+
+		session = newUDPSession(listener, clientAddr, fe.idleTimeout, func(closedSession *udpSession) {
+			release()
+
+			fe.sessionsMutex.Lock()
+			if fe.sessions[sessionKey] == closedSession {
+				delete(fe.sessions, sessionKey)
+			}
+			fe.sessionsMutex.Unlock()
+		})
+		fe.sessions[sessionKey] = session
+	}
+	fe.sessionsMutex.Unlock()
+
+	session.push(datagram)
+
+	if !exists {
+		slog.Debug("udpfrontend created session", slog.String("name", fe.name), slog.String("clientAddr", sessionKey))
+		fe.targetBackend.HandlePacket(fe.bans.watch(session))
+	}
+}
+
+// udpSession represents all datagrams exchanged with a single client as net.Conn. Every Read returns
+// exactly one datagram, and every Write sends exactly one datagram to the client.
+type udpSession struct {
+	listener      udpListener
+	clientAddr    *net.UDPAddr
+	datagrams     chan []byte
+	closed        chan struct{}
+	closeOnce     sync.Once
+	idleTimeout   time.Duration
+	idleTimer     *time.Timer
+	readDeadline  *sessionDeadline
+	writeDeadline *sessionDeadline
+	onClose       func(session *udpSession)
+}
+
+// newUDPSession creates a new udpSession for given client, that closes itself after being idle for
+// given idleTimeout. The onClose callback gets called once the session is closed.
+func newUDPSession(
+	listener udpListener,
+	clientAddr *net.UDPAddr,
+	idleTimeout time.Duration,
+	onClose func(session *udpSession),
+) *udpSession {
+	session := &udpSession{
+		listener:      listener,
+		clientAddr:    clientAddr,
+		datagrams:     make(chan []byte, udpSessionQueueSize),
+		closed:        make(chan struct{}),
+		idleTimeout:   idleTimeout,
+		readDeadline:  newSessionDeadline(),
+		writeDeadline: newSessionDeadline(),
+		onClose:       onClose,
+	}
+
+	session.idleTimer = time.AfterFunc(idleTimeout, func() {
+		slog.Debug("udp session expired", slog.String("clientAddr", clientAddr.String()))
+		session.close()
+	})
+
+	return session
+}
+
+// push queues a copy of given datagram for reading. If the queue is full, the datagram gets dropped,
+// like the kernel would do with a full socket buffer.
+func (s *udpSession) push(datagram []byte) {
+	s.idleTimer.Reset(s.idleTimeout)
+
+	select {
+	case s.datagrams <- append([]byte(nil), datagram...):
+	case <-s.closed:
+	default:
+		slog.Debug("udp session queue full, dropping datagram", slog.String("clientAddr", s.clientAddr.String()))
+	}
+}
+
+// Read reads the next datagram of the client into b. If b is too small, the datagram gets truncated.
+func (s *udpSession) Read(b []byte) (int, error) {
+	deadline := s.readDeadline.wait()
+
+	select {
+	case <-deadline:
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+
+	select {
+	case datagram := <-s.datagrams:
+		return copy(b, datagram), nil
+	case <-s.closed:
+		return 0, io.EOF
+	case <-deadline:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+// Write sends b as single datagram to the client.
+func (s *udpSession) Write(b []byte) (int, error) {
+	select {
+	case <-s.closed:
+		return 0, net.ErrClosed
+	case <-s.writeDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+
+	s.idleTimer.Reset(s.idleTimeout)
+
+	return s.listener.WriteToUDP(b, s.clientAddr)
+}
+
+// Close closes the session. The listener is shared with all other sessions, so it stays open.
+func (s *udpSession) Close() error {
+	s.idleTimer.Stop()
+	s.close()
+
+	return nil
+}
+
+// LocalAddr returns the address the frontend listens on.
+func (s *udpSession) LocalAddr() net.Addr {
+	return s.listener.LocalAddr()
+}
+
+// RemoteAddr returns the address of the client.
+func (s *udpSession) RemoteAddr() net.Addr {
+	return s.clientAddr
+}
+
+// SetDeadline sets the read and write deadlines of the session. Independent of any deadline, sessions get
+// closed after being idle for the idle timeout.
+func (s *udpSession) SetDeadline(t time.Time) error {
+	s.readDeadline.set(t)
+	s.writeDeadline.set(t)
+
+	return nil
+}
+
+// SetReadDeadline sets the time after which waiting Reads and future Reads fail with os.ErrDeadlineExceeded.
+// A zero time means Reads don't time out.
+func (s *udpSession) SetReadDeadline(t time.Time) error {
+	s.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the time after which Writes fail with os.ErrDeadlineExceeded. Datagrams are written
+// without waiting, so only Writes after the deadline fail. A zero time means Writes don't time out.
+func (s *udpSession) SetWriteDeadline(t time.Time) error {
+	s.writeDeadline.set(t)
+	return nil
+}
+
+// close marks the session as closed and calls the onClose callback, but only once.
+func (s *udpSession) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+
+		if s.onClose != nil {
+			s.onClose(s)
+		}
+	})
+}
+
+// sessionDeadline is a read or write deadline of a udpSession. Its channel gets closed once the deadline passed.
+type sessionDeadline struct {
+	mutex  sync.Mutex
+	timer  *time.Timer
+	passed chan struct{}
+}
+
+// newSessionDeadline creates a new sessionDeadline, that never passes until it gets set.
+func newSessionDeadline() *sessionDeadline {
+	return &sessionDeadline{
+		mutex:  sync.Mutex{},
+		timer:  nil,
+		passed: make(chan struct{}),
+	}
+}
+
+// set moves the deadline to given time. A zero time clears the deadline, and a time in the past lets it pass
+// right away.
+func (d *sessionDeadline) set(t time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// If the timer already fired, wait until it closed the channel, so the channel can be replaced below
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.passed
+	}
+	d.timer = nil
+
+	hasPassed := false
+	select {
+	case <-d.passed:
+		hasPassed = true
+	default:
+	}
+
+	if t.IsZero() {
+		if hasPassed {
+			d.passed = make(chan struct{})
+		}
+
+		return
+	}
+
+	if duration := time.Until(t); duration > 0 {
+		if hasPassed {
+			d.passed = make(chan struct{})
+		}
+
+		passed := d.passed
+		d.timer = time.AfterFunc(duration, func() {
+			close(passed)
+		})
+
+		return
+	}
+
+	if !hasPassed {
+		close(d.passed)
+	}
+}
+
+// wait returns a channel, that gets closed once the deadline passed.
+func (d *sessionDeadline) wait() <-chan struct{} {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.passed
+}
@@ -0,0 +1,495 @@
+package frontends
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// startTestUDPFrontend starts given frontend on a real udp listener bound to a random local port,
+// and returns the address it listens on.
+func startTestUDPFrontend(t *testing.T, frontend *udpFrontend) (*net.UDPAddr, chan error) {
+	t.Helper()
+
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("could not create udp listener: %v", err)
+	}
+
+	frontend.listenerFactory = &mockUDPListenerFactory{
+		mockListenUDP: func(_ string, _ *net.UDPAddr) (udpListener, error) {
+			return listener, nil
+		},
+	}
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- frontend.Listen()
+		close(listenDone)
+	}()
+
+	return listener.LocalAddr().(*net.UDPAddr), listenDone
+}
+
+// sessionCount returns the number of active sessions of given frontend.
+func sessionCount(frontend *udpFrontend) int {
+	frontend.sessionsMutex.Lock()
+	defer frontend.sessionsMutex.Unlock()
+
+	return len(frontend.sessions)
+}
+
+func TestUDPFrontend_GetName(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	if got := frontend.GetName(); got != "test-frontend" {
+		t.Errorf("GetName() = %q, want %q", got, "test-frontend")
+	}
+}
+
+func TestUDPFrontend_NewUDPFrontend_InvalidListenAddr(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	_, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "invalid-address",
+		Target:     "test-backend",
+	}, backendList)
+
+	if err == nil {
+		t.Fatal("expected newUDPFrontend() to fail with invalid listen address")
+	}
+}
+
+func TestUDPFrontend_NewUDPFrontend_NonExistentBackend(t *testing.T) {
+	backendList := createTestBackendList("other-backend")
+
+	_, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "non-existent-backend",
+	}, backendList)
+
+	if err == nil {
+		t.Fatal("expected newUDPFrontend() to fail with non-existent backend")
+	}
+}
+
+func TestUDPFrontend_NewUDPFrontend_DefaultIdleTimeout(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	if frontend.idleTimeout != udpDefaultIdleTimeout {
+		t.Errorf("idleTimeout = %v, want %v", frontend.idleTimeout, udpDefaultIdleTimeout)
+	}
+}
+
+func TestUDPFrontend_Listen_ListenUDPFails(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	frontend.listenerFactory = &mockUDPListenerFactory{
+		mockListenUDP: func(_ string, _ *net.UDPAddr) (udpListener, error) {
+			return nil, errors.New("failed to listen")
+		},
+	}
+
+	err = frontend.Listen()
+	if err == nil {
+		t.Fatal("expected Listen() to fail when ListenUDP fails")
+	}
+}
+
+func TestUDPFrontend_Listen_EchoesDatagramsPerSession(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	listenAddr, listenDone := startTestUDPFrontend(t, frontend)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	// Two clients with different source addresses should get two sessions
+	for _, message := range []string{"hello from client one", "hello from client two"} {
+		clientConn, err := net.DialUDP("udp", nil, listenAddr)
+		if err != nil {
+			t.Fatalf("could not dial frontend: %v", err)
+		}
+		defer clientConn.Close()
+
+		if _, err = clientConn.Write([]byte(message)); err != nil {
+			t.Fatalf("could not write datagram: %v", err)
+		}
+
+		clientConn.SetReadDeadline(time.Now().Add(time.Second))
+		readBuffer := make([]byte, 1024)
+		n, err := clientConn.Read(readBuffer)
+		if err != nil {
+			t.Fatalf("could not read echoed datagram: %v", err)
+		}
+
+		if string(readBuffer[:n]) != message {
+			t.Errorf("client received %q, want %q", string(readBuffer[:n]), message)
+		}
+	}
+
+	if got := sessionCount(frontend); got != 2 {
+		t.Errorf("session count = %d, want 2", got)
+	}
+}
+
+func TestUDPFrontend_Listen_ReusesSessionForSameClient(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	handledSessions := make(chan net.Conn, 2)
+	frontend.targetBackend = &mockPacketBackend{
+		mockHandlePacket: func(conn net.Conn) {
+			handledSessions <- conn
+		},
+	}
+
+	listenAddr, listenDone := startTestUDPFrontend(t, frontend)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, err := net.DialUDP("udp", nil, listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	clientConn.Write([]byte("first"))
+	clientConn.Write([]byte("second"))
+
+	var session net.Conn
+	select {
+	case session = <-handledSessions:
+	case <-time.After(time.Second):
+		t.Fatal("backend.HandlePacket() was not called in appropriate time")
+	}
+
+	// Both datagrams should arrive in order on the same session
+	readBuffer := make([]byte, 1024)
+	for _, want := range []string{"first", "second"} {
+		n, err := session.Read(readBuffer)
+		if err != nil {
+			t.Fatalf("session.Read() failed: %v", err)
+		}
+		if string(readBuffer[:n]) != want {
+			t.Errorf("session received %q, want %q", string(readBuffer[:n]), want)
+		}
+	}
+
+	if len(handledSessions) != 0 {
+		t.Error("HandlePacket() called more than once for the same client")
+	}
+}
+
+func TestUDPFrontend_Listen_ExpiresIdleSessions(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:        "test-frontend",
+		ListenAddr:  "127.0.0.1:8080",
+		Target:      "test-backend",
+		IdleTimeout: 50 * time.Millisecond,
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	handledSessions := make(chan net.Conn, 1)
+	frontend.targetBackend = &mockPacketBackend{
+		mockHandlePacket: func(conn net.Conn) {
+			handledSessions <- conn
+		},
+	}
+
+	listenAddr, listenDone := startTestUDPFrontend(t, frontend)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, err := net.DialUDP("udp", nil, listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	clientConn.Write([]byte("ping"))
+
+	var session net.Conn
+	select {
+	case session = <-handledSessions:
+	case <-time.After(time.Second):
+		t.Fatal("backend.HandlePacket() was not called in appropriate time")
+	}
+
+	// Drain the datagram, then wait for the session to expire
+	readBuffer := make([]byte, 1024)
+	session.Read(readBuffer)
+
+	readDone := make(chan error, 1)
+	go func() {
+		_, err := session.Read(readBuffer)
+		readDone <- err
+	}()
+
+	select {
+	case err = <-readDone:
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("Read() on expired session = %v, want io.EOF", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session did not expire in appropriate time")
+	}
+
+	if got := sessionCount(frontend); got != 0 {
+		t.Errorf("session count = %d, want 0", got)
+	}
+}
+
+func TestUDPFrontend_Close_ClosesSessionsAndExitsListenLoop(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	handledSessions := make(chan net.Conn, 1)
+	frontend.targetBackend = &mockPacketBackend{
+		mockHandlePacket: func(conn net.Conn) {
+			handledSessions <- conn
+		},
+	}
+
+	listenAddr, listenDone := startTestUDPFrontend(t, frontend)
+
+	clientConn, err := net.DialUDP("udp", nil, listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	clientConn.Write([]byte("ping"))
+
+	var session net.Conn
+	select {
+	case session = <-handledSessions:
+	case <-time.After(time.Second):
+		t.Fatal("backend.HandlePacket() was not called in appropriate time")
+	}
+
+	if err = frontend.Close(); err != nil {
+		t.Errorf("Close() returned error: %v", err)
+	}
+
+	select {
+	case <-listenDone:
+		// Success
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Listen() did not exit after Close()")
+	}
+
+	if _, err = session.Write([]byte("pong")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Write() on closed session = %v, want net.ErrClosed", err)
+	}
+
+	if got := sessionCount(frontend); got != 0 {
+		t.Errorf("session count = %d, want 0", got)
+	}
+}
+
+func TestUDPFrontend_Listen_BacksOffOnReadErrors(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	var readCount atomic.Int64
+	frontend.listenerFactory = &mockUDPListenerFactory{
+		mockListenUDP: func(_ string, _ *net.UDPAddr) (udpListener, error) {
+			return &mockUDPListener{
+				mockReadFromUDP: func(_ []byte) (int, *net.UDPAddr, error) {
+					readCount.Add(1)
+					return 0, nil, errors.New("read failed")
+				},
+			}, nil
+		},
+	}
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- frontend.Listen()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	frontend.Close()
+
+	select {
+	case <-listenDone:
+	case <-time.After(2 * maxAcceptRetryDelay):
+		t.Fatal("Listen() did not exit after Close()")
+	}
+
+	// With delays of 5ms, 10ms, 20ms, 40ms, ... only a handful of attempts fit into 100ms
+	if count := readCount.Load(); count > 10 {
+		t.Errorf("ReadFromUDP() called %d times, want backoff between attempts", count)
+	}
+}
+
+func TestUDPFrontend_Close_NoListener(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	if err = frontend.Close(); err != nil {
+		t.Errorf("Close() with no listener should return nil, got: %v", err)
+	}
+}
+
+func TestUDPFrontend_Listen_DropsDeniedDatagrams(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUDPFrontend(config.UDPFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUDPFrontend() failed: %v", err)
+	}
+
+	denyRules, _ := newAccessRules(config.AccessListConfig{Deny: []string{"127.0.0.0/8"}})
+	frontend.accessList.set(denyRules, &accessRules{})
+
+	listenAddr, listenDone := startTestUDPFrontend(t, frontend)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	clientConn, err := net.DialUDP("udp", nil, listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer clientConn.Close()
+
+	if _, err = clientConn.Write([]byte("hello")); err != nil {
+		t.Fatalf("could not write datagram: %v", err)
+	}
+
+	clientConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err = clientConn.Read(make([]byte, 1024)); err == nil {
+		t.Error("denied client received an answer")
+	}
+
+	if got := sessionCount(frontend); got != 0 {
+		t.Errorf("session count = %d, want 0", got)
+	}
+}
+
+func TestUDPSession_Deadlines(t *testing.T) {
+	session := newUDPSession(&mockUDPListener{}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}, time.Minute, nil)
+	defer session.Close()
+
+	readDone := make(chan error, 1)
+	go func() {
+		_, err := session.Read(make([]byte, 16))
+		readDone <- err
+	}()
+
+	session.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+
+	select {
+	case err := <-readDone:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("Read() = %v, want os.ErrDeadlineExceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read() did not return after its deadline passed")
+	}
+
+	session.SetDeadline(time.Time{})
+	session.push([]byte("ping"))
+
+	if n, err := session.Read(make([]byte, 16)); err != nil || n != 4 {
+		t.Errorf("Read() after clearing the deadline = %d, %v, want 4, nil", n, err)
+	}
+
+	session.SetWriteDeadline(time.Now().Add(-time.Second))
+
+	if _, err := session.Write([]byte("pong")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write() after deadline = %v, want os.ErrDeadlineExceeded", err)
+	}
+}
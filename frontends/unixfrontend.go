@@ -0,0 +1,286 @@
+package frontends
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/config"
+)
+
+const unixStaleSocketDialTimeout = time.Second
+
+type unixFrontend struct {
+	name            string
+	targetBackend   backends.Backend
+	socketPath      string
+	socketMode      os.FileMode
+	socketUID       int
+	socketGID       int
+	socketInherited bool
+	limiter         *connectionLimiter
+	reserve         *fdReserve
+	listenerMutex   sync.RWMutex
+	listener        streamListener
+	listenerFactory unixListenerFactory
+	onListening     func()
+}
+
+// newUnixFrontend creates a new instance of an unixFrontend, preparing it with all default dependencies.
+func newUnixFrontend(conf config.UnixFrontendConfig, backendList *backends.BackendList) (*unixFrontend, error) {
+	if conf.SocketPath == "" {
+		return nil, fmt.Errorf("socketPath of frontend '%s' is empty", conf.Name)
+	}
+
+	var socketMode os.FileMode
+	if conf.SocketMode != "" {
+		parsedMode, err := strconv.ParseUint(conf.SocketMode, 8, 32)
+		if err != nil || parsedMode > uint64(os.ModePerm) {
+			return nil, fmt.Errorf("could not parse socketMode '%s' of frontend '%s' as octal file mode", conf.SocketMode, conf.Name)
+		}
+
+		socketMode = os.FileMode(parsedMode)
+	}
+
+	socketUID, err := lookupID(conf.SocketOwner, func(name string) (string, error) {
+		u, lookupErr := user.Lookup(name)
+		if lookupErr != nil {
+			return "", lookupErr
+		}
+		return u.Uid, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve socketOwner '%s' of frontend '%s': %w", conf.SocketOwner, conf.Name, err)
+	}
+
+	socketGID, err := lookupID(conf.SocketGroup, func(name string) (string, error) {
+		g, lookupErr := user.LookupGroup(name)
+		if lookupErr != nil {
+			return "", lookupErr
+		}
+		return g.Gid, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve socketGroup '%s' of frontend '%s': %w", conf.SocketGroup, conf.Name, err)
+	}
+
+	targetBackend, ok := backendList.Get(conf.Target)
+	if !ok {
+		return nil, fmt.Errorf("target backend '%s' for frontend '%s' does not exist", conf.Target, conf.Name)
+	}
+
+	// Clients of unix sockets have no address, so there are no sources to limit
+	if conf.SourceConnectionRate != 0 || conf.SourceConnectionBurst != 0 || conf.SourceMaxConnections != 0 {
+		return nil, fmt.Errorf("frontend '%s' does not support limits per source", conf.Name)
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	return &unixFrontend{
+		name:            conf.Name,
+		targetBackend:   targetBackend,
+		socketPath:      conf.SocketPath,
+		socketMode:      socketMode,
+		socketUID:       socketUID,
+		socketGID:       socketGID,
+		socketInherited: false,
+		limiter:         limiter,
+		reserve:         nil,
+		listenerMutex:   sync.RWMutex{},
+		listener:        nil,
+		listenerFactory: defaultUnixListenerFactory{},
+		onListening:     func() {},
+	}, nil
+}
+
+// GetName returns the name of the current unixFrontend instance.
+func (fe *unixFrontend) GetName() string {
+	return fe.name
+}
+
+// setOnListening registers a callback that gets called every time the unixFrontend started listening.
+func (fe *unixFrontend) setOnListening(callback func()) {
+	fe.onListening = callback
+}
+
+// Listen removes a stale socket left behind by a previous run, creates a unix socket listener with the configured
+// permissions, and starts accepting connections.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen is resilient in that it does not stop accepting connections just because an error happens.
+func (fe *unixFrontend) Listen() error {
+	fe.listenerMutex.Lock()
+	listener, err := fe.createListener()
+	fe.listener = listener
+	fe.listenerMutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("can't listen on '%s' for frontend '%s': %w", fe.socketPath, fe.name, err)
+	}
+
+	slog.Info("unixfrontend started listening", slog.String("name", fe.name), slog.String("socketPath", fe.socketPath))
+	fe.onListening()
+
+	acceptConnections(listener, fe.isClosed, fe.reserve, fe.targetBackend.Handle, fe.limiter.frontendLimits(), frontendNameGate(fe.name))
+
+	return nil
+}
+
+// useInheritedFile makes the unixFrontend use given socket inherited by systemd socket activation,
+// instead of binding its own socket. The socket file is owned by systemd then, so the unixFrontend neither
+// applies permissions to it nor removes it.
+func (fe *unixFrontend) useInheritedFile(file *os.File) {
+	fe.listenerFactory = inheritedListenerFactory{file: file}
+	fe.socketInherited = true
+}
+
+// getConnectionLimiter returns the connectionLimiter limiting the connections of the unixFrontend.
+func (fe *unixFrontend) getConnectionLimiter() *connectionLimiter {
+	return fe.limiter
+}
+
+// setFDReserve makes the unixFrontend shed pending connections using given fdReserve, if the process runs out of
+// file descriptors.
+func (fe *unixFrontend) setFDReserve(reserve *fdReserve) {
+	fe.reserve = reserve
+}
+
+// isClosed reports whether the listener got closed, or never was created.
+func (fe *unixFrontend) isClosed() bool {
+	fe.listenerMutex.RLock()
+	defer fe.listenerMutex.RUnlock()
+
+	return fe.listener == nil
+}
+
+// Close closes the listening instance if existing and removes the socket file.
+func (fe *unixFrontend) Close() error {
+	fe.listenerMutex.Lock()
+	defer func() {
+		fe.listener = nil
+		fe.listenerMutex.Unlock()
+	}()
+
+	if fe.listener == nil {
+		return nil
+	}
+
+	if err := fe.listener.Close(); err != nil {
+		return fmt.Errorf("unixfrontend could not close listener: %w", err)
+	}
+
+	if fe.socketInherited {
+		return nil
+	}
+
+	if err := os.Remove(fe.socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unixfrontend could not remove socket '%s': %w", fe.socketPath, err)
+	}
+
+	return nil
+}
+
+// createListener creates the unix socket listener and applies the configured mode and ownership to the socket file.
+func (fe *unixFrontend) createListener() (streamListener, error) {
+	if fe.socketInherited {
+		return fe.listenerFactory.ListenUnix("unix", &net.UnixAddr{Name: fe.socketPath, Net: "unix"})
+	}
+
+	if err := removeStaleSocket(fe.socketPath); err != nil {
+		return nil, err
+	}
+
+	listener, err := fe.listenerFactory.ListenUnix("unix", &net.UnixAddr{Name: fe.socketPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = fe.applySocketPermissions(); err != nil {
+		if closeErr := listener.Close(); closeErr != nil {
+			slog.Warn("could not close listener after failing to apply permissions", slog.Any("error", closeErr))
+		}
+
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// applySocketPermissions applies the configured mode and ownership to the socket file, if configured.
+func (fe *unixFrontend) applySocketPermissions() error {
+	if fe.socketMode != 0 {
+		if err := os.Chmod(fe.socketPath, fe.socketMode); err != nil {
+			return fmt.Errorf("could not change mode of socket: %w", err)
+		}
+	}
+
+	if fe.socketUID != -1 || fe.socketGID != -1 {
+		if err := os.Chown(fe.socketPath, fe.socketUID, fe.socketGID); err != nil {
+			return fmt.Errorf("could not change owner of socket: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// removeStaleSocket removes the socket at given path, if it was left behind by a process that isn't running anymore.
+// If the path exists but isn't a socket, or another process is still accepting connections on it, an error
+// gets returned instead.
+func removeStaleSocket(socketPath string) error {
+	fileInfo, err := os.Lstat(socketPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not check for stale socket: %w", err)
+	}
+
+	if fileInfo.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("'%s' already exists and is not a socket", socketPath)
+	}
+
+	connection, err := net.DialTimeout("unix", socketPath, unixStaleSocketDialTimeout)
+	if err == nil {
+		if closeErr := connection.Close(); closeErr != nil {
+			slog.Warn("could not close connection to existing socket", slog.Any("error", closeErr))
+		}
+
+		return fmt.Errorf("socket '%s' is still in use by another process", socketPath)
+	}
+
+	slog.Info("removing stale socket", slog.String("socketPath", socketPath))
+
+	if err = os.Remove(socketPath); err != nil {
+		return fmt.Errorf("could not remove stale socket: %w", err)
+	}
+
+	return nil
+}
+
+// lookupID resolves given user or group to its numeric id. Numeric values are used as they are, names get
+// resolved using given lookup function. An empty value resolves to -1, which leaves the id unchanged on chown.
+func lookupID(nameOrID string, lookup func(name string) (string, error)) (int, error) {
+	if nameOrID == "" {
+		return -1, nil
+	}
+
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return id, nil
+	}
+
+	resolvedID, err := lookup(nameOrID)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(resolvedID)
+}
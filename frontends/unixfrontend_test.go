@@ -0,0 +1,427 @@
+package frontends
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// waitForSocket waits until a socket file exists at given path, or fails the test.
+func waitForSocket(t *testing.T, socketPath string) {
+	t.Helper()
+
+	for range 100 {
+		if fileInfo, err := os.Lstat(socketPath); err == nil && fileInfo.Mode()&os.ModeSocket != 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("socket '%s' was not created in appropriate time", socketPath)
+}
+
+func TestUnixFrontend_GetName(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUnixFrontend(config.UnixFrontendConfig{
+		Name:       "test-frontend",
+		SocketPath: filepath.Join(t.TempDir(), "pluggo.sock"),
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUnixFrontend() failed: %v", err)
+	}
+
+	if got := frontend.GetName(); got != "test-frontend" {
+		t.Errorf("GetName() = %q, want %q", got, "test-frontend")
+	}
+}
+
+func TestUnixFrontend_NewUnixFrontend_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	testCases := map[string]config.UnixFrontendConfig{
+		"empty socket path": {
+			Name:   "test-frontend",
+			Target: "test-backend",
+		},
+		"invalid socket mode": {
+			Name:       "test-frontend",
+			SocketPath: "/tmp/pluggo.sock",
+			SocketMode: "rwx",
+			Target:     "test-backend",
+		},
+		"socket mode out of range": {
+			Name:       "test-frontend",
+			SocketPath: "/tmp/pluggo.sock",
+			SocketMode: "17777",
+			Target:     "test-backend",
+		},
+		"unknown socket owner": {
+			Name:        "test-frontend",
+			SocketPath:  "/tmp/pluggo.sock",
+			SocketOwner: "pluggo-user-that-does-not-exist",
+			Target:      "test-backend",
+		},
+		"non-existent backend": {
+			Name:       "test-frontend",
+			SocketPath: "/tmp/pluggo.sock",
+			Target:     "non-existent-backend",
+		},
+		"limits per source": {
+			Name:                   "test-frontend",
+			SocketPath:             "/tmp/pluggo.sock",
+			Target:                 "test-backend",
+			ConnectionLimitsConfig: config.ConnectionLimitsConfig{SourceMaxConnections: 1},
+		},
+		"negative limits": {
+			Name:                   "test-frontend",
+			SocketPath:             "/tmp/pluggo.sock",
+			Target:                 "test-backend",
+			ConnectionLimitsConfig: config.ConnectionLimitsConfig{MaxConnections: -1},
+		},
+	}
+
+	for name, conf := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newUnixFrontend(conf, backendList); err == nil {
+				t.Error("expected newUnixFrontend() to fail")
+			}
+		})
+	}
+}
+
+func TestUnixFrontend_Listen_AcceptsConnectionsWithSocketMode(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "pluggo.sock")
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUnixFrontend(config.UnixFrontendConfig{
+		Name:       "test-frontend",
+		SocketPath: socketPath,
+		SocketMode: "0600",
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUnixFrontend() failed: %v", err)
+	}
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- frontend.Listen()
+		close(listenDone)
+	}()
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	waitForSocket(t, socketPath)
+
+	fileInfo, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("could not stat socket: %v", err)
+	}
+	if fileInfo.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %o, want %o", fileInfo.Mode().Perm(), 0o600)
+	}
+
+	clientConn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("could not dial socket: %v", err)
+	}
+	defer clientConn.Close()
+
+	testData := []byte("hello unix")
+	if _, err = clientConn.Write(testData); err != nil {
+		t.Fatalf("could not write to socket: %v", err)
+	}
+
+	readBuffer := make([]byte, len(testData))
+	if _, err = io.ReadFull(clientConn, readBuffer); err != nil {
+		t.Fatalf("could not read echoed data: %v", err)
+	}
+
+	if string(readBuffer) != string(testData) {
+		t.Errorf("client received %q, want %q", string(readBuffer), string(testData))
+	}
+}
+
+func TestUnixFrontend_Listen_ClosesConnectionsOverLimit(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "pluggo.sock")
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUnixFrontend(config.UnixFrontendConfig{
+		Name:                   "test-frontend",
+		SocketPath:             socketPath,
+		Target:                 "test-backend",
+		ConnectionLimitsConfig: config.ConnectionLimitsConfig{MaxConnections: 1},
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUnixFrontend() failed: %v", err)
+	}
+
+	// The global cap applies to unix sockets as well
+	globalLimit, err := newGlobalConnectionLimit(config.GlobalLimitsConfig{MaxConnections: 1})
+	if err != nil {
+		t.Fatalf("newGlobalConnectionLimit() failed: %v", err)
+	}
+	frontend.limiter.setGlobalLimit(globalLimit)
+
+	handledConns := make(chan net.Conn, 2)
+	frontend.targetBackend = &mockBackend{
+		mockHandle: func(conn net.Conn) {
+			handledConns <- conn
+		},
+	}
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- frontend.Listen()
+		close(listenDone)
+	}()
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	waitForSocket(t, socketPath)
+
+	firstConn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("could not dial socket: %v", err)
+	}
+	defer firstConn.Close()
+
+	select {
+	case conn := <-handledConns:
+		defer conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("backend.Handle() did not get called for first connection")
+	}
+
+	if globalLimit.acquire() {
+		globalLimit.release()
+		t.Error("global cap doesn't count the unix connection")
+	}
+
+	secondConn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("could not dial socket: %v", err)
+	}
+	defer secondConn.Close()
+
+	secondConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = secondConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF for connection over limit, got: %v", err)
+	}
+}
+
+func TestUnixFrontend_Listen_RemovesStaleSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "pluggo.sock")
+
+	// Leave a socket file behind without anybody listening on it
+	staleListener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		t.Fatalf("could not create stale socket: %v", err)
+	}
+	staleListener.SetUnlinkOnClose(false)
+	staleListener.Close()
+
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUnixFrontend(config.UnixFrontendConfig{
+		Name:       "test-frontend",
+		SocketPath: socketPath,
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUnixFrontend() failed: %v", err)
+	}
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- frontend.Listen()
+		close(listenDone)
+	}()
+
+	// Listen should come up and accept connections on the same path
+	var clientConn net.Conn
+	for range 100 {
+		clientConn, err = net.Dial("unix", socketPath)
+		if err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("could not dial socket after stale socket cleanup: %v", err)
+	}
+	clientConn.Close()
+
+	frontend.Close()
+
+	if err = <-listenDone; err != nil {
+		t.Errorf("Listen() returned error: %v", err)
+	}
+}
+
+func TestUnixFrontend_Listen_SocketInUse(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "pluggo.sock")
+
+	activeListener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("could not create active socket: %v", err)
+	}
+	defer activeListener.Close()
+
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUnixFrontend(config.UnixFrontendConfig{
+		Name:       "test-frontend",
+		SocketPath: socketPath,
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUnixFrontend() failed: %v", err)
+	}
+
+	if err = frontend.Listen(); err == nil {
+		t.Fatal("expected Listen() to fail when the socket is used by another listener")
+	}
+
+	if _, err = os.Lstat(socketPath); err != nil {
+		t.Errorf("socket of other listener got removed: %v", err)
+	}
+}
+
+func TestUnixFrontend_Listen_PathIsNoSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "pluggo.sock")
+	if err := os.WriteFile(socketPath, []byte("no socket"), 0o600); err != nil {
+		t.Fatalf("could not create file: %v", err)
+	}
+
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUnixFrontend(config.UnixFrontendConfig{
+		Name:       "test-frontend",
+		SocketPath: socketPath,
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUnixFrontend() failed: %v", err)
+	}
+
+	if err = frontend.Listen(); err == nil {
+		t.Fatal("expected Listen() to fail when the path is a regular file")
+	}
+
+	if _, err = os.Stat(socketPath); err != nil {
+		t.Errorf("regular file got removed: %v", err)
+	}
+}
+
+func TestUnixFrontend_Listen_ListenUnixFails(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUnixFrontend(config.UnixFrontendConfig{
+		Name:       "test-frontend",
+		SocketPath: filepath.Join(t.TempDir(), "pluggo.sock"),
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUnixFrontend() failed: %v", err)
+	}
+
+	frontend.listenerFactory = &mockUnixListenerFactory{
+		mockListenUnix: func(_ string, _ *net.UnixAddr) (streamListener, error) {
+			return nil, errors.New("failed to listen")
+		},
+	}
+
+	if err = frontend.Listen(); err == nil {
+		t.Fatal("expected Listen() to fail when ListenUnix fails")
+	}
+}
+
+func TestUnixFrontend_Close_RemovesSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "pluggo.sock")
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUnixFrontend(config.UnixFrontendConfig{
+		Name:       "test-frontend",
+		SocketPath: socketPath,
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUnixFrontend() failed: %v", err)
+	}
+
+	listenDone := make(chan error, 1)
+	go func() {
+		listenDone <- frontend.Listen()
+		close(listenDone)
+	}()
+
+	waitForSocket(t, socketPath)
+
+	if err = frontend.Close(); err != nil {
+		t.Errorf("Close() returned error: %v", err)
+	}
+
+	select {
+	case <-listenDone:
+		// Success
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Listen() did not exit after Close()")
+	}
+
+	if _, err = os.Lstat(socketPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket still exists after Close(): %v", err)
+	}
+}
+
+func TestUnixFrontend_Close_NoListener(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newUnixFrontend(config.UnixFrontendConfig{
+		Name:       "test-frontend",
+		SocketPath: filepath.Join(t.TempDir(), "pluggo.sock"),
+		Target:     "test-backend",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newUnixFrontend() failed: %v", err)
+	}
+
+	if err = frontend.Close(); err != nil {
+		t.Errorf("Close() with no listener should return nil, got: %v", err)
+	}
+}
+
+func TestLookupID(t *testing.T) {
+	failingLookup := func(_ string) (string, error) {
+		return "", errors.New("unknown name")
+	}
+
+	if id, err := lookupID("", failingLookup); err != nil || id != -1 {
+		t.Errorf("lookupID(\"\") = %d, %v, want -1, nil", id, err)
+	}
+
+	if id, err := lookupID("1000", failingLookup); err != nil || id != 1000 {
+		t.Errorf("lookupID(\"1000\") = %d, %v, want 1000, nil", id, err)
+	}
+
+	if _, err := lookupID("somebody", failingLookup); err == nil {
+		t.Error("expected lookupID() to fail when the lookup fails")
+	}
+
+	id, err := lookupID("somebody", func(_ string) (string, error) { return "42", nil })
+	if err != nil || id != 42 {
+		t.Errorf("lookupID(\"somebody\") = %d, %v, want 42, nil", id, err)
+	}
+}
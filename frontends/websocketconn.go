@@ -0,0 +1,369 @@
+package frontends
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebSocket frame opcodes, as defined by RFC 6455.
+const (
+	webSocketOpcodeContinuation = 0x0
+	webSocketOpcodeText         = 0x1
+	webSocketOpcodeBinary       = 0x2
+	webSocketOpcodeClose        = 0x8
+	webSocketOpcodePing         = 0x9
+	webSocketOpcodePong         = 0xa
+)
+
+// WebSocket close status codes, as defined by RFC 6455.
+const (
+	webSocketCloseNormal          = 1000
+	webSocketCloseProtocolError   = 1002
+	webSocketCloseUnsupportedData = 1003
+)
+
+const (
+	webSocketFinalBit     = 0x80
+	webSocketReservedBits = 0x70
+	webSocketOpcodeBits   = 0x0f
+	webSocketMaskBit      = 0x80
+	webSocketLengthBits   = 0x7f
+	webSocketLength16     = 126
+	webSocketLength64     = 127
+	// webSocketMaxShortPayload is the longest payload whose length fits into the first length byte, which
+	// is also the longest payload control frames may have.
+	webSocketMaxShortPayload = 125
+	webSocketMaxHeaderLength = 10
+	webSocketCloseTimeout    = time.Second
+)
+
+// webSocketConn is a net.Conn carrying a byte stream in the binary frames of an upgraded WebSocket connection.
+// Reading returns the unmasked payload of the binary frames sent by the client, while pings get answered and
+// close frames end the stream. Every write gets sent as single binary frame.
+// As long as the webSocketConn is open, it pings the client every pingInterval, and closes the connection if
+// the client didn't send anything since the previous ping.
+type webSocketConn struct {
+	net.Conn
+
+	reader     *bufio.Reader
+	remaining  uint64
+	maskKey    [4]byte
+	maskOffset int
+	inMessage  bool
+	readErr    error
+	reading    atomic.Bool
+	alive      atomic.Bool
+	writeMutex sync.Mutex
+	closeSent  bool
+	closeOnce  sync.Once
+	closed     chan struct{}
+}
+
+// newWebSocketConn creates a new webSocketConn for given upgraded connection, reading through given reader, and
+// starts pinging the client every pingInterval. The reader must read from given connection, and must not contain
+// any handshake data anymore.
+func newWebSocketConn(connection net.Conn, reader *bufio.Reader, pingInterval time.Duration) *webSocketConn {
+	webSocketConnection := &webSocketConn{
+		Conn:       connection,
+		reader:     reader,
+		remaining:  0,
+		maskKey:    [4]byte{},
+		maskOffset: 0,
+		inMessage:  false,
+		readErr:    nil,
+		reading:    atomic.Bool{},
+		alive:      atomic.Bool{},
+		writeMutex: sync.Mutex{},
+		closeSent:  false,
+		closeOnce:  sync.Once{},
+		closed:     make(chan struct{}),
+	}
+	webSocketConnection.alive.Store(true)
+
+	go webSocketConnection.keepAlive(pingInterval)
+
+	return webSocketConnection
+}
+
+// Read reads the payload of the binary frames sent by the client. Control frames get handled on the way, and
+// a close frame of the client ends the stream with io.EOF. Text frames aren't supported, and fail the connection.
+func (c *webSocketConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	c.reading.Store(true)
+	defer c.reading.Store(false)
+
+	for c.remaining == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+
+		c.readErr = c.nextFrame()
+	}
+
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+
+	n, err := c.reader.Read(b)
+	c.unmask(b[:n])
+	c.remaining -= uint64(n)
+
+	if n > 0 {
+		c.alive.Store(true)
+	}
+
+	if errors.Is(err, io.EOF) {
+		// The connection ended within a frame
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// Write sends given data as single binary frame.
+func (c *webSocketConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(webSocketOpcodeBinary, b); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// Close sends a close frame to the client, if none was sent yet, and closes the underlying connection. Closing
+// a webSocketConn again does nothing.
+func (c *webSocketConn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.closed)
+
+		// The deadline unblocks pending writes, and keeps a client not reading from delaying the close
+		if deadlineErr := c.Conn.SetWriteDeadline(time.Now().Add(webSocketCloseTimeout)); deadlineErr == nil {
+			c.sendClose(binary.BigEndian.AppendUint16(nil, webSocketCloseNormal))
+		}
+
+		err = c.Conn.Close()
+	})
+
+	return err
+}
+
+// NetConn returns the underlying connection.
+func (c *webSocketConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// nextFrame reads the header of the next frame. For data frames the payload is left to be read, while control
+// frames get read and handled completely. Protocol errors get reported to the client with a close frame.
+func (c *webSocketConn) nextFrame() error {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return err
+	}
+
+	c.alive.Store(true)
+
+	final := header[0]&webSocketFinalBit != 0
+	opcode := header[0] & webSocketOpcodeBits
+
+	if header[0]&webSocketReservedBits != 0 {
+		return c.fail(webSocketCloseProtocolError, errors.New("frame uses reserved bits"))
+	}
+
+	// Clients have to mask all their frames
+	if header[1]&webSocketMaskBit == 0 {
+		return c.fail(webSocketCloseProtocolError, errors.New("frame of client is not masked"))
+	}
+
+	length, err := c.readPayloadLength(header[1] & webSocketLengthBits)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.ReadFull(c.reader, c.maskKey[:]); err != nil {
+		return err
+	}
+
+	c.maskOffset = 0
+
+	switch opcode {
+	case webSocketOpcodeBinary:
+		if c.inMessage {
+			return c.fail(webSocketCloseProtocolError, errors.New("new message started before previous message ended"))
+		}
+
+		c.inMessage = !final
+		c.remaining = length
+	case webSocketOpcodeContinuation:
+		if !c.inMessage {
+			return c.fail(webSocketCloseProtocolError, errors.New("continuation frame without message"))
+		}
+
+		c.inMessage = !final
+		c.remaining = length
+	case webSocketOpcodeText:
+		return c.fail(webSocketCloseUnsupportedData, errors.New("text frames are not supported"))
+	case webSocketOpcodeClose, webSocketOpcodePing, webSocketOpcodePong:
+		return c.handleControlFrame(opcode, final, length)
+	default:
+		return c.fail(webSocketCloseProtocolError, fmt.Errorf("unknown opcode %#x", opcode))
+	}
+
+	return nil
+}
+
+// readPayloadLength reads the payload length of the current frame, based on given length of the frame header.
+func (c *webSocketConn) readPayloadLength(length byte) (uint64, error) {
+	switch length {
+	case webSocketLength16:
+		var extendedLength [2]byte
+		if _, err := io.ReadFull(c.reader, extendedLength[:]); err != nil {
+			return 0, err
+		}
+
+		return uint64(binary.BigEndian.Uint16(extendedLength[:])), nil
+	case webSocketLength64:
+		var extendedLength [8]byte
+		if _, err := io.ReadFull(c.reader, extendedLength[:]); err != nil {
+			return 0, err
+		}
+
+		extended := binary.BigEndian.Uint64(extendedLength[:])
+		if extended > math.MaxInt64 {
+			return 0, c.fail(webSocketCloseProtocolError, errors.New("payload length uses most significant bit"))
+		}
+
+		return extended, nil
+	default:
+		return uint64(length), nil
+	}
+}
+
+// handleControlFrame reads the payload of the current control frame, and answers pings with pongs and close frames
+// with close frames. After a close frame io.EOF is returned, as the client won't send any more data.
+func (c *webSocketConn) handleControlFrame(opcode byte, final bool, length uint64) error {
+	if !final || length > webSocketMaxShortPayload {
+		return c.fail(webSocketCloseProtocolError, errors.New("control frame is fragmented or too long"))
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+
+	c.unmask(payload)
+
+	switch opcode {
+	case webSocketOpcodePing:
+		return c.writeFrame(webSocketOpcodePong, payload)
+	case webSocketOpcodeClose:
+		// Echo the status code of the client, which makes up the first two bytes of the payload
+		c.sendClose(payload[:min(len(payload), 2)]) //nolint:mnd // status codes are two bytes long
+
+		return io.EOF
+	default:
+		// Pongs only show that the client is alive, which nextFrame already noted
+		return nil
+	}
+}
+
+// fail sends a close frame with given status code to the client, and returns given error.
+func (c *webSocketConn) fail(status uint16, err error) error {
+	c.sendClose(binary.BigEndian.AppendUint16(nil, status))
+
+	return fmt.Errorf("websocket protocol error: %w", err)
+}
+
+// sendClose sends a close frame with given payload to the client, if none was sent yet. Afterwards no more
+// frames get sent.
+func (c *webSocketConn) sendClose(payload []byte) {
+	if err := c.writeFrame(webSocketOpcodeClose, payload); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Debug("could not send websocket close frame", slog.Any("error", err))
+	}
+}
+
+// writeFrame sends given payload as single unmasked frame with given opcode. Once a close frame got sent,
+// net.ErrClosed is returned.
+func (c *webSocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.closeSent {
+		return net.ErrClosed
+	}
+
+	if opcode == webSocketOpcodeClose {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, webSocketMaxHeaderLength+len(payload))
+	frame = append(frame, webSocketFinalBit|opcode)
+
+	switch {
+	case len(payload) <= webSocketMaxShortPayload:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= math.MaxUint16:
+		frame = append(frame, webSocketLength16)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, webSocketLength64)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+
+	frame = append(frame, payload...)
+
+	if _, err := c.Conn.Write(frame); err != nil {
+		return fmt.Errorf("could not write websocket frame: %w", err)
+	}
+
+	return nil
+}
+
+// unmask unmasks given payload of the current frame, continuing where the previous call stopped.
+func (c *webSocketConn) unmask(payload []byte) {
+	for i := range payload {
+		payload[i] ^= c.maskKey[c.maskOffset]
+		c.maskOffset = (c.maskOffset + 1) % len(c.maskKey)
+	}
+}
+
+// keepAlive pings the client every given interval, until the webSocketConn gets closed. If the client didn't
+// send anything since the previous ping, the connection gets closed.
+func (c *webSocketConn) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+
+		// The pong can only be seen while someone reads, so backends that don't read yet, like a WoL forwarder
+		// waiting for its target, don't get their connections closed
+		if !c.alive.Swap(false) && c.reading.Load() {
+			slog.Debug("websocket client didn't answer ping, closing connection", slog.String("remoteAddr", c.RemoteAddr().String()))
+			closeUnroutedConnection(c)
+
+			return
+		}
+
+		if err := c.writeFrame(webSocketOpcodePing, nil); err != nil {
+			slog.Debug("could not send websocket ping", slog.Any("error", err))
+			return
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package frontends
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestWebSocketConnPair returns a webSocketConn with given ping interval, and the client side of its
+// connection.
+func newTestWebSocketConnPair(t *testing.T, pingInterval time.Duration) (*webSocketConn, net.Conn) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	serverSide, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("could not accept: %v", err)
+	}
+
+	connection := newWebSocketConn(serverSide, bufio.NewReader(serverSide), pingInterval)
+	t.Cleanup(func() { connection.Close() })
+
+	return connection, client
+}
+
+// writeTestWebSocketFrame writes a masked client frame with given first header byte and payload to given writer.
+func writeTestWebSocketFrame(t *testing.T, writer io.Writer, firstByte byte, payload []byte) {
+	t.Helper()
+
+	maskKey := [4]byte{0x12, 0x34, 0x56, 0x78}
+
+	frame := []byte{firstByte}
+	switch {
+	case len(payload) <= webSocketMaxShortPayload:
+		frame = append(frame, webSocketMaskBit|byte(len(payload)))
+	default:
+		frame = append(frame, webSocketMaskBit|webSocketLength16)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+
+	frame = append(frame, maskKey[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^maskKey[i%len(maskKey)])
+	}
+
+	if _, err := writer.Write(frame); err != nil {
+		t.Fatalf("could not write frame: %v", err)
+	}
+}
+
+// readTestWebSocketFrame reads an unmasked server frame from given reader, and returns its opcode and payload.
+func readTestWebSocketFrame(t *testing.T, reader io.Reader) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatalf("could not read frame header: %v", err)
+	}
+
+	if header[0]&webSocketFinalBit == 0 || header[1]&webSocketMaskBit != 0 {
+		t.Fatalf("unexpected frame header %#x", header)
+	}
+
+	length := uint64(header[1] & webSocketLengthBits)
+	switch length {
+	case webSocketLength16:
+		var extendedLength [2]byte
+		io.ReadFull(reader, extendedLength[:])
+		length = uint64(binary.BigEndian.Uint16(extendedLength[:]))
+	case webSocketLength64:
+		var extendedLength [8]byte
+		io.ReadFull(reader, extendedLength[:])
+		length = binary.BigEndian.Uint64(extendedLength[:])
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("could not read frame payload: %v", err)
+	}
+
+	return header[0] & webSocketOpcodeBits, payload
+}
+
+func TestWebSocketConn_Read_BinaryFramesAsStream(t *testing.T) {
+	connection, client := newTestWebSocketConnPair(t, time.Hour)
+
+	// A fragmented message with a ping in between, followed by an empty and a long message
+	writeTestWebSocketFrame(t, client, webSocketOpcodeBinary, []byte("hello "))
+	writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodePing, []byte("ping"))
+	writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodeContinuation, []byte("world"))
+	writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodeBinary, nil)
+	writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodeBinary, bytes.Repeat([]byte("x"), 300))
+
+	want := "hello world" + string(bytes.Repeat([]byte("x"), 300))
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(connection, got); err != nil {
+		t.Fatalf("could not read stream: %v", err)
+	}
+
+	if string(got) != want {
+		t.Errorf("read %q, want %q", got, want)
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if opcode, payload := readTestWebSocketFrame(t, client); opcode != webSocketOpcodePong || string(payload) != "ping" {
+		t.Errorf("got frame %#x with payload %q, want pong with payload %q", opcode, payload, "ping")
+	}
+}
+
+func TestWebSocketConn_Read_CloseFrameEndsStream(t *testing.T) {
+	connection, client := newTestWebSocketConnPair(t, time.Hour)
+
+	writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodeClose, []byte{0x03, 0xe9, 'b', 'y', 'e'})
+
+	if _, err := connection.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if opcode, payload := readTestWebSocketFrame(t, client); opcode != webSocketOpcodeClose || !bytes.Equal(payload, []byte{0x03, 0xe9}) {
+		t.Errorf("got frame %#x with payload %#x, want close with status 1001", opcode, payload)
+	}
+
+	if _, err := connection.Write([]byte("late")); err == nil {
+		t.Error("Write() after close frame succeeded")
+	}
+}
+
+func TestWebSocketConn_Read_ProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		write      func(t *testing.T, client net.Conn)
+		wantStatus uint16
+	}{
+		{
+			name: "unmasked frame",
+			write: func(_ *testing.T, client net.Conn) {
+				client.Write([]byte{webSocketFinalBit | webSocketOpcodeBinary, 0x01, 'a'})
+			},
+			wantStatus: webSocketCloseProtocolError,
+		},
+		{
+			name: "text frame",
+			write: func(t *testing.T, client net.Conn) {
+				writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodeText, []byte("a"))
+			},
+			wantStatus: webSocketCloseUnsupportedData,
+		},
+		{
+			name: "reserved bits",
+			write: func(t *testing.T, client net.Conn) {
+				writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketReservedBits|webSocketOpcodeBinary, []byte("a"))
+			},
+			wantStatus: webSocketCloseProtocolError,
+		},
+		{
+			name: "continuation without message",
+			write: func(t *testing.T, client net.Conn) {
+				writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodeContinuation, []byte("a"))
+			},
+			wantStatus: webSocketCloseProtocolError,
+		},
+		{
+			name: "new message within fragmented message",
+			write: func(t *testing.T, client net.Conn) {
+				writeTestWebSocketFrame(t, client, webSocketOpcodeBinary, nil)
+				writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodeBinary, []byte("a"))
+			},
+			wantStatus: webSocketCloseProtocolError,
+		},
+		{
+			name: "fragmented ping",
+			write: func(t *testing.T, client net.Conn) {
+				writeTestWebSocketFrame(t, client, webSocketOpcodePing, nil)
+			},
+			wantStatus: webSocketCloseProtocolError,
+		},
+		{
+			name: "unknown opcode",
+			write: func(t *testing.T, client net.Conn) {
+				writeTestWebSocketFrame(t, client, webSocketFinalBit|0x3, nil)
+			},
+			wantStatus: webSocketCloseProtocolError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connection, client := newTestWebSocketConnPair(t, time.Hour)
+
+			tt.write(t, client)
+
+			if _, err := connection.Read(make([]byte, 1)); err == nil {
+				t.Fatal("Read() succeeded")
+			}
+
+			// Errors are sticky, so the stream doesn't continue in the middle of garbage
+			if _, err := connection.Read(make([]byte, 1)); err == nil {
+				t.Error("second Read() succeeded")
+			}
+
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			opcode, payload := readTestWebSocketFrame(t, client)
+			if opcode != webSocketOpcodeClose || len(payload) != 2 || binary.BigEndian.Uint16(payload) != tt.wantStatus {
+				t.Errorf("got frame %#x with payload %#x, want close with status %d", opcode, payload, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWebSocketConn_Write_SendsBinaryFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+	}{
+		{name: "short", length: 5},
+		{name: "16 bit length", length: 300},
+		{name: "64 bit length", length: 70000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connection, client := newTestWebSocketConnPair(t, time.Hour)
+
+			data := bytes.Repeat([]byte("x"), tt.length)
+
+			go func() {
+				if n, err := connection.Write(data); err != nil || n != len(data) {
+					t.Errorf("Write() = %d, %v", n, err)
+				}
+			}()
+
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			if opcode, payload := readTestWebSocketFrame(t, client); opcode != webSocketOpcodeBinary || !bytes.Equal(payload, data) {
+				t.Errorf("got frame %#x with %d bytes, want binary frame with %d bytes", opcode, len(payload), len(data))
+			}
+		})
+	}
+}
+
+func TestWebSocketConn_Close_SendsCloseFrame(t *testing.T) {
+	connection, client := newTestWebSocketConnPair(t, time.Hour)
+
+	if err := connection.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	if err := connection.Close(); err != nil {
+		t.Errorf("second Close() failed: %v", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	opcode, payload := readTestWebSocketFrame(t, client)
+	if opcode != webSocketOpcodeClose || binary.BigEndian.Uint16(payload) != webSocketCloseNormal {
+		t.Errorf("got frame %#x with payload %#x, want close with status %d", opcode, payload, webSocketCloseNormal)
+	}
+
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("client Read() error = %v, want io.EOF", err)
+	}
+}
+
+func TestWebSocketConn_KeepAlive_PingsClient(t *testing.T) {
+	connection, client := newTestWebSocketConnPair(t, 20*time.Millisecond)
+
+	go io.Copy(io.Discard, connection)
+
+	// Answering every ping keeps the connection open
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for range 5 {
+		opcode, payload := readTestWebSocketFrame(t, client)
+		if opcode != webSocketOpcodePing {
+			t.Fatalf("got frame %#x, want ping", opcode)
+		}
+
+		writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodePong, payload)
+	}
+}
+
+func TestWebSocketConn_KeepAlive_ClosesUnresponsiveConnection(t *testing.T) {
+	connection, client := newTestWebSocketConnPair(t, 20*time.Millisecond)
+
+	go io.Copy(io.Discard, connection)
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if opcode, _ := readTestWebSocketFrame(t, client); opcode != webSocketOpcodePing {
+		t.Fatalf("got frame %#x, want ping", opcode)
+	}
+
+	// Without pong, the next tick closes the connection
+	if opcode, _ := readTestWebSocketFrame(t, client); opcode != webSocketOpcodeClose {
+		t.Fatalf("got frame %#x, want close", opcode)
+	}
+
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("client Read() error = %v, want io.EOF", err)
+	}
+}
+
+func TestWebSocketConn_KeepAlive_KeepsConnectionsNotRead(t *testing.T) {
+	connection, client := newTestWebSocketConnPair(t, 20*time.Millisecond)
+
+	// Nobody reads, like for a backend still waiting for its target, so missing pongs don't count
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for range 3 {
+		if opcode, _ := readTestWebSocketFrame(t, client); opcode != webSocketOpcodePing {
+			t.Fatalf("got frame %#x, want ping", opcode)
+		}
+	}
+
+	if _, err := connection.Write([]byte("still open")); err != nil {
+		t.Errorf("Write() failed: %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package frontends
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // the websocket handshake is defined to use sha1
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sateffen/pluggo/backends"
+	"github.com/sateffen/pluggo/backends/helper"
+	"github.com/sateffen/pluggo/config"
+)
+
+const (
+	webSocketDefaultPingInterval = 30 * time.Second
+	webSocketVersion             = "13"
+	webSocketKeyLength           = 16
+	webSocketAuthenticateRealm   = `Bearer realm="pluggo"`
+	// webSocketGUID gets appended to the key of the client to calculate the accept key, as defined by RFC 6455.
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+type webSocketFrontend struct {
+	*tcpListeners
+
+	routes       map[string]backends.Backend
+	bearerToken  string
+	pingInterval time.Duration
+}
+
+// newWebSocketFrontend creates a new instance of a webSocketFrontend, preparing it with all default dependencies.
+// The ping interval defaults to 30 seconds if not set.
+func newWebSocketFrontend(conf config.WebSocketFrontendConfig, backendList *backends.BackendList) (*webSocketFrontend, error) {
+	parsedListenAddr, err := net.ResolveTCPAddr("tcp", conf.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse listenAddr '%s' of frontend '%s': %w", conf.ListenAddr, conf.Name, err)
+	}
+
+	routes, err := newWebSocketRoutes(conf.Routes, backendList)
+	if err != nil {
+		return nil, fmt.Errorf("could not create routes of frontend '%s': %w", conf.Name, err)
+	}
+
+	pingInterval := conf.PingInterval
+	if pingInterval <= 0 {
+		pingInterval = webSocketDefaultPingInterval
+	}
+
+	limiter, err := newConnectionLimiter(conf.Name, conf.ConnectionLimitsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection limits of frontend '%s': %w", conf.Name, err)
+	}
+
+	socketOptions, err := helper.NewSocketOptions(conf.SocketOptionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket options of frontend '%s': %w", conf.Name, err)
+	}
+
+	return &webSocketFrontend{
+		tcpListeners: newTCPListeners(conf.Name, "websocketfrontend", []*net.TCPAddr{parsedListenAddr}, limiter, socketOptions),
+		routes:       routes,
+		bearerToken:  conf.BearerToken,
+		pingInterval: pingInterval,
+	}, nil
+}
+
+// newWebSocketRoutes maps the paths of given configs to their backends. Paths have to start with a slash, and
+// may only be configured once.
+func newWebSocketRoutes(confs []config.WebSocketRouteConfig, backendList *backends.BackendList) (map[string]backends.Backend, error) {
+	routes := make(map[string]backends.Backend, len(confs))
+
+	for _, routeConf := range confs {
+		if !strings.HasPrefix(routeConf.Path, "/") {
+			return nil, fmt.Errorf("path '%s' doesn't start with a slash", routeConf.Path)
+		}
+
+		if _, exists := routes[routeConf.Path]; exists {
+			return nil, fmt.Errorf("path '%s' is configured multiple times", routeConf.Path)
+		}
+
+		targetBackend, ok := backendList.Get(routeConf.Target)
+		if !ok {
+			return nil, fmt.Errorf("target backend '%s' for path '%s' does not exist", routeConf.Target, routeConf.Path)
+		}
+
+		routes[routeConf.Path] = targetBackend
+	}
+
+	return routes, nil
+}
+
+// Listen creates a TCP listener, starts listening and accepting connections. Every accepted connection gets
+// upgraded in its own go-routine, and handed to the backend of the requested path.
+// Listen blocks the current thread by starting an endless loop accepting new connections.
+// Listen is resilient in that it does not stop accepting connections just because an error happens.
+func (fe *webSocketFrontend) Listen() error {
+	return fe.listen(func(connection net.Conn) {
+		go fe.route(connection)
+	}, fe.acceptGates())
+}
+
+// route reads the upgrade request of given connection, completes the WebSocket handshake, and hands the upgraded
+// connection to the backend of the requested path. Requests that can't be upgraded get answered with an error
+// status, and the connection gets closed.
+func (fe *webSocketFrontend) route(connection net.Conn) {
+	reader := bufio.NewReaderSize(connection, httpMaxHeaderLength)
+
+	targetBackend, key, err := fe.readUpgradeRequest(connection, reader)
+	if err != nil {
+		slog.Debug(
+			"websocketfrontend could not upgrade connection",
+			slog.String("name", fe.name),
+			slog.String("remoteAddr", connection.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+
+		return
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAcceptKey(key) + "\r\n\r\n"
+
+	if _, err = connection.Write([]byte(response)); err != nil {
+		slog.Debug("could not write http response", slog.Any("error", err))
+		closeUnroutedConnection(connection)
+
+		return
+	}
+
+	slog.Debug(
+		"websocketfrontend upgraded connection",
+		slog.String("name", fe.name),
+		slog.String("remoteAddr", connection.RemoteAddr().String()),
+		slog.String("backend", targetBackend.GetName()),
+	)
+
+	targetBackend.Handle(newWebSocketConn(connection, reader, fe.pingInterval))
+}
+
+// readUpgradeRequest reads the upgrade request of given connection, checks its bearer token, and returns
+// the backend of the requested path together with the WebSocket key of the client. The request gets consumed
+// from given reader. If the request can't be upgraded, the client gets the matching error response and
+// the connection gets closed.
+func (fe *webSocketFrontend) readUpgradeRequest(connection net.Conn, reader *bufio.Reader) (backends.Backend, string, error) {
+	request, header, status, err := readHTTPRequest(connection, reader)
+	if err != nil {
+		if status != 0 {
+			writeHTTPError(connection, status, nil)
+		} else {
+			closeUnroutedConnection(connection)
+		}
+
+		return nil, "", err
+	}
+
+	// readHTTPRequest only peeks, so the already buffered headers get dropped here
+	if _, err = reader.Discard(len(header)); err != nil {
+		closeUnroutedConnection(connection)
+		return nil, "", fmt.Errorf("could not consume request headers: %w", err)
+	}
+
+	if fe.bearerToken != "" && !fe.checkBearerToken(request.Header.Get("Authorization")) {
+		writeHTTPError(connection, http.StatusUnauthorized, http.Header{"Www-Authenticate": {webSocketAuthenticateRealm}})
+		return nil, "", errors.New("missing or invalid bearer token")
+	}
+
+	targetBackend, ok := fe.routes[request.URL.Path]
+	if !ok {
+		writeHTTPError(connection, http.StatusNotFound, nil)
+		return nil, "", fmt.Errorf("no backend for path '%s'", request.URL.Path)
+	}
+
+	if request.Method != http.MethodGet {
+		writeHTTPError(connection, http.StatusMethodNotAllowed, http.Header{"Allow": {http.MethodGet}})
+		return nil, "", fmt.Errorf("unsupported method '%s'", request.Method)
+	}
+
+	if !headerContainsToken(request.Header, "Upgrade", "websocket") || !headerContainsToken(request.Header, "Connection", "upgrade") {
+		writeHTTPError(connection, http.StatusUpgradeRequired, http.Header{"Upgrade": {"websocket"}})
+		return nil, "", errors.New("request is no websocket upgrade")
+	}
+
+	if version := request.Header.Get("Sec-WebSocket-Version"); version != webSocketVersion {
+		writeHTTPError(connection, http.StatusUpgradeRequired, http.Header{"Sec-Websocket-Version": {webSocketVersion}})
+		return nil, "", fmt.Errorf("unsupported websocket version '%s'", version)
+	}
+
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if decodedKey, decodeErr := base64.StdEncoding.DecodeString(key); decodeErr != nil || len(decodedKey) != webSocketKeyLength {
+		writeHTTPError(connection, http.StatusBadRequest, nil)
+		return nil, "", fmt.Errorf("invalid websocket key '%s'", key)
+	}
+
+	return targetBackend, key, nil
+}
+
+// checkBearerToken reports whether given Authorization header value carries the configured bearer token.
+func (fe *webSocketFrontend) checkBearerToken(value string) bool {
+	scheme, token, ok := strings.Cut(value, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(fe.bearerToken)) == 1
+}
+
+// headerContainsToken reports whether the comma separated values of given header contain given token, ignoring
+// case.
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for element := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(element), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// webSocketAcceptKey returns the accept key for given WebSocket key of a client.
+func webSocketAcceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + webSocketGUID)) //nolint:gosec // the websocket handshake is defined to use sha1
+
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,229 @@
+package frontends
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sateffen/pluggo/config"
+)
+
+// testWebSocketUpgradeRequest is the upgrade request of RFC 6455, with given path and additional header lines.
+func testWebSocketUpgradeRequest(path string, headers string) string {
+	return "GET " + path + " HTTP/1.1\r\nHost: nas.example.com\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n" + headers + "\r\n"
+}
+
+func TestWebSocketFrontend_GetName(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	frontend, err := newWebSocketFrontend(config.WebSocketFrontendConfig{
+		Name:       "test-frontend",
+		ListenAddr: "127.0.0.1:8080",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newWebSocketFrontend() failed: %v", err)
+	}
+
+	if got := frontend.GetName(); got != "test-frontend" {
+		t.Errorf("GetName() = %q, want %q", got, "test-frontend")
+	}
+
+	if frontend.pingInterval != webSocketDefaultPingInterval {
+		t.Errorf("pingInterval = %v, want %v", frontend.pingInterval, webSocketDefaultPingInterval)
+	}
+}
+
+func TestWebSocketFrontend_NewWebSocketFrontend_InvalidConfig(t *testing.T) {
+	backendList := createTestBackendList("test-backend")
+
+	tests := []struct {
+		name   string
+		routes []config.WebSocketRouteConfig
+		listen string
+	}{
+		{
+			name:   "invalid listenAddr",
+			listen: "invalid",
+		},
+		{
+			name:   "unknown route target",
+			listen: "127.0.0.1:8080",
+			routes: []config.WebSocketRouteConfig{{Path: "/ssh", Target: "unknown"}},
+		},
+		{
+			name:   "relative path",
+			listen: "127.0.0.1:8080",
+			routes: []config.WebSocketRouteConfig{{Path: "ssh", Target: "test-backend"}},
+		},
+		{
+			name:   "duplicate path",
+			listen: "127.0.0.1:8080",
+			routes: []config.WebSocketRouteConfig{{Path: "/ssh", Target: "test-backend"}, {Path: "/ssh", Target: "test-backend"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.WebSocketFrontendConfig{Name: "test-frontend", ListenAddr: tt.listen, Routes: tt.routes}
+
+			if _, err := newWebSocketFrontend(conf, backendList); err == nil {
+				t.Error("expected newWebSocketFrontend() to fail")
+			}
+		})
+	}
+}
+
+func TestWebSocketFrontend_Listen_TunnelsToBackendOfPath(t *testing.T) {
+	backendList := createTestBackendList("ssh")
+
+	frontend, err := newWebSocketFrontend(config.WebSocketFrontendConfig{
+		Name:        "test-frontend",
+		ListenAddr:  "127.0.0.1:8080",
+		Routes:      []config.WebSocketRouteConfig{{Path: "/ssh", Target: "ssh"}},
+		BearerToken: "secret",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newWebSocketFrontend() failed: %v", err)
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	client, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("could not dial frontend: %v", err)
+	}
+	defer client.Close()
+
+	// The first frame is sent right away with the handshake, so it has to be buffered for the backend
+	client.Write([]byte(testWebSocketUpgradeRequest("/ssh?client=1", "Authorization: bearer secret\r\n")))
+	writeTestWebSocketFrame(t, client, webSocketFinalBit|webSocketOpcodeBinary, []byte("hello"))
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(client)
+
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("could not read response: %v", err)
+	}
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want %d", response.StatusCode, http.StatusSwitchingProtocols)
+	}
+
+	// The accept key of the example in RFC 6455
+	if got := response.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q, want %q", got, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	}
+
+	if opcode, payload := readTestWebSocketFrame(t, reader); opcode != webSocketOpcodeBinary || string(payload) != "hello" {
+		t.Errorf("got frame %#x with payload %q, want binary frame with payload %q", opcode, payload, "hello")
+	}
+}
+
+func TestWebSocketFrontend_Listen_RejectsInvalidUpgrades(t *testing.T) {
+	backendList := createTestBackendList("ssh")
+
+	frontend, err := newWebSocketFrontend(config.WebSocketFrontendConfig{
+		Name:        "test-frontend",
+		ListenAddr:  "127.0.0.1:8080",
+		Routes:      []config.WebSocketRouteConfig{{Path: "/ssh", Target: "ssh"}},
+		BearerToken: "secret",
+	}, backendList)
+	if err != nil {
+		t.Fatalf("newWebSocketFrontend() failed: %v", err)
+	}
+
+	listenAddr, listenDone := startTestFrontend(t, &frontend.listenerFactory, frontend.Listen)
+	defer func() {
+		frontend.Close()
+		<-listenDone
+	}()
+
+	const auth = "Authorization: Bearer secret\r\n"
+
+	tests := []struct {
+		name       string
+		rawRequest string
+		wantStatus int
+	}{
+		{
+			name:       "missing token",
+			rawRequest: testWebSocketUpgradeRequest("/ssh", ""),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong token",
+			rawRequest: testWebSocketUpgradeRequest("/ssh", "Authorization: Bearer guessed\r\n"),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown path",
+			rawRequest: testWebSocketUpgradeRequest("/rdp", auth),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "no upgrade",
+			rawRequest: "GET /ssh HTTP/1.1\r\nHost: nas.example.com\r\n" + auth + "\r\n",
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:       "wrong method",
+			rawRequest: strings.Replace(testWebSocketUpgradeRequest("/ssh", auth), "GET", "POST", 1),
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "unsupported version",
+			rawRequest: strings.Replace(testWebSocketUpgradeRequest("/ssh", auth), "Version: 13", "Version: 8", 1),
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:       "invalid key",
+			rawRequest: strings.Replace(testWebSocketUpgradeRequest("/ssh", auth), "dGhlIHNhbXBsZSBub25jZQ==", "c2hvcnQ=", 1),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer := sendTestRequest(t, listenAddr, tt.rawRequest)
+
+			response, err := http.ReadResponse(bufio.NewReader(strings.NewReader(answer)), nil)
+			if err != nil {
+				t.Fatalf("could not parse answer %q: %v", answer, err)
+			}
+
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", response.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHeaderContainsToken(t *testing.T) {
+	header := http.Header{"Connection": {"keep-alive, Upgrade", "close"}}
+
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{token: "upgrade", want: true},
+		{token: "close", want: true},
+		{token: "websocket", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			if got := headerContainsToken(header, "Connection", tt.token); got != tt.want {
+				t.Errorf("headerContainsToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -13,31 +13,93 @@ import (
 	"github.com/sateffen/pluggo/frontends"
 )
 
-func getLogLevel() slog.Level {
+// getLogLevel returns the log level set by the LOG_LEVEL environment variable, or given default level.
+func getLogLevel(defaultLevel slog.Level) slog.Level {
 	switch strings.ToUpper(os.Getenv("LOG_LEVEL")) {
 	case "DEBUG":
 		return slog.LevelDebug
+	case "INFO":
+		return slog.LevelInfo
 	case "WARN":
 		return slog.LevelWarn
 	case "ERROR":
 		return slog.LevelError
 	default:
-		return slog.LevelInfo
+		return defaultLevel
+	}
+}
+
+// parseArgs splits given command line arguments into the config file path and, if the --stdio flag is given, the
+// name of the backend to hand stdin and stdout to. ok is false if the arguments are incomplete.
+func parseArgs(args []string) (string, string, bool) {
+	if len(args) > 0 && args[0] == "--stdio" {
+		if len(args) < 3 { //nolint:mnd // flag, backend name and config file path
+			return "", "", false
+		}
+
+		return args[2], args[1], true
+	}
+
+	if len(args) == 0 {
+		return "", "", false
+	}
+
+	return args[0], "", true
+}
+
+// serveStdio hands stdin and stdout to the backend with given name as a single connection, and exits the
+// process when the connection got closed.
+func serveStdio(backendList *backends.BackendList, backendName string) {
+	targetBackend, ok := backendList.Get(backendName)
+	if !ok {
+		slog.Error("backend for stdio does not exist", slog.String("name", backendName))
+		os.Exit(1)
+	}
+
+	frontends.ServeStdio(targetBackend, os.Stdin, os.Stdout)
+
+	backendList.CloseAll()
+	os.Exit(0)
+}
+
+// reloadAccessLists loads the config file from given path again, and replaces the access lists of all frontends
+// with the ones of the loaded config. If loading fails, the current access lists are kept.
+func reloadAccessLists(configFilePath string, frontendList *frontends.FrontendList) {
+	//nolint:gosec // admin-controlled path, not user-injectable
+	slog.Info("reloading access lists", slog.String("configFilePath", configFilePath))
+
+	conf, err := config.LoadConfig(configFilePath)
+	if err != nil {
+		slog.Error("could not load config, keeping current access lists", slog.Any("error", err))
+		return
+	}
+
+	if err = frontendList.UpdateAccessLists(conf); err != nil {
+		slog.Error("could not update access lists, keeping current ones", slog.Any("error", err))
 	}
 }
 
 func main() {
-	globalLogger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: getLogLevel(),
+	configArg, stdioBackendName, argsOk := parseArgs(os.Args[1:])
+
+	// In stdio mode stdout carries the connection, so logs go to stderr, and only warnings by default so they
+	// don't clutter the terminal of ssh users.
+	logOutput, defaultLogLevel := os.Stdout, slog.LevelInfo
+	if stdioBackendName != "" {
+		logOutput, defaultLogLevel = os.Stderr, slog.LevelWarn
+	}
+
+	globalLogger := slog.New(slog.NewTextHandler(logOutput, &slog.HandlerOptions{
+		Level: getLogLevel(defaultLogLevel),
 	}))
 	slog.SetDefault(globalLogger)
 
-	if len(os.Args) == 1 {
-		slog.Error("No arguments given, please pass a path to a config file")
+	if !argsOk {
+		slog.Error("No arguments given, please pass a path to a config file, optionally preceded by --stdio <backend>")
 		os.Exit(1)
 	}
 
-	configFilePath, err := filepath.Abs(os.Args[1])
+	configFilePath, err := filepath.Abs(configArg)
 	if err != nil {
 		slog.Error("could not normalize config file path", slog.Any("error", err))
 		os.Exit(1)
@@ -57,27 +119,44 @@ func main() {
 		os.Exit(1)
 	}
 
-	frontendList, err := frontends.NewFrontendList(conf.Frontends, backendList)
+	if stdioBackendName != "" {
+		serveStdio(backendList, stdioBackendName)
+	}
+
+	frontendList, err := frontends.NewFrontendList(conf, backendList)
 	if err != nil {
 		slog.Error("could not create frontends", slog.Any("error", err))
 		os.Exit(1)
 	}
 
+	// Health checks only start now, so backends no frontend routes to, and stdio mode, don't check any targets
+	backendList.StartHealthChecks()
+
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+
 	slog.Info("start listening")
 
-	select {
-	case <-signalChan:
-		slog.Info("received exit signal, stopping...")
-		frontendList.CloseAll()
-		backendList.CloseAll()
-	// error handling is done inside ListenAll, so logging and stuff. Here we just stop the process.
-	case <-frontendList.ListenAll():
-		frontendList.CloseAll()
-		backendList.CloseAll()
-	}
+	listenErrChan := frontendList.ListenAll()
 
-	os.Exit(0)
+	for {
+		select {
+		case <-reloadChan:
+			reloadAccessLists(configFilePath, frontendList)
+		case <-signalChan:
+			slog.Info("received exit signal, stopping...")
+			frontendList.CloseAll()
+			backendList.CloseAll()
+			os.Exit(0)
+		// error handling is done inside ListenAll, so logging and retrying. Only fatal bind failures arrive here, so
+		// we just stop the process.
+		case <-listenErrChan:
+			frontendList.CloseAll()
+			backendList.CloseAll()
+			os.Exit(0)
+		}
+	}
 }